@@ -0,0 +1,186 @@
+package influxdb
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBatchSize is the default number of points inputs buffer before a write.
+	DefaultBatchSize = 1000
+
+	// DefaultBatchTimeout is the default maximum time inputs buffer points before a write.
+	DefaultBatchTimeout = time.Second
+)
+
+// SeriesWriter writes points to a database and retention policy.
+type SeriesWriter interface {
+	WriteSeries(database, retentionPolicy string, points []Point) (uint64, error)
+}
+
+// PointBatcher accepts Points and will emit a batch of those points when either
+// a) the batch reaches a certain size, or b) a certain time passes.
+type PointBatcher struct {
+	size     int
+	duration time.Duration
+
+	stop  chan struct{}
+	in    chan Point
+	out   chan []Point
+	flush chan struct{}
+
+	wg *sync.WaitGroup
+
+	mu    sync.RWMutex
+	stats PointBatcherStats
+}
+
+// NewPointBatcher returns a new PointBatcher. sz is the batching size,
+// d is the maximum time a point will be held before it is emitted.
+func NewPointBatcher(sz int, d time.Duration) *PointBatcher {
+	return &PointBatcher{
+		size:     sz,
+		duration: d,
+		stop:     make(chan struct{}),
+		in:       make(chan Point),
+		out:      make(chan []Point),
+		flush:    make(chan struct{}),
+	}
+}
+
+// PointBatcherStats are the statistics each batcher tracks.
+type PointBatcherStats struct {
+	BatchTotal   uint64 // Total count of batches transmitted.
+	PointTotal   uint64 // Total count of points processed.
+	SizeTotal    uint64 // Number of times batch size was reached.
+	TimeoutTotal uint64 // Number of timeouts that occurred.
+}
+
+// Start starts the batching process. Points written to In() are emitted as
+// batches on Out().
+func (b *PointBatcher) Start() {
+	// Already running?
+	if b.wg != nil {
+		return
+	}
+
+	var timer *time.Timer
+	var batch []Point
+	var timerCh <-chan time.Time
+
+	emit := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timerCh = nil, nil
+		}
+
+		b.out <- batch
+		b.mu.Lock()
+		b.stats.BatchTotal++
+		b.mu.Unlock()
+		batch = nil
+	}
+
+	b.wg = &sync.WaitGroup{}
+	b.wg.Add(1)
+
+	go func() {
+		defer b.wg.Done()
+		for {
+			select {
+			case <-b.stop:
+				if len(batch) > 0 {
+					emit()
+				}
+				return
+			case p := <-b.in:
+				b.mu.Lock()
+				b.stats.PointTotal++
+				b.mu.Unlock()
+				if batch == nil {
+					batch = make([]Point, 0, b.size)
+					if b.duration > 0 {
+						timer = time.NewTimer(b.duration)
+						timerCh = timer.C
+					}
+				}
+
+				batch = append(batch, p)
+				if len(batch) >= b.size { // 0 means send immediately.
+					b.mu.Lock()
+					b.stats.SizeTotal++
+					b.mu.Unlock()
+					emit()
+				}
+
+			case <-b.flush:
+				if len(batch) > 0 {
+					emit()
+				}
+
+			case <-timerCh:
+				b.mu.Lock()
+				b.stats.TimeoutTotal++
+				b.mu.Unlock()
+				emit()
+			}
+		}
+	}()
+}
+
+// Stop stops the batching process. Stop waits for the batching routine
+// to stop before returning.
+func (b *PointBatcher) Stop() {
+	// If not running, nothing to stop.
+	if b.wg == nil {
+		return
+	}
+
+	close(b.stop)
+	b.wg.Wait()
+}
+
+// In returns the channel to which points should be written.
+func (b *PointBatcher) In() chan<- Point { return b.in }
+
+// Out returns the channel from which batches should be read.
+func (b *PointBatcher) Out() <-chan []Point { return b.out }
+
+// Flush instructs the batcher to emit any pending points in a batch, regardless of batch size.
+// If there are no pending points, no batch is emitted.
+func (b *PointBatcher) Flush() {
+	b.flush <- struct{}{}
+}
+
+// Stats returns a PointBatcherStats object for the PointBatcher. While the each statistic should be
+// closely correlated with each other statistic, it is not guaranteed.
+func (b *PointBatcher) Stats() *PointBatcherStats {
+	stats := PointBatcherStats{}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	stats.BatchTotal = b.stats.BatchTotal
+	stats.PointTotal = b.stats.PointTotal
+	stats.SizeTotal = b.stats.SizeTotal
+	stats.TimeoutTotal = b.stats.TimeoutTotal
+	return &stats
+}
+
+// WriteBatches writes the batches emitted by a batcher to a database and retention
+// policy until done is closed. Written and failed batches are counted in stats as
+// "batchesTx" and "batchesTxFail", and failed writes are logged.
+func WriteBatches(b *PointBatcher, w SeriesWriter, database, retentionPolicy string, stats *Stats, logger *log.Logger, done <-chan struct{}) {
+	for {
+		select {
+		case batch := <-b.Out():
+			if _, err := w.WriteSeries(database, retentionPolicy, batch); err != nil {
+				stats.Inc("batchesTxFail")
+				logger.Printf("failed to write %d points to database %q: %s", len(batch), database, err)
+				continue
+			}
+			stats.Inc("batchesTx")
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package influxdb_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/influxdb/influxdb"
+)
+
+// Ensure the batcher emits a batch once the batch size is reached.
+func TestBatch_Size(t *testing.T) {
+	batchSize := 5
+	batcher := influxdb.NewPointBatcher(batchSize, time.Hour)
+	if batcher == nil {
+		t.Fatal("failed to create batcher for size test")
+	}
+
+	batcher.Start()
+
+	var p influxdb.Point
+	go func() {
+		for i := 0; i < batchSize; i++ {
+			batcher.In() <- p
+		}
+	}()
+	batch := <-batcher.Out()
+	if len(batch) != batchSize {
+		t.Errorf("received batch has incorrect length exp %d, got %d", batchSize, len(batch))
+	}
+	checkPointBatcherStats(t, batcher, -1, batchSize, 1, 0)
+}
+
+// Ensure the batcher emits a partial batch once the timeout passes.
+func TestBatch_Timeout(t *testing.T) {
+	batchSize := 5
+	batcher := influxdb.NewPointBatcher(batchSize+1, 100*time.Millisecond)
+	if batcher == nil {
+		t.Fatal("failed to create batcher for timeout test")
+	}
+
+	batcher.Start()
+
+	var p influxdb.Point
+	go func() {
+		for i := 0; i < batchSize; i++ {
+			batcher.In() <- p
+		}
+	}()
+	batch := <-batcher.Out()
+	if len(batch) != batchSize {
+		t.Errorf("received batch has incorrect length exp %d, got %d", batchSize, len(batch))
+	}
+	checkPointBatcherStats(t, batcher, -1, batchSize, 0, 1)
+}
+
+// Ensure the batcher emits pending points when flushed.
+func TestBatch_Flush(t *testing.T) {
+	batchSize := 2
+	batcher := influxdb.NewPointBatcher(batchSize, time.Hour)
+	if batcher == nil {
+		t.Fatal("failed to create batcher for flush test")
+	}
+
+	batcher.Start()
+
+	var p influxdb.Point
+	go func() {
+		batcher.In() <- p
+		batcher.Flush()
+	}()
+	batch := <-batcher.Out()
+	if len(batch) != 1 {
+		t.Errorf("received batch has incorrect length exp %d, got %d", 1, len(batch))
+	}
+	checkPointBatcherStats(t, batcher, -1, 1, 0, 0)
+}
+
+// Ensure the batcher emits pending points when stopped.
+func TestBatch_Stop(t *testing.T) {
+	batcher := influxdb.NewPointBatcher(10, time.Hour)
+	batcher.Start()
+
+	var p influxdb.Point
+	batcher.In() <- p
+
+	done := make(chan []influxdb.Point)
+	go func() { done <- <-batcher.Out() }()
+	batcher.Stop()
+
+	if batch := <-done; len(batch) != 1 {
+		t.Errorf("received batch has incorrect length exp %d, got %d", 1, len(batch))
+	}
+}
+
+// Ensure batches are written until done is closed and counted as written or failed.
+func TestWriteBatches(t *testing.T) {
+	batcher := influxdb.NewPointBatcher(1, time.Hour)
+	batcher.Start()
+	defer batcher.Stop()
+
+	var batches [][]influxdb.Point
+	w := seriesWriterFunc(func(database, retentionPolicy string, points []influxdb.Point) (uint64, error) {
+		if database != "db" || retentionPolicy != "rp" {
+			t.Errorf("unexpected target: %s.%s", database, retentionPolicy)
+		}
+		batches = append(batches, points)
+		if len(batches) == 2 {
+			return 0, errors.New("marker")
+		}
+		return 0, nil
+	})
+
+	stats := influxdb.NewStats("test")
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		influxdb.WriteBatches(batcher, w, "db", "rp", stats, log.New(ioutil.Discard, "", 0), done)
+		close(stopped)
+	}()
+	for i := 0; i < 3; i++ {
+		batcher.In() <- influxdb.Point{Name: "cpu"}
+	}
+	batcher.Flush()
+	close(done)
+	<-stopped
+
+	if len(batches) != 3 {
+		t.Fatalf("unexpected batch count: %d", len(batches))
+	} else if n := stats.Get("batchesTx"); n != 2 {
+		t.Fatalf("unexpected batchesTx: %d", n)
+	} else if n := stats.Get("batchesTxFail"); n != 1 {
+		t.Fatalf("unexpected batchesTxFail: %d", n)
+	}
+}
+
+// seriesWriterFunc is a function which implements influxdb.SeriesWriter.
+type seriesWriterFunc func(database, retentionPolicy string, points []influxdb.Point) (uint64, error)
+
+func (fn seriesWriterFunc) WriteSeries(database, retentionPolicy string, points []influxdb.Point) (uint64, error) {
+	return fn(database, retentionPolicy, points)
+}
+
+// checkPointBatcherStats ensures the batcher's stats match the given values.
+// A value of -1 skips the check.
+func checkPointBatcherStats(t *testing.T, b *influxdb.PointBatcher, batchTotal, pointTotal, sizeTotal, timeoutTotal int) {
+	stats := b.Stats()
+
+	if batchTotal != -1 && stats.BatchTotal != uint64(batchTotal) {
+		t.Errorf("batch total stat is incorrect: %d", stats.BatchTotal)
+	}
+	if pointTotal != -1 && stats.PointTotal != uint64(pointTotal) {
+		t.Errorf("point total stat is incorrect: %d", stats.PointTotal)
+	}
+	if sizeTotal != -1 && stats.SizeTotal != uint64(sizeTotal) {
+		t.Errorf("size total stat is incorrect: %d", stats.SizeTotal)
+	}
+	if timeoutTotal != -1 && stats.TimeoutTotal != uint64(timeoutTotal) {
+		t.Errorf("timeout total stat is incorrect: %d", stats.TimeoutTotal)
+	}
+}
@@ -0,0 +1,617 @@
+package influxdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/influxdb/influxdb/influxql"
+)
+
+// Shards store the points of each series in blocks of up to maxBlockPoints
+// points, ordered by timestamp. Each block is stored under the timestamp of its
+// last point so the block holding a given time can be found with a single seek.
+//
+// A block starts with its format and number of points, followed by the
+// timestamps encoded as the first timestamp, the first delta and the delta of
+// each following delta, as varints.
+//
+// Columnar blocks then hold a column for each field ID, with a bitmap of the
+// points which have a value and the values encoded by type: floats are XOR'd
+// with the previous value and the meaningful bits written, integers are written
+// as varint deltas, booleans as a bitmap, and strings as indexes into a
+// dictionary of the column's distinct values.
+//
+// Points encoded before fields were tagged with their type can't be split into
+// columns, so blocks holding them store each point's encoded fields as is.
+const (
+	blockColumnar = 1
+	blockRaw      = 2
+
+	// maxBlockPoints is the largest number of points stored in a block.
+	maxBlockPoints = 1000
+)
+
+// errInvalidBlock is returned when a block cannot be decoded.
+var errInvalidBlock = errors.New("invalid block")
+
+// blockPoint is a point stored in a block. Data holds the encoded fields.
+type blockPoint struct {
+	timestamp int64
+	data      []byte
+}
+
+// blockPoints sorts points in the order of their keys in the store.
+type blockPoints []blockPoint
+
+func (a blockPoints) Len() int           { return len(a) }
+func (a blockPoints) Less(i, j int) bool { return uint64(a[i].timestamp) < uint64(a[j].timestamp) }
+func (a blockPoints) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// blockColumn holds the values of a field within a block.
+type blockColumn struct {
+	id      uint16
+	typ     influxql.DataType
+	present []byte // bitmap of points with a value
+	values  []interface{}
+}
+
+// encodeBlock encodes points, which must be sorted by timestamp, into a block.
+func encodeBlock(points []blockPoint) []byte {
+	columns, ok := splitBlockColumns(points)
+
+	b := make([]byte, 0, 64)
+	if ok {
+		b = append(b, blockColumnar)
+	} else {
+		b = append(b, blockRaw)
+	}
+	b = appendUvarint(b, uint64(len(points)))
+	b = appendTimestamps(b, points)
+
+	if !ok {
+		for _, p := range points {
+			b = appendUvarint(b, uint64(len(p.data)))
+			b = append(b, p.data...)
+		}
+		return b
+	}
+
+	b = appendUvarint(b, uint64(len(columns)))
+	for _, c := range columns {
+		b = appendUvarint(b, uint64(c.id))
+		b = append(b, fieldValueCode(c.typ))
+		b = append(b, c.present...)
+
+		var data []byte
+		switch c.typ {
+		case influxql.Float:
+			data = encodeFloatColumn(c.values)
+		case influxql.Integer:
+			data = encodeIntegerColumn(c.values)
+		case influxql.Boolean:
+			data = encodeBooleanColumn(c.values)
+		case influxql.String:
+			data = encodeStringColumn(c.values)
+		}
+		b = appendUvarint(b, uint64(len(data)))
+		b = append(b, data...)
+	}
+	return b
+}
+
+// decodeBlock decodes the points of a block.
+func decodeBlock(b []byte) ([]blockPoint, error) {
+	if len(b) < 1 {
+		return nil, errInvalidBlock
+	}
+	format := b[0]
+	b = b[1:]
+
+	n, i := binary.Uvarint(b)
+	if i <= 0 || n > uint64(len(b)) {
+		return nil, errInvalidBlock
+	}
+	b = b[i:]
+
+	points := make([]blockPoint, n)
+	b, err := readTimestamps(b, points)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case blockRaw:
+		for i := range points {
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return nil, errInvalidBlock
+			}
+			points[i].data, b = b[n:n+int(size)], b[n+int(size):]
+		}
+	case blockColumnar:
+		ncols, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errInvalidBlock
+		}
+		b = b[n:]
+
+		for i := range points {
+			points[i].data = []byte{fieldEncodingTyped}
+		}
+		bitmapSize := (len(points) + 7) / 8
+		for ; ncols > 0; ncols-- {
+			id, n := binary.Uvarint(b)
+			if n <= 0 || id > math.MaxUint16 || len(b) < n+1+bitmapSize {
+				return nil, errInvalidBlock
+			}
+			typ := fieldValueType(b[n])
+			present := b[n+1 : n+1+bitmapSize]
+			b = b[n+1+bitmapSize:]
+
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return nil, errInvalidBlock
+			}
+			data := b[n : n+int(size)]
+			b = b[n+int(size):]
+
+			var count int
+			for i := range points {
+				if bitSet(present, i) {
+					count++
+				}
+			}
+
+			var values []interface{}
+			switch typ {
+			case influxql.Float:
+				values, err = decodeFloatColumn(data, count)
+			case influxql.Integer:
+				values, err = decodeIntegerColumn(data, count)
+			case influxql.Boolean:
+				values, err = decodeBooleanColumn(data, count)
+			case influxql.String:
+				values, err = decodeStringColumn(data, count)
+			default:
+				err = errInvalidBlock
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			for i := range points {
+				if bitSet(present, i) {
+					points[i].data = appendFieldValue(points[i].data, uint16(id), typ, values[0])
+					values = values[1:]
+				}
+			}
+		}
+	default:
+		return nil, errInvalidBlock
+	}
+
+	return points, nil
+}
+
+// blockPointN returns the number of points in a block without decoding it.
+func blockPointN(b []byte) (int, error) {
+	if len(b) < 1 {
+		return 0, errInvalidBlock
+	}
+	n, i := binary.Uvarint(b[1:])
+	if i <= 0 {
+		return 0, errInvalidBlock
+	}
+	return int(n), nil
+}
+
+// splitBlockColumns splits the fields of points into a column for each field,
+// ordered by field ID. Returns false if a point's fields aren't tagged with their
+// types or a field has values of more than one type.
+func splitBlockColumns(points []blockPoint) ([]*blockColumn, bool) {
+	bitmapSize := (len(points) + 7) / 8
+	columns := make(map[uint16]*blockColumn)
+	for i, p := range points {
+		if !hasTypedFields(p.data) {
+			return nil, false
+		}
+
+		b := p.data[1:]
+		for len(b) > 0 {
+			id, typ, v, rest, err := decodeFieldValue(b)
+			if err != nil {
+				return nil, false
+			}
+			b = rest
+
+			c := columns[id]
+			if c == nil {
+				c = &blockColumn{id: id, typ: typ, present: make([]byte, bitmapSize)}
+				columns[id] = c
+			} else if c.typ != typ || bitSet(c.present, i) {
+				return nil, false
+			}
+			c.present[i/8] |= 1 << uint(i%8)
+			c.values = append(c.values, v)
+		}
+	}
+
+	ids := make([]int, 0, len(columns))
+	for id := range columns {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+
+	a := make([]*blockColumn, len(ids))
+	for i, id := range ids {
+		a[i] = columns[uint16(id)]
+	}
+	return a, true
+}
+
+// appendTimestamps appends the delta-of-delta encoded timestamps of points to b.
+func appendTimestamps(b []byte, points []blockPoint) []byte {
+	var prev, delta int64
+	for i, p := range points {
+		switch i {
+		case 0:
+			b = appendVarint(b, p.timestamp)
+		case 1:
+			delta = p.timestamp - prev
+			b = appendVarint(b, delta)
+		default:
+			d := p.timestamp - prev
+			b = appendVarint(b, d-delta)
+			delta = d
+		}
+		prev = p.timestamp
+	}
+	return b
+}
+
+// readTimestamps decodes a timestamp for each point from b and returns the
+// remaining bytes.
+func readTimestamps(b []byte, points []blockPoint) ([]byte, error) {
+	var prev, delta int64
+	for i := range points {
+		v, n := binary.Varint(b)
+		if n <= 0 {
+			return nil, errInvalidBlock
+		}
+		b = b[n:]
+
+		switch i {
+		case 0:
+			points[i].timestamp = v
+		case 1:
+			delta = v
+			points[i].timestamp = prev + delta
+		default:
+			delta += v
+			points[i].timestamp = prev + delta
+		}
+		prev = points[i].timestamp
+	}
+	return b, nil
+}
+
+// encodeFloatColumn encodes floats by XOR'ing each value with the previous one
+// and writing only the bits between the leading and trailing zeros of the result.
+// The leading and trailing zero counts are reused while the bits fit within them.
+func encodeFloatColumn(values []interface{}) []byte {
+	var w bitWriter
+	var prev uint64
+	leading, trailing := uint(math.MaxUint8), uint(0)
+	for i, v := range values {
+		bits := math.Float64bits(v.(float64))
+		if i == 0 {
+			w.writeBits(bits, 64)
+			prev = bits
+			continue
+		}
+
+		xor := bits ^ prev
+		prev = bits
+		if xor == 0 {
+			w.writeBit(false)
+			continue
+		}
+		w.writeBit(true)
+
+		l, t := leadingZeros(xor), trailingZeros(xor)
+		if l > 31 {
+			l = 31
+		}
+		if leading != math.MaxUint8 && l >= leading && t >= trailing {
+			// Reuse the previous window.
+			w.writeBit(false)
+			w.writeBits(xor>>trailing, 64-leading-trailing)
+			continue
+		}
+
+		// Write a new window: 5 bits of leading zeros and 6 bits of meaningful
+		// bit count, where 64 meaningful bits are written as 0.
+		leading, trailing = l, t
+		meaningful := 64 - leading - trailing
+		w.writeBit(true)
+		w.writeBits(uint64(leading), 5)
+		w.writeBits(uint64(meaningful&63), 6)
+		w.writeBits(xor>>trailing, meaningful)
+	}
+	return w.buf
+}
+
+// decodeFloatColumn decodes n floats written by encodeFloatColumn.
+func decodeFloatColumn(b []byte, n int) ([]interface{}, error) {
+	r := bitReader{buf: b}
+	values := make([]interface{}, 0, n)
+	var prev uint64
+	var leading, trailing uint
+	for i := 0; i < n; i++ {
+		if i == 0 {
+			bits, err := r.readBits(64)
+			if err != nil {
+				return nil, err
+			}
+			prev = bits
+			values = append(values, math.Float64frombits(bits))
+			continue
+		}
+
+		if changed, err := r.readBit(); err != nil {
+			return nil, err
+		} else if !changed {
+			values = append(values, math.Float64frombits(prev))
+			continue
+		}
+
+		if newWindow, err := r.readBit(); err != nil {
+			return nil, err
+		} else if newWindow {
+			l, err := r.readBits(5)
+			if err != nil {
+				return nil, err
+			}
+			m, err := r.readBits(6)
+			if err != nil {
+				return nil, err
+			}
+			if m == 0 {
+				m = 64
+			}
+			if l+m > 64 {
+				return nil, errInvalidBlock
+			}
+			leading, trailing = uint(l), uint(64-l-m)
+		}
+
+		bits, err := r.readBits(64 - leading - trailing)
+		if err != nil {
+			return nil, err
+		}
+		prev ^= bits << trailing
+		values = append(values, math.Float64frombits(prev))
+	}
+	return values, nil
+}
+
+// encodeIntegerColumn encodes integers as the first value followed by the
+// difference from each previous value, as varints.
+func encodeIntegerColumn(values []interface{}) []byte {
+	var b []byte
+	var prev int64
+	for _, v := range values {
+		value := v.(int64)
+		b = appendVarint(b, value-prev)
+		prev = value
+	}
+	return b
+}
+
+// decodeIntegerColumn decodes n integers written by encodeIntegerColumn.
+func decodeIntegerColumn(b []byte, n int) ([]interface{}, error) {
+	values := make([]interface{}, 0, n)
+	var prev int64
+	for i := 0; i < n; i++ {
+		delta, n := binary.Varint(b)
+		if n <= 0 {
+			return nil, errInvalidBlock
+		}
+		b = b[n:]
+		prev += delta
+		values = append(values, prev)
+	}
+	return values, nil
+}
+
+// encodeBooleanColumn encodes booleans as a bitmap.
+func encodeBooleanColumn(values []interface{}) []byte {
+	b := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v.(bool) {
+			b[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return b
+}
+
+// decodeBooleanColumn decodes n booleans written by encodeBooleanColumn.
+func decodeBooleanColumn(b []byte, n int) ([]interface{}, error) {
+	if len(b) < (n+7)/8 {
+		return nil, errInvalidBlock
+	}
+	values := make([]interface{}, n)
+	for i := range values {
+		values[i] = bitSet(b, i)
+	}
+	return values, nil
+}
+
+// encodeStringColumn encodes strings as a dictionary of the distinct values,
+// each prefixed by its length, followed by the dictionary index of each value.
+func encodeStringColumn(values []interface{}) []byte {
+	var dict []string
+	indexes := make(map[string]int)
+	for _, v := range values {
+		if _, ok := indexes[v.(string)]; !ok {
+			indexes[v.(string)] = len(dict)
+			dict = append(dict, v.(string))
+		}
+	}
+
+	b := appendUvarint(nil, uint64(len(dict)))
+	for _, s := range dict {
+		b = appendUvarint(b, uint64(len(s)))
+		b = append(b, s...)
+	}
+	for _, v := range values {
+		b = appendUvarint(b, uint64(indexes[v.(string)]))
+	}
+	return b
+}
+
+// decodeStringColumn decodes n strings written by encodeStringColumn.
+func decodeStringColumn(b []byte, n int) ([]interface{}, error) {
+	size, i := binary.Uvarint(b)
+	if i <= 0 || size > uint64(len(b)) {
+		return nil, errInvalidBlock
+	}
+	b = b[i:]
+
+	dict := make([]string, size)
+	for j := range dict {
+		l, i := binary.Uvarint(b)
+		if i <= 0 || uint64(len(b)-i) < l {
+			return nil, errInvalidBlock
+		}
+		dict[j], b = string(b[i:i+int(l)]), b[i+int(l):]
+	}
+
+	values := make([]interface{}, 0, n)
+	for j := 0; j < n; j++ {
+		index, i := binary.Uvarint(b)
+		if i <= 0 || index >= uint64(len(dict)) {
+			return nil, errInvalidBlock
+		}
+		b = b[i:]
+		values = append(values, dict[index])
+	}
+	return values, nil
+}
+
+// fieldValueCode returns the typed field encoding's code for a type.
+func fieldValueCode(typ influxql.DataType) byte {
+	switch typ {
+	case influxql.Float:
+		return fieldValueFloat
+	case influxql.Integer:
+		return fieldValueInteger
+	case influxql.Boolean:
+		return fieldValueBoolean
+	}
+	return fieldValueString
+}
+
+// fieldValueType returns the type for a typed field encoding code.
+func fieldValueType(code byte) influxql.DataType {
+	switch code {
+	case fieldValueFloat:
+		return influxql.Float
+	case fieldValueInteger:
+		return influxql.Integer
+	case fieldValueBoolean:
+		return influxql.Boolean
+	case fieldValueString:
+		return influxql.String
+	}
+	return influxql.Unknown
+}
+
+// appendVarint appends the varint encoding of v to b.
+func appendVarint(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+// bitSet returns true if bit i of the bitmap is set.
+func bitSet(bitmap []byte, i int) bool {
+	return bitmap[i/8]&(1<<uint(i%8)) != 0
+}
+
+// leadingZeros returns the number of leading zero bits in v.
+func leadingZeros(v uint64) uint {
+	var n uint
+	for ; n < 64 && v&(1<<63) == 0; v <<= 1 {
+		n++
+	}
+	return n
+}
+
+// trailingZeros returns the number of trailing zero bits in v.
+func trailingZeros(v uint64) uint {
+	var n uint
+	for ; n < 64 && v&1 == 0; v >>= 1 {
+		n++
+	}
+	return n
+}
+
+// bitWriter writes values bit by bit, most significant bit first.
+type bitWriter struct {
+	buf []byte
+	n   uint // bits used in the last byte
+}
+
+// writeBit writes a single bit.
+func (w *bitWriter) writeBit(bit bool) {
+	if w.n == 0 || w.n == 8 {
+		w.buf = append(w.buf, 0)
+		w.n = 0
+	}
+	if bit {
+		w.buf[len(w.buf)-1] |= 1 << (7 - w.n)
+	}
+	w.n++
+}
+
+// writeBits writes the lowest n bits of v.
+func (w *bitWriter) writeBits(v uint64, n uint) {
+	for ; n > 0; n-- {
+		w.writeBit(v&(1<<(n-1)) != 0)
+	}
+}
+
+// bitReader reads values written by a bitWriter.
+type bitReader struct {
+	buf []byte
+	pos uint // bit position in buf
+}
+
+// readBit reads a single bit.
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos/8 >= uint(len(r.buf)) {
+		return false, errInvalidBlock
+	}
+	bit := r.buf[r.pos/8]&(1<<(7-r.pos%8)) != 0
+	r.pos++
+	return bit, nil
+}
+
+// readBits reads n bits into the lowest bits of the returned value.
+func (r *bitReader) readBits(n uint) (uint64, error) {
+	var v uint64
+	for ; n > 0; n-- {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v <<= 1
+		if bit {
+			v |= 1
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,679 @@
+package influxdb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+func init() {
+	RegisterEngine("bolt", func() Engine { return NewBoltEngine() })
+}
+
+// BoltEngine is an engine which stores each series in a bolt bucket of
+// compressed blocks, keyed by the timestamp of the last point in the block.
+type BoltEngine struct {
+	mu      sync.RWMutex // protects store
+	writeMu sync.Mutex   // serializes writes and compactions
+	path    string
+	store   *boltStore
+	stats   *Stats
+	closing sync.WaitGroup // stores closing after a compaction
+}
+
+// boltStore is an open bolt database and its outstanding read transactions.
+// A database replaced by a compaction is closed once its readers finish.
+type boltStore struct {
+	db      *bolt.DB
+	readers sync.WaitGroup
+}
+
+// NewBoltEngine returns a new instance of BoltEngine.
+func NewBoltEngine() *BoltEngine {
+	return &BoltEngine{stats: NewStats("bolt")}
+}
+
+// Open opens and initializes the bolt database at path.
+func (e *BoltEngine) Open(path string) error {
+	db, err := bolt.Open(path, 0666, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return err
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, _ = tx.CreateBucketIfNotExists([]byte("meta"))
+		_, _ = tx.CreateBucketIfNotExists([]byte("values"))
+		return nil
+	}); err != nil {
+		_ = db.Close()
+		return err
+	}
+
+	// Convert series written a point per key into blocks.
+	if err := migrateShardBlocks(db); err != nil {
+		_ = db.Close()
+		return fmt.Errorf("migrate: %s", err)
+	}
+
+	e.path = path
+	e.store = &boltStore{db: db}
+	return nil
+}
+
+// Close closes the bolt database.
+func (e *BoltEngine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.store == nil {
+		return nil
+	}
+	err := e.store.db.Close()
+	e.store = nil
+	e.closing.Wait()
+	return err
+}
+
+// db returns the current bolt database.
+func (e *BoltEngine) db() *bolt.DB {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.store.db
+}
+
+// Index returns the index of the last batch written.
+func (e *BoltEngine) Index() uint64 {
+	var index uint64
+	_ = e.db().View(func(tx *bolt.Tx) error {
+		index = shardMetaIndex(tx)
+		return nil
+	})
+	return index
+}
+
+// WriteBatch inserts the values of each series into the series' blocks.
+func (e *BoltEngine) WriteBatch(index uint64, values map[uint64][]SeriesValue) error {
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+	return e.db().Update(func(tx *bolt.Tx) error {
+		for seriesID, a := range values {
+			// Create a bucket for the series.
+			b, err := tx.CreateBucketIfNotExists(u64tob(seriesID))
+			if err != nil {
+				return err
+			}
+
+			points := make([]blockPoint, len(a))
+			for i, v := range a {
+				points[i] = blockPoint{timestamp: v.Timestamp, data: v.Data}
+			}
+
+			// Insert the values into the series' blocks.
+			n, err := writeBlockPoints(b, mergeBlockPoints(nil, points))
+			if err != nil {
+				return err
+			}
+			e.stats.Add("shardBytes", int64(n))
+			e.stats.Add("shardWrite", int64(len(a)))
+		}
+
+		// Set index.
+		if err := tx.Bucket([]byte("meta")).Put([]byte("index"), u64tob(index)); err != nil {
+			return fmt.Errorf("write shard index: %s", err)
+		}
+		return nil
+	})
+}
+
+// Begin starts a read-only bolt transaction.
+func (e *BoltEngine) Begin() (EngineTx, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	tx, err := e.store.db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+	e.store.readers.Add(1)
+	return &boltEngineTx{tx: tx, store: e.store}, nil
+}
+
+// DeleteSeries removes the buckets of the series.
+func (e *BoltEngine) DeleteSeries(seriesIDs ...uint64) error {
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+	return e.db().Update(func(tx *bolt.Tx) error {
+		for _, seriesID := range seriesIDs {
+			err := tx.DeleteBucket(u64tob(seriesID))
+			if err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteRange removes the points between min and max from the series' blocks.
+func (e *BoltEngine) DeleteRange(seriesIDs []uint64, min, max int64) error {
+	if min > max {
+		return nil
+	}
+
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+	return e.db().Update(func(tx *bolt.Tx) error {
+		for _, seriesID := range seriesIDs {
+			b := tx.Bucket(u64tob(seriesID))
+			if b == nil {
+				continue
+			}
+
+			// Blocks are ordered by unsigned timestamp so a range spanning zero
+			// is deleted in two parts.
+			var n int
+			var err error
+			if min < 0 && max >= 0 {
+				if n, err = deleteBlockPoints(b, min, -1); err == nil {
+					var m int
+					m, err = deleteBlockPoints(b, 0, max)
+					n += m
+				}
+			} else {
+				n, err = deleteBlockPoints(b, min, max)
+			}
+			if err != nil {
+				return err
+			}
+			e.stats.Add("shardBytes", int64(n))
+		}
+		return nil
+	})
+}
+
+// Snapshot returns a writer for the bolt database as of a read transaction.
+func (e *BoltEngine) Snapshot() (int64, uint64, SnapshotFileWriter, error) {
+	tx, err := e.Begin()
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("begin: %s", err)
+	}
+	btx := tx.(*boltEngineTx)
+	return btx.tx.Size(), shardMetaIndex(btx.tx), &boltEngineTxCloser{btx}, nil
+}
+
+// Stats returns the engine's counters.
+func (e *BoltEngine) Stats() *Stats { return e.stats }
+
+// boltEngineTx wraps a read-only bolt transaction to implement EngineTx.
+type boltEngineTx struct {
+	tx    *bolt.Tx
+	store *boltStore
+}
+
+// Cursor returns a cursor over the blocks of a series bucket.
+func (tx *boltEngineTx) Cursor(seriesID uint64) EngineCursor {
+	b := tx.tx.Bucket(u64tob(seriesID))
+	if b == nil {
+		return nil
+	}
+	return newShardCursor(b.Cursor())
+}
+
+// Rollback ends the transaction. Rolling back more than once is a no-op.
+func (tx *boltEngineTx) Rollback() error {
+	if tx.store == nil {
+		return nil
+	}
+	defer tx.store.readers.Done()
+	tx.store = nil
+	return tx.tx.Rollback()
+}
+
+// boltEngineTxCloser writes the database of a transaction and ends the
+// transaction on close.
+type boltEngineTxCloser struct {
+	*boltEngineTx
+}
+
+// WriteTo writes the database to w.
+func (tx *boltEngineTxCloser) WriteTo(w io.Writer) (int64, error) { return tx.tx.WriteTo(w) }
+
+// Close rolls back the transaction.
+func (tx *boltEngineTxCloser) Close() error { return tx.Rollback() }
+
+// Compact rewrites the database into a new file, which replaces the current
+// one, to reclaim the space of deleted data. If recompress is set, the blocks
+// of each series are decoded and rewritten as full blocks. Readers of the old
+// file keep their transactions and the file is closed once they finish.
+// Returns the number of bytes reclaimed.
+func (e *BoltEngine) Compact(recompress bool) (int64, error) {
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+
+	e.mu.RLock()
+	store := e.store
+	e.mu.RUnlock()
+
+	// Write a copy of the database.
+	path := e.path + ".compacting"
+	_ = os.Remove(path)
+	db, err := bolt.Open(path, 0666, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return 0, err
+	}
+	if err := compactBolt(db, store.db, recompress, e.stats); err != nil {
+		_ = db.Close()
+		_ = os.Remove(path)
+		return 0, fmt.Errorf("compact: %s", err)
+	}
+
+	// Replace the file and swap in the new database.
+	before, err := os.Stat(e.path)
+	if err != nil {
+		_ = db.Close()
+		return 0, err
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		_ = db.Close()
+		return 0, err
+	}
+	if err := os.Rename(path, e.path); err != nil {
+		_ = db.Close()
+		return 0, err
+	}
+	e.mu.Lock()
+	e.store = &boltStore{db: db}
+	e.mu.Unlock()
+
+	// Close the old database once its readers are done.
+	e.closing.Add(1)
+	go func() {
+		defer e.closing.Done()
+		store.readers.Wait()
+		_ = store.db.Close()
+	}()
+
+	reclaimed := before.Size() - after.Size()
+	e.stats.Inc("compactions")
+	e.stats.Add("compactBytesReclaimed", reclaimed)
+	return reclaimed, nil
+}
+
+// compactBolt copies the buckets of src into dst, a bucket per transaction.
+func compactBolt(dst, src *bolt.DB, recompress bool, stats *Stats) error {
+	return src.View(func(stx *bolt.Tx) error {
+		// Count the series for progress.
+		var n int64
+		_ = stx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			if len(name) == 8 {
+				n++
+			}
+			return nil
+		})
+		stats.Set("compactSeriesTotal", n)
+		stats.Set("compactSeriesDone", 0)
+
+		return stx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			return dst.Update(func(dtx *bolt.Tx) error {
+				other, err := dtx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				other.FillPercent = 1.0
+
+				// Copy other buckets and series as they are.
+				if len(name) != 8 || !recompress {
+					if err := b.ForEach(func(k, v []byte) error { return other.Put(k, v) }); err != nil {
+						return err
+					}
+					if len(name) == 8 {
+						stats.Inc("compactSeriesDone")
+					}
+					return nil
+				}
+
+				// Rewrite the series' points into full blocks.
+				var points []blockPoint
+				if err := b.ForEach(func(k, v []byte) error {
+					a, err := decodeBlock(append([]byte{}, v...))
+					if err != nil {
+						return fmt.Errorf("decode block: key=%d, err=%s", btou64(k), err)
+					}
+					points = append(points, a...)
+					return nil
+				}); err != nil {
+					return err
+				}
+				if _, err := writeBlockPoints(other, points); err != nil {
+					return err
+				}
+				stats.Inc("compactSeriesDone")
+				return nil
+			})
+		})
+	})
+}
+
+// shardMetaIndex returns the index from the "meta" bucket on a transaction.
+func shardMetaIndex(tx *bolt.Tx) uint64 {
+	var index uint64
+	if buf := tx.Bucket([]byte("meta")).Get([]byte("index")); len(buf) > 0 {
+		index = btou64(buf)
+	}
+	return index
+}
+
+// writeBlockPoints inserts points, sorted by timestamp, into the blocks of a
+// series bucket. Points later than the last block are appended by
+// appendBlockPoints. Other points are merged into the first block ending at or
+// after their timestamp and blocks growing past maxBlockPoints are split.
+// Returns the change in the size of the blocks.
+func writeBlockPoints(b *bolt.Bucket, points []blockPoint) (int, error) {
+	var size int
+	for len(points) > 0 {
+		// Find the block the first point belongs to.
+		c := b.Cursor()
+		k, v := c.Seek(u64tob(uint64(points[0].timestamp)))
+		if k == nil {
+			n, err := appendBlockPoints(b, points)
+			return size + n, err
+		}
+		n := sort.Search(len(points), func(i int) bool { return uint64(points[i].timestamp) > btou64(k) })
+
+		// Merge the points into the existing block. Copy the block since it
+		// is replaced below.
+		existing, err := decodeBlock(append([]byte{}, v...))
+		if err != nil {
+			return 0, fmt.Errorf("decode block: key=%d, err=%s", btou64(k), err)
+		}
+		size -= len(v)
+		if err := b.Delete(append([]byte{}, k...)); err != nil {
+			return 0, err
+		}
+		merged := mergeBlockPoints(existing, points[:n])
+		points = points[n:]
+
+		// Split the points evenly into as few blocks as possible.
+		blockN := (len(merged) + maxBlockPoints - 1) / maxBlockPoints
+		for i := 0; i < blockN; i++ {
+			block := merged[i*len(merged)/blockN : (i+1)*len(merged)/blockN]
+			buf := encodeBlock(block)
+			if err := b.Put(u64tob(uint64(block[len(block)-1].timestamp)), buf); err != nil {
+				return 0, err
+			}
+			size += len(buf)
+		}
+	}
+	return size, nil
+}
+
+// appendBlockPoints appends points, which must all be later than the last
+// block, to a series bucket. The last block is filled up to maxBlockPoints and
+// the remaining points start new blocks. Full blocks aren't decoded. Returns the
+// change in the size of the blocks.
+func appendBlockPoints(b *bolt.Bucket, points []blockPoint) (int, error) {
+	var size int
+	if k, v := b.Cursor().Last(); k != nil {
+		n, err := blockPointN(v)
+		if err != nil {
+			return 0, fmt.Errorf("decode block: key=%d, err=%s", btou64(k), err)
+		}
+
+		// Rewrite the last block with the points following it.
+		if n < maxBlockPoints {
+			existing, err := decodeBlock(append([]byte{}, v...))
+			if err != nil {
+				return 0, fmt.Errorf("decode block: key=%d, err=%s", btou64(k), err)
+			}
+			size -= len(v)
+			if err := b.Delete(append([]byte{}, k...)); err != nil {
+				return 0, err
+			}
+			points = append(existing, points...)
+		}
+	}
+
+	for len(points) > 0 {
+		n := maxBlockPoints
+		if n > len(points) {
+			n = len(points)
+		}
+		buf := encodeBlock(points[:n])
+		if err := b.Put(u64tob(uint64(points[n-1].timestamp)), buf); err != nil {
+			return 0, err
+		}
+		size += len(buf)
+		points = points[n:]
+	}
+	return size, nil
+}
+
+// deleteBlockPoints removes the points between min and max, which must have
+// the same sign, from the blocks of a series bucket. Returns the change in the
+// size of the blocks.
+func deleteBlockPoints(b *bolt.Bucket, min, max int64) (int, error) {
+	// Find the blocks overlapping the range. The first block ending at or after
+	// min is the first which can hold points in the range.
+	type block struct {
+		key    []byte
+		points []blockPoint
+		size   int
+	}
+	var blocks []block
+	c := b.Cursor()
+	for k, v := c.Seek(u64tob(uint64(min))); k != nil; k, v = c.Next() {
+		points, err := decodeBlock(append([]byte{}, v...))
+		if err != nil {
+			return 0, fmt.Errorf("decode block: key=%d, err=%s", btou64(k), err)
+		}
+		if len(points) > 0 && uint64(points[0].timestamp) > uint64(max) {
+			break
+		}
+		blocks = append(blocks, block{key: append([]byte{}, k...), points: points, size: len(v)})
+	}
+
+	// Rewrite each block without the points in the range.
+	var size int
+	for _, blk := range blocks {
+		other := blk.points[:0]
+		for _, p := range blk.points {
+			if p.timestamp < min || p.timestamp > max {
+				other = append(other, p)
+			}
+		}
+		if len(other) == len(blk.points) {
+			continue
+		}
+
+		size -= blk.size
+		if err := b.Delete(blk.key); err != nil {
+			return 0, err
+		}
+		if len(other) == 0 {
+			continue
+		}
+		buf := encodeBlock(other)
+		if err := b.Put(u64tob(uint64(other[len(other)-1].timestamp)), buf); err != nil {
+			return 0, err
+		}
+		size += len(buf)
+	}
+	return size, nil
+}
+
+// mergeBlockPoints returns the points of a and b sorted by timestamp. Points in
+// b replace points in a, and later points in b replace earlier ones, with the
+// same timestamp.
+func mergeBlockPoints(a, b []blockPoint) []blockPoint {
+	merged := make([]blockPoint, 0, len(a)+len(b))
+	merged = append(merged, a...)
+	merged = append(merged, b...)
+	sort.Stable(blockPoints(merged))
+
+	// Keep the last point for each timestamp.
+	other := merged[:0]
+	for i, p := range merged {
+		if i+1 < len(merged) && merged[i+1].timestamp == p.timestamp {
+			continue
+		}
+		other = append(other, p)
+	}
+	return other
+}
+
+// migrateShardBlocks converts series buckets written by earlier versions, with a
+// key for each point, into blocks. Each series is converted in its own
+// transaction, which records it in the meta bucket so an interrupted conversion
+// resumes with the next series. Completion is recorded so it only runs once.
+func migrateShardBlocks(db *bolt.DB) error {
+	for {
+		var done bool
+		if err := db.Update(func(tx *bolt.Tx) error {
+			meta := tx.Bucket([]byte("meta"))
+			if meta.Get([]byte("format")) != nil {
+				done = true
+				return nil
+			}
+
+			// Find the series bucket following the last one converted.
+			var name []byte
+			c := tx.Cursor()
+			k, _ := c.First()
+			if last := meta.Get([]byte("migrated")); last != nil {
+				if k, _ = c.Seek(last); bytes.Equal(k, last) {
+					k, _ = c.Next()
+				}
+			}
+			for ; k != nil; k, _ = c.Next() {
+				if len(k) == 8 {
+					name = append([]byte{}, k...)
+					break
+				}
+			}
+
+			if name == nil {
+				done = true
+				if err := meta.Delete([]byte("migrated")); err != nil {
+					return err
+				}
+				return meta.Put([]byte("format"), []byte("blocks"))
+			}
+
+			if err := migrateSeriesBlocks(tx, name); err != nil {
+				return err
+			}
+			return meta.Put([]byte("migrated"), name)
+		}); err != nil {
+			return err
+		} else if done {
+			return nil
+		}
+	}
+}
+
+// migrateSeriesBlocks replaces a series bucket with a key per point with one
+// holding blocks.
+func migrateSeriesBlocks(tx *bolt.Tx, name []byte) error {
+	var points []blockPoint
+	if err := tx.Bucket(name).ForEach(func(k, v []byte) error {
+		points = append(points, blockPoint{timestamp: int64(btou64(k)), data: append([]byte{}, v...)})
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if err := tx.DeleteBucket(name); err != nil {
+		return err
+	}
+	b, err := tx.CreateBucket(name)
+	if err != nil {
+		return err
+	}
+	_, err = writeBlockPoints(b, points)
+	return err
+}
+
+// shardCursor iterates over the points of a series bucket in timestamp order.
+// Keys and values are the timestamps and encoded fields of each point, as
+// returned by a cursor over a key per point.
+type shardCursor struct {
+	cursor *bolt.Cursor
+	points []blockPoint
+	i      int
+	err    error // error decoding a block
+}
+
+// newShardCursor returns a cursor over the blocks of a series bucket.
+func newShardCursor(c *bolt.Cursor) *shardCursor {
+	return &shardCursor{cursor: c}
+}
+
+// Seek moves the cursor to the first point at or after a timestamp.
+func (c *shardCursor) Seek(seek []byte) (key, value []byte) {
+	k, v := c.cursor.Seek(seek)
+	if !c.load(k, v) {
+		return nil, nil
+	}
+	c.i = sort.Search(len(c.points), func(i int) bool { return uint64(c.points[i].timestamp) >= btou64(seek) })
+	if c.i == len(c.points) {
+		c.i--
+		return c.Next()
+	}
+	return c.point()
+}
+
+// Next moves the cursor to the next point.
+func (c *shardCursor) Next() (key, value []byte) {
+	if c.points == nil {
+		return nil, nil
+	}
+	if c.i++; c.i >= len(c.points) {
+		if !c.load(c.cursor.Next()) {
+			return nil, nil
+		}
+	}
+	return c.point()
+}
+
+// Last moves the cursor to the last point.
+func (c *shardCursor) Last() (key, value []byte) {
+	if !c.load(c.cursor.Last()) {
+		return nil, nil
+	}
+	c.i = len(c.points) - 1
+	return c.point()
+}
+
+// load decodes the points of a block. Returns false if there is no block or
+// the block can't be decoded, in which case the error is kept for Err.
+func (c *shardCursor) load(k, v []byte) bool {
+	c.points, c.i = nil, 0
+	if k == nil {
+		return false
+	}
+	points, err := decodeBlock(v)
+	if err != nil {
+		c.err = fmt.Errorf("decode block: key=%d, err=%s", btou64(k), err)
+		return false
+	} else if len(points) == 0 {
+		return false
+	}
+	c.points = points
+	return true
+}
+
+// Err returns the error decoding a block, if any.
+func (c *shardCursor) Err() error { return c.err }
+
+// point returns the key and value of the current point.
+func (c *shardCursor) point() (key, value []byte) {
+	if c.i >= len(c.points) {
+		return nil, nil
+	}
+	p := c.points[c.i]
+	return u64tob(uint64(p.timestamp)), p.data
+}
@@ -0,0 +1,280 @@
+package influxdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultShardCacheMaxSize is the size, in bytes, of the points a shard holds
+	// in memory before committing them to its engine.
+	DefaultShardCacheMaxSize = 10 * 1024 * 1024
+
+	// DefaultShardCacheFlushInterval is the longest a shard holds points in
+	// memory before committing them to its engine.
+	DefaultShardCacheFlushInterval = 10 * time.Second
+
+	// shardCacheBatchN is the most messages appended to the cache log per sync.
+	shardCacheBatchN = 1000
+)
+
+// cacheRecordHeaderSize is the size of the header of a cache log record.
+const cacheRecordHeaderSize = 8 + 4 + 4 // index + data length + checksum
+
+// shardCache holds the points written to a shard which are not yet committed
+// to its engine. Messages are appended to a log as they arrive so the cache can
+// be rebuilt if the server stops before the points are committed.
+type shardCache struct {
+	mu     sync.RWMutex
+	log    *os.File                 // append-only log of cached messages
+	values map[uint64][]SeriesValue // uncommitted values by series id
+	size   int                      // size of the cached values, in bytes
+	index  uint64                   // index of the last cached message
+}
+
+// openShardCache opens the cache log at path and returns an empty cache.
+func openShardCache(path string) (*shardCache, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &shardCache{log: f, values: make(map[uint64][]SeriesValue)}, nil
+}
+
+// close closes the cache log.
+func (c *shardCache) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.log.Close()
+}
+
+// replay reads the messages after index from the log into the cache. A
+// partially written record at the end of the log is discarded.
+func (c *shardCache) replay(index uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.log.Seek(0, 0); err != nil {
+		return err
+	}
+
+	var offset int64
+	r := bufio.NewReader(c.log)
+	for {
+		// Read the record's header and data. Stop at the first short or
+		// corrupt record.
+		hdr := make([]byte, cacheRecordHeaderSize)
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			break
+		}
+		data := make([]byte, binary.BigEndian.Uint32(hdr[8:12]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			break
+		} else if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(hdr[12:16]) {
+			break
+		}
+		offset += int64(len(hdr) + len(data))
+
+		// Add messages which aren't committed yet.
+		if i := binary.BigEndian.Uint64(hdr[0:8]); i > index {
+			values, err := unmarshalSeriesBatch(data)
+			if err != nil {
+				return err
+			}
+			c.add(i, values)
+		}
+	}
+
+	// Remove anything after the last whole record and append from there.
+	if err := c.log.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := c.log.Seek(offset, 0)
+	return err
+}
+
+// append writes a message to the log and adds its values to the cache. The
+// log must be synced before the message is acknowledged.
+func (c *shardCache) append(index uint64, data []byte, values map[uint64][]SeriesValue) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	buf := make([]byte, cacheRecordHeaderSize, cacheRecordHeaderSize+len(data))
+	binary.BigEndian.PutUint64(buf[0:8], index)
+	binary.BigEndian.PutUint32(buf[8:12], uint32(len(data)))
+	binary.BigEndian.PutUint32(buf[12:16], crc32.ChecksumIEEE(data))
+	if _, err := c.log.Write(append(buf, data...)); err != nil {
+		return err
+	}
+
+	c.add(index, values)
+	return nil
+}
+
+// add adds values to the cache. Cache lock must be held.
+func (c *shardCache) add(index uint64, values map[uint64][]SeriesValue) {
+	for seriesID, a := range values {
+		c.values[seriesID] = append(c.values[seriesID], a...)
+		for _, v := range a {
+			c.size += 8 + len(v.Data)
+		}
+	}
+	c.index = index
+}
+
+// sync flushes the log to disk.
+func (c *shardCache) sync() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.log.Sync()
+}
+
+// Size returns the size of the cached values, in bytes.
+func (c *shardCache) Size() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.size
+}
+
+// seriesValues returns a copy of the cached values of a series sorted by
+// timestamp. Later values replace earlier ones with the same timestamp.
+func (c *shardCache) seriesValues(seriesID uint64) []SeriesValue {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return sortSeriesValues(append([]SeriesValue{}, c.values[seriesID]...))
+}
+
+// commit writes the cached values to the engine in a single batch, then
+// empties the cache and its log. Returns the number of values committed.
+func (c *shardCache) commit(e Engine) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.values) == 0 {
+		return 0, nil
+	}
+	if err := e.WriteBatch(c.index, c.values); err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, a := range c.values {
+		n += len(a)
+	}
+
+	// Start a new log now the values are stored by the engine.
+	if err := c.log.Truncate(0); err != nil {
+		return 0, err
+	} else if _, err := c.log.Seek(0, 0); err != nil {
+		return 0, err
+	}
+	c.values = make(map[uint64][]SeriesValue)
+	c.size = 0
+
+	return n, nil
+}
+
+// sortSeriesValues sorts values by timestamp in place. Later values replace
+// earlier ones with the same timestamp.
+func sortSeriesValues(a []SeriesValue) []SeriesValue {
+	sort.Stable(seriesValues(a))
+	other := a[:0]
+	for i, v := range a {
+		if i+1 < len(a) && a[i+1].Timestamp == v.Timestamp {
+			continue
+		}
+		other = append(other, v)
+	}
+	return other
+}
+
+// seriesValues sorts values in the order of their 8 byte big endian keys.
+type seriesValues []SeriesValue
+
+func (a seriesValues) Len() int           { return len(a) }
+func (a seriesValues) Less(i, j int) bool { return uint64(a[i].Timestamp) < uint64(a[j].Timestamp) }
+func (a seriesValues) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// cacheCursor iterates over the values of a series in the engine and in the
+// cache together. Cached values replace stored values with the same timestamp.
+type cacheCursor struct {
+	cursor EngineCursor  // engine cursor, nil if the series isn't stored
+	values []SeriesValue // sorted cached values
+	i      int           // position in values
+
+	key, value []byte // current engine key and value
+}
+
+// newCacheCursor returns a cursor merging an engine cursor and cached values.
+func newCacheCursor(c EngineCursor, values []SeriesValue) *cacheCursor {
+	return &cacheCursor{cursor: c, values: values}
+}
+
+// Seek moves the cursor to the first value at or after the timestamp key.
+func (c *cacheCursor) Seek(seek []byte) (key, value []byte) {
+	c.key, c.value = nil, nil
+	if c.cursor != nil {
+		c.key, c.value = c.cursor.Seek(seek)
+	}
+	c.i = sort.Search(len(c.values), func(i int) bool { return uint64(c.values[i].Timestamp) >= btou64(seek) })
+	return c.read()
+}
+
+// Next moves the cursor to the next value.
+func (c *cacheCursor) Next() (key, value []byte) {
+	// Advance past the current value, which may be in both the engine and the cache.
+	var k uint64
+	if c.key != nil && (c.i >= len(c.values) || btou64(c.key) <= uint64(c.values[c.i].Timestamp)) {
+		k = btou64(c.key)
+		c.key, c.value = c.cursor.Next()
+	} else if c.i < len(c.values) {
+		k = uint64(c.values[c.i].Timestamp)
+	} else {
+		return nil, nil
+	}
+	if c.i < len(c.values) && uint64(c.values[c.i].Timestamp) == k {
+		c.i++
+	}
+	return c.read()
+}
+
+// Last moves the cursor to the last value.
+func (c *cacheCursor) Last() (key, value []byte) {
+	c.key, c.value = nil, nil
+	if c.cursor != nil {
+		c.key, c.value = c.cursor.Last()
+	}
+
+	// Read the last cached value unless the engine's last value is later.
+	c.i = len(c.values)
+	if n := len(c.values); n > 0 && (c.key == nil || uint64(c.values[n-1].Timestamp) >= btou64(c.key)) {
+		c.key, c.value = nil, nil
+		c.i = n - 1
+	}
+	return c.read()
+}
+
+// Err returns the error which ended iteration of the engine cursor, if any.
+func (c *cacheCursor) Err() error {
+	if c.cursor == nil {
+		return nil
+	}
+	return c.cursor.Err()
+}
+
+// read returns the lower of the current engine and cached values.
+func (c *cacheCursor) read() (key, value []byte) {
+	if c.i < len(c.values) {
+		v := c.values[c.i]
+		if c.key == nil || uint64(v.Timestamp) <= btou64(c.key) {
+			return u64tob(uint64(v.Timestamp)), v.Data
+		}
+	}
+	return c.key, c.value
+}
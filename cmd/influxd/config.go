@@ -13,8 +13,12 @@ import (
 	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/influxdb/influxdb"
 	"github.com/influxdb/influxdb/collectd"
 	"github.com/influxdb/influxdb/graphite"
+	"github.com/influxdb/influxdb/prometheus"
+	"github.com/influxdb/influxdb/statsd"
+	"github.com/influxdb/influxdb/syslog"
 )
 
 const (
@@ -59,6 +63,18 @@ const (
 	// DefaultOpenTSDBDatabaseName is the default OpenTSDB database if none is specified
 	DefaultOpenTSDBDatabaseName = "opentsdb"
 
+	// DefaultUDPPort is the default port for UDP listeners if none is specified
+	DefaultUDPPort = 4444
+
+	// DefaultStatsDDatabaseName is the default StatsD database if none is specified
+	DefaultStatsDDatabaseName = "statsd"
+
+	// DefaultPrometheusDatabaseName is the default Prometheus database if none is specified
+	DefaultPrometheusDatabaseName = "prometheus"
+
+	// DefaultSyslogDatabaseName is the default syslog database if none is specified
+	DefaultSyslogDatabaseName = "syslog"
+
 	// DefaultRetentionAutoCreate is the default for auto-creating retention policies
 	DefaultRetentionAutoCreate = true
 
@@ -68,6 +84,21 @@ const (
 	// DefaultRetentionCheckPeriod is the period of time between retention policy checks are run
 	DefaultRetentionCheckPeriod = 10 * time.Minute
 
+	// DefaultMaxSeriesPerDatabase is the default limit of series in a database
+	DefaultMaxSeriesPerDatabase = 1000000
+
+	// DefaultMaxValuesPerTag is the default limit of values of a measurement's tag
+	DefaultMaxValuesPerTag = 100000
+
+	// DefaultCompactionEnabled is the default for compacting cold shards
+	DefaultCompactionEnabled = true
+
+	// DefaultCompactionCheckPeriod is the period of time between checks for cold shards
+	DefaultCompactionCheckPeriod = time.Hour
+
+	// DefaultCompactionColdAfter is how long a shard goes without writes before it is compacted
+	DefaultCompactionColdAfter = 4 * time.Hour
+
 	// DefaultRecomputePreviousN is ???
 	DefaultContinuousQueryRecomputePreviousN = 2
 
@@ -116,12 +147,45 @@ type Snapshot struct {
 
 // Data represents the configuration for a data node
 type Data struct {
-	Dir                   string   `toml:"dir"`
-	Enabled               bool     `toml:"enabled"`
-	RetentionAutoCreate   bool     `toml:"retention-auto-create"`
-	RetentionCheckEnabled bool     `toml:"retention-check-enabled"`
-	RetentionCheckPeriod  Duration `toml:"retention-check-period"`
-	RetentionCreatePeriod Duration `toml:"retention-create-period"`
+	Dir                   string           `toml:"dir"`
+	Enabled               bool             `toml:"enabled"`
+	RetentionAutoCreate   bool             `toml:"retention-auto-create"`
+	RetentionCheckEnabled bool             `toml:"retention-check-enabled"`
+	RetentionCheckPeriod  Duration         `toml:"retention-check-period"`
+	RetentionCreatePeriod Duration         `toml:"retention-create-period"`
+	CacheMaxSize          Size             `toml:"cache-max-size"`
+	CacheFlushInterval    Duration         `toml:"cache-flush-interval"`
+	MaxSeriesPerDatabase  int              `toml:"max-series-per-database"`
+	MaxValuesPerTag       int              `toml:"max-values-per-tag"`
+	CompactionEnabled     bool             `toml:"compaction-enabled"`
+	CompactionCheckPeriod Duration         `toml:"compaction-check-period"`
+	CompactionColdAfter   Duration         `toml:"compaction-cold-after"`
+	CompactionRecompress  bool             `toml:"compaction-recompress"`
+	Engines               []Engine         `toml:"engines"`
+	Tiers                 []Tier           `toml:"tiers"`
+	LastValueCaches       []LastValueCache `toml:"last-value-caches"`
+}
+
+// LastValueCache enables caching the latest point of each series of a measurement.
+type LastValueCache struct {
+	Database    string `toml:"database"`
+	Measurement string `toml:"measurement"`
+}
+
+// Engine selects the storage engine for new shards of a retention policy.
+type Engine struct {
+	Database        string `toml:"database"`
+	RetentionPolicy string `toml:"retention-policy"`
+	Name            string `toml:"name"`
+}
+
+// Tier moves the shards of a retention policy to a cold tier directory once
+// their shard group ended longer ago than MoveAfter.
+type Tier struct {
+	Database        string   `toml:"database"`
+	RetentionPolicy string   `toml:"retention-policy"`
+	MoveAfter       Duration `toml:"move-after"`
+	ColdDir         string   `toml:"cold-dir"`
 }
 
 // Initialization contains configuration options for the first time a node boots
@@ -164,11 +228,15 @@ type Config struct {
 	Collectd  Collectd   `toml:"collectd"`
 	OpenTSDB  OpenTSDB   `toml:"opentsdb"`
 
-	UDP struct {
-		Enabled     bool   `toml:"enabled"`
-		BindAddress string `toml:"bind-address"`
-		Port        int    `toml:"port"`
-	} `toml:"udp"`
+	UDPs []UDP `toml:"udp"`
+
+	StatsDs []StatsD `toml:"statsd"`
+
+	Prometheus Prometheus `toml:"prometheus"`
+
+	Syslog Syslog `toml:"syslog"`
+
+	Pipeline []PipelineRule `toml:"pipeline"`
 
 	Broker Broker `toml:"broker"`
 
@@ -236,6 +304,14 @@ func NewConfig() *Config {
 	c.Data.RetentionCheckEnabled = DefaultRetentionCheckEnabled
 	c.Data.RetentionCheckPeriod = Duration(DefaultRetentionCheckPeriod)
 	c.Data.RetentionCreatePeriod = Duration(DefaultRetentionCreatePeriod)
+	c.Data.CacheMaxSize = Size(influxdb.DefaultShardCacheMaxSize)
+	c.Data.CacheFlushInterval = Duration(influxdb.DefaultShardCacheFlushInterval)
+	c.Data.MaxSeriesPerDatabase = DefaultMaxSeriesPerDatabase
+	c.Data.MaxValuesPerTag = DefaultMaxValuesPerTag
+	c.Data.CompactionEnabled = DefaultCompactionEnabled
+	c.Data.CompactionCheckPeriod = Duration(DefaultCompactionCheckPeriod)
+	c.Data.CompactionColdAfter = Duration(DefaultCompactionColdAfter)
+	c.Data.CompactionRecompress = true
 
 	c.Logging.HTTPAccess = true
 	c.Logging.WriteTracing = false
@@ -252,13 +328,6 @@ func NewConfig() *Config {
 	c.Broker.MaxTopicSize = DefaultBrokerMaxTopicSize
 	c.Broker.MaxSegmentSize = DefaultBrokerMaxSegmentSize
 
-	// FIX(benbjohnson): Append where the udp servers are actually used.
-	// config.UDPServers = append(config.UDPServers, UDPInputConfig{
-	// 	Enabled:  tomlConfiguration.InputPlugins.UDPInput.Enabled,
-	// 	Database: tomlConfiguration.InputPlugins.UDPInput.Database,
-	// 	Port:     tomlConfiguration.InputPlugins.UDPInput.Port,
-	// })
-
 	return c
 }
 
@@ -304,11 +373,6 @@ func (c *Config) APIAddr() string {
 	return net.JoinHostPort(ba, strconv.Itoa(bp))
 }
 
-// APIAddrUDP returns the UDP address for the series listener.
-func (c *Config) APIAddrUDP() string {
-	return net.JoinHostPort(c.UDP.BindAddress, strconv.Itoa(c.UDP.Port))
-}
-
 // ClusterAddr returns the binding address for the cluster
 func (c *Config) ClusterAddr() string {
 	return net.JoinHostPort(c.BindAddress, strconv.Itoa(c.Port))
@@ -436,13 +500,68 @@ func ParseConfig(s string) (*Config, error) {
 	return c, nil
 }
 
+// batchSizeOrDefault returns the number of points an input buffers before
+// writing, or the default if n isn't set.
+func batchSizeOrDefault(n int) int {
+	if n == 0 {
+		return influxdb.DefaultBatchSize
+	}
+	return n
+}
+
+// batchTimeoutOrDefault returns the maximum time an input buffers points before
+// writing, or the default if d isn't set.
+func batchTimeoutOrDefault(d Duration) time.Duration {
+	if d == 0 {
+		return influxdb.DefaultBatchTimeout
+	}
+	return time.Duration(d)
+}
+
 type Collectd struct {
 	BindAddress string `toml:"bind-address"`
 	Port        uint16 `toml:"port"`
 
-	Database string `toml:"database"`
-	Enabled  bool   `toml:"enabled"`
-	TypesDB  string `toml:"typesdb"`
+	Database        string   `toml:"database"`
+	Enabled         bool     `toml:"enabled"`
+	TypesDB         string   `toml:"typesdb"`
+	TypesDBPaths    []string `toml:"typesdb-paths"`
+	SecurityLevel   string   `toml:"security-level"`
+	AuthFile        string   `toml:"auth-file"`
+	ParseMultiValue string   `toml:"parse-multivalue"`
+	BatchSize       int      `toml:"batch-size"`
+	BatchTimeout    Duration `toml:"batch-timeout"`
+}
+
+// TypesDBList returns the types.db files and directories to load, starting
+// with typesdb and followed by typesdb-paths.
+func (c *Collectd) TypesDBList() []string {
+	var paths []string
+	if c.TypesDB != "" {
+		paths = append(paths, c.TypesDB)
+	}
+	return append(paths, c.TypesDBPaths...)
+}
+
+// ParseMultiValueOrDefault returns how values are mapped onto points, or the
+// default if no mode is set.
+func (c *Collectd) ParseMultiValueOrDefault() string {
+	if c.ParseMultiValue == "" {
+		return collectd.MultiValueSplit
+	}
+	return c.ParseMultiValue
+}
+
+// BatchSizeOrDefault returns the number of points to buffer before writing, or
+// the default if no batch size is set.
+func (c *Collectd) BatchSizeOrDefault() int {
+	return batchSizeOrDefault(c.BatchSize)
+}
+
+// BatchTimeoutOrDefault returns the maximum time points are buffered before
+// writing, or the default if no timeout is set.
+func (c *Collectd) BatchTimeoutOrDefault() time.Duration {
+	return batchTimeoutOrDefault(c.BatchTimeout)
 }
 
 // ConnnectionString returns the connection string for this collectd config in the form host:port.
@@ -466,11 +585,16 @@ type Graphite struct {
 	BindAddress string `toml:"bind-address"`
 	Port        int    `toml:"port"`
 
-	Database      string `toml:"database"`
-	Enabled       bool   `toml:"enabled"`
-	Protocol      string `toml:"protocol"`
-	NamePosition  string `toml:"name-position"`
-	NameSeparator string `toml:"name-separator"`
+	Database        string   `toml:"database"`
+	RetentionPolicy string   `toml:"retention-policy"`
+	Enabled         bool     `toml:"enabled"`
+	Protocol        string   `toml:"protocol"`
+	NamePosition    string   `toml:"name-position"`
+	NameSeparator   string   `toml:"name-separator"`
+	Templates       []string `toml:"templates"`
+	Tags            []string `toml:"tags"`
+	BatchSize       int      `toml:"batch-size"`
+	BatchTimeout    Duration `toml:"batch-timeout"`
 }
 
 // ConnnectionString returns the connection string for this Graphite config in the form host:port.
@@ -499,6 +623,18 @@ func (g *Graphite) LastEnabled() bool {
 	return g.NamePosition == strings.ToLower("last")
 }
 
+// BatchSizeOrDefault returns the number of points to buffer before writing, or
+// the default if no batch size is set.
+func (g *Graphite) BatchSizeOrDefault() int {
+	return batchSizeOrDefault(g.BatchSize)
+}
+
+// BatchTimeoutOrDefault returns the maximum time points are buffered before
+// writing, or the default if no timeout is set.
+func (g *Graphite) BatchTimeoutOrDefault() time.Duration {
+	return batchTimeoutOrDefault(g.BatchTimeout)
+}
+
 // maxInt is the largest integer representable by a word (architeture dependent).
 const maxInt = int64(^uint(0) >> 1)
 
@@ -506,9 +642,11 @@ type OpenTSDB struct {
 	Addr string `toml:"address"`
 	Port int    `toml:"port"`
 
-	Enabled         bool   `toml:"enabled"`
-	Database        string `toml:"database"`
-	RetentionPolicy string `toml:"retention-policy"`
+	Enabled         bool     `toml:"enabled"`
+	Database        string   `toml:"database"`
+	RetentionPolicy string   `toml:"retention-policy"`
+	BatchSize       int      `toml:"batch-size"`
+	BatchTimeout    Duration `toml:"batch-timeout"`
 }
 
 func (o OpenTSDB) DatabaseString() string {
@@ -521,3 +659,250 @@ func (o OpenTSDB) DatabaseString() string {
 func (o OpenTSDB) ListenAddress() string {
 	return net.JoinHostPort(o.Addr, strconv.Itoa(o.Port))
 }
+
+// BatchSizeOrDefault returns the number of points to buffer before writing, or
+// the default if no batch size is set.
+func (o OpenTSDB) BatchSizeOrDefault() int {
+	return batchSizeOrDefault(o.BatchSize)
+}
+
+// BatchTimeoutOrDefault returns the maximum time points are buffered before
+// writing, or the default if no timeout is set.
+func (o OpenTSDB) BatchTimeoutOrDefault() time.Duration {
+	return batchTimeoutOrDefault(o.BatchTimeout)
+}
+
+// UDP represents the configuration for a UDP listener accepting points in the line protocol.
+type UDP struct {
+	Enabled     bool   `toml:"enabled"`
+	BindAddress string `toml:"bind-address"`
+	Port        int    `toml:"port"`
+
+	Database        string   `toml:"database"`
+	RetentionPolicy string   `toml:"retention-policy"`
+	Precision       string   `toml:"precision"`
+	BatchSize       int      `toml:"batch-size"`
+	BatchTimeout    Duration `toml:"batch-timeout"`
+}
+
+// ConnectionString returns the connection string for this UDP config in the form host:port.
+func (u *UDP) ConnectionString(defaultBindAddr string) string {
+	addr := u.BindAddress
+	// If no address specified, use default.
+	if addr == "" {
+		addr = defaultBindAddr
+	}
+
+	port := u.Port
+	// If no port specified, use default.
+	if port == 0 {
+		port = DefaultUDPPort
+	}
+
+	return net.JoinHostPort(addr, strconv.Itoa(port))
+}
+
+// BatchSizeOrDefault returns the number of points to buffer before writing, or
+// the default if no batch size is set.
+func (u *UDP) BatchSizeOrDefault() int {
+	return batchSizeOrDefault(u.BatchSize)
+}
+
+// BatchTimeoutOrDefault returns the maximum time points are buffered before
+// writing, or the default if no timeout is set.
+func (u *UDP) BatchTimeoutOrDefault() time.Duration {
+	return batchTimeoutOrDefault(u.BatchTimeout)
+}
+
+// StatsD represents the configuration for a StatsD listener.
+type StatsD struct {
+	Enabled     bool   `toml:"enabled"`
+	BindAddress string `toml:"bind-address"`
+	Port        int    `toml:"port"`
+
+	Database        string    `toml:"database"`
+	RetentionPolicy string    `toml:"retention-policy"`
+	FlushInterval   Duration  `toml:"flush-interval"`
+	Percentiles     []float64 `toml:"percentiles"`
+	Templates       []string  `toml:"templates"`
+	Tags            []string  `toml:"tags"`
+}
+
+// ConnectionString returns the connection string for this StatsD config in the form host:port.
+func (s *StatsD) ConnectionString(defaultBindAddr string) string {
+	addr := s.BindAddress
+	// If no address specified, use default.
+	if addr == "" {
+		addr = defaultBindAddr
+	}
+
+	port := s.Port
+	// If no port specified, use default.
+	if port == 0 {
+		port = statsd.DefaultPort
+	}
+
+	return net.JoinHostPort(addr, strconv.Itoa(port))
+}
+
+// DatabaseString returns the database to write to, or the default if no database is set.
+func (s *StatsD) DatabaseString() string {
+	if s.Database == "" {
+		return DefaultStatsDDatabaseName
+	}
+	return s.Database
+}
+
+// FlushIntervalOrDefault returns the time between writes of aggregated
+// metrics, or the default if no interval is set.
+func (s *StatsD) FlushIntervalOrDefault() time.Duration {
+	if s.FlushInterval == 0 {
+		return statsd.DefaultFlushInterval
+	}
+	return time.Duration(s.FlushInterval)
+}
+
+// PercentilesOrDefault returns the timer percentiles to compute, or the
+// default if none are set.
+func (s *StatsD) PercentilesOrDefault() []float64 {
+	if len(s.Percentiles) == 0 {
+		return statsd.DefaultPercentiles
+	}
+	return s.Percentiles
+}
+
+// Prometheus represents the configuration for scraping metrics in the
+// Prometheus exposition format.
+type Prometheus struct {
+	Enabled bool     `toml:"enabled"`
+	Targets []string `toml:"targets"`
+
+	Database        string   `toml:"database"`
+	RetentionPolicy string   `toml:"retention-policy"`
+	Interval        Duration `toml:"interval"`
+	Timeout         Duration `toml:"timeout"`
+}
+
+// DatabaseString returns the database to write to, or the default if no database is set.
+func (p *Prometheus) DatabaseString() string {
+	if p.Database == "" {
+		return DefaultPrometheusDatabaseName
+	}
+	return p.Database
+}
+
+// IntervalOrDefault returns the time between scrapes of each target, or the
+// default if no interval is set.
+func (p *Prometheus) IntervalOrDefault() time.Duration {
+	if p.Interval == 0 {
+		return prometheus.DefaultInterval
+	}
+	return time.Duration(p.Interval)
+}
+
+// TimeoutOrDefault returns the time allowed for a single scrape, or the
+// default if no timeout is set.
+func (p *Prometheus) TimeoutOrDefault() time.Duration {
+	if p.Timeout == 0 {
+		return prometheus.DefaultTimeout
+	}
+	return time.Duration(p.Timeout)
+}
+
+// Syslog represents the configuration for receiving syslog messages.
+type Syslog struct {
+	Enabled     bool     `toml:"enabled"`
+	BindAddress string   `toml:"bind-address"`
+	Port        int      `toml:"port"`
+	Protocols   []string `toml:"protocols"`
+
+	Database        string   `toml:"database"`
+	RetentionPolicy string   `toml:"retention-policy"`
+	Measurement     string   `toml:"measurement"`
+	BatchSize       int      `toml:"batch-size"`
+	BatchTimeout    Duration `toml:"batch-timeout"`
+}
+
+// ConnectionString returns the connection string for this syslog config in the form host:port.
+func (s *Syslog) ConnectionString(defaultBindAddr string) string {
+	addr := s.BindAddress
+	// If no address specified, use default.
+	if addr == "" {
+		addr = defaultBindAddr
+	}
+
+	port := s.Port
+	// If no port specified, use default.
+	if port == 0 {
+		port = syslog.DefaultPort
+	}
+
+	return net.JoinHostPort(addr, strconv.Itoa(port))
+}
+
+// ProtocolsOrDefault returns the protocols to listen on, or both "tcp" and
+// "udp" if none are set.
+func (s *Syslog) ProtocolsOrDefault() []string {
+	if len(s.Protocols) == 0 {
+		return []string{"tcp", "udp"}
+	}
+	return s.Protocols
+}
+
+// DatabaseString returns the database to write to, or the default if no database is set.
+func (s *Syslog) DatabaseString() string {
+	if s.Database == "" {
+		return DefaultSyslogDatabaseName
+	}
+	return s.Database
+}
+
+// MeasurementString returns the measurement to write to, or the default if
+// no measurement is set.
+func (s *Syslog) MeasurementString() string {
+	if s.Measurement == "" {
+		return syslog.DefaultMeasurement
+	}
+	return s.Measurement
+}
+
+// BatchSizeOrDefault returns the number of points to buffer before writing, or
+// the default if no batch size is set.
+func (s *Syslog) BatchSizeOrDefault() int {
+	return batchSizeOrDefault(s.BatchSize)
+}
+
+// BatchTimeoutOrDefault returns the maximum time points are buffered before
+// writing, or the default if no timeout is set.
+func (s *Syslog) BatchTimeoutOrDefault() time.Duration {
+	return batchTimeoutOrDefault(s.BatchTimeout)
+}
+
+// PipelineRule represents the configuration for a rule rewriting or filtering
+// points before they are written.
+type PipelineRule struct {
+	Name        string `toml:"name"`
+	Action      string `toml:"action"`
+	Measurement string `toml:"measurement"`
+	Pattern     string `toml:"pattern"`
+	Key         string `toml:"key"`
+	Value       string `toml:"value"`
+	Type        string `toml:"type"`
+}
+
+// PipelineRules returns the configured pipeline rules in order.
+func (c *Config) PipelineRules() []influxdb.Rule {
+	var rules []influxdb.Rule
+	for _, r := range c.Pipeline {
+		rules = append(rules, influxdb.Rule{
+			Name:        r.Name,
+			Action:      r.Action,
+			Measurement: r.Measurement,
+			Pattern:     r.Pattern,
+			Key:         r.Key,
+			Value:       r.Value,
+			Type:        r.Type,
+		})
+	}
+	return rules
+}
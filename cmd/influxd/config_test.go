@@ -8,7 +8,10 @@ import (
 	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/influxdb/influxdb"
 	main "github.com/influxdb/influxdb/cmd/influxd"
+	"github.com/influxdb/influxdb/prometheus"
+	"github.com/influxdb/influxdb/syslog"
 )
 
 // Testing configuration file.
@@ -55,12 +58,54 @@ ssl-cert = "../cert.pem"
 # However, if a request is taking longer than this to complete, could be a problem.
 read-timeout = "5s"
 
-[input_plugins]
+# Configure the UDP listeners
+[[udp]]
+enabled = true
+port = 4444
+database = "test"
+precision = "s"
+batch-size = 500
+batch-timeout = "2s"
+
+[[udp]]
+enabled = false
+bind-address = "192.168.0.4"
+port = 4445
+database = "test2"
+retention-policy = "raw"
+
+# Configure the StatsD servers
+[[statsd]]
+enabled = true
+port = 8126
+flush-interval = "5s"
+percentiles = [90.0, 99.5]
+templates = ["measurement.field"]
+
+# Configure the Prometheus scraper
+[prometheus]
+enabled = true
+targets = ["http://localhost:9100/metrics", "http://localhost:9101/metrics"]
+interval = "15s"
+
+# Configure the syslog server
+[syslog]
+enabled = true
+port = 5514
+protocols = ["udp"]
+retention-policy = "raw"
 
-  [input_plugins.udp]
-  enabled = true
-  port = 4444
-  database = "test"
+# Configure the pipeline
+[[pipeline]]
+name = "fix-host"
+action = "rename-tag"
+pattern = "^hostname$"
+value = "host"
+
+[[pipeline]]
+action = "drop-point"
+measurement = "^debug_"
+pattern = "."
 
 # Configure the Graphite servers
 [[graphite]]
@@ -69,8 +114,13 @@ enabled = true
 bind-address = "192.168.0.1"
 port = 2003
 database = "graphite_tcp"  # store graphite data in this database
+retention-policy = "raw"
+batch-size = 500
+batch-timeout = "2s"
 name-position = "last"
 name-separator = "-"
+templates = ["servers.* .host.measurement.field", "measurement*"]
+tags = ["region=us-east"]
 
 [[graphite]]
 protocol = "udP"
@@ -85,6 +135,10 @@ bind-address = "192.168.0.3"
 port = 25827
 database = "collectd_database"
 typesdb = "foo-db-type"
+security-level = "sign"
+auth-file = "/etc/collectd/auth_file"
+typesdb-paths = ["/etc/collectd/types.d"]
+parse-multivalue = "join"
 
 # Configure OpenTSDB server
 [opentsdb]
@@ -93,6 +147,7 @@ address = "192.168.0.3"
 port = 4242
 database = "opentsdb_database"
 retention-policy = "raw"
+batch-size = 200
 
 # Broker configuration
 [broker]
@@ -110,8 +165,31 @@ dir = "/tmp/influxdb/development/db"
 retention-auto-create = false
 retention-check-enabled = true
 retention-check-period = "5m"
+cache-max-size = "20m"
+cache-flush-interval = "30s"
+max-series-per-database = 5000
+max-values-per-tag = 0
+compaction-enabled = false
+compaction-check-period = "30m"
+compaction-cold-after = "2h"
+compaction-recompress = false
 enabled = false
 
+[[data.last-value-caches]]
+database = "metrics"
+measurement = "cpu"
+
+[[data.engines]]
+database = "metrics"
+retention-policy = "default"
+name = "bolt"
+
+[[data.tiers]]
+database = "metrics"
+retention-policy = "default"
+move-after = "168h"
+cold-dir = "/mnt/cold/influxdb"
+
 [continuous_queries]
 disabled = true
 
@@ -168,8 +246,90 @@ func TestParseConfig(t *testing.T) {
 		t.Fatalf("http api bind-address mismatch: got %v, exp %v", c.HTTPAPI.BindAddress, exp)
 	}
 
-	if c.UDP.Enabled {
-		t.Fatalf("udp enabled mismatch: %v", c.UDP.Enabled)
+	if len(c.UDPs) != 2 {
+		t.Fatalf("udps mismatch. expected %v, got: %v", 2, len(c.UDPs))
+	}
+
+	switch u := c.UDPs[0]; {
+	case u.Enabled != true:
+		t.Fatalf("udp enabled mismatch: expected: %v, got %v", true, u.Enabled)
+	case u.ConnectionString("") != ":4444":
+		t.Fatalf("udp address mismatch: expected %v, got %v", ":4444", u.ConnectionString(""))
+	case u.Database != "test":
+		t.Fatalf("udp database mismatch: expected %v, got %v", "test", u.Database)
+	case u.Precision != "s":
+		t.Fatalf("udp precision mismatch: expected %v, got %v", "s", u.Precision)
+	case u.BatchSizeOrDefault() != 500:
+		t.Fatalf("udp batch size mismatch: expected %v, got %v", 500, u.BatchSizeOrDefault())
+	case u.BatchTimeoutOrDefault() != 2*time.Second:
+		t.Fatalf("udp batch timeout mismatch: expected %v, got %v", 2*time.Second, u.BatchTimeoutOrDefault())
+	}
+
+	switch u := c.UDPs[1]; {
+	case u.Enabled != false:
+		t.Fatalf("udp enabled mismatch: expected: %v, got %v", false, u.Enabled)
+	case u.ConnectionString("") != "192.168.0.4:4445":
+		t.Fatalf("udp address mismatch: expected %v, got %v", "192.168.0.4:4445", u.ConnectionString(""))
+	case u.RetentionPolicy != "raw":
+		t.Fatalf("udp retention policy mismatch: expected %v, got %v", "raw", u.RetentionPolicy)
+	case u.BatchSizeOrDefault() != influxdb.DefaultBatchSize:
+		t.Fatalf("udp batch size mismatch: expected %v, got %v", influxdb.DefaultBatchSize, u.BatchSizeOrDefault())
+	}
+
+	if len(c.StatsDs) != 1 {
+		t.Fatalf("statsds mismatch. expected %v, got: %v", 1, len(c.StatsDs))
+	}
+
+	switch sd := c.StatsDs[0]; {
+	case sd.Enabled != true:
+		t.Fatalf("statsd enabled mismatch: expected: %v, got %v", true, sd.Enabled)
+	case sd.ConnectionString("") != ":8126":
+		t.Fatalf("statsd address mismatch: expected %v, got %v", ":8126", sd.ConnectionString(""))
+	case sd.DatabaseString() != "statsd":
+		t.Fatalf("statsd database mismatch: expected %v, got %v", "statsd", sd.DatabaseString())
+	case sd.FlushIntervalOrDefault() != 5*time.Second:
+		t.Fatalf("statsd flush interval mismatch: expected %v, got %v", 5*time.Second, sd.FlushIntervalOrDefault())
+	case !reflect.DeepEqual(sd.PercentilesOrDefault(), []float64{90, 99.5}):
+		t.Fatalf("statsd percentiles mismatch: got %v", sd.PercentilesOrDefault())
+	case !reflect.DeepEqual(sd.Templates, []string{"measurement.field"}):
+		t.Fatalf("statsd templates mismatch: got %v", sd.Templates)
+	}
+
+	switch p := c.Prometheus; {
+	case p.Enabled != true:
+		t.Fatalf("prometheus enabled mismatch: expected: %v, got %v", true, p.Enabled)
+	case !reflect.DeepEqual(p.Targets, []string{"http://localhost:9100/metrics", "http://localhost:9101/metrics"}):
+		t.Fatalf("prometheus targets mismatch: got %v", p.Targets)
+	case p.DatabaseString() != "prometheus":
+		t.Fatalf("prometheus database mismatch: expected %v, got %v", "prometheus", p.DatabaseString())
+	case p.IntervalOrDefault() != 15*time.Second:
+		t.Fatalf("prometheus interval mismatch: expected %v, got %v", 15*time.Second, p.IntervalOrDefault())
+	case p.TimeoutOrDefault() != prometheus.DefaultTimeout:
+		t.Fatalf("prometheus timeout mismatch: expected %v, got %v", prometheus.DefaultTimeout, p.TimeoutOrDefault())
+	}
+
+	switch sl := c.Syslog; {
+	case sl.Enabled != true:
+		t.Fatalf("syslog enabled mismatch: expected: %v, got %v", true, sl.Enabled)
+	case sl.ConnectionString("") != ":5514":
+		t.Fatalf("syslog address mismatch: expected %v, got %v", ":5514", sl.ConnectionString(""))
+	case !reflect.DeepEqual(sl.ProtocolsOrDefault(), []string{"udp"}):
+		t.Fatalf("syslog protocols mismatch: got %v", sl.ProtocolsOrDefault())
+	case sl.DatabaseString() != "syslog":
+		t.Fatalf("syslog database mismatch: expected %v, got %v", "syslog", sl.DatabaseString())
+	case sl.RetentionPolicy != "raw":
+		t.Fatalf("syslog retention policy mismatch: expected %v, got %v", "raw", sl.RetentionPolicy)
+	case sl.MeasurementString() != syslog.DefaultMeasurement:
+		t.Fatalf("syslog measurement mismatch: expected %v, got %v", syslog.DefaultMeasurement, sl.MeasurementString())
+	case sl.BatchSizeOrDefault() != influxdb.DefaultBatchSize:
+		t.Fatalf("syslog batch size mismatch: expected %v, got %v", influxdb.DefaultBatchSize, sl.BatchSizeOrDefault())
+	}
+
+	if rules := c.PipelineRules(); !reflect.DeepEqual(rules, []influxdb.Rule{
+		{Name: "fix-host", Action: influxdb.RuleRenameTag, Pattern: "^hostname$", Value: "host"},
+		{Action: influxdb.RuleDropPoint, Measurement: "^debug_", Pattern: "."},
+	}) {
+		t.Fatalf("pipeline rules mismatch: %#v", rules)
 	}
 
 	if c.Admin.Enabled != true {
@@ -204,6 +364,16 @@ func TestParseConfig(t *testing.T) {
 		t.Fatalf("graphite tcp name-position mismatch: expected %v, got %v", "last", tcpGraphite.NamePosition)
 	case tcpGraphite.NameSeparatorString() != "-":
 		t.Fatalf("graphite tcp name-separator mismatch: expected %v, got %v", "-", tcpGraphite.NameSeparatorString())
+	case !reflect.DeepEqual(tcpGraphite.Templates, []string{"servers.* .host.measurement.field", "measurement*"}):
+		t.Fatalf("graphite tcp templates mismatch: got %v", tcpGraphite.Templates)
+	case !reflect.DeepEqual(tcpGraphite.Tags, []string{"region=us-east"}):
+		t.Fatalf("graphite tcp tags mismatch: got %v", tcpGraphite.Tags)
+	case tcpGraphite.RetentionPolicy != "raw":
+		t.Fatalf("graphite tcp retention-policy mismatch: expected %v, got %v", "raw", tcpGraphite.RetentionPolicy)
+	case tcpGraphite.BatchSizeOrDefault() != 500:
+		t.Fatalf("graphite tcp batch-size mismatch: expected %v, got %v", 500, tcpGraphite.BatchSizeOrDefault())
+	case tcpGraphite.BatchTimeoutOrDefault() != 2*time.Second:
+		t.Fatalf("graphite tcp batch-timeout mismatch: expected %v, got %v", 2*time.Second, tcpGraphite.BatchTimeoutOrDefault())
 	}
 
 	udpGraphite := c.Graphites[1]
@@ -231,6 +401,14 @@ func TestParseConfig(t *testing.T) {
 		t.Errorf("collectdabase mismatch: expected %v, got %v", "collectd_database", c.Collectd.Database)
 	case c.Collectd.TypesDB != "foo-db-type":
 		t.Errorf("collectd typesdb mismatch: expected %v, got %v", "foo-db-type", c.Collectd.TypesDB)
+	case c.Collectd.SecurityLevel != "sign":
+		t.Errorf("collectd security-level mismatch: expected %v, got %v", "sign", c.Collectd.SecurityLevel)
+	case c.Collectd.AuthFile != "/etc/collectd/auth_file":
+		t.Errorf("collectd auth-file mismatch: expected %v, got %v", "/etc/collectd/auth_file", c.Collectd.AuthFile)
+	case !reflect.DeepEqual(c.Collectd.TypesDBList(), []string{"foo-db-type", "/etc/collectd/types.d"}):
+		t.Errorf("collectd typesdb paths mismatch: got %v", c.Collectd.TypesDBList())
+	case c.Collectd.ParseMultiValueOrDefault() != "join":
+		t.Errorf("collectd parse-multivalue mismatch: expected %v, got %v", "join", c.Collectd.ParseMultiValueOrDefault())
 	}
 
 	switch {
@@ -242,6 +420,10 @@ func TestParseConfig(t *testing.T) {
 		t.Errorf("opentsdb database mismatch: expected %v, got %v", "opentsdb_database", c.OpenTSDB.DatabaseString())
 	case c.OpenTSDB.RetentionPolicy != "raw":
 		t.Errorf("collectd retention-policy mismatch: expected %v, got %v", "foo-db-type", c.OpenTSDB.RetentionPolicy)
+	case c.OpenTSDB.BatchSizeOrDefault() != 200:
+		t.Errorf("opentsdb batch-size mismatch: expected %v, got %v", 200, c.OpenTSDB.BatchSizeOrDefault())
+	case c.OpenTSDB.BatchTimeoutOrDefault() != influxdb.DefaultBatchTimeout:
+		t.Errorf("opentsdb batch-timeout mismatch: expected %v, got %v", influxdb.DefaultBatchTimeout, c.OpenTSDB.BatchTimeoutOrDefault())
 	}
 
 	if c.Broker.Dir != "/tmp/influxdb/development/broker" {
@@ -262,10 +444,44 @@ func TestParseConfig(t *testing.T) {
 		t.Fatalf("Retention check period mismatch: %v", c.Data.RetentionCheckPeriod)
 	}
 
+	if c.Data.CacheMaxSize != main.Size(20*(1<<20)) {
+		t.Fatalf("cache max size mismatch: %v", c.Data.CacheMaxSize)
+	} else if c.Data.CacheFlushInterval != main.Duration(30*time.Second) {
+		t.Fatalf("cache flush interval mismatch: %v", c.Data.CacheFlushInterval)
+	}
+
+	if c.Data.MaxSeriesPerDatabase != 5000 {
+		t.Fatalf("max series per database mismatch: %v", c.Data.MaxSeriesPerDatabase)
+	} else if c.Data.MaxValuesPerTag != 0 {
+		t.Fatalf("max values per tag mismatch: %v", c.Data.MaxValuesPerTag)
+	}
+
+	if c.Data.CompactionEnabled != false {
+		t.Fatalf("compaction enabled mismatch: %v", c.Data.CompactionEnabled)
+	} else if c.Data.CompactionCheckPeriod != main.Duration(30*time.Minute) {
+		t.Fatalf("compaction check period mismatch: %v", c.Data.CompactionCheckPeriod)
+	} else if c.Data.CompactionColdAfter != main.Duration(2*time.Hour) {
+		t.Fatalf("compaction cold after mismatch: %v", c.Data.CompactionColdAfter)
+	} else if c.Data.CompactionRecompress != false {
+		t.Fatalf("compaction recompress mismatch: %v", c.Data.CompactionRecompress)
+	}
+
 	if c.Data.Enabled != false {
 		t.Fatalf("data disabled mismatch: %v, got: %v", false, c.Data.Enabled)
 	}
 
+	if !reflect.DeepEqual(c.Data.Tiers, []main.Tier{{Database: "metrics", RetentionPolicy: "default", MoveAfter: main.Duration(168 * time.Hour), ColdDir: "/mnt/cold/influxdb"}}) {
+		t.Fatalf("data tiers mismatch: %#v", c.Data.Tiers)
+	}
+
+	if !reflect.DeepEqual(c.Data.LastValueCaches, []main.LastValueCache{{Database: "metrics", Measurement: "cpu"}}) {
+		t.Fatalf("data last value caches mismatch: %#v", c.Data.LastValueCaches)
+	}
+
+	if !reflect.DeepEqual(c.Data.Engines, []main.Engine{{Database: "metrics", RetentionPolicy: "default", Name: "bolt"}}) {
+		t.Fatalf("data engines mismatch: %#v", c.Data.Engines)
+	}
+
 	if c.Monitoring.WriteInterval.String() != "1m0s" {
 		t.Fatalf("Monitoring.WriteInterval mismatch: %v", c.Monitoring.WriteInterval)
 	}
@@ -273,14 +489,6 @@ func TestParseConfig(t *testing.T) {
 	if !c.Snapshot.Enabled {
 		t.Fatalf("snapshot enabled mismatch: %v, got %v", true, c.Snapshot.Enabled)
 	}
-
-	// TODO: UDP Servers testing.
-	/*
-		c.Assert(config.UdpServers, HasLen, 1)
-		c.Assert(config.UdpServers[0].Enabled, Equals, true)
-		c.Assert(config.UdpServers[0].Port, Equals, 4444)
-		c.Assert(config.UdpServers[0].Database, Equals, "test")
-	*/
 }
 
 func TestEncodeConfig(t *testing.T) {
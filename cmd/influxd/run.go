@@ -21,7 +21,10 @@ import (
 	"github.com/influxdb/influxdb/graphite"
 	"github.com/influxdb/influxdb/messaging"
 	"github.com/influxdb/influxdb/opentsdb"
+	"github.com/influxdb/influxdb/prometheus"
 	"github.com/influxdb/influxdb/raft"
+	"github.com/influxdb/influxdb/statsd"
+	"github.com/influxdb/influxdb/syslog"
 	"github.com/influxdb/influxdb/udp"
 )
 
@@ -45,10 +48,14 @@ type Node struct {
 	raftLog  *raft.Log
 
 	adminServer     *admin.Server
-	clusterListener net.Listener      // The cluster TCP listener
-	apiListener     net.Listener      // The API TCP listener
-	GraphiteServers []graphite.Server // The Graphite Servers
-	OpenTSDBServer  *opentsdb.Server  // The OpenTSDB Server
+	clusterListener net.Listener        // The cluster TCP listener
+	apiListener     net.Listener        // The API TCP listener
+	GraphiteServers []graphite.Server   // The Graphite Servers
+	OpenTSDBServer  *opentsdb.Server    // The OpenTSDB Server
+	UDPServers      []*udp.UDPServer    // The UDP Servers
+	StatsDServers   []*statsd.Server    // The StatsD Servers
+	PromScraper     *prometheus.Scraper // The Prometheus scraper
+	SyslogServer    *syslog.Server      // The syslog server
 }
 
 func (s *Node) ClusterAddr() net.Addr {
@@ -96,6 +103,30 @@ func (s *Node) Close() error {
 		}
 	}
 
+	for _, u := range s.UDPServers {
+		if err := u.Close(); err != nil {
+			return err
+		}
+	}
+
+	for _, sd := range s.StatsDServers {
+		if err := sd.Close(); err != nil {
+			return err
+		}
+	}
+
+	if s.PromScraper != nil {
+		if err := s.PromScraper.Close(); err != nil {
+			return err
+		}
+	}
+
+	if s.SyslogServer != nil {
+		if err := s.SyslogServer.Close(); err != nil {
+			return err
+		}
+	}
+
 	if s.DataNode != nil {
 		if err := s.DataNode.Close(); err != nil {
 			return err
@@ -304,6 +335,12 @@ func (cmd *RunCommand) CheckConfig() {
 	if cmd.config.Data.Enabled && cmd.config.Data.Dir == "" {
 		log.Fatal("Data.Dir must be specified.  Run `influxd config` to generate a valid configuration.")
 	}
+
+	for _, u := range cmd.config.UDPs {
+		if u.Enabled && u.Database == "" {
+			log.Fatal("UDP database must be specified for each enabled UDP listener.")
+		}
+	}
 }
 
 func (cmd *RunCommand) Open(config *Config, join string) *Node {
@@ -350,6 +387,33 @@ func (cmd *RunCommand) Open(config *Config, join string) *Node {
 			log.Printf("broker enforcing retention policies with check interval of %s", interval)
 		}
 
+		// Enable compaction of cold shards if requested.
+		if cmd.config.Data.CompactionEnabled {
+			interval := time.Duration(cmd.config.Data.CompactionCheckPeriod)
+			coldAfter := time.Duration(cmd.config.Data.CompactionColdAfter)
+			if err := s.StartShardCompaction(interval, coldAfter, cmd.config.Data.CompactionRecompress); err != nil {
+				log.Fatalf("shard compaction failed: %s", err.Error())
+			}
+			log.Printf("compacting shards without writes for %s, check interval of %s", coldAfter, interval)
+		}
+
+		// Set the storage engine of retention policies.
+		for _, e := range cmd.config.Data.Engines {
+			rp, err := s.RetentionPolicy(e.Database, e.RetentionPolicy)
+			if err != nil || rp == nil {
+				log.Printf("retention policy %s.%s not found, ignoring engine %s", e.Database, e.RetentionPolicy, e.Name)
+				continue
+			} else if rp.Engine == e.Name {
+				continue
+			}
+
+			name := e.Name
+			if err := s.UpdateRetentionPolicy(e.Database, e.RetentionPolicy, &influxdb.RetentionPolicyUpdate{Engine: &name}); err != nil {
+				log.Fatalf("failed to set engine of retention policy %s.%s: %s", e.Database, e.RetentionPolicy, err.Error())
+			}
+			log.Printf("retention policy %s.%s using engine %s for new shards", e.Database, e.RetentionPolicy, e.Name)
+		}
+
 		// Start shard group pre-create
 		interval := cmd.config.ShardGroupPreCreateCheckPeriod()
 		if err := s.StartShardGroupsPreCreate(interval); err != nil {
@@ -377,22 +441,102 @@ func (cmd *RunCommand) Open(config *Config, join string) *Node {
 		// Spin up the collectd server
 		if cmd.config.Collectd.Enabled {
 			c := cmd.config.Collectd
-			cs := collectd.NewServer(s, c.TypesDB)
+			cs := collectd.NewServer(s, c.TypesDBList()...)
 			cs.Database = c.Database
-			err := collectd.ListenAndServe(cs, c.ConnectionString(cmd.config.BindAddress))
+			cs.AuthFile = c.AuthFile
+			cs.ParseMultiValue = c.ParseMultiValueOrDefault()
+			cs.BatchSize = c.BatchSizeOrDefault()
+			cs.BatchTimeout = c.BatchTimeoutOrDefault()
+			level, err := collectd.ParseSecurityLevel(c.SecurityLevel)
+			if err != nil {
+				log.Fatalf("failed to configure collectd Server: %s", err.Error())
+			}
+			cs.SecurityLevel = level
+			err = collectd.ListenAndServe(cs, c.ConnectionString(cmd.config.BindAddress))
 			if err != nil {
 				log.Printf("failed to start collectd Server: %v\n", err.Error())
 			}
+			s.RegisterStats(cs.Stats())
 		}
 
-		// Start the server bound to a UDP listener
-		if cmd.config.UDP.Enabled {
-			log.Printf("Starting UDP listener on %s", cmd.config.APIAddrUDP())
-			u := udp.NewUDPServer(s)
-			if err := u.ListenAndServe(cmd.config.APIAddrUDP()); err != nil {
-				log.Printf("Failed to start UDP listener on %s: %s", cmd.config.APIAddrUDP(), err)
+		// Spin up any UDP listeners
+		for _, udpConfig := range cmd.config.UDPs {
+			if !udpConfig.Enabled {
+				continue
+			}
+
+			addr := udpConfig.ConnectionString(cmd.config.BindAddress)
+			if err := s.CreateDatabaseIfNotExists(udpConfig.Database); err != nil {
+				log.Fatalf("failed to create database for UDP listener on %s: %s", addr, err.Error())
+			}
+
+			if policy := udpConfig.RetentionPolicy; policy != "" {
+				// Ensure retention policy exists.
+				rp := influxdb.NewRetentionPolicy(policy)
+				if err := s.CreateRetentionPolicyIfNotExists(udpConfig.Database, rp); err != nil {
+					log.Fatalf("failed to create retention policy for UDP listener on %s: %s", addr, err.Error())
+				}
+			}
+
+			u := udp.NewUDPServer(s, udpConfig.Database, udpConfig.RetentionPolicy)
+			u.Precision = udpConfig.Precision
+			u.BatchSize = udpConfig.BatchSizeOrDefault()
+			u.BatchTimeout = udpConfig.BatchTimeoutOrDefault()
+
+			log.Printf("Starting UDP listener on %s", addr)
+			if err := u.ListenAndServe(addr); err != nil {
+				log.Printf("Failed to start UDP listener on %s: %s", addr, err)
+				continue
+			}
+			cmd.node.UDPServers = append(cmd.node.UDPServers, u)
+		}
+
+		// Spin up any StatsD servers
+		for _, statsdConfig := range cmd.config.StatsDs {
+			if !statsdConfig.Enabled {
+				continue
+			}
+
+			addr := statsdConfig.ConnectionString(cmd.config.BindAddress)
+			db := statsdConfig.DatabaseString()
+			if err := s.CreateDatabaseIfNotExists(db); err != nil {
+				log.Fatalf("failed to create database for StatsD server on %s: %s", addr, err.Error())
+			}
+
+			if policy := statsdConfig.RetentionPolicy; policy != "" {
+				// Ensure retention policy exists.
+				rp := influxdb.NewRetentionPolicy(policy)
+				if err := s.CreateRetentionPolicyIfNotExists(db, rp); err != nil {
+					log.Fatalf("failed to create retention policy for StatsD server on %s: %s", addr, err.Error())
+				}
+			}
+
+			// Bucket names are parsed like Graphite paths, using the whole
+			// name as the measurement if no templates are set.
+			templates := statsdConfig.Templates
+			if len(templates) == 0 {
+				templates = []string{"measurement*"}
+			}
+			parser := graphite.NewParser()
+			if err := parser.SetTemplates(templates); err != nil {
+				log.Fatalf("failed to parse templates for StatsD server on %s: %s", addr, err.Error())
+			}
+			if err := parser.SetDefaultTags(statsdConfig.Tags); err != nil {
+				log.Fatalf("failed to parse tags for StatsD server on %s: %s", addr, err.Error())
 			}
 
+			sd := statsd.NewServer(s, parser)
+			sd.Database = db
+			sd.RetentionPolicy = statsdConfig.RetentionPolicy
+			sd.FlushInterval = statsdConfig.FlushIntervalOrDefault()
+			sd.Percentiles = statsdConfig.PercentilesOrDefault()
+
+			log.Printf("Starting StatsD server on %s", addr)
+			if err := sd.ListenAndServe(addr); err != nil {
+				log.Fatalf("failed to start StatsD server on %s: %s", addr, err.Error())
+			}
+			s.RegisterStats(sd.Stats())
+			cmd.node.StatsDServers = append(cmd.node.StatsDServers, sd)
 		}
 
 		// Spin up any Graphite servers
@@ -405,22 +549,41 @@ func (cmd *RunCommand) Open(config *Config, join string) *Node {
 			parser := graphite.NewParser()
 			parser.Separator = graphiteConfig.NameSeparatorString()
 			parser.LastEnabled = graphiteConfig.LastEnabled()
+			if len(graphiteConfig.Templates) > 0 {
+				if err := parser.SetTemplates(graphiteConfig.Templates); err != nil {
+					log.Fatalf("failed to parse templates for %s Graphite server: %s", graphiteConfig.Protocol, err.Error())
+				}
+			}
+			if err := parser.SetDefaultTags(graphiteConfig.Tags); err != nil {
+				log.Fatalf("failed to parse tags for %s Graphite server: %s", graphiteConfig.Protocol, err.Error())
+			}
 
-			if err := s.CreateDatabaseIfNotExists(graphiteConfig.DatabaseString()); err != nil {
+			db := graphiteConfig.DatabaseString()
+			if err := s.CreateDatabaseIfNotExists(db); err != nil {
 				log.Fatalf("failed to create database for %s Graphite server: %s", graphiteConfig.Protocol, err.Error())
 			}
 
+			if policy := graphiteConfig.RetentionPolicy; policy != "" {
+				// Ensure retention policy exists.
+				rp := influxdb.NewRetentionPolicy(policy)
+				if err := s.CreateRetentionPolicyIfNotExists(db, rp); err != nil {
+					log.Fatalf("failed to create retention policy for %s Graphite server: %s", graphiteConfig.Protocol, err.Error())
+				}
+			}
+
 			// Spin up the server.
 			var g graphite.Server
-			g, err := graphite.NewServer(graphiteConfig.Protocol, parser, s, graphiteConfig.DatabaseString())
+			g, err := graphite.NewServer(graphiteConfig.Protocol, parser, s, db, graphiteConfig.RetentionPolicy)
 			if err != nil {
 				log.Fatalf("failed to initialize %s Graphite server: %s", graphiteConfig.Protocol, err.Error())
 			}
+			g.SetBatching(graphiteConfig.BatchSizeOrDefault(), graphiteConfig.BatchTimeoutOrDefault())
 
 			err = g.ListenAndServe(graphiteConfig.ConnectionString())
 			if err != nil {
 				log.Fatalf("failed to start %s Graphite server: %s", graphiteConfig.Protocol, err.Error())
 			}
+			s.RegisterStats(g.Stats())
 			cmd.node.GraphiteServers = append(cmd.node.GraphiteServers, g)
 		}
 
@@ -444,12 +607,89 @@ func (cmd *RunCommand) Open(config *Config, join string) *Node {
 			}
 
 			os := opentsdb.NewServer(s, policy, db)
+			os.BatchSize = o.BatchSizeOrDefault()
+			os.BatchTimeout = o.BatchTimeoutOrDefault()
+			s.RegisterStats(os.Stats())
 
 			log.Println("Starting OpenTSDB service on", laddr)
 			go os.ListenAndServe(laddr)
 			cmd.node.OpenTSDBServer = os
 		}
 
+		// Start scraping Prometheus targets
+		if cmd.config.Prometheus.Enabled {
+			p := cmd.config.Prometheus
+			db := p.DatabaseString()
+			if err := s.CreateDatabaseIfNotExists(db); err != nil {
+				log.Fatalf("failed to create database for Prometheus scraper: %s", err.Error())
+			}
+
+			if policy := p.RetentionPolicy; policy != "" {
+				// Ensure retention policy exists.
+				rp := influxdb.NewRetentionPolicy(policy)
+				if err := s.CreateRetentionPolicyIfNotExists(db, rp); err != nil {
+					log.Fatalf("failed to create retention policy for Prometheus scraper: %s", err.Error())
+				}
+			}
+
+			ps := prometheus.NewScraper(s)
+			ps.Targets = p.Targets
+			ps.Database = db
+			ps.RetentionPolicy = p.RetentionPolicy
+			ps.Interval = p.IntervalOrDefault()
+			ps.Timeout = p.TimeoutOrDefault()
+
+			log.Printf("Starting Prometheus scraper for %d targets", len(p.Targets))
+			if err := ps.Open(); err != nil {
+				log.Fatalf("failed to start Prometheus scraper: %s", err.Error())
+			}
+			s.RegisterStats(ps.Stats())
+			cmd.node.PromScraper = ps
+		}
+
+		// Start receiving syslog messages
+		if cmd.config.Syslog.Enabled {
+			sc := cmd.config.Syslog
+			addr := sc.ConnectionString(cmd.config.BindAddress)
+			db := sc.DatabaseString()
+			if err := s.CreateDatabaseIfNotExists(db); err != nil {
+				log.Fatalf("failed to create database for syslog server on %s: %s", addr, err.Error())
+			}
+
+			if policy := sc.RetentionPolicy; policy != "" {
+				// Ensure retention policy exists.
+				rp := influxdb.NewRetentionPolicy(policy)
+				if err := s.CreateRetentionPolicyIfNotExists(db, rp); err != nil {
+					log.Fatalf("failed to create retention policy for syslog server on %s: %s", addr, err.Error())
+				}
+			}
+
+			ss := syslog.NewServer(s)
+			ss.Database = db
+			ss.RetentionPolicy = sc.RetentionPolicy
+			ss.Measurement = sc.MeasurementString()
+			ss.BatchSize = sc.BatchSizeOrDefault()
+			ss.BatchTimeout = sc.BatchTimeoutOrDefault()
+
+			for _, protocol := range sc.ProtocolsOrDefault() {
+				var err error
+				switch strings.ToLower(protocol) {
+				case "tcp":
+					err = ss.ListenAndServeTCP(addr)
+				case "udp":
+					err = ss.ListenAndServeUDP(addr)
+				default:
+					log.Fatalf("unrecognized syslog protocol: %s", protocol)
+				}
+				if err != nil {
+					log.Fatalf("failed to start %s syslog server on %s: %s", protocol, addr, err.Error())
+				}
+				log.Printf("Starting %s syslog server on %s", protocol, addr)
+			}
+			s.RegisterStats(ss.Stats())
+			cmd.node.SyslogServer = ss
+		}
+
 		// Start up self-monitoring if enabled.
 		if cmd.config.Monitoring.Enabled {
 			database := monitoringDatabase
@@ -627,9 +867,33 @@ func (cmd *RunCommand) openServer(joinURLs []url.URL) *influxdb.Server {
 	s.RecomputeNoOlderThan = time.Duration(cmd.config.ContinuousQuery.RecomputeNoOlderThan)
 	s.ComputeRunsPerInterval = cmd.config.ContinuousQuery.ComputeRunsPerInterval
 	s.ComputeNoMoreThan = time.Duration(cmd.config.ContinuousQuery.ComputeNoMoreThan)
+	s.ShardCacheMaxSize = int(cmd.config.Data.CacheMaxSize)
+	s.ShardCacheFlushInterval = time.Duration(cmd.config.Data.CacheFlushInterval)
+	s.MaxSeriesPerDatabase = cmd.config.Data.MaxSeriesPerDatabase
+	s.MaxValuesPerTag = cmd.config.Data.MaxValuesPerTag
 	s.Version = version
 	s.CommitHash = commit
 
+	// Rewrite and filter points from all inputs before they are written.
+	if rules := cmd.config.PipelineRules(); len(rules) > 0 {
+		p, err := influxdb.NewPipeline(rules)
+		if err != nil {
+			log.Fatalf("failed to create pipeline: %s", err.Error())
+		}
+		s.SetPipeline(p)
+	}
+
+	// Cache the latest points of measurements queried with last().
+	for _, c := range cmd.config.Data.LastValueCaches {
+		s.EnableLastValueCache(c.Database, c.Measurement)
+	}
+
+	// Move old shards of retention policies to this node's cold tier directories.
+	for _, t := range cmd.config.Data.Tiers {
+		s.EnableColdTier(t.Database, t.RetentionPolicy, time.Duration(t.MoveAfter), t.ColdDir)
+		log.Printf("retention policy %s.%s moving shards to %s after %s", t.Database, t.RetentionPolicy, t.ColdDir, time.Duration(t.MoveAfter))
+	}
+
 	// Open server with data directory and broker client.
 	if err := s.Open(cmd.config.Data.Dir, c); err != nil {
 		log.Fatalf("failed to open data node: %v", err.Error())
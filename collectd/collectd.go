@@ -3,8 +3,11 @@ package collectd
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -12,8 +15,21 @@ import (
 	"github.com/kimor79/gollectd"
 )
 
-// DefaultPort for collectd is 25826
-const DefaultPort = 25826
+const (
+	// DefaultPort for collectd is 25826
+	DefaultPort = 25826
+)
+
+// Modes for mapping the values of a packet onto points.
+const (
+	// MultiValueSplit stores each value as its own measurement, named after
+	// the plugin and the data source.
+	MultiValueSplit = "split"
+
+	// MultiValueJoin stores all values of a packet as fields of a single
+	// point, named after the plugin, with a field per data source.
+	MultiValueJoin = "join"
+)
 
 // SeriesWriter defines the interface for the destination of the data.
 type SeriesWriter interface {
@@ -23,29 +39,61 @@ type SeriesWriter interface {
 // Server represents a UDP server which receives metrics in collectd's binary
 // protocol and stores them in InfluxDB.
 type Server struct {
-	wg   sync.WaitGroup
-	done chan struct{}
+	wg      sync.WaitGroup
+	done    chan struct{}
+	writing sync.WaitGroup // batch writer
+	stop    chan struct{}  // stops the batch writer
+
+	conn    *net.UDPConn
+	batcher *influxdb.PointBatcher
+
+	writer       SeriesWriter
+	Database     string
+	typesdb      gollectd.Types
+	typesdbpaths []string
+	passwords    map[string]string
+	stats        *influxdb.Stats
 
-	conn *net.UDPConn
+	// Points are buffered until BatchSize points are received or
+	// BatchTimeout has passed since the first buffered point.
+	BatchSize    int
+	BatchTimeout time.Duration
 
-	writer      SeriesWriter
-	Database    string
-	typesdb     gollectd.Types
-	typesdbpath string
+	// ParseMultiValue is either MultiValueSplit or MultiValueJoin and
+	// determines how values are mapped onto points.
+	ParseMultiValue string
+
+	// SecurityLevel is the minimum security level of accepted packets.
+	SecurityLevel SecurityLevel
+
+	// AuthFile is the path of a collectd auth file containing the passwords
+	// used to verify signed packets and decrypt encrypted packets.
+	AuthFile string
 }
 
-// NewServer constructs a new Server.
-func NewServer(w SeriesWriter, typesDBPath string) *Server {
+// NewServer constructs a new Server. Each types.db path is either a file or
+// a directory of files, which are loaded in order.
+func NewServer(w SeriesWriter, typesDBPaths ...string) *Server {
 	s := Server{
-		done:        make(chan struct{}),
-		writer:      w,
-		typesdbpath: typesDBPath,
-		typesdb:     make(gollectd.Types),
+		done:            make(chan struct{}),
+		writer:          w,
+		typesdbpaths:    typesDBPaths,
+		typesdb:         make(gollectd.Types),
+		stats:           influxdb.NewStats("collectd"),
+		BatchSize:       influxdb.DefaultBatchSize,
+		BatchTimeout:    influxdb.DefaultBatchTimeout,
+		ParseMultiValue: MultiValueSplit,
 	}
 
 	return &s
 }
 
+// Stats returns the counters for packets received, packets rejected by the
+// security checks and parse failures.
+func (s *Server) Stats() *influxdb.Stats {
+	return s.stats
+}
+
 // ListenAndServe starts starts receiving collectd metrics via UDP and writes
 // the received data points into the server's SeriesWriter. The serving
 // goroutine is only stopped when s.Close() is called, but ListenAndServe
@@ -62,23 +110,82 @@ func ListenAndServe(s *Server, iface string) error {
 		return fmt.Errorf("unable to resolve UDP address: %v", err)
 	}
 
-	s.typesdb, err = gollectd.TypesDBFile(s.typesdbpath)
+	switch s.ParseMultiValue {
+	case MultiValueSplit, MultiValueJoin:
+	default:
+		return fmt.Errorf("invalid multi-value mode: %s", s.ParseMultiValue)
+	}
+
+	s.typesdb, err = loadTypesDB(s.typesdbpaths)
 	if err != nil {
 		return fmt.Errorf("unable to parse typesDBFile: %v", err)
 	}
 
+	if s.AuthFile != "" {
+		s.passwords, err = ParseAuthFile(s.AuthFile)
+		if err != nil {
+			return fmt.Errorf("unable to parse auth file: %v", err)
+		}
+	} else if s.SecurityLevel != SecurityLevelNone {
+		return ErrAuthFileRequired
+	}
+
 	conn, err := net.ListenUDP("udp", addr)
 	if err != nil {
 		return fmt.Errorf("unable to listen on UDP: %v", err)
 	}
 	s.conn = conn
 
+	s.batcher = influxdb.NewPointBatcher(s.BatchSize, s.BatchTimeout)
+	s.batcher.Start()
+	s.stop = make(chan struct{})
+	s.writing.Add(1)
+	go s.writePoints()
+
 	s.wg.Add(1)
 	go s.serve()
 
 	return nil
 }
 
+// loadTypesDB loads and merges the types.db files at the given paths. Every
+// file in a directory is loaded, in name order. Types defined by later files
+// replace earlier definitions.
+func loadTypesDB(paths []string) (gollectd.Types, error) {
+	types := make(gollectd.Types)
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		files := []string{path}
+		if fi.IsDir() {
+			infos, err := ioutil.ReadDir(path)
+			if err != nil {
+				return nil, err
+			}
+			files = files[:0]
+			for _, info := range infos {
+				if !info.IsDir() {
+					files = append(files, filepath.Join(path, info.Name()))
+				}
+			}
+		}
+
+		for _, file := range files {
+			t, err := gollectd.TypesDBFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", file, err)
+			}
+			for name, ds := range t {
+				types[name] = ds
+			}
+		}
+	}
+	return types, nil
+}
+
 func (s *Server) serve() {
 	defer s.wg.Done()
 
@@ -113,24 +220,43 @@ func (s *Server) serve() {
 }
 
 func (s *Server) handleMessage(buffer []byte) {
+	s.stats.Inc("packetsRx")
+
+	buffer, err := openPacket(buffer, s.SecurityLevel, s.passwords)
+	if err != nil {
+		s.stats.Inc("packetsRejected")
+		log.Printf("Collectd packet rejected: %s", err)
+		return
+	}
+
 	packets, err := gollectd.Packets(buffer, s.typesdb)
 	if err != nil {
+		s.stats.Inc("parseFail")
 		log.Printf("Collectd parse error: %s", err)
 		return
 	}
 
 	for _, packet := range *packets {
-		points := Unmarshal(&packet)
+		var points []influxdb.Point
+		if s.ParseMultiValue == MultiValueJoin {
+			points = UnmarshalJoined(&packet)
+		} else {
+			points = Unmarshal(&packet)
+		}
+
+		s.stats.Add("pointsRx", int64(len(points)))
 		for _, p := range points {
-			_, err := s.writer.WriteSeries(s.Database, "", []influxdb.Point{p})
-			if err != nil {
-				log.Printf("Collectd cannot write data: %s", err)
-				continue
-			}
+			s.batcher.In() <- p
 		}
 	}
 }
 
+// writePoints writes batches emitted by the batcher until the server is closed.
+func (s *Server) writePoints() {
+	defer s.writing.Done()
+	influxdb.WriteBatches(s.batcher, s.writer, s.Database, "", s.stats, log.New(os.Stderr, "", log.LstdFlags), s.stop)
+}
+
 // Close shuts down the server's listeners.
 func (s *Server) Close() error {
 	if s.conn == nil {
@@ -142,52 +268,34 @@ func (s *Server) Close() error {
 	close(s.done)
 	s.wg.Wait()
 
+	// Flush the remaining points before stopping the writer.
+	s.batcher.Stop()
+	close(s.stop)
+	s.writing.Wait()
+
 	// Release all remaining resources.
 	s.done = nil
 	s.conn = nil
+	s.batcher = nil
 	log.Println("collectd UDP closed")
 	return nil
 }
 
-// Unmarshal translates a collectd packet into InfluxDB data points.
+// Unmarshal translates a collectd packet into InfluxDB data points, one per value.
 func Unmarshal(data *gollectd.Packet) []influxdb.Point {
-	// Prefer high resolution timestamp.
-	var timestamp time.Time
-	if data.TimeHR > 0 {
-		// TimeHR is "near" nanosecond measurement, but not exactly nanasecond time
-		// Since we store time in microseconds, we round here (mostly so tests will work easier)
-		sec := data.TimeHR >> 30
-		// Shifting, masking, and dividing by 1 billion to get nanoseconds.
-		nsec := ((data.TimeHR & 0x3FFFFFFF) << 30) / 1000 / 1000 / 1000
-		timestamp = time.Unix(int64(sec), int64(nsec)).UTC().Round(time.Microsecond)
-	} else {
-		// If we don't have high resolution time, fall back to basic unix time
-		timestamp = time.Unix(int64(data.Time), 0).UTC()
-	}
+	timestamp := packetTime(data)
+	tags := packetTags(data)
 
 	var points []influxdb.Point
 	for i := range data.Values {
 		name := fmt.Sprintf("%s_%s", data.Plugin, data.Values[i].Name)
-		tags := make(map[string]string)
 		fields := make(map[string]interface{})
 
 		fields[name] = data.Values[i].Value
 
-		if data.Hostname != "" {
-			tags["host"] = data.Hostname
-		}
-		if data.PluginInstance != "" {
-			tags["instance"] = data.PluginInstance
-		}
-		if data.Type != "" {
-			tags["type"] = data.Type
-		}
-		if data.TypeInstance != "" {
-			tags["type_instance"] = data.TypeInstance
-		}
 		p := influxdb.Point{
 			Name:      name,
-			Tags:      tags,
+			Tags:      copyTags(tags),
 			Timestamp: timestamp,
 			Fields:    fields,
 		}
@@ -196,3 +304,71 @@ func Unmarshal(data *gollectd.Packet) []influxdb.Point {
 	}
 	return points
 }
+
+// UnmarshalJoined translates a collectd packet into a single InfluxDB data
+// point named after the plugin, with a field per value named after its data
+// source. For example, the rx and tx values of the interface plugin's
+// if_octets type are stored together. No point is returned for a packet
+// without values.
+func UnmarshalJoined(data *gollectd.Packet) []influxdb.Point {
+	if len(data.Values) == 0 {
+		return nil
+	}
+
+	fields := make(map[string]interface{})
+	for _, v := range data.Values {
+		fields[v.Name] = v.Value
+	}
+
+	return []influxdb.Point{{
+		Name:      data.Plugin,
+		Tags:      packetTags(data),
+		Timestamp: packetTime(data),
+		Fields:    fields,
+	}}
+}
+
+// packetTime returns the timestamp of a packet.
+func packetTime(data *gollectd.Packet) time.Time {
+	// Prefer high resolution timestamp.
+	var timestamp time.Time
+	if data.TimeHR > 0 {
+		// TimeHR is "near" nanosecond measurement, but not exactly nanasecond time
+		// Since we store time in microseconds, we round here (mostly so tests will work easier)
+		sec := data.TimeHR >> 30
+		// Shifting, masking, and dividing by 1 billion to get nanoseconds.
+		nsec := ((data.TimeHR & 0x3FFFFFFF) << 30) / 1000 / 1000 / 1000
+		timestamp = time.Unix(int64(sec), int64(nsec)).UTC().Round(time.Microsecond)
+	} else {
+		// If we don't have high resolution time, fall back to basic unix time
+		timestamp = time.Unix(int64(data.Time), 0).UTC()
+	}
+	return timestamp
+}
+
+// packetTags returns the tags identifying the source of a packet's values.
+func packetTags(data *gollectd.Packet) map[string]string {
+	tags := make(map[string]string)
+	if data.Hostname != "" {
+		tags["host"] = data.Hostname
+	}
+	if data.PluginInstance != "" {
+		tags["instance"] = data.PluginInstance
+	}
+	if data.Type != "" {
+		tags["type"] = data.Type
+	}
+	if data.TypeInstance != "" {
+		tags["type_instance"] = data.TypeInstance
+	}
+	return tags
+}
+
+// copyTags returns a copy of tags.
+func copyTags(tags map[string]string) map[string]string {
+	other := make(map[string]string, len(tags))
+	for k, v := range tags {
+		other[k] = v
+	}
+	return other
+}
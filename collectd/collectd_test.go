@@ -1,9 +1,21 @@
 package collectd_test
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
@@ -158,6 +170,7 @@ func TestServer_Serve_Success(t *testing.T) {
 	)
 
 	s.Database = "counter"
+	s.BatchSize = 33
 	e := collectd.ListenAndServe(s, addr)
 	defer s.Close()
 	if e != nil {
@@ -178,11 +191,271 @@ func TestServer_Serve_Success(t *testing.T) {
 		t.Fatalf("err does not match.  expected %v, got %v", nil, e)
 	}
 
-	if _, err := ts.ResponseN(33); err != nil {
+	// All points are written in a single batch.
+	r, err := ts.ResponseN(1)
+	if err != nil {
 		t.Fatal(err)
+	} else if len(r[0].points) != 33 {
+		t.Fatalf("unexpected point count.  expected %d, got %d", 33, len(r[0].points))
 	}
 }
 
+func TestServer_Serve_TypesDBDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "collectd-types")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "a.db"), []byte("ps_state\t\tvalue:GAUGE:0:65535\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "b.db"), []byte("ps_state\t\tprocs:GAUGE:0:65535\n"), 0644)
+
+	var (
+		ts   testServer
+		s    = collectd.NewServer(ts, "./collectd_test.conf", dir)
+		addr = "127.0.0.1:25833"
+	)
+	s.Database = "counter"
+	s.BatchSize = 1
+	if err := collectd.ListenAndServe(s, addr); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	buf, _ := hex.DecodeString(testPacket)
+	conn.Write(buf)
+
+	// Later files replace the earlier definitions of a type.
+	r, err := ts.ResponseN(1)
+	if err != nil {
+		t.Fatal(err)
+	} else if name := r[0].points[0].Name; name != "processes_procs" {
+		t.Fatalf("unexpected name.  expected %q, got %q", "processes_procs", name)
+	}
+}
+
+func TestServer_ListenAndServe_ErrTypesDBPath(t *testing.T) {
+	var (
+		ts testServer
+		s  = collectd.NewServer(ts, "./collectd_test.conf", "./does-not-exist")
+	)
+
+	s.Database = "counter"
+	if e := collectd.ListenAndServe(s, "127.0.0.1:25834"); e == nil {
+		t.Fatalf("expected an error, got %v", e)
+	}
+}
+
+// testPacket is a collectd packet containing a single value.
+const testPacket = "0000000e6c6f63616c686f7374000008000c1512b2e40f5da16f0009000c00000002800000000002000e70726f636573736573000004000d70735f7374617465000005000c72756e6e696e67000006000f000101000000000000f03f"
+
+func TestServer_Serve_SecurityLevel(t *testing.T) {
+	authFile, err := ioutil.TempFile("", "collectd-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(authFile.Name())
+	authFile.WriteString("# collectd users\nalice: secret\nbob: hunter2\n")
+	authFile.Close()
+
+	plain, _ := hex.DecodeString(testPacket)
+
+	var tests = []struct {
+		name     string
+		level    collectd.SecurityLevel
+		packet   []byte
+		accepted bool
+	}{
+		{name: "none, plain", level: collectd.SecurityLevelNone, packet: plain, accepted: true},
+		{name: "none, signed", level: collectd.SecurityLevelNone, packet: signPacket(plain, "alice", "secret"), accepted: true},
+		{name: "none, bad signature", level: collectd.SecurityLevelNone, packet: signPacket(plain, "alice", "wrong")},
+		{name: "sign, plain", level: collectd.SecurityLevelSign, packet: plain},
+		{name: "sign, signed", level: collectd.SecurityLevelSign, packet: signPacket(plain, "bob", "hunter2"), accepted: true},
+		{name: "sign, unknown user", level: collectd.SecurityLevelSign, packet: signPacket(plain, "eve", "secret")},
+		{name: "sign, encrypted", level: collectd.SecurityLevelSign, packet: encryptPacket(plain, "alice", "secret"), accepted: true},
+		{name: "encrypt, signed", level: collectd.SecurityLevelEncrypt, packet: signPacket(plain, "alice", "secret")},
+		{name: "encrypt, encrypted", level: collectd.SecurityLevelEncrypt, packet: encryptPacket(plain, "bob", "hunter2"), accepted: true},
+		{name: "encrypt, bad password", level: collectd.SecurityLevelEncrypt, packet: encryptPacket(plain, "bob", "wrong")},
+		{name: "sign, signed with plain parts appended", level: collectd.SecurityLevelSign, packet: append(signPacket(plain, "bob", "hunter2"), plain...)},
+		{name: "sign, encrypted with plain parts appended", level: collectd.SecurityLevelSign, packet: append(encryptPacket(plain, "bob", "hunter2"), plain...)},
+		{name: "encrypt, encrypted with plain parts appended", level: collectd.SecurityLevelEncrypt, packet: append(encryptPacket(plain, "bob", "hunter2"), plain...)},
+	}
+
+	for _, tt := range tests {
+		var (
+			ts   testServer
+			s    = collectd.NewServer(ts, "./collectd_test.conf")
+			addr = "127.0.0.1:25831"
+		)
+		s.Database = "counter"
+		s.BatchSize = 1
+		s.SecurityLevel = tt.level
+		s.AuthFile = authFile.Name()
+		if err := collectd.ListenAndServe(s, addr); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+
+		conn, err := net.Dial("udp", addr)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+
+		// Follow the test packet with a valid one, so the test packet has been
+		// handled once the valid packet is written.
+		conn.Write(tt.packet)
+		conn.Write(encryptPacket(plain, "alice", "secret"))
+		conn.Close()
+
+		n := 1
+		if tt.accepted {
+			n = 2
+		}
+		if _, err := ts.ResponseN(n); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+
+		var rejected int64
+		if !tt.accepted {
+			rejected = 1
+		}
+		if v := s.Stats().Get("packetsRejected"); v != rejected {
+			t.Fatalf("%s: unexpected packetsRejected.  expected %d, got %d", tt.name, rejected, v)
+		}
+		s.Close()
+	}
+}
+
+// Ensure parts appended to an encrypted packet are not written.
+func TestServer_Serve_EncryptedPacketAppendedParts(t *testing.T) {
+	authFile, err := ioutil.TempFile("", "collectd-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(authFile.Name())
+	authFile.WriteString("alice: secret\n")
+	authFile.Close()
+
+	var (
+		ts   testServer
+		s    = collectd.NewServer(ts, "./collectd_test.conf")
+		addr = "127.0.0.1:25833"
+	)
+	s.Database = "counter"
+	s.BatchSize = 1
+	s.SecurityLevel = collectd.SecurityLevelEncrypt
+	s.AuthFile = authFile.Name()
+	if err := collectd.ListenAndServe(s, addr); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Append a plain value from another host to a captured encrypted packet.
+	plain, _ := hex.DecodeString(testPacket)
+	forged := append([]byte{}, plain...)
+	copy(forged[4:13], "attackers")
+	tampered := append(encryptPacket(plain, "alice", "secret"), forged...)
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write(tampered)
+	conn.Write(encryptPacket(plain, "alice", "secret"))
+	conn.Close()
+
+	// Only the point of the valid packet is written.
+	r, _ := ts.ResponseN(2)
+	if len(r) != 1 {
+		t.Fatalf("unexpected response count: expected: 1, actual: %d", len(r))
+	}
+	for _, p := range r[0].points {
+		if host := p.Tags["host"]; host != "localhost" {
+			t.Fatalf("unexpected point written from host %q", host)
+		}
+	}
+	if v := s.Stats().Get("packetsRejected"); v != 1 {
+		t.Fatalf("unexpected packetsRejected.  expected 1, got %d", v)
+	}
+}
+
+func TestServer_ListenAndServe_ErrAuthFileRequired(t *testing.T) {
+	var (
+		ts testServer
+		s  = collectd.NewServer(ts, "./collectd_test.conf")
+	)
+
+	s.Database = "counter"
+	s.SecurityLevel = collectd.SecurityLevelSign
+	if e := collectd.ListenAndServe(s, "127.0.0.1:25832"); e != collectd.ErrAuthFileRequired {
+		t.Fatalf("err does not match.  expected %v, got %v", collectd.ErrAuthFileRequired, e)
+	}
+}
+
+func TestParseSecurityLevel(t *testing.T) {
+	var tests = []struct {
+		s     string
+		level collectd.SecurityLevel
+		err   bool
+	}{
+		{s: "", level: collectd.SecurityLevelNone},
+		{s: "None", level: collectd.SecurityLevelNone},
+		{s: "sign", level: collectd.SecurityLevelSign},
+		{s: "Encrypt", level: collectd.SecurityLevelEncrypt},
+		{s: "secure", err: true},
+	}
+
+	for _, tt := range tests {
+		level, err := collectd.ParseSecurityLevel(tt.s)
+		if (err != nil) != tt.err {
+			t.Fatalf("%q: unexpected error: %v", tt.s, err)
+		} else if level != tt.level {
+			t.Fatalf("%q: level mismatch.  expected %v, got %v", tt.s, tt.level, level)
+		}
+	}
+}
+
+// signPacket prepends a collectd signature part to buf.
+func signPacket(buf []byte, username, password string) []byte {
+	mac := hmac.New(sha256.New, []byte(password))
+	mac.Write([]byte(username))
+	mac.Write(buf)
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint16(0x0200))
+	binary.Write(&b, binary.BigEndian, uint16(4+sha256.Size+len(username)))
+	b.Write(mac.Sum(nil))
+	b.WriteString(username)
+	b.Write(buf)
+	return b.Bytes()
+}
+
+// encryptPacket wraps buf in a collectd encryption part.
+func encryptPacket(buf []byte, username, password string) []byte {
+	sum := sha1.Sum(buf)
+	plain := append(sum[:], buf...)
+
+	iv := make([]byte, aes.BlockSize)
+	rand.Read(iv)
+
+	key := sha256.Sum256([]byte(password))
+	block, _ := aes.NewCipher(key[:])
+	data := make([]byte, len(plain))
+	cipher.NewOFB(block, iv).XORKeyStream(data, plain)
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint16(0x0210))
+	binary.Write(&b, binary.BigEndian, uint16(4+2+len(username)+len(iv)+len(data)))
+	binary.Write(&b, binary.BigEndian, uint16(len(username)))
+	b.WriteString(username)
+	b.Write(iv)
+	b.Write(data)
+	return b.Bytes()
+}
+
 func TestUnmarshal_Points(t *testing.T) {
 	/*
 	   This is a sample of what data can be represented like in json
@@ -355,3 +628,38 @@ func TestUnmarshal_Time(t *testing.T) {
 		}
 	}
 }
+
+func TestUnmarshalJoined(t *testing.T) {
+	packet := gollectd.Packet{
+		Hostname:       "server01",
+		Plugin:         "interface",
+		PluginInstance: "eth0",
+		Type:           "if_octets",
+		Time:           1414080767,
+		Values: []gollectd.Value{
+			{Name: "rx", Value: 1024},
+			{Name: "tx", Value: 2048},
+		},
+	}
+
+	points := collectd.UnmarshalJoined(&packet)
+	if len(points) != 1 {
+		t.Fatalf("unexpected point count.  expected %d, got %d", 1, len(points))
+	}
+
+	p := points[0]
+	if p.Name != "interface" {
+		t.Fatalf("unexpected name.  expected %q, got %q", "interface", p.Name)
+	} else if !reflect.DeepEqual(p.Fields, map[string]interface{}{"rx": float64(1024), "tx": float64(2048)}) {
+		t.Fatalf("unexpected fields: %v", p.Fields)
+	} else if !reflect.DeepEqual(p.Tags, map[string]string{"host": "server01", "instance": "eth0", "type": "if_octets"}) {
+		t.Fatalf("unexpected tags: %v", p.Tags)
+	} else if !p.Timestamp.Equal(time.Unix(1414080767, 0)) {
+		t.Fatalf("unexpected timestamp: %v", p.Timestamp)
+	}
+
+	// Packets without values have no point.
+	if points := collectd.UnmarshalJoined(&gollectd.Packet{Plugin: "interface"}); len(points) != 0 {
+		t.Fatalf("unexpected point count.  expected %d, got %d", 0, len(points))
+	}
+}
@@ -0,0 +1,222 @@
+package collectd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Part types used by collectd's network plugin to sign and encrypt packets.
+const (
+	typeSignature  = 0x0200
+	typeEncryption = 0x0210
+)
+
+// SecurityLevel is the minimum level of security required for received packets.
+type SecurityLevel int
+
+const (
+	// SecurityLevelNone accepts all packets. Signed and encrypted packets are
+	// still verified if an auth file is configured.
+	SecurityLevelNone SecurityLevel = iota
+
+	// SecurityLevelSign accepts signed or encrypted packets only.
+	SecurityLevelSign
+
+	// SecurityLevelEncrypt accepts encrypted packets only.
+	SecurityLevelEncrypt
+)
+
+var (
+	// ErrAuthFileRequired is returned when starting a server which requires
+	// signed or encrypted packets without an auth file.
+	ErrAuthFileRequired = errors.New("auth file required for security level")
+
+	// ErrUnsignedPacket is returned when a packet is not signed or encrypted
+	// but the security level requires it.
+	ErrUnsignedPacket = errors.New("packet not signed or encrypted")
+
+	// ErrUnencryptedPacket is returned when a packet is not encrypted but the
+	// security level requires it.
+	ErrUnencryptedPacket = errors.New("packet not encrypted")
+
+	// ErrInvalidSignature is returned when a packet's signature does not match.
+	ErrInvalidSignature = errors.New("invalid packet signature")
+
+	// ErrInvalidChecksum is returned when a decrypted packet's checksum does not match.
+	ErrInvalidChecksum = errors.New("invalid checksum for encrypted packet")
+
+	// ErrUnencryptedParts is returned when an encrypted packet has parts
+	// following the encryption part, which are not covered by its checksum.
+	ErrUnencryptedParts = errors.New("unencrypted parts following encryption part")
+)
+
+// ParseSecurityLevel returns the security level for the given name, which
+// is one of "none", "sign" or "encrypt". An empty name is "none".
+func ParseSecurityLevel(s string) (SecurityLevel, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return SecurityLevelNone, nil
+	case "sign":
+		return SecurityLevelSign, nil
+	case "encrypt":
+		return SecurityLevelEncrypt, nil
+	}
+	return SecurityLevelNone, fmt.Errorf("invalid security level: %s", s)
+}
+
+// String returns the name of the security level.
+func (l SecurityLevel) String() string {
+	switch l {
+	case SecurityLevelSign:
+		return "sign"
+	case SecurityLevelEncrypt:
+		return "encrypt"
+	}
+	return "none"
+}
+
+// ParseAuthFile parses a collectd auth file, where each line has the form
+// "username: password". Empty lines and lines starting with '#' are ignored.
+func ParseAuthFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	passwords := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid auth file entry on line %d", n)
+		}
+		passwords[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return passwords, nil
+}
+
+// openPacket verifies the signature of, or decrypts, a packet according to
+// the security level and returns the plain parts it contains.
+func openPacket(buf []byte, level SecurityLevel, passwords map[string]string) ([]byte, error) {
+	if len(buf) < 4 {
+		return buf, nil
+	}
+
+	switch binary.BigEndian.Uint16(buf[0:2]) {
+	case typeSignature:
+		if level == SecurityLevelEncrypt {
+			return nil, ErrUnencryptedPacket
+		} else if level == SecurityLevelNone && passwords == nil {
+			// Signatures cannot be checked without an auth file.
+			return skipPart(buf)
+		}
+		return verifySignature(buf, passwords)
+	case typeEncryption:
+		return decryptPacket(buf, passwords)
+	}
+
+	if level != SecurityLevelNone {
+		return nil, ErrUnsignedPacket
+	}
+	return buf, nil
+}
+
+// skipPart returns the parts following the first part in buf.
+func skipPart(buf []byte) ([]byte, error) {
+	length := int(binary.BigEndian.Uint16(buf[2:4]))
+	if length < 4 || length > len(buf) {
+		return nil, errors.New("invalid part length")
+	}
+	return buf[length:], nil
+}
+
+// verifySignature checks the HMAC-SHA256 signature part at the start of buf
+// and returns the signed parts which follow it. The signature covers all of
+// the remaining packet so no unsigned parts can be appended.
+func verifySignature(buf []byte, passwords map[string]string) ([]byte, error) {
+	length := int(binary.BigEndian.Uint16(buf[2:4]))
+	if length <= 4+sha256.Size || length > len(buf) {
+		return nil, errors.New("invalid signature part length")
+	}
+
+	sig := buf[4 : 4+sha256.Size]
+	username := buf[4+sha256.Size : length]
+	payload := buf[length:]
+
+	password, ok := passwords[string(username)]
+	if !ok {
+		return nil, fmt.Errorf("unknown user: %s", username)
+	}
+
+	// The signature covers the username and the signed parts.
+	mac := hmac.New(sha256.New, []byte(password))
+	mac.Write(username)
+	mac.Write(payload)
+	if !hmac.Equal(mac.Sum(nil), sig) {
+		return nil, ErrInvalidSignature
+	}
+	return payload, nil
+}
+
+// decryptPacket decrypts the AES-256-OFB encryption part at the start of buf
+// and returns the plain parts it contains. The encryption part must be the last
+// part of the packet, since nothing following it is authenticated.
+func decryptPacket(buf []byte, passwords map[string]string) ([]byte, error) {
+	length := int(binary.BigEndian.Uint16(buf[2:4]))
+	if length > len(buf) || length < 6 {
+		return nil, errors.New("invalid encryption part length")
+	} else if length < len(buf) {
+		return nil, ErrUnencryptedParts
+	}
+	part := buf[4:length]
+
+	// Read the username and the initialization vector.
+	ulen := int(binary.BigEndian.Uint16(part[0:2]))
+	if len(part) < 2+ulen+aes.BlockSize+sha1.Size {
+		return nil, errors.New("invalid encryption part length")
+	}
+	username := string(part[2 : 2+ulen])
+	iv := part[2+ulen : 2+ulen+aes.BlockSize]
+	data := part[2+ulen+aes.BlockSize:]
+
+	password, ok := passwords[username]
+	if !ok {
+		return nil, fmt.Errorf("unknown user: %s", username)
+	}
+
+	// The key is the SHA-256 hash of the password.
+	key := sha256.Sum256([]byte(password))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	// The decrypted data is a SHA-1 checksum followed by the plain parts.
+	plain := make([]byte, len(data))
+	cipher.NewOFB(block, iv).XORKeyStream(plain, data)
+	checksum, payload := plain[:sha1.Size], plain[sha1.Size:]
+	if sum := sha1.Sum(payload); !bytes.Equal(sum[:], checksum) {
+		return nil, ErrInvalidChecksum
+	}
+
+	return payload, nil
+}
@@ -13,8 +13,9 @@ const (
 	deleteDataNodeMessageType = messaging.MessageType(0x01)
 
 	// Database messages
-	createDatabaseMessageType = messaging.MessageType(0x10)
-	dropDatabaseMessageType   = messaging.MessageType(0x11)
+	createDatabaseMessageType   = messaging.MessageType(0x10)
+	dropDatabaseMessageType     = messaging.MessageType(0x11)
+	setFieldCoercionMessageType = messaging.MessageType(0x12)
 
 	// Retention policy messages
 	createRetentionPolicyMessageType     = messaging.MessageType(0x20)
@@ -32,7 +33,8 @@ const (
 	deleteShardGroupMessageType            = messaging.MessageType(0x41)
 
 	// Series messages
-	dropSeriesMessageType = messaging.MessageType(0x50)
+	dropSeriesMessageType    = messaging.MessageType(0x50)
+	unindexSeriesMessageType = messaging.MessageType(0x51)
 
 	// Measurement messages
 	createMeasurementsIfNotExistsMessageType = messaging.MessageType(0x60)
@@ -65,6 +67,11 @@ type dropDatabaseCommand struct {
 	Name string `json:"name"`
 }
 
+type setFieldCoercionCommand struct {
+	Database string `json:"database"`
+	Policy   string `json:"policy"`
+}
+
 type createShardGroupIfNotExistsCommand struct {
 	Database  string    `json:"database"`
 	Policy    string    `json:"policy"`
@@ -103,6 +110,7 @@ type createRetentionPolicyCommand struct {
 	ShardGroupDuration time.Duration `json:"shardGroupDuration"`
 	ReplicaN           uint32        `json:"replicaN"`
 	SplitN             uint32        `json:"splitN"`
+	Engine             string        `json:"engine,omitempty"`
 }
 type updateRetentionPolicyCommand struct {
 	Database string                 `json:"database"`
@@ -122,6 +130,10 @@ type setDefaultRetentionPolicyCommand struct {
 type dropMeasurementCommand struct {
 	Database string `json:"database"`
 	Name     string `json:"name"`
+
+	// Restricts the drop to the data of a retention policy. The measurement
+	// and its series are kept in the index.
+	Policy string `json:"policy,omitempty"`
 }
 
 type createMeasurementSubcommand struct {
@@ -203,6 +215,26 @@ func (c *createMeasurementsIfNotExistsCommand) addFieldIfNotExists(measurement,
 type dropSeriesCommand struct {
 	Database            string              `json:"database"`
 	SeriesByMeasurement map[string][]uint64 `json:"seriesIds"`
+
+	// Restricts the drop to the data between the min and max time, inclusive.
+	// The series are kept in the index.
+	MinTime time.Time `json:"minTime,omitempty"`
+	MaxTime time.Time `json:"maxTime,omitempty"`
+}
+
+// restricted returns true if the command only drops a time range.
+func (c *dropSeriesCommand) restricted() bool {
+	return !c.MinTime.IsZero() || !c.MaxTime.IsZero()
+}
+
+// unindexSeriesCommand removes series from the index without deleting their
+// data, such as the series left without data by a restricted drop.
+type unindexSeriesCommand struct {
+	Database            string              `json:"database"`
+	SeriesByMeasurement map[string][]uint64 `json:"seriesIds"`
+
+	// Drops the measurements left without series.
+	DropMeasurements bool `json:"dropMeasurements,omitempty"`
 }
 
 // createContinuousQueryCommand is the raft command for creating a continuous query on a database
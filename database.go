@@ -13,8 +13,41 @@ import (
 	"github.com/influxdb/influxdb/influxql"
 )
 
+// Encoded fields are stored in one of two formats. Shards written by earlier
+// versions hold a list of entries made of a 1 byte field ID and the value: 8 byte
+// big endian floats and integers, a 1 byte boolean or a string prefixed by its
+// 2 byte length.
+//
+// Fields are now encoded as a fieldEncodingTyped byte followed by entries made of
+// a uvarint key and the value, with strings prefixed by their uvarint length. The
+// key holds the field ID and, in its lowest 2 bits, the type of the value so
+// entries can be read without the measurement's fields.
+//
+// Field IDs start at 1 so the marker is never the first byte of the original
+// format, and entries with a field ID of 0 are rejected as invalid.
+const fieldEncodingTyped = 0
+
+// Value types held in the keys of the typed field encoding.
+const (
+	fieldValueFloat   = 0
+	fieldValueInteger = 1
+	fieldValueBoolean = 2
+	fieldValueString  = 3
+)
+
+// Field coercion policies control how values are written to a field first
+// created with another type.
 const (
-	maxStringLength = 64 * 1024
+	// FieldCoercionNone rejects values of another type. This is the default.
+	FieldCoercionNone = "none"
+
+	// FieldCoercionNumeric converts integers to float fields and floats without
+	// a fractional part to integer fields.
+	FieldCoercionNumeric = "numeric"
+
+	// FieldCoercionAll additionally converts between numbers, booleans and
+	// strings, such as "true" to a boolean field or 1 to a string field.
+	FieldCoercionAll = "all"
 )
 
 // database is a collection of retention policies and shards. It also has methods
@@ -29,9 +62,17 @@ type database struct {
 
 	defaultRetentionPolicy string
 
+	// fieldCoercion is the policy for writing values to fields of another type.
+	fieldCoercion string
+
+	// lastValueSeries holds the series whose latest points are cached by shards.
+	lastValueSeries *seriesIDSet
+
+	// meta holds the series index of the database.
+	meta *metastore
+
 	// in memory indexing structures
 	measurements map[string]*Measurement // measurement name to object and index
-	series       map[uint64]*Series      // map series id to the Series object
 	names        []string                // sorted list of the measurement names
 }
 
@@ -41,8 +82,8 @@ func newDatabase() *database {
 		policies:          make(map[string]*RetentionPolicy),
 		continuousQueries: make([]*ContinuousQuery, 0),
 		measurements:      make(map[string]*Measurement),
-		series:            make(map[uint64]*Series),
 		names:             make([]string, 0),
+		lastValueSeries:   newSeriesIDSet(),
 	}
 }
 
@@ -56,8 +97,15 @@ func (db *database) shardGroupByTimestamp(policy string, timestamp time.Time) (*
 }
 
 // Series takes a series ID and returns a series.
-func (db *database) Series(id uint64) *Series {
-	return db.series[id]
+func (db *database) Series(id uint64) (s *Series) {
+	if db.meta == nil {
+		return nil
+	}
+	_ = db.meta.mustView(func(tx *metatx) error {
+		_, s = tx.series(db.name, id)
+		return nil
+	})
+	return
 }
 
 // MarshalJSON encodes a database into a JSON-encoded byte slice.
@@ -66,6 +114,7 @@ func (db *database) MarshalJSON() ([]byte, error) {
 	var o databaseJSON
 	o.Name = db.name
 	o.DefaultRetentionPolicy = db.defaultRetentionPolicy
+	o.FieldCoercion = db.fieldCoercion
 	for _, rp := range db.policies {
 		o.Policies = append(o.Policies, rp)
 	}
@@ -84,6 +133,7 @@ func (db *database) UnmarshalJSON(data []byte) error {
 	// Copy over properties from intermediate type.
 	db.name = o.Name
 	db.defaultRetentionPolicy = o.DefaultRetentionPolicy
+	db.fieldCoercion = o.FieldCoercion
 
 	// Copy shard policies.
 	db.policies = make(map[string]*RetentionPolicy)
@@ -105,24 +155,22 @@ func (db *database) UnmarshalJSON(data []byte) error {
 type databaseJSON struct {
 	Name                   string             `json:"name,omitempty"`
 	DefaultRetentionPolicy string             `json:"defaultRetentionPolicy,omitempty"`
+	FieldCoercion          string             `json:"fieldCoercion,omitempty"`
 	Policies               []*RetentionPolicy `json:"policies,omitempty"`
 	ContinuousQueries      []*ContinuousQuery `json:"continuousQueries,omitempty"`
 }
 
-// Measurement represents a collection of time series in a database. It also contains in memory
-// structures for indexing tags. These structures are accessed through private methods on the Measurement
-// object. Generally these methods are only accessed from Index, which is responsible for ensuring
+// Measurement represents a collection of time series in a database. Its series and the index of its
+// tags are stored in the metastore and read through private methods on the Measurement object.
+// Generally these methods are only accessed from Index, which is responsible for ensuring
 // go routine safe access.
 type Measurement struct {
 	Name   string   `json:"name,omitempty"`
 	Fields []*Field `json:"fields,omitempty"`
 
-	// in-memory index fields
-	series              map[string]*Series // sorted tagset string to the series object
-	seriesByID          map[uint64]*Series // lookup table for series by their id
-	measurement         *Measurement
-	seriesByTagKeyValue map[string]map[string]seriesIDs // map from tag key to value to sorted set of series ids
-	seriesIDs           seriesIDs                       // sorted list of series IDs in this measurement
+	// series index
+	meta     *metastore // store of the series index, nil if the measurement has no series
+	database string     // name of the database
 }
 
 // NewMeasurement allocates and initializes a new Measurement.
@@ -130,22 +178,44 @@ func NewMeasurement(name string) *Measurement {
 	return &Measurement{
 		Name:   name,
 		Fields: make([]*Field, 0),
+	}
+}
 
-		series:              make(map[string]*Series),
-		seriesByID:          make(map[uint64]*Series),
-		seriesByTagKeyValue: make(map[string]map[string]seriesIDs),
-		seriesIDs:           make(seriesIDs, 0),
+// index calls fn with the series index of the measurement. Lookups within fn
+// read from a single consistent view of the index.
+func (m *Measurement) index(fn func(mi *measurementIndex)) {
+	if m.meta == nil {
+		fn(&measurementIndex{})
+		return
 	}
+	_ = m.meta.mustView(func(tx *metatx) error {
+		fn(tx.measurementIndex(m.database, m.Name))
+		return nil
+	})
 }
 
 // HasTagKey returns true if at least one eries in this measurement has written a value for the passed in tag key
-func (m *Measurement) HasTagKey(k string) bool {
-	return m.seriesByTagKeyValue[k] != nil
+func (m *Measurement) HasTagKey(k string) (ok bool) {
+	m.index(func(mi *measurementIndex) { ok = mi.hasTagKey(k) })
+	return
+}
+
+// seriesIDs returns the sorted ids of the series in this measurement.
+func (m *Measurement) seriesIDs() (ids seriesIDs) {
+	m.index(func(mi *measurementIndex) { ids = mi.seriesIDs() })
+	return
+}
+
+// seriesN returns the number of series in this measurement.
+func (m *Measurement) seriesN() (n int) {
+	m.index(func(mi *measurementIndex) { n = mi.seriesN() })
+	return
 }
 
 // createFieldIfNotExists creates a new field with an autoincrementing ID.
-// Returns an error if 255 fields have already been created on the measurement or
-// the fields already exists with a different type.
+// Field IDs start at 1, which the field encodings rely on. Returns an error if
+// 65535 fields have already been created on the measurement or the fields already
+// exists with a different type.
 func (m *Measurement) createFieldIfNotExists(name string, typ influxql.DataType) error {
 	// Ignore if the field already exists.
 	if f := m.FieldByName(name); f != nil {
@@ -155,14 +225,14 @@ func (m *Measurement) createFieldIfNotExists(name string, typ influxql.DataType)
 		return nil
 	}
 
-	// Only 255 fields are allowed. If we go over that then return an error.
-	if len(m.Fields)+1 > math.MaxUint8 {
+	// Only 65535 fields are allowed. If we go over that then return an error.
+	if len(m.Fields)+1 > math.MaxUint16 {
 		return ErrFieldOverflow
 	}
 
 	// Create and append a new field.
 	f := &Field{
-		ID:   uint8(len(m.Fields) + 1),
+		ID:   uint16(len(m.Fields) + 1),
 		Name: name,
 		Type: typ,
 	}
@@ -172,7 +242,7 @@ func (m *Measurement) createFieldIfNotExists(name string, typ influxql.DataType)
 }
 
 // Field returns a field by id.
-func (m *Measurement) Field(id uint8) *Field {
+func (m *Measurement) Field(id uint16) *Field {
 	if int(id) > len(m.Fields) {
 		return nil
 	}
@@ -189,109 +259,25 @@ func (m *Measurement) FieldByName(name string) *Field {
 	return nil
 }
 
-// addSeries will add a series to the measurementIndex. Returns false if already present
-func (m *Measurement) addSeries(s *Series) bool {
-	if _, ok := m.seriesByID[s.ID]; ok {
-		return false
-	}
-	m.seriesByID[s.ID] = s
-	tagset := string(marshalTags(s.Tags))
-	m.series[tagset] = s
-	m.seriesIDs = append(m.seriesIDs, s.ID)
-
-	// the series ID should always be higher than all others because it's a new
-	// series. So don't do the sort if we don't have to.
-	if len(m.seriesIDs) > 1 && m.seriesIDs[len(m.seriesIDs)-1] < m.seriesIDs[len(m.seriesIDs)-2] {
-		sort.Sort(m.seriesIDs)
-	}
-
-	// add this series id to the tag index on the measurement
-	for k, v := range s.Tags {
-		valueMap := m.seriesByTagKeyValue[k]
-		if valueMap == nil {
-			valueMap = make(map[string]seriesIDs)
-			m.seriesByTagKeyValue[k] = valueMap
-		}
-		ids := valueMap[v]
-		ids = append(ids, s.ID)
-
-		// most of the time the series ID will be higher than all others because it's a new
-		// series. So don't do the sort if we don't have to.
-		if len(ids) > 1 && ids[len(ids)-1] < ids[len(ids)-2] {
-			sort.Sort(ids)
-		}
-		valueMap[v] = ids
-	}
-
-	return true
-}
-
-// dropSeries will remove a series from the measurementIndex. Returns true if already removed
-func (m *Measurement) dropSeries(seriesID uint64) bool {
-	if _, ok := m.seriesByID[seriesID]; !ok {
-		return true
-	}
-	s := m.seriesByID[seriesID]
-	tagset := string(marshalTags(s.Tags))
-
-	delete(m.series, tagset)
-	delete(m.seriesByID, seriesID)
-
-	var ids []uint64
-	for _, id := range m.seriesIDs {
-		if id != seriesID {
-			ids = append(ids, id)
-		}
-	}
-	m.seriesIDs = ids
-
-	// remove this series id to the tag index on the measurement
-	// s.seriesByTagKeyValue is defined as map[string]map[string]seriesIDs
-	for k, v := range m.seriesByTagKeyValue {
-		values := v
-		for kk, vv := range values {
-			var ids []uint64
-			for _, id := range vv {
-				if id != seriesID {
-					ids = append(ids, id)
-				}
-			}
-			// Check to see if we have any ids, if not, remove the key
-			if len(ids) == 0 {
-				delete(values, kk)
-			} else {
-				values[kk] = ids
-			}
-		}
-		// If we have no values, then we delete the key
-		if len(values) == 0 {
-			delete(m.seriesByTagKeyValue, k)
-		} else {
-			m.seriesByTagKeyValue[k] = values
-		}
-	}
-
-	return true
-}
-
 // seriesByTags returns the Series that matches the given tagset.
-func (m *Measurement) seriesByTags(tags map[string]string) *Series {
-	return m.series[string(marshalTags(tags))]
+func (m *Measurement) seriesByTags(tags map[string]string) (s *Series) {
+	m.index(func(mi *measurementIndex) { s = mi.seriesByTags(tags) })
+	return
 }
 
 // filters walks the where clause of a select statement and returns a map with all series ids
 // matching the where clause and any filter expression that should be applied to each
-func (m *Measurement) filters(stmt *influxql.SelectStatement) (map[uint64]influxql.Expr, error) {
+func (m *Measurement) filters(mi *measurementIndex, stmt *influxql.SelectStatement) (map[uint64]influxql.Expr, error) {
 	seriesIdsToExpr := make(map[uint64]influxql.Expr)
 
 	if stmt.Condition == nil || stmt.OnlyTimeDimensions() {
-		for _, id := range m.seriesIDs {
+		for _, id := range mi.seriesIDs() {
 			seriesIdsToExpr[id] = nil
 		}
 		return seriesIdsToExpr, nil
 	}
 
-	ids, _, _, err := m.walkWhereForSeriesIds(stmt.Condition, seriesIdsToExpr)
+	ids, _, _, err := m.walkWhereForSeriesIds(mi, stmt.Condition, seriesIdsToExpr)
 	if err != nil {
 		return nil, err
 	}
@@ -314,39 +300,48 @@ func (m *Measurement) filters(stmt *influxql.SelectStatement) (map[uint64]influx
 // This will also populate the TagSet objects with the series IDs that match each tagset and any
 // influx filter expression that goes with the series
 func (m *Measurement) tagSets(stmt *influxql.SelectStatement, dimensions []string) ([]*influxql.TagSet, error) {
-	// get the unique set of series ids and the filters that should be applied to each
-	filters, err := m.filters(stmt)
-	if err != nil {
-		return nil, err
-	}
-
-	// build the tag sets
 	var tagStrings []string
 	tagSets := make(map[string]*influxql.TagSet)
-	for id, filter := range filters {
-		// get the series and set the tag values for the dimensions we care about
-		s := m.seriesByID[id]
-		tags := make([]string, len(dimensions))
-		for i, dim := range dimensions {
-			tags[i] = s.Tags[dim]
+	var err error
+	m.index(func(mi *measurementIndex) {
+		// get the unique set of series ids and the filters that should be applied to each
+		var filters map[uint64]influxql.Expr
+		if filters, err = m.filters(mi, stmt); err != nil {
+			return
 		}
 
-		// marshal it into a string and put this series and its expr into the tagSets map
-		t := strings.Join(tags, "")
-		set, ok := tagSets[t]
-		if !ok {
-			tagStrings = append(tagStrings, t)
-			set = &influxql.TagSet{}
-			// set the tags for this set
-			tagsForSet := make(map[string]string)
+		// build the tag sets
+		for id, filter := range filters {
+			// get the series and set the tag values for the dimensions we care about
+			s := mi.series(id)
+			if s == nil {
+				continue
+			}
+			tags := make([]string, len(dimensions))
 			for i, dim := range dimensions {
-				tagsForSet[dim] = tags[i]
+				tags[i] = s.Tags[dim]
+			}
+
+			// marshal it into a string and put this series and its expr into the tagSets map
+			t := strings.Join(tags, "")
+			set, ok := tagSets[t]
+			if !ok {
+				tagStrings = append(tagStrings, t)
+				set = &influxql.TagSet{}
+				// set the tags for this set
+				tagsForSet := make(map[string]string)
+				for i, dim := range dimensions {
+					tagsForSet[dim] = tags[i]
+				}
+				set.Tags = tagsForSet
+				set.Key = marshalTags(tagsForSet)
 			}
-			set.Tags = tagsForSet
-			set.Key = marshalTags(tagsForSet)
+			set.AddFilter(id, filter)
+			tagSets[t] = set
 		}
-		set.AddFilter(id, filter)
-		tagSets[t] = set
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// return the tag sets in sorted order
@@ -361,7 +356,7 @@ func (m *Measurement) tagSets(stmt *influxql.SelectStatement, dimensions []strin
 
 // idsForExpr will return a collection of series ids, a bool indicating if the result should be
 // used (it'll be false if it's a time expr) and a field expression if the passed in expression is against a field.
-func (m *Measurement) idsForExpr(n *influxql.BinaryExpr) (seriesIDs, bool, influxql.Expr, error) {
+func (m *Measurement) idsForExpr(mi *measurementIndex, n *influxql.BinaryExpr) (seriesIDs, bool, influxql.Expr, error) {
 	name, ok := n.LHS.(*influxql.VarRef)
 	value := n.RHS
 	if !ok {
@@ -379,63 +374,57 @@ func (m *Measurement) idsForExpr(n *influxql.BinaryExpr) (seriesIDs, bool, influ
 
 	// if it's a field we can't collapse it so we have to look at all series ids for this
 	if m.FieldByName(name.Val) != nil {
-		return m.seriesIDs, true, n, nil
+		return mi.seriesIDs(), true, n, nil
 	}
 
-	tagVals, ok := m.seriesByTagKeyValue[name.Val]
-	if !ok {
+	if !mi.hasTagKey(name.Val) {
 		return nil, true, nil, nil
 	}
 
-	// if we're looking for series with specific tag values
-	if str, ok := value.(*influxql.StringLiteral); ok {
-		var ids seriesIDs
-
+	var ids seriesIDs
+	switch value := value.(type) {
+	case *influxql.StringLiteral:
+		// if we're looking for series with specific tag values
 		if n.Op == influxql.EQ {
 			// return series that have a tag of specific value.
-			ids = tagVals[str.Val]
+			ids = mi.tagValueSeriesIDs(name.Val, value.Val)
 		} else if n.Op == influxql.NEQ {
-			ids = m.seriesIDs.reject(tagVals[str.Val])
+			ids = mi.seriesIDs().reject(mi.tagValueSeriesIDs(name.Val, value.Val))
 		}
-		return ids, true, nil, nil
-	}
 
-	// if we're looking for series with tag values that match a regex
-	if re, ok := value.(*influxql.RegexLiteral); ok {
-		var ids seriesIDs
+	case *influxql.RegexLiteral:
+		// if we're looking for series with tag values that match a regex
 
 		// The operation is a NEQREGEX, code must start by assuming all match, even
 		// series without any tags.
 		if n.Op == influxql.NEQREGEX {
-			ids = m.seriesIDs
+			ids = mi.seriesIDs()
 		}
 
-		for k := range tagVals {
-			match := re.Val.MatchString(k)
+		for _, k := range mi.tagValues(name.Val) {
+			match := value.Val.MatchString(k)
 
 			if match && n.Op == influxql.EQREGEX {
-				ids = ids.union(tagVals[k])
+				ids = ids.union(mi.tagValueSeriesIDs(name.Val, k))
 			} else if match && n.Op == influxql.NEQREGEX {
-				ids = ids.reject(tagVals[k])
+				ids = ids.reject(mi.tagValueSeriesIDs(name.Val, k))
 			}
 		}
-		return ids, true, nil, nil
 	}
-
-	return nil, true, nil, nil
+	return ids, true, nil, nil
 }
 
 // walkWhereForSeriesIds will recursively walk the where clause and return a collection of series ids, a boolean indicating if this return
 // value should be included in the resulting set, and an expression if the return is a field expression.
 // The map that it takes maps each series id to the field expression that should be used to evaluate it when iterating over its cursor.
 // Series that have no field expressions won't be in the map
-func (m *Measurement) walkWhereForSeriesIds(expr influxql.Expr, filters map[uint64]influxql.Expr) (seriesIDs, bool, influxql.Expr, error) {
+func (m *Measurement) walkWhereForSeriesIds(mi *measurementIndex, expr influxql.Expr, filters map[uint64]influxql.Expr) (seriesIDs, bool, influxql.Expr, error) {
 	switch n := expr.(type) {
 	case *influxql.BinaryExpr:
 		switch n.Op {
 		case influxql.EQ, influxql.NEQ, influxql.LT, influxql.LTE, influxql.GT, influxql.GTE, influxql.EQREGEX, influxql.NEQREGEX:
 			// if it's a compare, then it's either a field expression or against a tag. we can return this
-			ids, shouldInclude, expr, err := m.idsForExpr(n)
+			ids, shouldInclude, expr, err := m.idsForExpr(mi, n)
 			if err != nil {
 				return nil, false, nil, err
 			}
@@ -448,12 +437,12 @@ func (m *Measurement) walkWhereForSeriesIds(expr influxql.Expr, filters map[uint
 		case influxql.AND, influxql.OR:
 			// if it's an AND or OR we need to union or intersect the results
 			var ids seriesIDs
-			l, il, lexpr, err := m.walkWhereForSeriesIds(n.LHS, filters)
+			l, il, lexpr, err := m.walkWhereForSeriesIds(mi, n.LHS, filters)
 			if err != nil {
 				return nil, false, nil, err
 			}
 
-			r, ir, rexpr, err := m.walkWhereForSeriesIds(n.RHS, filters)
+			r, ir, rexpr, err := m.walkWhereForSeriesIds(mi, n.RHS, filters)
 			if err != nil {
 				return nil, false, nil, err
 			}
@@ -518,10 +507,10 @@ func (m *Measurement) walkWhereForSeriesIds(expr influxql.Expr, filters map[uint
 			return ids, true, nil, nil
 		}
 
-		return m.idsForExpr(n)
+		return m.idsForExpr(mi, n)
 	case *influxql.ParenExpr:
 		// walk down the tree
-		return m.walkWhereForSeriesIds(n.Expr, filters)
+		return m.walkWhereForSeriesIds(mi, n.Expr, filters)
 	default:
 		return nil, false, nil, nil
 	}
@@ -586,23 +575,22 @@ func expandExprWithValues(expr influxql.Expr, keys []string, tagExprs []tagExpr,
 
 // seriesIDsAllOrByExpr walks an expressions for matching series IDs
 // or, if no expressions is given, returns all series IDs for the measurement.
-func (m *Measurement) seriesIDsAllOrByExpr(expr influxql.Expr) (seriesIDs, error) {
-	// If no expression given or the measurement has no series,
-	// we can take just return the ids or nil accordingly.
-	if expr == nil {
-		return m.seriesIDs, nil
-	} else if len(m.seriesIDs) == 0 {
-		return nil, nil
-	}
-
-	// Get series IDs that match the WHERE clause.
-	filters := map[uint64]influxql.Expr{}
-	ids, _, _, err := m.walkWhereForSeriesIds(expr, filters)
-	if err != nil {
-		return nil, err
-	}
+func (m *Measurement) seriesIDsAllOrByExpr(expr influxql.Expr) (ids seriesIDs, err error) {
+	m.index(func(mi *measurementIndex) {
+		// If no expression given or the measurement has no series,
+		// we can take just return the ids or nil accordingly.
+		if expr == nil {
+			ids = mi.seriesIDs()
+			return
+		} else if mi.seriesN() == 0 {
+			return
+		}
 
-	return ids, nil
+		// Get series IDs that match the WHERE clause.
+		filters := map[uint64]influxql.Expr{}
+		ids, _, _, err = m.walkWhereForSeriesIds(mi, expr, filters)
+	})
+	return
 }
 
 // tagValuer is used during expression expansion to evaluate all sets of tag values.
@@ -756,7 +744,7 @@ func (a Measurements) union(other Measurements) Measurements {
 
 // Field represents a series field.
 type Field struct {
-	ID   uint8             `json:"id,omitempty"`
+	ID   uint16            `json:"id,omitempty"`
 	Name string            `json:"name,omitempty"`
 	Type influxql.DataType `json:"type,omitempty"`
 }
@@ -770,14 +758,17 @@ type Fields []*Field
 //
 // It is not affected by changes to the Measurement object after codec creation.
 type FieldCodec struct {
-	fieldsByID   map[uint8]*Field
+	fieldsByID   map[uint16]*Field
 	fieldsByName map[string]*Field
+
+	// coercion is the policy for encoding values of another type than their field.
+	coercion string
 }
 
 // NewFieldCodec returns a FieldCodec for the given Measurement. Must be called with
 // a RLock that protects the Measurement.
 func NewFieldCodec(m *Measurement) *FieldCodec {
-	fieldsByID := make(map[uint8]*Field, len(m.Fields))
+	fieldsByID := make(map[uint16]*Field, len(m.Fields))
 	fieldsByName := make(map[string]*Field, len(m.Fields))
 	for _, f := range m.Fields {
 		fieldsByID[f.ID] = f
@@ -789,187 +780,291 @@ func NewFieldCodec(m *Measurement) *FieldCodec {
 // EncodeFields converts a map of values with string keys to a byte slice of field
 // IDs and values.
 //
-// If a field exists in the codec, but its type is different, an error is returned. If
-// a field is not present in the codec, the system panics.
+// If a field exists in the codec, but its type is different, the value is coerced to
+// the field's type if the codec's coercion policy allows it, otherwise an error is
+// returned. If a field is not present in the codec, the system panics.
 func (f *FieldCodec) EncodeFields(values map[string]interface{}) ([]byte, error) {
-	// Allocate byte slice
+	// Allocate byte slice, starting with the encoding.
 	b := make([]byte, 0, 10)
+	b = append(b, fieldEncodingTyped)
 
 	for k, v := range values {
 		field := f.fieldsByName[k]
 		if field == nil {
 			panic(fmt.Sprintf("field does not exist for %s", k))
 		} else if influxql.InspectDataType(v) != field.Type {
-			return nil, fmt.Errorf("field \"%s\" is type %T, mapped as type %s", k, k, field.Type)
+			value, err := coerceFieldValue(v, field.Type, f.coercion)
+			if err != nil {
+				return nil, fmt.Errorf("field \"%s\" is type %T, mapped as type %s", k, v, field.Type)
+			}
+			v = value
 		}
 
-		var buf []byte
-
-		switch field.Type {
-		case influxql.Float:
-			value := v.(float64)
-			buf = make([]byte, 9)
-			binary.BigEndian.PutUint64(buf[1:9], math.Float64bits(value))
-		case influxql.Integer:
-			var value uint64
-			switch v.(type) {
-			case int:
-				value = uint64(v.(int))
-			case int32:
-				value = uint64(v.(int32))
-			case int64:
-				value = uint64(v.(int64))
-			default:
-				panic(fmt.Sprintf("invalid integer type: %T", v))
-			}
-			buf = make([]byte, 9)
-			binary.BigEndian.PutUint64(buf[1:9], value)
-		case influxql.Boolean:
-			value := v.(bool)
-
-			// Only 1 byte need for a boolean.
-			buf = make([]byte, 2)
-			if value {
-				buf[1] = byte(1)
-			}
-		case influxql.String:
-			value := v.(string)
-			if len(value) > maxStringLength {
-				value = value[:maxStringLength]
-			}
-			// Make a buffer for field ID (1 bytes), the string length (2 bytes), and the string.
-			buf = make([]byte, len(value)+3)
+		b = appendFieldValue(b, field.ID, field.Type, v)
+	}
 
-			// Set the string length, then copy the string itself.
-			binary.BigEndian.PutUint16(buf[1:3], uint16(len(value)))
-			for i, c := range []byte(value) {
-				buf[i+3] = byte(c)
-			}
+	return b, nil
+}
+
+// appendFieldValue appends a field ID and value to b in the typed encoding.
+func appendFieldValue(b []byte, id uint16, typ influxql.DataType, v interface{}) []byte {
+	switch typ {
+	case influxql.Float:
+		b = appendUvarint(b, uint64(id)<<2|fieldValueFloat)
+		b = appendUint64(b, math.Float64bits(v.(float64)))
+	case influxql.Integer:
+		var value uint64
+		switch v.(type) {
+		case int:
+			value = uint64(v.(int))
+		case int32:
+			value = uint64(v.(int32))
+		case int64:
+			value = uint64(v.(int64))
 		default:
-			panic(fmt.Sprintf("unsupported value type during encode fields: %T", v))
+			panic(fmt.Sprintf("invalid integer type: %T", v))
+		}
+		b = appendUvarint(b, uint64(id)<<2|fieldValueInteger)
+		b = appendUint64(b, value)
+	case influxql.Boolean:
+		// Only 1 byte need for a boolean.
+		b = appendUvarint(b, uint64(id)<<2|fieldValueBoolean)
+		if v.(bool) {
+			b = append(b, 1)
+		} else {
+			b = append(b, 0)
 		}
+	case influxql.String:
+		// Set the string length, then copy the string itself.
+		value := v.(string)
+		b = appendUvarint(b, uint64(id)<<2|fieldValueString)
+		b = appendUvarint(b, uint64(len(value)))
+		b = append(b, value...)
+	default:
+		panic(fmt.Sprintf("unsupported value type during encode fields: %T", v))
+	}
+	return b
+}
 
-		// Always set the field ID as the leading byte.
-		buf[0] = field.ID
+// decodeFieldValue decodes the first entry of b in the typed encoding. Returns
+// the field ID, the type and value, and the remaining bytes. Returns
+// ErrFieldEncoding if the entry is truncated or its field ID is 0.
+func decodeFieldValue(b []byte) (id uint16, typ influxql.DataType, value interface{}, rest []byte, err error) {
+	key, n := binary.Uvarint(b)
+	if n <= 0 || key>>2 == 0 || key>>2 > math.MaxUint16 {
+		return 0, influxql.Unknown, nil, nil, ErrFieldEncoding
+	}
+	id, b = uint16(key>>2), b[n:]
 
-		// Append temp buffer to the end.
-		b = append(b, buf...)
+	switch key & 3 {
+	case fieldValueFloat, fieldValueInteger:
+		if len(b) < 8 {
+			return 0, influxql.Unknown, nil, nil, ErrFieldEncoding
+		}
+		if key&3 == fieldValueFloat {
+			typ, value = influxql.Float, math.Float64frombits(binary.BigEndian.Uint64(b[0:8]))
+		} else {
+			typ, value = influxql.Integer, int64(binary.BigEndian.Uint64(b[0:8]))
+		}
+		b = b[8:]
+	case fieldValueBoolean:
+		if len(b) < 1 {
+			return 0, influxql.Unknown, nil, nil, ErrFieldEncoding
+		}
+		typ, value, b = influxql.Boolean, b[0] == 1, b[1:]
+	case fieldValueString:
+		size, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < size {
+			return 0, influxql.Unknown, nil, nil, ErrFieldEncoding
+		}
+		b = b[n:]
+		typ, value, b = influxql.String, string(b[:size]), b[size:]
 	}
+	return id, typ, value, b, nil
+}
 
-	return b, nil
+// appendUvarint appends the uvarint encoding of v to b.
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+// appendUint64 appends the big endian encoding of v to b.
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// coerceFieldValue converts a value to a field type under a coercion policy.
+// Returns ErrFieldTypeConflict if the policy doesn't allow the conversion or the
+// value can't be represented by the type.
+func coerceFieldValue(v interface{}, typ influxql.DataType, policy string) (interface{}, error) {
+	from := influxql.InspectDataType(v)
+	switch policy {
+	case FieldCoercionNumeric:
+		if !isNumericDataType(from) || !isNumericDataType(typ) {
+			return nil, ErrFieldTypeConflict
+		}
+	case FieldCoercionAll:
+	default:
+		return nil, ErrFieldTypeConflict
+	}
+
+	// Floats are only coerced to integers if no precision is lost.
+	if f, ok := v.(float64); ok && typ == influxql.Integer {
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return nil, ErrFieldTypeConflict
+		}
+	}
+
+	value, err := convertFieldValue(v, string(typ))
+	if err != nil {
+		return nil, ErrFieldTypeConflict
+	}
+	return value, nil
+}
+
+// isNumericDataType returns true if typ is a float or integer.
+func isNumericDataType(typ influxql.DataType) bool {
+	return typ == influxql.Float || typ == influxql.Integer
 }
 
 // DecodeByID scans a byte slice for a field with the given ID, converts it to its
 // expected type, and return that value.
-func (f *FieldCodec) DecodeByID(targetID uint8, b []byte) (interface{}, error) {
+func (f *FieldCodec) DecodeByID(targetID uint16, b []byte) (interface{}, error) {
 	if len(b) == 0 {
 		return 0, ErrFieldNotFound
 	}
 
-	for {
-		if len(b) < 1 {
-			// No more bytes.
-			break
-		}
-		field, ok := f.fieldsByID[b[0]]
-		if !ok {
-			// This can happen, though is very unlikely. If this node receives encoded data, to be written
-			// to disk, and is queried for that data before its metastore is updated, there will be no field
-			// mapping for the data during decode. All this can happen because data is encoded by the node
-			// that first received the write request, not the node that actually writes the data to disk.
-			// So if this happens, the read must be aborted.
-			return 0, ErrFieldUnmappedID
-		}
-
-		var value interface{}
-		switch field.Type {
-		case influxql.Float:
-			// Move bytes forward.
-			value = math.Float64frombits(binary.BigEndian.Uint64(b[1:9]))
-			b = b[9:]
-		case influxql.Integer:
-			value = int64(binary.BigEndian.Uint64(b[1:9]))
-			b = b[9:]
-		case influxql.Boolean:
-			if b[1] == 1 {
-				value = true
-			} else {
-				value = false
-			}
-			// Move bytes forward.
-			b = b[2:]
-		case influxql.String:
-			size := binary.BigEndian.Uint16(b[1:3])
-			value = string(b[3 : 3+size])
-			// Move bytes forward.
-			b = b[size+3:]
-		default:
-			panic(fmt.Sprintf("unsupported value type during decode by id: %T", field.Type))
-		}
-
+	var value interface{}
+	var found bool
+	if err := f.walkFields(b, func(field *Field, v interface{}) bool {
 		if field.ID == targetID {
-			return value, nil
+			value, found = v, true
 		}
+		return !found
+	}); err != nil {
+		return 0, err
+	} else if !found {
+		return 0, ErrFieldNotFound
 	}
-
-	return 0, ErrFieldNotFound
+	return value, nil
 }
 
 // DecodeFields decodes a byte slice into a set of field ids and values.
-func (f *FieldCodec) DecodeFields(b []byte) (map[uint8]interface{}, error) {
+func (f *FieldCodec) DecodeFields(b []byte) (map[uint16]interface{}, error) {
 	if len(b) == 0 {
 		return nil, nil
 	}
 
 	// Create a map to hold the decoded data.
-	values := make(map[uint8]interface{}, 0)
+	values := make(map[uint16]interface{}, 0)
+	if err := f.walkFields(b, func(field *Field, v interface{}) bool {
+		values[field.ID] = v
+		return true
+	}); err != nil {
+		return nil, err
+	}
 
-	for {
-		if len(b) < 1 {
-			// No more bytes.
-			break
-		}
+	return values, nil
+}
 
-		// First byte is the field identifier.
-		fieldID := b[0]
-		field := f.fieldsByID[fieldID]
-		if field == nil {
-			// See note in DecodeByID() regarding field-mapping failures.
-			return nil, ErrFieldUnmappedID
-		}
+// walkFields decodes each field in b, in any encoding, and calls fn with the
+// field and its value until fn returns false.
+func (f *FieldCodec) walkFields(b []byte, fn func(field *Field, value interface{}) bool) error {
+	typed := hasTypedFields(b)
+	if typed {
+		b = b[1:]
+	}
 
+	for len(b) > 0 {
+		var field *Field
 		var value interface{}
-		switch field.Type {
-		case influxql.Float:
-			value = math.Float64frombits(binary.BigEndian.Uint64(b[1:9]))
-			// Move bytes forward.
-			b = b[9:]
-		case influxql.Integer:
-			value = int64(binary.BigEndian.Uint64(b[1:9]))
-			// Move bytes forward.
-			b = b[9:]
-		case influxql.Boolean:
-			if b[1] == 1 {
-				value = true
-			} else {
-				value = false
+		if typed {
+			id, _, v, rest, err := decodeFieldValue(b)
+			if err != nil {
+				return err
+			} else if field = f.fieldsByID[id]; field == nil {
+				// See note in decodeUntypedField() regarding field-mapping failures.
+				return ErrFieldUnmappedID
+			}
+			value, b = v, rest
+		} else {
+			var err error
+			if field, value, b, err = f.decodeUntypedField(b); err != nil {
+				return err
 			}
-			// Move bytes forward.
-			b = b[2:]
-		case influxql.String:
-			size := binary.BigEndian.Uint16(b[1:3])
-			value = string(b[3 : size+3])
-			// Move bytes forward.
-			b = b[size+3:]
-		default:
-			panic(fmt.Sprintf("unsupported value type during decode fields: %T", f.fieldsByID[fieldID]))
 		}
 
-		values[fieldID] = value
+		if !fn(field, value) {
+			return nil
+		}
+	}
 
+	return nil
+}
+
+// hasTypedFields returns true if encoded fields are in the typed encoding.
+func hasTypedFields(b []byte) bool {
+	return len(b) > 0 && b[0] == fieldEncodingTyped
+}
+
+// decodeUntypedField decodes the first entry of b in the original encoding.
+// Returns the field, its value and the remaining bytes.
+func (f *FieldCodec) decodeUntypedField(b []byte) (*Field, interface{}, []byte, error) {
+	// Read the field identifier.
+	id, b := b[0], b[1:]
+
+	field := f.fieldsByID[uint16(id)]
+	if field == nil {
+		// This can happen, though is very unlikely. If this node receives encoded data, to be written
+		// to disk, and is queried for that data before its metastore is updated, there will be no field
+		// mapping for the data during decode. All this can happen because data is encoded by the node
+		// that first received the write request, not the node that actually writes the data to disk.
+		// So if this happens, the read must be aborted.
+		return nil, nil, nil, ErrFieldUnmappedID
 	}
 
-	return values, nil
+	var value interface{}
+	switch field.Type {
+	case influxql.Float, influxql.Integer:
+		if len(b) < 8 {
+			return nil, nil, nil, ErrFieldEncoding
+		}
+		if field.Type == influxql.Float {
+			value = math.Float64frombits(binary.BigEndian.Uint64(b[0:8]))
+		} else {
+			value = int64(binary.BigEndian.Uint64(b[0:8]))
+		}
+		// Move bytes forward.
+		b = b[8:]
+	case influxql.Boolean:
+		if len(b) < 1 {
+			return nil, nil, nil, ErrFieldEncoding
+		}
+		value = b[0] == 1
+		// Move bytes forward.
+		b = b[1:]
+	case influxql.String:
+		// Read the string length.
+		if len(b) < 2 {
+			return nil, nil, nil, ErrFieldEncoding
+		}
+		size := int(binary.BigEndian.Uint16(b[0:2]))
+		b = b[2:]
+
+		if len(b) < size {
+			return nil, nil, nil, ErrFieldEncoding
+		}
+		value = string(b[:size])
+		// Move bytes forward.
+		b = b[size:]
+	default:
+		panic(fmt.Sprintf("unsupported value type during decode fields: %T", field.Type))
+	}
+	return field, value, b, nil
 }
 
 // DecodeFieldsWithNames decodes a byte slice into a set of field names and values
@@ -997,8 +1092,6 @@ func (f *FieldCodec) FieldByName(name string) *Field {
 type Series struct {
 	ID   uint64
 	Tags map[string]string
-
-	measurement *Measurement
 }
 
 // match returns true if all tags match the series' tags.
@@ -1137,6 +1230,9 @@ type RetentionPolicy struct {
 	// The number of copies to make of each shard.
 	ReplicaN uint32 `json:"replicaN"`
 
+	// The storage engine of new shards. Blank for the default engine.
+	Engine string `json:"engine,omitempty"`
+
 	shardGroups []*ShardGroup
 }
 
@@ -1178,43 +1274,42 @@ func (rp *RetentionPolicy) shardGroupByID(shardID uint64) *ShardGroup {
 	return nil
 }
 
-// dropMeasurement will remove a measurement from:
-//    In memory index.
-//    Series data from the shards.
-func (db *database) dropMeasurement(name string) error {
+// dropMeasurement will remove a measurement from the in memory index. The data
+// of its series is deleted from the shards separately.
+func (db *database) dropMeasurement(name string) {
 	if _, ok := db.measurements[name]; !ok {
-		return nil
+		return
 	}
 
 	// remove measurement from in memory index
 	delete(db.measurements, name)
-
-	// collect the series ids to remove
-	var ids []uint64
-
-	// remove series from in memory map
-	for id, series := range db.series {
-		if series.measurement.Name == name {
-			ids = append(ids, id)
-			delete(db.series, id)
+	for i, n := range db.names {
+		if n == name {
+			db.names = append(db.names[:i:i], db.names[i+1:]...)
+			break
 		}
 	}
+}
 
-	// remove series data from shards
-	for _, rp := range db.policies {
-		if err := rp.dropSeries(ids...); err != nil {
+// dropSeries will delete all data with the seriesID
+func (rp *RetentionPolicy) dropSeries(seriesIDs ...uint64) error {
+	for _, g := range rp.shardGroups {
+		err := g.dropSeries(seriesIDs...)
+		if err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
-// dropSeries will delete all data with the seriesID
-func (rp *RetentionPolicy) dropSeries(seriesIDs ...uint64) error {
+// deleteRange removes the data of the series with timestamps between min and
+// max, inclusive, from the shard groups covering the range.
+func (rp *RetentionPolicy) deleteRange(seriesIDs []uint64, min, max time.Time) error {
 	for _, g := range rp.shardGroups {
-		err := g.dropSeries(seriesIDs...)
-		if err != nil {
+		if !g.Contains(min, max) {
+			continue
+		}
+		if err := g.deleteRange(seriesIDs, min, max); err != nil {
 			return err
 		}
 	}
@@ -1237,6 +1332,7 @@ func (rp *RetentionPolicy) MarshalJSON() ([]byte, error) {
 	o.Duration = rp.Duration
 	o.ShardGroupDuration = rp.ShardGroupDuration
 	o.ReplicaN = rp.ReplicaN
+	o.Engine = rp.Engine
 	for _, g := range rp.shardGroups {
 		o.ShardGroups = append(o.ShardGroups, g)
 	}
@@ -1256,6 +1352,7 @@ func (rp *RetentionPolicy) UnmarshalJSON(data []byte) error {
 	rp.ReplicaN = o.ReplicaN
 	rp.Duration = o.Duration
 	rp.ShardGroupDuration = o.ShardGroupDuration
+	rp.Engine = o.Engine
 	rp.shardGroups = o.ShardGroups
 
 	return nil
@@ -1267,6 +1364,7 @@ type retentionPolicyJSON struct {
 	ReplicaN           uint32        `json:"replicaN,omitempty"`
 	Duration           time.Duration `json:"duration,omitempty"`
 	ShardGroupDuration time.Duration `json:"shardGroupDuration"`
+	Engine             string        `json:"engine,omitempty"`
 	ShardGroups        []*ShardGroup `json:"shardGroups,omitempty"`
 }
 
@@ -1278,37 +1376,12 @@ type TagFilter struct {
 	Regex *regexp.Regexp
 }
 
-// addSeriesToIndex adds the series for the given measurement to the index. Returns false if already present
-func (db *database) addSeriesToIndex(measurementName string, s *Series) bool {
-	// if there is a measurement for this id, it's already been added
-	if db.series[s.ID] != nil {
-		return false
-	}
-
-	// get or create the measurement index and index it globally and in the measurement
-	idx := db.createMeasurementIfNotExists(measurementName)
-
-	s.measurement = idx
-	db.series[s.ID] = s
-
-	// TODO: add this series to the global tag index
-
-	return idx.addSeries(s)
-}
-
-// dropSeries removes the series from the in memory references
+// dropSeries removes the data of the series from the shards. The series must
+// already be removed from the series index.
 func (db *database) dropSeries(seriesByMeasurement map[string][]uint64) error {
-	for measurement, ids := range seriesByMeasurement {
+	for _, ids := range seriesByMeasurement {
 		for _, id := range ids {
-			// if the series is already gone, return
-			if db.series[id] == nil {
-				continue
-			}
-
-			delete(db.series, id)
-
-			// Remove series information from measurements
-			db.measurements[measurement].dropSeries(id)
+			db.lastValueSeries.remove(id)
 
 			// Remove shard data
 			for _, rp := range db.policies {
@@ -1322,11 +1395,38 @@ func (db *database) dropSeries(seriesByMeasurement map[string][]uint64) error {
 	return nil
 }
 
+// deleteSeriesRange removes the data of the series with timestamps between min
+// and max, inclusive, from a retention policy or every policy if it is blank.
+func (db *database) deleteSeriesRange(policy string, ids []uint64, min, max time.Time) error {
+	for _, rp := range db.policies {
+		if policy != "" && rp.Name != policy {
+			continue
+		}
+		if err := rp.deleteRange(ids, min, max); err != nil {
+			return fmt.Errorf("database.retentionPolicies.deleteRange: %s", err)
+		}
+	}
+	return nil
+}
+
+// seriesN returns the number of series in the database.
+func (db *database) seriesN() (n int) {
+	if db.meta == nil {
+		return 0
+	}
+	_ = db.meta.mustView(func(tx *metatx) error {
+		n = tx.seriesN(db.name)
+		return nil
+	})
+	return
+}
+
 // createMeasurementIfNotExists will either add a measurement object to the index or return the existing one.
 func (db *database) createMeasurementIfNotExists(name string) *Measurement {
 	idx := db.measurements[name]
 	if idx == nil {
 		idx = NewMeasurement(name)
+		idx.meta, idx.database = db.meta, db.name
 		db.measurements[name] = idx
 		db.names = append(db.names, name)
 		sort.Strings(db.names)
@@ -1345,7 +1445,7 @@ func (db *database) MeasurementAndSeries(name string, tags map[string]string) (*
 
 // SeriesByID returns the Series that has the given id.
 func (db *database) SeriesByID(id uint64) *Series {
-	return db.series[id]
+	return db.Series(id)
 }
 
 // Names returns all measurement names in sorted order.
@@ -1412,6 +1512,22 @@ func timeBetweenInclusive(t, min, max time.Time) bool {
 	return (t.Equal(min) || t.After(min)) && (t.Equal(max) || t.Before(max))
 }
 
+// minTime returns the earlier of two times.
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// maxTime returns the later of two times.
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
 // measurementsByExpr takes and expression containing only tags and returns
 // a list of matching *Measurement.
 func (db *database) measurementsByExpr(expr influxql.Expr) (Measurements, error) {
@@ -1487,8 +1603,8 @@ func (db *database) measurementsByTagFilters(filters []*TagFilter) Measurements
 	for _, m := range db.measurements {
 		// Iterate filters seeing if the measurement has a matching tag.
 		for _, f := range filters {
-			tagVals, ok := m.seriesByTagKeyValue[f.Key]
-			if !ok {
+			tagVals := m.tagValues(f.Key)
+			if len(tagVals) == 0 {
 				continue
 			}
 
@@ -1496,13 +1612,12 @@ func (db *database) measurementsByTagFilters(filters []*TagFilter) Measurements
 
 			// If the operator is non-regex, only check the specified value.
 			if f.Op == influxql.EQ || f.Op == influxql.NEQ {
-				if _, ok := tagVals[f.Value]; ok {
-					tagMatch = true
-				}
+				i := sort.SearchStrings(tagVals, f.Value)
+				tagMatch = i < len(tagVals) && tagVals[i] == f.Value
 			} else {
 				// Else, the operator is regex and we have to check all tag
 				// values against the regular expression.
-				for tagVal := range tagVals {
+				for _, tagVal := range tagVals {
 					if f.Regex.MatchString(tagVal) {
 						tagMatch = true
 						break
@@ -1551,20 +1666,29 @@ func (db *database) Measurements() Measurements {
 
 // tagKeys returns a list of the measurement's tag names.
 func (m *Measurement) tagKeys() []string {
-	keys := make([]string, 0, len(m.seriesByTagKeyValue))
-	for k := range m.seriesByTagKeyValue {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
+	keys := make([]string, 0)
+	m.index(func(mi *measurementIndex) { keys = append(keys, mi.tagKeys()...) })
 	return keys
 }
 
-func (m *Measurement) tagValuesByKeyAndSeriesID(tagKeys []string, ids seriesIDs) map[string]stringSet {
+// tagValues returns the sorted values of a tag key.
+func (m *Measurement) tagValues(key string) (values []string) {
+	m.index(func(mi *measurementIndex) { values = mi.tagValues(key) })
+	return
+}
+
+// hasTagValue returns true if any series has the value for the tag key.
+func (m *Measurement) hasTagValue(key, value string) (ok bool) {
+	m.index(func(mi *measurementIndex) { ok = mi.hasTagValue(key, value) })
+	return
+}
+
+// tagValuesByKeyAndSeriesID returns the values of the tag keys, or of all tag
+// keys if none are given, used by the given series.
+func (mi *measurementIndex) tagValuesByKeyAndSeriesID(tagKeys []string, ids seriesIDs) map[string]stringSet {
 	// If no tag keys were passed, get all tag keys for the measurement.
 	if len(tagKeys) == 0 {
-		for k := range m.seriesByTagKeyValue {
-			tagKeys = append(tagKeys, k)
-		}
+		tagKeys = mi.tagKeys()
 	}
 
 	// Mapping between tag keys to all existing tag values.
@@ -1572,8 +1696,8 @@ func (m *Measurement) tagValuesByKeyAndSeriesID(tagKeys []string, ids seriesIDs)
 
 	// Iterate all series to collect tag values.
 	for _, id := range ids {
-		s, ok := m.seriesByID[id]
-		if !ok {
+		s := mi.series(id)
+		if s == nil {
 			continue
 		}
 
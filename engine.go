@@ -0,0 +1,131 @@
+package influxdb
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultEngine is the name of the storage engine used by shards which don't
+// name one.
+const DefaultEngine = "bolt"
+
+// Engine stores the series data of a shard. Shards create their engine by name
+// from the engines registered with RegisterEngine, so engines can be selected
+// per retention policy.
+type Engine interface {
+	// Open opens or creates the store at path.
+	Open(path string) error
+
+	// Close closes the store.
+	Close() error
+
+	// Index returns the highest messaging index written to the store.
+	Index() uint64
+
+	// WriteBatch writes the values of each series, by series ID, and records
+	// the messaging index of the batch. Values replace existing values of the
+	// series with the same timestamp.
+	WriteBatch(index uint64, values map[uint64][]SeriesValue) error
+
+	// Begin starts a read-only transaction.
+	Begin() (EngineTx, error)
+
+	// DeleteSeries removes all values of the series.
+	DeleteSeries(seriesIDs ...uint64) error
+
+	// DeleteRange removes the values of the series with timestamps between min
+	// and max, inclusive.
+	DeleteRange(seriesIDs []uint64, min, max int64) error
+
+	// Snapshot returns a writer for a copy of the store as a single file, which
+	// the engine can open once restored, along with its size and index.
+	Snapshot() (size int64, index uint64, w SnapshotFileWriter, err error)
+
+	// Stats returns the engine's counters.
+	Stats() *Stats
+}
+
+// EngineCompactor is implemented by engines which can rewrite their data to
+// reclaim the space of deleted data.
+type EngineCompactor interface {
+	// Compact rewrites the store, recompressing its data if recompress is set,
+	// without interrupting open transactions. Returns the bytes reclaimed.
+	Compact(recompress bool) (int64, error)
+}
+
+// EngineTx is a consistent, read-only view of an engine's series data.
+type EngineTx interface {
+	// Cursor returns a cursor over the values of a series. Returns nil if the
+	// series has no values.
+	Cursor(seriesID uint64) EngineCursor
+
+	// Rollback ends the transaction.
+	Rollback() error
+}
+
+// EngineCursor iterates over the values of a series in timestamp order. Keys
+// are 8 byte big endian timestamps and values are encoded fields. Both return
+// a nil key once there are no more values or the values can't be read.
+type EngineCursor interface {
+	// Seek moves to the first value at or after the timestamp key.
+	Seek(seek []byte) (key, value []byte)
+
+	// Next moves to the next value.
+	Next() (key, value []byte)
+
+	// Last moves to the last value.
+	Last() (key, value []byte)
+
+	// Err returns the error which ended the iteration early, if any.
+	Err() error
+}
+
+// SeriesValue is the encoded fields of a series at a timestamp.
+type SeriesValue struct {
+	Timestamp int64
+	Data      []byte
+}
+
+var (
+	enginesMu sync.RWMutex
+	engines   = make(map[string]func() Engine)
+)
+
+// RegisterEngine makes an engine available by name. Panics if an engine is
+// already registered with the name.
+func RegisterEngine(name string, fn func() Engine) {
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+	if _, ok := engines[name]; ok {
+		panic("engine already registered: " + name)
+	}
+	engines[name] = fn
+}
+
+// NewEngine returns a new instance of the named engine. The default engine is
+// returned for a blank name.
+func NewEngine(name string) (Engine, error) {
+	if name == "" {
+		name = DefaultEngine
+	}
+
+	enginesMu.RLock()
+	defer enginesMu.RUnlock()
+	fn := engines[name]
+	if fn == nil {
+		return nil, ErrEngineNotFound
+	}
+	return fn(), nil
+}
+
+// Engines returns the sorted names of the registered engines.
+func Engines() []string {
+	enginesMu.RLock()
+	defer enginesMu.RUnlock()
+	var a []string
+	for name := range engines {
+		a = append(a, name)
+	}
+	sort.Strings(a)
+	return a
+}
@@ -17,6 +17,9 @@ const (
 
 	// DefaultGraphiteNameSeparator represents the default Graphite field separator.
 	DefaultGraphiteNameSeparator = "."
+
+	// DefaultGraphiteFieldName is the field name used when a template does not specify one.
+	DefaultGraphiteFieldName = "value"
 )
 
 var (
@@ -38,18 +41,30 @@ type SeriesWriter interface {
 
 // Server defines the interface all Graphite servers support.
 type Server interface {
+	// SetBatching sets the number of points buffered before a write and the
+	// maximum time they are buffered. It must be called before ListenAndServe.
+	SetBatching(size int, timeout time.Duration)
+
 	ListenAndServe(iface string) error
 	Host() string
 	Close() error
+
+	// Stats returns the counters for points received, batches written and
+	// parse failures.
+	Stats() *influxdb.Stats
 }
 
 // NewServer return a Graphite server for the given protocol, using the given parser
-// series writer, and database.
-func NewServer(protocol string, p *Parser, s SeriesWriter, db string) (Server, error) {
+// series writer, database and retention policy.
+func NewServer(protocol string, p *Parser, s SeriesWriter, db, rp string) (Server, error) {
 	if strings.ToLower(protocol) == "tcp" {
-		return NewTCPServer(p, s, db), nil
+		t := NewTCPServer(p, s, db)
+		t.RetentionPolicy = rp
+		return t, nil
 	} else if strings.ToLower(protocol) == "udp" {
-		return NewUDPServer(p, s, db), nil
+		u := NewUDPServer(p, s, db)
+		u.RetentionPolicy = rp
+		return u, nil
 	} else {
 		return nil, fmt.Errorf("unrecognized Graphite Server protocol %s", protocol)
 	}
@@ -59,6 +74,9 @@ func NewServer(protocol string, p *Parser, s SeriesWriter, db string) (Server, e
 type Parser struct {
 	Separator   string
 	LastEnabled bool
+
+	matcher     *matcher
+	defaultTags map[string]string
 }
 
 // NewParser returns a GraphiteParser instance.
@@ -74,27 +92,80 @@ func (p *Parser) Parse(line string) (influxdb.Point, error) {
 		return influxdb.Point{}, fmt.Errorf("received %q which doesn't have three fields", line)
 	}
 
-	// decode the name and tags
-	name, tags, err := p.DecodeNameAndTags(fields[0])
+	// Parse value.
+	v, err := strconv.ParseFloat(fields[1], 64)
 	if err != nil {
 		return influxdb.Point{}, err
 	}
 
-	// Parse value.
-	v, err := strconv.ParseFloat(fields[1], 64)
+	// Parse timestamp.
+	unixTime, err := strconv.ParseFloat(fields[2], 64)
 	if err != nil {
 		return influxdb.Point{}, err
 	}
 
-	fieldValues := make(map[string]interface{})
-	fieldValues[name] = v
+	return p.newPoint(fields[0], v, unixTime)
+}
 
-	// Parse timestamp.
-	unixTime, err := strconv.ParseFloat(fields[2], 64)
+// ParsePickle performs Graphite parsing of a Carbon pickle message, which
+// contains a list of (path, (timestamp, value)) tuples.
+func (p *Parser) ParsePickle(data []byte) ([]influxdb.Point, error) {
+	v, err := unpickle(data)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("pickle message is %T, expected list", v)
+	}
+
+	points := make([]influxdb.Point, 0, len(metrics))
+	for _, m := range metrics {
+		// Each metric is a tuple of (path, (timestamp, value)).
+		metric, ok := m.([]interface{})
+		if !ok || len(metric) != 2 {
+			return nil, fmt.Errorf("invalid pickle metric: %v", m)
+		}
+		path, ok := metric[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid pickle metric path: %v", metric[0])
+		}
+		datapoint, ok := metric[1].([]interface{})
+		if !ok || len(datapoint) != 2 {
+			return nil, fmt.Errorf("invalid pickle datapoint for %q: %v", path, metric[1])
+		}
+
+		unixTime, err := pickleFloat(datapoint[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pickle timestamp for %q: %s", path, err)
+		}
+		value, err := pickleFloat(datapoint[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pickle value for %q: %s", path, err)
+		}
+
+		point, err := p.newPoint(path, value, unixTime)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+// newPoint returns a point for a metric path, value and Unix timestamp in seconds.
+func (p *Parser) newPoint(path string, value, unixTime float64) (influxdb.Point, error) {
+	// decode the name, tags and field name
+	name, tags, field, err := p.DecodeMetric(path)
 	if err != nil {
 		return influxdb.Point{}, err
 	}
 
+	fieldValues := make(map[string]interface{})
+	fieldValues[field] = value
+
 	// Check if we have fractional seconds
 	timestamp := time.Unix(int64(unixTime), int64((unixTime-math.Floor(unixTime))*float64(time.Second)))
 
@@ -108,6 +179,145 @@ func (p *Parser) Parse(line string) (influxdb.Point, error) {
 	return point, nil
 }
 
+// pickleFloat converts a number decoded from a pickle to a float.
+func pickleFloat(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("unexpected type %T", v)
+}
+
+// SetTemplates configures the parser to decode metric paths using templates
+// instead of alternating tag keys and values. Each template has the form
+// "[filter] pattern [tag1=value1,tag2=value2]". The pattern of the template with
+// the most specific matching filter is applied to a path; a template without a
+// filter is used when no filter matches.
+//
+// Pattern parts name what the matching path part is used for: "measurement",
+// "field", a tag key, or nothing to skip the part. "measurement*" and "field*"
+// may be used as the last part to consume all remaining path parts. Multiple
+// measurement or field parts are joined using the separator.
+func (p *Parser) SetTemplates(templates []string) error {
+	m := newMatcher(p.Separator)
+	for _, s := range templates {
+		var filter, pattern, tags string
+
+		parts := strings.Fields(s)
+		switch len(parts) {
+		case 1:
+			pattern = parts[0]
+		case 2:
+			if strings.Contains(parts[1], "=") {
+				pattern, tags = parts[0], parts[1]
+			} else {
+				filter, pattern = parts[0], parts[1]
+			}
+		case 3:
+			filter, pattern, tags = parts[0], parts[1], parts[2]
+		default:
+			return fmt.Errorf("invalid template %q: expected [filter] pattern [tags]", s)
+		}
+
+		defaultTags, err := parseTags(tags)
+		if err != nil {
+			return fmt.Errorf("invalid template %q: %s", s, err)
+		}
+
+		t, err := newTemplate(pattern, defaultTags, p.Separator)
+		if err != nil {
+			return err
+		}
+		m.Add(filter, t)
+	}
+
+	p.matcher = m
+	return nil
+}
+
+// SetDefaultTags configures tags, in the form key=value, which are added to every
+// point unless the metric path or template already sets the tag.
+func (p *Parser) SetDefaultTags(tags []string) error {
+	defaultTags, err := parseTags(strings.Join(tags, ","))
+	if err != nil {
+		return err
+	}
+	p.defaultTags = defaultTags
+	return nil
+}
+
+// DecodeMetric returns the measurement name, tags and field name of a Graphite
+// metric path. If no templates are set, the path is decoded by DecodeNameAndTags
+// and the field is named after the measurement.
+//
+// Paths may use the Graphite tagged series syntax, name;tag1=value1;tag2=value2.
+// The tags of such a path take precedence over any other tags, and if no
+// templates are set the whole name is used as the measurement name.
+func (p *Parser) DecodeMetric(path string) (string, map[string]string, string, error) {
+	var (
+		name, field string
+		tags        map[string]string
+		seriesTags  map[string]string
+	)
+
+	if i := strings.Index(path, ";"); i != -1 {
+		var err error
+		if seriesTags, err = parseSeriesTags(path[i+1:]); err != nil {
+			return "", nil, "", fmt.Errorf("invalid tagged series %q: %s", path, err)
+		} else if i == 0 {
+			return "", nil, "", fmt.Errorf("no name specified for metric. %q", path)
+		}
+		path = path[:i]
+	}
+
+	if p.matcher == nil && seriesTags != nil {
+		name, tags, field = path, make(map[string]string), DefaultGraphiteFieldName
+	} else if p.matcher == nil {
+		var err error
+		name, tags, err = p.DecodeNameAndTags(path)
+		if err != nil {
+			return "", nil, "", err
+		}
+		field = name
+	} else {
+		name, tags, field = p.matcher.Match(path).Apply(path)
+		if name == "" {
+			return "", nil, "", fmt.Errorf("no measurement name found for metric %q", path)
+		}
+		if field == "" {
+			field = DefaultGraphiteFieldName
+		}
+	}
+
+	for k, v := range seriesTags {
+		tags[k] = v
+	}
+	for k, v := range p.defaultTags {
+		if _, ok := tags[k]; !ok {
+			tags[k] = v
+		}
+	}
+
+	return name, tags, field, nil
+}
+
+// parseSeriesTags parses the semicolon-separated tags of a tagged series.
+func parseSeriesTags(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, kv := range strings.Split(s, ";") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid tag %q: expected key=value", kv)
+		}
+		tags[parts[0]] = parts[1]
+	}
+	return tags, nil
+}
+
 // DecodeNameAndTags parses the name and tags of a single field of a Graphite datum.
 func (p *Parser) DecodeNameAndTags(field string) (string, map[string]string, error) {
 	var (
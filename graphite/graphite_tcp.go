@@ -2,23 +2,39 @@ package graphite
 
 import (
 	"bufio"
+	"io"
 	"log"
 	"net"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/influxdb/influxdb"
 )
 
-// TCPServer processes Graphite data received over TCP connections.
+// TCPServer processes Graphite data received over TCP connections. Points
+// from all connections are buffered and written in batches.
 type TCPServer struct {
 	writer   SeriesWriter
 	parser   *Parser
 	database string
 	listener *net.Listener
+	batcher  *influxdb.PointBatcher
+	stats    *influxdb.Stats
 
-	wg sync.WaitGroup
+	wg      sync.WaitGroup // accept loop and connections
+	writing sync.WaitGroup // batch writer
+	done    chan struct{}
+
+	// RetentionPolicy is the retention policy points are written to. If it is
+	// empty, the database's default retention policy is used.
+	RetentionPolicy string
+
+	// Points are buffered until BatchSize points are received or
+	// BatchTimeout has passed since the first buffered point.
+	BatchSize    int
+	BatchTimeout time.Duration
 
 	Logger *log.Logger
 
@@ -28,13 +44,26 @@ type TCPServer struct {
 // NewTCPServer returns a new instance of a TCPServer.
 func NewTCPServer(p *Parser, w SeriesWriter, db string) *TCPServer {
 	return &TCPServer{
-		parser:   p,
-		writer:   w,
-		database: db,
-		Logger:   log.New(os.Stderr, "[graphite] ", log.LstdFlags),
+		parser:       p,
+		writer:       w,
+		database:     db,
+		stats:        influxdb.NewStats("graphite_tcp"),
+		BatchSize:    influxdb.DefaultBatchSize,
+		BatchTimeout: influxdb.DefaultBatchTimeout,
+		Logger:       log.New(os.Stderr, "[graphite] ", log.LstdFlags),
 	}
 }
 
+// SetBatching sets the batch size and timeout used by the server.
+func (t *TCPServer) SetBatching(size int, timeout time.Duration) {
+	t.BatchSize, t.BatchTimeout = size, timeout
+}
+
+// Stats returns the server's counters.
+func (t *TCPServer) Stats() *influxdb.Stats {
+	return t.stats
+}
+
 // ListenAndServe instructs the TCPServer to start processing Graphite data
 // on the given interface. iface must be in the form host:port
 func (t *TCPServer) ListenAndServe(iface string) error {
@@ -49,6 +78,12 @@ func (t *TCPServer) ListenAndServe(iface string) error {
 	t.listener = &ln
 	t.host = ln.Addr().String()
 
+	t.batcher = influxdb.NewPointBatcher(t.BatchSize, t.BatchTimeout)
+	t.batcher.Start()
+	t.done = make(chan struct{})
+	t.writing.Add(1)
+	go t.writePoints()
+
 	t.Logger.Println("listening on TCP connection", ln.Addr().String())
 	t.wg.Add(1)
 	go func() {
@@ -75,12 +110,21 @@ func (t *TCPServer) Host() string {
 	return t.host
 }
 
+// Close stops the listener, waits for open connections to finish and writes
+// any buffered points.
 func (t *TCPServer) Close() error {
-	var err error
-	if t.listener != nil {
-		err = (*t.listener).Close()
+	if t.listener == nil {
+		return ErrServerClosed
 	}
+
+	err := (*t.listener).Close()
 	t.wg.Wait()
+
+	// Flush the remaining points before stopping the writer.
+	t.batcher.Stop()
+	close(t.done)
+	t.writing.Wait()
+
 	t.listener = nil
 	return err
 }
@@ -91,6 +135,14 @@ func (t *TCPServer) handleConnection(conn net.Conn) {
 	defer t.wg.Done()
 
 	reader := bufio.NewReader(conn)
+
+	// Pickle messages start with a 4-byte length header whose first byte is
+	// always zero, which can never start a plaintext metric.
+	if b, err := reader.Peek(1); err == nil && b[0] == 0 {
+		t.handlePickle(reader)
+		return
+	}
+
 	for {
 		// Read up to the next newline.
 		buf, err := reader.ReadBytes('\n')
@@ -104,14 +156,43 @@ func (t *TCPServer) handleConnection(conn net.Conn) {
 		// Parse it.
 		point, err := t.parser.Parse(line)
 		if err != nil {
+			t.stats.Inc("parseFail")
 			t.Logger.Printf("unable to parse data: %s", err)
 			continue
 		}
 
-		// Send the data to the writer.
-		_, e := t.writer.WriteSeries(t.database, "", []influxdb.Point{point})
-		if e != nil {
-			t.Logger.Printf("failed to write data point to database %q: %s\n", t.database, e)
+		t.stats.Inc("pointsRx")
+		t.batcher.In() <- point
+	}
+}
+
+// handlePickle services a connection sending Carbon pickle messages.
+func (t *TCPServer) handlePickle(r io.Reader) {
+	for {
+		buf, err := readPickle(r)
+		if err != nil {
+			if err != io.EOF {
+				t.Logger.Printf("unable to read pickle message: %s", err)
+			}
+			return
+		}
+
+		points, err := t.parser.ParsePickle(buf)
+		if err != nil {
+			t.stats.Inc("parseFail")
+			t.Logger.Printf("unable to parse pickle data: %s", err)
+			continue
+		}
+
+		t.stats.Add("pointsRx", int64(len(points)))
+		for _, p := range points {
+			t.batcher.In() <- p
 		}
 	}
 }
+
+// writePoints writes batches emitted by the batcher until the server is closed.
+func (t *TCPServer) writePoints() {
+	defer t.writing.Done()
+	influxdb.WriteBatches(t.batcher, t.writer, t.database, t.RetentionPolicy, t.stats, t.Logger, t.done)
+}
@@ -1,11 +1,16 @@
 package graphite_test
 
 import (
+	"encoding/binary"
+	"net"
+	"reflect"
 	"strconv"
 	"testing"
 	"time"
 
+	"github.com/influxdb/influxdb"
 	"github.com/influxdb/influxdb/graphite"
+	"github.com/influxdb/influxdb/test"
 )
 
 func Test_DecodeNameAndTags(t *testing.T) {
@@ -221,6 +226,425 @@ func Test_DecodeMetric(t *testing.T) {
 	}
 }
 
+func Test_DecodeMetric_Templates(t *testing.T) {
+	var tests = []struct {
+		test        string
+		templates   []string
+		defaultTags []string
+		path        string
+		name        string
+		tags        map[string]string
+		field       string
+		err         string
+	}{
+		{
+			test:      "measurement and field",
+			templates: []string{"servers.host.measurement.field"},
+			path:      "servers.web01.cpu.user",
+			name:      "cpu",
+			tags:      map[string]string{"servers": "servers", "host": "web01"},
+			field:     "user",
+		},
+		{
+			test:      "skipped parts",
+			templates: []string{".host.measurement.field"},
+			path:      "servers.web01.cpu.user",
+			name:      "cpu",
+			tags:      map[string]string{"host": "web01"},
+			field:     "user",
+		},
+		{
+			test:      "default field name",
+			templates: []string{".host.measurement"},
+			path:      "servers.web01.cpu",
+			name:      "cpu",
+			tags:      map[string]string{"host": "web01"},
+			field:     "value",
+		},
+		{
+			test:      "multiple measurement parts",
+			templates: []string{"measurement.measurement.region"},
+			path:      "cpu.load.us-west",
+			name:      "cpu.load",
+			tags:      map[string]string{"region": "us-west"},
+			field:     "value",
+		},
+		{
+			test:      "greedy measurement",
+			templates: []string{"region.measurement*"},
+			path:      "us-west.cpu.load.shortterm",
+			name:      "cpu.load.shortterm",
+			tags:      map[string]string{"region": "us-west"},
+			field:     "value",
+		},
+		{
+			test:      "greedy field",
+			templates: []string{"measurement.host.field*"},
+			path:      "cpu.web01.load.shortterm",
+			name:      "cpu",
+			tags:      map[string]string{"host": "web01"},
+			field:     "load.shortterm",
+		},
+		{
+			test:      "fewer path parts than template",
+			templates: []string{"measurement.host.field"},
+			path:      "cpu",
+			name:      "cpu",
+			tags:      map[string]string{},
+			field:     "value",
+		},
+		{
+			test:      "filter match",
+			templates: []string{"servers.* .host.measurement.field", "stats.* .measurement.host"},
+			path:      "stats.cpu.web01",
+			name:      "cpu",
+			tags:      map[string]string{"host": "web01"},
+			field:     "value",
+		},
+		{
+			test:      "exact filter preferred over wildcard",
+			templates: []string{"servers.*.cpu .host.measurement", "servers.web01.cpu ..measurement.field"},
+			path:      "servers.web01.cpu.user",
+			name:      "cpu",
+			tags:      map[string]string{},
+			field:     "user",
+		},
+		{
+			test:      "longest filter preferred",
+			templates: []string{"servers.* .host.measurement", "servers.*.cpu .host.measurement.field"},
+			path:      "servers.web01.cpu.user",
+			name:      "cpu",
+			tags:      map[string]string{"host": "web01"},
+			field:     "user",
+		},
+		{
+			test:      "default template when no filter matches",
+			templates: []string{"servers.* .host.measurement.field", "measurement.field"},
+			path:      "cpu.user",
+			name:      "cpu",
+			tags:      map[string]string{},
+			field:     "user",
+		},
+		{
+			test:      "whole path when no template matches",
+			templates: []string{"servers.* .host.measurement.field"},
+			path:      "cpu.user",
+			name:      "cpu.user",
+			tags:      map[string]string{},
+			field:     "value",
+		},
+		{
+			test:        "template and default tags",
+			templates:   []string{"servers.* .host.measurement region=us-west,zone=1a"},
+			defaultTags: []string{"zone=1c", "dc=dc1"},
+			path:        "servers.web01.cpu",
+			name:        "cpu",
+			tags:        map[string]string{"host": "web01", "region": "us-west", "zone": "1a", "dc": "dc1"},
+			field:       "value",
+		},
+		{
+			test:        "path tags override default tags",
+			templates:   []string{".host.measurement"},
+			defaultTags: []string{"host=unknown"},
+			path:        "servers.web01.cpu",
+			name:        "cpu",
+			tags:        map[string]string{"host": "web01"},
+			field:       "value",
+		},
+		{
+			test:      "no measurement in template",
+			templates: []string{"host.field"},
+			err:       `invalid template "host.field": no measurement specified`,
+		},
+		{
+			test:      "wildcard not last",
+			templates: []string{"measurement*.host"},
+			err:       `invalid template "measurement*.host": wildcard must be the last part`,
+		},
+		{
+			test:      "filter without measurement in template",
+			templates: []string{"measurement region"},
+			err:       `invalid template "region": no measurement specified`,
+		},
+		{
+			test:      "invalid tag format",
+			templates: []string{"servers.* measurement region=us-west,zone"},
+			err:       `invalid template "servers.* measurement region=us-west,zone": invalid tag "zone": expected key=value`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Logf("testing %q...", test.test)
+
+		p := graphite.NewParser()
+		if err := p.SetTemplates(test.templates); errstr(err) != test.err {
+			t.Fatalf("err does not match.  expected %v, got %v", test.err, err)
+		} else if err != nil {
+			continue
+		}
+		if err := p.SetDefaultTags(test.defaultTags); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		name, tags, field, err := p.DecodeMetric(test.path)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if name != test.name {
+			t.Fatalf("name parse failure.  expected %v, got %v", test.name, name)
+		}
+		if !reflect.DeepEqual(tags, test.tags) {
+			t.Fatalf("tags mismatch.  expected %v, got %v", test.tags, tags)
+		}
+		if field != test.field {
+			t.Fatalf("field parse failure.  expected %v, got %v", test.field, field)
+		}
+	}
+}
+
+func Test_Parse_Templates(t *testing.T) {
+	p := graphite.NewParser()
+	if err := p.SetTemplates([]string{"servers.* .host.measurement.field"}); err != nil {
+		t.Fatal(err)
+	}
+
+	point, err := p.Parse("servers.web01.cpu.user 50.5 1419972457")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if point.Name != "cpu" {
+		t.Fatalf("name mismatch.  expected %v, got %v", "cpu", point.Name)
+	}
+	if !reflect.DeepEqual(point.Tags, map[string]string{"host": "web01"}) {
+		t.Fatalf("tags mismatch.  got %v", point.Tags)
+	}
+	if !reflect.DeepEqual(point.Fields, map[string]interface{}{"user": 50.5}) {
+		t.Fatalf("fields mismatch.  got %v", point.Fields)
+	}
+	if !point.Timestamp.Equal(time.Unix(1419972457, 0)) {
+		t.Fatalf("timestamp mismatch.  got %v", point.Timestamp)
+	}
+}
+
+func Test_DecodeMetric_TaggedSeries(t *testing.T) {
+	var tests = []struct {
+		test      string
+		templates []string
+		path      string
+		name      string
+		tags      map[string]string
+		field     string
+		err       string
+	}{
+		{
+			test:  "tagged series without templates",
+			path:  "disk.used;host=web01;mount=/",
+			name:  "disk.used",
+			tags:  map[string]string{"host": "web01", "mount": "/"},
+			field: "value",
+		},
+		{
+			test:      "tagged series with templates",
+			templates: []string{"measurement.field"},
+			path:      "disk.used;host=web01",
+			name:      "disk",
+			tags:      map[string]string{"host": "web01"},
+			field:     "used",
+		},
+		{
+			test:      "series tags override template tags",
+			templates: []string{"host.measurement"},
+			path:      "web01.cpu;host=web02",
+			name:      "cpu",
+			tags:      map[string]string{"host": "web02"},
+			field:     "value",
+		},
+		{
+			test: "invalid tag",
+			path: "disk.used;host",
+			err:  `invalid tagged series "disk.used;host": invalid tag "host": expected key=value`,
+		},
+		{
+			test: "no name",
+			path: ";host=web01",
+			err:  `no name specified for metric. ";host=web01"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Logf("testing %q...", test.test)
+
+		p := graphite.NewParser()
+		if test.templates != nil {
+			if err := p.SetTemplates(test.templates); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		name, tags, field, err := p.DecodeMetric(test.path)
+		if errstr(err) != test.err {
+			t.Fatalf("err does not match.  expected %v, got %v", test.err, err)
+		} else if err != nil {
+			continue
+		}
+		if name != test.name {
+			t.Fatalf("name parse failure.  expected %v, got %v", test.name, name)
+		}
+		if !reflect.DeepEqual(tags, test.tags) {
+			t.Fatalf("tags mismatch.  expected %v, got %v", test.tags, tags)
+		}
+		if field != test.field {
+			t.Fatalf("field parse failure.  expected %v, got %v", test.field, field)
+		}
+	}
+}
+
+// Pickled [("servers.web01.cpu", (1419972457, 50.5)), ("disk.used;host=web01;mount=/", (1419972458.5, 42))]
+// using Python pickle protocols 0, 2 and 4.
+var pickleTests = map[string]string{
+	"protocol 0": "(lp0\n(Vservers.web01.cpu\np1\n(I1419972457\nF50.5\ntp2\ntp3\na(Vdisk.used;host=web01;mount=/\np4\n(F1419972458.5\nI42\ntp5\ntp6\na.",
+	"protocol 2": "\x80\x02]q\x00(X\x11\x00\x00\x00servers.web01.cpuq\x01Ji\x0f\xa3TG@I@\x00\x00\x00\x00\x00\x86q\x02\x86q\x03X\x1c\x00\x00\x00disk.used;host=web01;mount=/q\x04GA\xd5(\xc3\xda\xa0\x00\x00K*\x86q\x05\x86q\x06e.",
+	"protocol 4": "\x80\x04\x95Y\x00\x00\x00\x00\x00\x00\x00]\x94(\x8c\x11servers.web01.cpu\x94Ji\x0f\xa3TG@I@\x00\x00\x00\x00\x00\x86\x94\x86\x94\x8c\x1cdisk.used;host=web01;mount=/\x94GA\xd5(\xc3\xda\xa0\x00\x00K*\x86\x94\x86\x94e.",
+}
+
+func Test_ParsePickle(t *testing.T) {
+	for name, data := range pickleTests {
+		t.Logf("testing %q...", name)
+
+		p := graphite.NewParser()
+		points, err := p.ParsePickle([]byte(data))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		checkPicklePoints(t, points)
+	}
+}
+
+func Test_ParsePickle_Errors(t *testing.T) {
+	var tests = []struct {
+		test string
+		data string
+		err  string
+	}{
+		{test: "truncated", data: "\x80\x02]q\x00(X\x11\x00", err: "unexpected end of pickle"},
+		{test: "not a list", data: "K*.", err: "pickle message is int64, expected list"},
+		{test: "invalid metric", data: "]K*a.", err: "invalid pickle metric: 42"},
+		{test: "unsupported opcode", data: "c__builtin__\neval\n.", err: "unsupported pickle opcode: 0x63"},
+	}
+
+	for _, test := range tests {
+		t.Logf("testing %q...", test.test)
+
+		p := graphite.NewParser()
+		if _, err := p.ParsePickle([]byte(test.data)); errstr(err) != test.err {
+			t.Fatalf("err does not match.  expected %v, got %v", test.err, err)
+		}
+	}
+}
+
+func Test_TCPServer_Pickle(t *testing.T) {
+	w := make(test.SeriesWriter, 1)
+	s := graphite.NewTCPServer(graphite.NewParser(), w, "graphite")
+	s.BatchSize = 2
+	if err := s.ListenAndServe("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.Host())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Send a length-prefixed pickle message.
+	data := pickleTests["protocol 2"]
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	if _, err := conn.Write(append(header, data...)); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	checkPicklePoints(t, w.Wait(t).Points)
+}
+
+func Test_Server_Batching(t *testing.T) {
+	for _, protocol := range []string{"tcp", "udp"} {
+		t.Logf("testing %q...", protocol)
+
+		w := make(test.SeriesWriter, 1)
+		s, err := graphite.NewServer(protocol, graphite.NewParser(), w, "graphite", "raw")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.SetBatching(3, time.Hour)
+		if err := s.ListenAndServe("127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+
+		conn, err := net.Dial(protocol, s.Host())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Write([]byte("cpu 1 1419972457\nbad\ncpu 2 1419972458\ncpu 3 1419972459\ncpu 4 1419972460\n")); err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+
+		// The first batch is written once it is full.
+		b := w.Wait(t)
+		if b.Database != "graphite" || b.RetentionPolicy != "raw" {
+			t.Fatalf("unexpected destination: %s.%s", b.Database, b.RetentionPolicy)
+		} else if len(b.Points) != 3 {
+			t.Fatalf("unexpected number of points.  expected %d, got %d", 3, len(b.Points))
+		}
+
+		// The remaining point is written when the server is closed.
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if b := w.Wait(t); len(b.Points) != 1 {
+			t.Fatalf("unexpected number of points.  expected %d, got %d", 1, len(b.Points))
+		}
+
+		st := s.Stats()
+		if n := st.Get("pointsRx"); n != 4 {
+			t.Fatalf("unexpected pointsRx.  expected %d, got %d", 4, n)
+		} else if n := st.Get("batchesTx"); n != 2 {
+			t.Fatalf("unexpected batchesTx.  expected %d, got %d", 2, n)
+		} else if n := st.Get("parseFail"); n != 1 {
+			t.Fatalf("unexpected parseFail.  expected %d, got %d", 1, n)
+		}
+	}
+}
+
+// checkPicklePoints ensures points match the data encoded in pickleTests.
+func checkPicklePoints(t *testing.T, points []influxdb.Point) {
+	if len(points) != 2 {
+		t.Fatalf("unexpected number of points.  expected %d, got %d", 2, len(points))
+	}
+
+	if points[0].Name != "servers" {
+		t.Fatalf("name mismatch.  expected %v, got %v", "servers", points[0].Name)
+	} else if !reflect.DeepEqual(points[0].Tags, map[string]string{"web01": "cpu"}) {
+		t.Fatalf("tags mismatch.  got %v", points[0].Tags)
+	} else if !reflect.DeepEqual(points[0].Fields, map[string]interface{}{"servers": 50.5}) {
+		t.Fatalf("fields mismatch.  got %v", points[0].Fields)
+	} else if !points[0].Timestamp.Equal(time.Unix(1419972457, 0)) {
+		t.Fatalf("timestamp mismatch.  got %v", points[0].Timestamp)
+	}
+
+	if points[1].Name != "disk.used" {
+		t.Fatalf("name mismatch.  expected %v, got %v", "disk.used", points[1].Name)
+	} else if !reflect.DeepEqual(points[1].Tags, map[string]string{"host": "web01", "mount": "/"}) {
+		t.Fatalf("tags mismatch.  got %v", points[1].Tags)
+	} else if !reflect.DeepEqual(points[1].Fields, map[string]interface{}{"value": float64(42)}) {
+		t.Fatalf("fields mismatch.  got %v", points[1].Fields)
+	} else if !points[1].Timestamp.Equal(time.Unix(1419972458, int64(500*time.Millisecond))) {
+		t.Fatalf("timestamp mismatch.  got %v", points[1].Timestamp)
+	}
+}
+
 // Test Helpers
 func errstr(err error) string {
 	if err != nil {
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/influxdb/influxdb"
 )
@@ -14,14 +15,28 @@ const (
 	udpBufferSize = 65536
 )
 
-// UDPServer processes Graphite data received via UDP.
+// UDPServer processes Graphite data received via UDP. Received points are
+// buffered and written in batches.
 type UDPServer struct {
 	writer   SeriesWriter
 	parser   *Parser
 	database string
 	conn     *net.UDPConn
 	addr     *net.UDPAddr
-	wg       sync.WaitGroup
+	batcher  *influxdb.PointBatcher
+	stats    *influxdb.Stats
+
+	wg   sync.WaitGroup
+	done chan struct{}
+
+	// RetentionPolicy is the retention policy points are written to. If it is
+	// empty, the database's default retention policy is used.
+	RetentionPolicy string
+
+	// Points are buffered until BatchSize points are received or
+	// BatchTimeout has passed since the first buffered point.
+	BatchSize    int
+	BatchTimeout time.Duration
 
 	Logger *log.Logger
 
@@ -31,14 +46,27 @@ type UDPServer struct {
 // NewUDPServer returns a new instance of a UDPServer
 func NewUDPServer(p *Parser, w SeriesWriter, db string) *UDPServer {
 	u := UDPServer{
-		parser:   p,
-		writer:   w,
-		database: db,
-		Logger:   log.New(os.Stderr, "[graphite] ", log.LstdFlags),
+		parser:       p,
+		writer:       w,
+		database:     db,
+		stats:        influxdb.NewStats("graphite_udp"),
+		BatchSize:    influxdb.DefaultBatchSize,
+		BatchTimeout: influxdb.DefaultBatchTimeout,
+		Logger:       log.New(os.Stderr, "[graphite] ", log.LstdFlags),
 	}
 	return &u
 }
 
+// SetBatching sets the batch size and timeout used by the server.
+func (u *UDPServer) SetBatching(size int, timeout time.Duration) {
+	u.BatchSize, u.BatchTimeout = size, timeout
+}
+
+// Stats returns the server's counters.
+func (u *UDPServer) Stats() *influxdb.Stats {
+	return u.stats
+}
+
 // ListenAndServer instructs the UDPServer to start processing Graphite data
 // on the given interface. iface must be in the form host:port.
 func (u *UDPServer) ListenAndServe(iface string) error {
@@ -57,41 +85,66 @@ func (u *UDPServer) ListenAndServe(iface string) error {
 	if err != nil {
 		return err
 	}
+	u.conn = conn
+	u.host = conn.LocalAddr().String()
+	u.done = make(chan struct{})
+
+	u.batcher = influxdb.NewPointBatcher(u.BatchSize, u.BatchTimeout)
+	u.batcher.Start()
+
+	u.wg.Add(2)
+	go u.serve()
+	go u.writePoints()
+	return nil
+}
 
-	u.host = u.addr.String()
+// serve reads datagrams until the connection is closed.
+func (u *UDPServer) serve() {
+	defer u.wg.Done()
+	defer close(u.done)
+	defer u.batcher.Stop()
 
 	buf := make([]byte, udpBufferSize)
-	u.wg.Add(1)
-	go func() {
-		defer u.wg.Done()
-		for {
-			n, _, err := conn.ReadFromUDP(buf)
-			if err != nil {
-				return
+	for {
+		n, _, err := u.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
 			}
-			for _, line := range strings.Split(string(buf[:n]), "\n") {
-				point, err := u.parser.Parse(line)
-				if err != nil {
-					continue
-				}
-
-				// Send the data to the writer.
-				_, e := u.writer.WriteSeries(u.database, "", []influxdb.Point{point})
-				if e != nil {
-					u.Logger.Printf("failed to write data point: %s\n", e)
-				}
+
+			point, err := u.parser.Parse(line)
+			if err != nil {
+				u.stats.Inc("parseFail")
+				continue
 			}
+
+			u.stats.Inc("pointsRx")
+			u.batcher.In() <- point
 		}
-	}()
-	return nil
+	}
+}
+
+// writePoints writes batches emitted by the batcher until the server is closed.
+func (u *UDPServer) writePoints() {
+	defer u.wg.Done()
+	influxdb.WriteBatches(u.batcher, u.writer, u.database, u.RetentionPolicy, u.stats, u.Logger, u.done)
 }
 
 func (u *UDPServer) Host() string {
 	return u.host
 }
 
+// Close stops the listener and writes any buffered points.
 func (u *UDPServer) Close() error {
-	err := u.Close()
-	u.wg.Done()
+	if u.conn == nil {
+		return ErrServerClosed
+	}
+
+	err := u.conn.Close()
+	u.wg.Wait()
+	u.conn = nil
 	return err
 }
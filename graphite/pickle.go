@@ -0,0 +1,368 @@
+package graphite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxPickleSize is the largest pickle message accepted, matching Carbon's limit.
+const maxPickleSize = 1 << 20
+
+var (
+	// ErrPickleTooLarge is returned when a pickle message exceeds the maximum size.
+	ErrPickleTooLarge = errors.New("pickle message too large")
+
+	// errPickleStackUnderflow is returned when an opcode requires more values than are on the stack.
+	errPickleStackUnderflow = errors.New("pickle stack underflow")
+)
+
+// readPickle reads a single length-prefixed pickle message as sent by carbon-relay.
+func readPickle(r io.Reader) ([]byte, error) {
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	} else if n > maxPickleSize {
+		return nil, ErrPickleTooLarge
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// pickleMark separates groups of values on the unpickler stack.
+type pickleMark struct{}
+
+// unpickle decodes the subset of the Python pickle format (protocols 0 to 4)
+// needed to read Carbon messages: lists and tuples of strings, integers and
+// floats. Lists and tuples are returned as []interface{}.
+func unpickle(data []byte) (interface{}, error) {
+	var (
+		r     = bytes.NewReader(data)
+		stack []interface{}
+		memo  = make(map[int]interface{})
+	)
+
+	pop := func() (interface{}, error) {
+		if len(stack) == 0 {
+			return nil, errPickleStackUnderflow
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v, nil
+	}
+
+	// popMark removes and returns all values above the topmost mark.
+	popMark := func() ([]interface{}, error) {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if _, ok := stack[i].(pickleMark); ok {
+				items := append([]interface{}{}, stack[i+1:]...)
+				stack = stack[:i]
+				return items, nil
+			}
+		}
+		return nil, errors.New("pickle mark not found")
+	}
+
+	// appendItems adds items to the list at the top of the stack.
+	appendItems := func(items ...interface{}) error {
+		if len(stack) == 0 {
+			return errPickleStackUnderflow
+		}
+		list, ok := stack[len(stack)-1].([]interface{})
+		if !ok {
+			return fmt.Errorf("cannot append to %T", stack[len(stack)-1])
+		}
+		stack[len(stack)-1] = append(list, items...)
+		return nil
+	}
+
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("unexpected end of pickle")
+		}
+
+		switch op {
+		case '.': // STOP
+			return pop()
+
+		case 0x80: // PROTO
+			if _, err := r.ReadByte(); err != nil {
+				return nil, err
+			}
+		case 0x95: // FRAME
+			if _, err := readBytes(r, 8); err != nil {
+				return nil, err
+			}
+
+		case '(': // MARK
+			stack = append(stack, pickleMark{})
+		case ']': // EMPTY_LIST
+			stack = append(stack, []interface{}{})
+		case ')': // EMPTY_TUPLE
+			stack = append(stack, []interface{}{})
+		case 'l', 't': // LIST, TUPLE
+			items, err := popMark()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, items)
+		case 0x85, 0x86, 0x87: // TUPLE1, TUPLE2, TUPLE3
+			n := int(op-0x85) + 1
+			if len(stack) < n {
+				return nil, errPickleStackUnderflow
+			}
+			items := append([]interface{}{}, stack[len(stack)-n:]...)
+			stack = append(stack[:len(stack)-n], items)
+		case 'a': // APPEND
+			v, err := pop()
+			if err != nil {
+				return nil, err
+			} else if err := appendItems(v); err != nil {
+				return nil, err
+			}
+		case 'e': // APPENDS
+			items, err := popMark()
+			if err != nil {
+				return nil, err
+			} else if err := appendItems(items...); err != nil {
+				return nil, err
+			}
+
+		case 'N': // NONE
+			stack = append(stack, nil)
+		case 0x88: // NEWTRUE
+			stack = append(stack, true)
+		case 0x89: // NEWFALSE
+			stack = append(stack, false)
+
+		case 'J': // BININT
+			b, err := readBytes(r, 4)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, int64(int32(binary.LittleEndian.Uint32(b))))
+		case 'K': // BININT1
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, int64(b))
+		case 'M': // BININT2
+			b, err := readBytes(r, 2)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, int64(binary.LittleEndian.Uint16(b)))
+		case 0x8a: // LONG1
+			n, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			b, err := readBytes(r, int(n))
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeLong(b)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, v)
+		case 'G': // BINFLOAT
+			b, err := readBytes(r, 8)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, math.Float64frombits(binary.BigEndian.Uint64(b)))
+		case 'I', 'L', 'F': // INT, LONG, FLOAT
+			line, err := readLine(r)
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeNumber(op, line)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, v)
+
+		case 'U', 0x8c: // SHORT_BINSTRING, SHORT_BINUNICODE
+			n, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			b, err := readBytes(r, int(n))
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, string(b))
+		case 'T', 'X': // BINSTRING, BINUNICODE
+			b, err := readBytes(r, 4)
+			if err != nil {
+				return nil, err
+			}
+			b, err = readBytes(r, int(binary.LittleEndian.Uint32(b)))
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, string(b))
+		case 'S': // STRING
+			line, err := readLine(r)
+			if err != nil {
+				return nil, err
+			}
+			s, err := decodeString(line)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, s)
+		case 'V': // UNICODE
+			line, err := readLine(r)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, line)
+
+		case 'p': // PUT
+			line, err := readLine(r)
+			if err != nil {
+				return nil, err
+			}
+			i, err := strconv.Atoi(line)
+			if err != nil {
+				return nil, err
+			} else if len(stack) == 0 {
+				return nil, errPickleStackUnderflow
+			}
+			memo[i] = stack[len(stack)-1]
+		case 'q': // BINPUT
+			i, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			} else if len(stack) == 0 {
+				return nil, errPickleStackUnderflow
+			}
+			memo[int(i)] = stack[len(stack)-1]
+		case 'r': // LONG_BINPUT
+			b, err := readBytes(r, 4)
+			if err != nil {
+				return nil, err
+			} else if len(stack) == 0 {
+				return nil, errPickleStackUnderflow
+			}
+			memo[int(binary.LittleEndian.Uint32(b))] = stack[len(stack)-1]
+		case 0x94: // MEMOIZE
+			if len(stack) == 0 {
+				return nil, errPickleStackUnderflow
+			}
+			memo[len(memo)] = stack[len(stack)-1]
+		case 'g': // GET
+			line, err := readLine(r)
+			if err != nil {
+				return nil, err
+			}
+			i, err := strconv.Atoi(line)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, memo[i])
+		case 'h': // BINGET
+			i, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, memo[int(i)])
+		case 'j': // LONG_BINGET
+			b, err := readBytes(r, 4)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, memo[int(binary.LittleEndian.Uint32(b))])
+
+		default:
+			return nil, fmt.Errorf("unsupported pickle opcode: 0x%02x", op)
+		}
+	}
+}
+
+// readBytes reads exactly n bytes from r.
+func readBytes(r *bytes.Reader, n int) ([]byte, error) {
+	if n > r.Len() {
+		return nil, fmt.Errorf("unexpected end of pickle")
+	}
+	b := make([]byte, n)
+	_, err := io.ReadFull(r, b)
+	return b, err
+}
+
+// readLine reads up to the next newline, which is not included in the result.
+func readLine(r *bytes.Reader) (string, error) {
+	var buf bytes.Buffer
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", fmt.Errorf("unexpected end of pickle")
+		} else if c == '\n' {
+			return buf.String(), nil
+		}
+		buf.WriteByte(c)
+	}
+}
+
+// decodeLong decodes a little-endian two's complement integer of up to 8 bytes.
+func decodeLong(b []byte) (int64, error) {
+	if len(b) > 8 {
+		return 0, fmt.Errorf("pickle integer too large")
+	}
+
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+
+	// Sign extend negative values.
+	if n := uint(len(b)); n > 0 && n < 8 && b[n-1]&0x80 != 0 {
+		v |= ^uint64(0) << (n * 8)
+	}
+	return int64(v), nil
+}
+
+// decodeString decodes a quoted protocol 0 string.
+func decodeString(s string) (string, error) {
+	if len(s) < 2 || (s[0] != '\'' && s[0] != '"') || s[len(s)-1] != s[0] {
+		return "", fmt.Errorf("invalid pickle string: %s", s)
+	}
+
+	body := s[1 : len(s)-1]
+	if s[0] == '\'' {
+		body = strings.Replace(body, `\'`, `'`, -1)
+		body = strings.Replace(body, `"`, `\"`, -1)
+	}
+
+	if v, err := strconv.Unquote(`"` + body + `"`); err == nil {
+		return v, nil
+	}
+	return body, nil
+}
+
+// decodeNumber decodes the text representation of a protocol 0 number.
+func decodeNumber(op byte, s string) (interface{}, error) {
+	switch {
+	case op == 'F':
+		return strconv.ParseFloat(s, 64)
+	case s == "00":
+		return false, nil
+	case s == "01":
+		return true, nil
+	default:
+		return strconv.ParseInt(strings.TrimSuffix(s, "L"), 10, 64)
+	}
+}
@@ -0,0 +1,191 @@
+package graphite
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// template represents a pattern used to map a Graphite metric path to a
+// measurement name, a set of tags and a field name. Each part of the template
+// names what the matching part of the metric path is used for: "measurement",
+// "field", a tag key, or an empty string to ignore the part. A trailing
+// "measurement*" or "field*" consumes all remaining parts.
+type template struct {
+	tags        []string
+	defaultTags map[string]string
+	separator   string
+}
+
+// newTemplate returns a template for the given pattern and default tags.
+func newTemplate(pattern string, defaultTags map[string]string, separator string) (*template, error) {
+	tags := strings.Split(pattern, separator)
+
+	var hasMeasurement bool
+	for i, tag := range tags {
+		switch tag {
+		case "measurement", "measurement*":
+			hasMeasurement = true
+		}
+		if strings.HasSuffix(tag, "*") && i != len(tags)-1 {
+			return nil, fmt.Errorf("invalid template %q: wildcard must be the last part", pattern)
+		}
+	}
+	if !hasMeasurement {
+		return nil, fmt.Errorf("invalid template %q: no measurement specified", pattern)
+	}
+
+	return &template{tags: tags, defaultTags: defaultTags, separator: separator}, nil
+}
+
+// Apply extracts the measurement name, tags and field name from a metric path.
+// The field name is empty if the template does not specify one.
+func (t *template) Apply(path string) (string, map[string]string, string) {
+	var (
+		parts       = strings.Split(path, t.separator)
+		measurement []string
+		field       []string
+		tags        = make(map[string]string)
+	)
+
+	for k, v := range t.defaultTags {
+		tags[k] = v
+	}
+
+	for i, tag := range t.tags {
+		if i >= len(parts) {
+			break
+		}
+
+		switch tag {
+		case "":
+			continue
+		case "measurement":
+			measurement = append(measurement, parts[i])
+		case "field":
+			field = append(field, parts[i])
+		case "measurement*":
+			measurement = append(measurement, parts[i:]...)
+		case "field*":
+			field = append(field, parts[i:]...)
+		default:
+			tags[tag] = parts[i]
+		}
+	}
+
+	return strings.Join(measurement, t.separator), tags, strings.Join(field, t.separator)
+}
+
+// matcher determines which template applies to a metric path.
+type matcher struct {
+	root            *node
+	defaultTemplate *template
+	separator       string
+}
+
+// newMatcher returns a matcher which uses the whole metric path as the
+// measurement name until a default template is added.
+func newMatcher(separator string) *matcher {
+	return &matcher{
+		root:            &node{},
+		defaultTemplate: &template{tags: []string{"measurement*"}, separator: separator},
+		separator:       separator,
+	}
+}
+
+// Add registers a template for a filter. An empty filter sets the default template.
+func (m *matcher) Add(filter string, t *template) {
+	if filter == "" {
+		m.defaultTemplate = t
+		return
+	}
+	m.root.Insert(strings.Split(filter, m.separator), t)
+}
+
+// Match returns the template with the most specific filter matching path,
+// or the default template if no filter matches.
+func (m *matcher) Match(path string) *template {
+	if t := m.root.Search(strings.Split(path, m.separator)); t != nil {
+		return t
+	}
+	return m.defaultTemplate
+}
+
+// node is an element of the filter tree. Each level of the tree matches
+// one part of a metric path, either exactly or with a "*" wildcard.
+type node struct {
+	value    string
+	children nodes
+	template *template
+}
+
+// Insert adds a template to the tree at the location described by filter.
+func (n *node) Insert(filter []string, t *template) {
+	if len(filter) == 0 {
+		n.template = t
+		return
+	}
+
+	// Find or create the child for the next filter part.
+	var child *node
+	for _, c := range n.children {
+		if c.value == filter[0] {
+			child = c
+			break
+		}
+	}
+	if child == nil {
+		child = &node{value: filter[0]}
+		n.children = append(n.children, child)
+
+		// Keep exact matches ahead of wildcards so they are preferred.
+		sort.Sort(n.children)
+	}
+
+	child.Insert(filter[1:], t)
+}
+
+// Search returns the template of the deepest node matching the path parts.
+func (n *node) Search(parts []string) *template {
+	if len(parts) > 0 {
+		for _, c := range n.children {
+			if c.value != parts[0] && c.value != "*" {
+				continue
+			}
+			if t := c.Search(parts[1:]); t != nil {
+				return t
+			}
+		}
+	}
+	return n.template
+}
+
+type nodes []*node
+
+func (a nodes) Len() int      { return len(a) }
+func (a nodes) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+
+// Less orders wildcards after exact values.
+func (a nodes) Less(i, j int) bool {
+	if a[i].value == "*" || a[j].value == "*" {
+		return a[j].value == "*" && a[i].value != "*"
+	}
+	return a[i].value < a[j].value
+}
+
+// parseTags parses a comma-separated list of key=value pairs.
+func parseTags(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	if s == "" {
+		return tags, nil
+	}
+
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid tag %q: expected key=value", kv)
+		}
+		tags[parts[0]] = parts[1]
+	}
+	return tags, nil
+}
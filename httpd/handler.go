@@ -134,6 +134,14 @@ func NewAPIHandler(s *influxdb.Server, requireAuthentication, loggingEnabled boo
 		route{
 			"dump", // export all points in the given db.
 			"GET", "/dump", true, true, h.serveDump,
+		},
+		route{
+			"prometheus-write", // Prometheus remote write.
+			"POST", "/api/v1/prom/write", false, true, h.servePromWrite,
+		},
+		route{
+			"prometheus-read", // Prometheus remote read.
+			"POST", "/api/v1/prom/read", false, true, h.servePromRead,
 		}})
 	return h
 }
@@ -528,6 +536,12 @@ func (h *Handler) serveWrite(w http.ResponseWriter, r *http.Request, user *influ
 	}
 
 	if index, err := h.server.WriteSeries(bp.Database, bp.RetentionPolicy, points); err != nil {
+		// Report which points were dropped when the others were written.
+		if _, ok := err.(influxdb.ErrPartialWrite); ok {
+			w.Header().Add("X-InfluxDB-Index", fmt.Sprintf("%d", index))
+			writeError(influxdb.Result{Err: err}, http.StatusBadRequest)
+			return
+		}
 		writeError(influxdb.Result{Err: err}, http.StatusInternalServerError)
 		return
 	} else {
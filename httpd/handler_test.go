@@ -11,15 +11,18 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang/snappy"
 	"github.com/influxdb/influxdb"
 	"github.com/influxdb/influxdb/client"
 	"github.com/influxdb/influxdb/httpd"
 	"github.com/influxdb/influxdb/influxql"
+	"github.com/influxdb/influxdb/prometheus"
 	"github.com/influxdb/influxdb/test"
 )
 
@@ -1133,6 +1136,32 @@ func TestHandler_serveWriteSeries(t *testing.T) {
 	}
 }
 
+// Ensure points dropped by the series limits are reported while the others are written.
+func TestHandler_serveWriteSeries_PartialWrite(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	srvr := OpenAuthlessServer(c)
+	srvr.CreateDatabase("foo")
+	srvr.MaxSeriesPerDatabase = 1
+	s := NewAPIServer(srvr)
+	defer s.Close()
+
+	status, body := MustHTTP("POST", s.URL+`/write`, nil, nil, `{"database" : "foo", "retentionPolicy" : "default", "points": [{"name": "cpu", "tags": {"host": "server01"},"timestamp": "2009-11-10T23:00:00Z","fields": {"value": 100}}, {"name": "cpu", "tags": {"host": "server02"},"timestamp": "2009-11-10T23:00:00Z","fields": {"value": 100}}]}`)
+	if status != http.StatusBadRequest {
+		t.Fatalf("unexpected status for post: %d", status)
+	} else if body != `{"error":"1 points dropped: max series per database exceeded: foo (1): cpu,host=server02 2009-11-10T23:00:00Z"}` {
+		t.Fatalf("unexpected body: %s", body)
+	}
+
+	query := map[string]string{"db": "foo", "q": "select * from cpu"}
+	status, body = MustHTTP("GET", s.URL+`/query`, query, nil, "")
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status for get: %d", status)
+	} else if !strings.Contains(body, `"name":"cpu"`) {
+		t.Fatalf("Write doesn't match query results. Response body is %s.", body)
+	}
+}
+
 func TestHandler_serveDump(t *testing.T) {
 	c := test.NewDefaultMessagingClient()
 	defer c.Close()
@@ -1563,6 +1592,233 @@ func TestHandler_serveWriteSeriesFieldTypeConflict(t *testing.T) {
 	}
 }
 
+// Ensure samples sent by Prometheus remote write can be read back by remote read.
+func TestHandler_PrometheusWriteRead(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	srvr := OpenAuthlessServer(c)
+	srvr.CreateDatabase("foo")
+	s := NewAPIServer(srvr)
+	defer s.Close()
+
+	wr := &prometheus.WriteRequest{Timeseries: []prometheus.TimeSeries{
+		{
+			Labels:  []prometheus.Label{{Name: "__name__", Value: "http_requests_total"}, {Name: "job", Value: "api"}, {Name: "code", Value: "200"}},
+			Samples: []prometheus.Sample{{Value: 10, TimestampMs: 1420070400000}, {Value: 12, TimestampMs: 1420070410000}},
+		},
+		{
+			Labels:  []prometheus.Label{{Name: "__name__", Value: "http_requests_total"}, {Name: "job", Value: "api"}, {Name: "code", Value: "500"}},
+			Samples: []prometheus.Sample{{Value: 1, TimestampMs: 1420070400000}},
+		},
+		{
+			Labels:  []prometheus.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}},
+			Samples: []prometheus.Sample{{Value: 1, TimestampMs: 1420070400000}},
+		},
+	}}
+	status, body := MustHTTP("POST", s.URL+`/api/v1/prom/write`, map[string]string{"db": "foo"}, nil, string(snappy.Encode(nil, wr.Marshal())))
+	if status != http.StatusNoContent {
+		t.Fatalf("unexpected status for write: %d: %s", status, body)
+	}
+	time.Sleep(100 * time.Millisecond) // Ensure data node picks up write.
+
+	rr := &prometheus.ReadRequest{Queries: []prometheus.Query{
+		{
+			StartTimestampMs: 1420070400000,
+			EndTimestampMs:   1420070405000,
+			Matchers: []prometheus.LabelMatcher{
+				{Type: prometheus.MatchEqual, Name: "__name__", Value: "http_requests_total"},
+				{Type: prometheus.MatchRegexp, Name: "code", Value: "2.."},
+			},
+		},
+		{
+			StartTimestampMs: 1420070400000,
+			EndTimestampMs:   1420070420000,
+			Matchers: []prometheus.LabelMatcher{
+				{Type: prometheus.MatchRegexp, Name: "__name__", Value: "http_.*|up"},
+				{Type: prometheus.MatchNotEqual, Name: "__name__", Value: "up"},
+				{Type: prometheus.MatchEqual, Name: "job", Value: "api"},
+			},
+		},
+	}}
+	resp, err := http.Post(s.URL+`/api/v1/prom/read?db=foo`, "application/x-protobuf", bytes.NewReader(snappy.Encode(nil, rr.Marshal())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status for read: %d: %s", resp.StatusCode, b)
+	}
+
+	buf, err := snappy.Decode(nil, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rresp prometheus.ReadResponse
+	if err := rresp.Unmarshal(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []prometheus.QueryResult{
+		{Timeseries: []prometheus.TimeSeries{{
+			Labels:  []prometheus.Label{{Name: "__name__", Value: "http_requests_total"}, {Name: "code", Value: "200"}, {Name: "job", Value: "api"}},
+			Samples: []prometheus.Sample{{Value: 10, TimestampMs: 1420070400000}},
+		}}},
+		{Timeseries: []prometheus.TimeSeries{
+			{
+				Labels:  []prometheus.Label{{Name: "__name__", Value: "http_requests_total"}, {Name: "code", Value: "200"}, {Name: "job", Value: "api"}},
+				Samples: []prometheus.Sample{{Value: 10, TimestampMs: 1420070400000}, {Value: 12, TimestampMs: 1420070410000}},
+			},
+			{
+				Labels:  []prometheus.Label{{Name: "__name__", Value: "http_requests_total"}, {Name: "code", Value: "500"}, {Name: "job", Value: "api"}},
+				Samples: []prometheus.Sample{{Value: 1, TimestampMs: 1420070400000}},
+			},
+		}},
+	}
+	if !reflect.DeepEqual(rresp.Results, exp) {
+		t.Fatalf("unexpected results.\n\nexp: %#v\n\ngot: %#v", exp, rresp.Results)
+	}
+}
+
+// Ensure remote read treats a missing label as an empty value.
+func TestHandler_PrometheusRead_MissingLabels(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	srvr := OpenAuthlessServer(c)
+	srvr.CreateDatabase("foo")
+	s := NewAPIServer(srvr)
+	defer s.Close()
+
+	// "up" has series with and without a job and "build_info" has no job.
+	wr := &prometheus.WriteRequest{Timeseries: []prometheus.TimeSeries{
+		{
+			Labels:  []prometheus.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}},
+			Samples: []prometheus.Sample{{Value: 1, TimestampMs: 1420070400000}},
+		},
+		{
+			Labels:  []prometheus.Label{{Name: "__name__", Value: "up"}, {Name: "instance", Value: "a"}},
+			Samples: []prometheus.Sample{{Value: 2, TimestampMs: 1420070400000}},
+		},
+		{
+			Labels:  []prometheus.Label{{Name: "__name__", Value: "build_info"}, {Name: "version", Value: "1"}},
+			Samples: []prometheus.Sample{{Value: 3, TimestampMs: 1420070400000}},
+		},
+	}}
+	status, body := MustHTTP("POST", s.URL+`/api/v1/prom/write`, map[string]string{"db": "foo"}, nil, string(snappy.Encode(nil, wr.Marshal())))
+	if status != http.StatusNoContent {
+		t.Fatalf("unexpected status for write: %d: %s", status, body)
+	}
+	time.Sleep(100 * time.Millisecond) // Ensure data node picks up write.
+
+	query := func(m prometheus.LabelMatcher) prometheus.Query {
+		return prometheus.Query{
+			StartTimestampMs: 1420070400000,
+			EndTimestampMs:   1420070410000,
+			Matchers:         []prometheus.LabelMatcher{{Type: prometheus.MatchRegexp, Name: "__name__", Value: "up|build_info"}, m},
+		}
+	}
+	rr := &prometheus.ReadRequest{Queries: []prometheus.Query{
+		query(prometheus.LabelMatcher{Type: prometheus.MatchNotEqual, Name: "job", Value: "api"}),
+		query(prometheus.LabelMatcher{Type: prometheus.MatchEqual, Name: "job", Value: ""}),
+		query(prometheus.LabelMatcher{Type: prometheus.MatchNotEqual, Name: "job", Value: ""}),
+		query(prometheus.LabelMatcher{Type: prometheus.MatchRegexp, Name: "job", Value: "a.*|"}),
+		query(prometheus.LabelMatcher{Type: prometheus.MatchNotRegexp, Name: "job", Value: "x|"}),
+	}}
+	resp, err := http.Post(s.URL+`/api/v1/prom/read?db=foo`, "application/x-protobuf", bytes.NewReader(snappy.Encode(nil, rr.Marshal())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status for read: %d: %s", resp.StatusCode, b)
+	}
+
+	buf, err := snappy.Decode(nil, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rresp prometheus.ReadResponse
+	if err := rresp.Unmarshal(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		withJob = prometheus.TimeSeries{
+			Labels:  []prometheus.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}},
+			Samples: []prometheus.Sample{{Value: 1, TimestampMs: 1420070400000}},
+		}
+		withoutJob = prometheus.TimeSeries{
+			Labels:  []prometheus.Label{{Name: "__name__", Value: "up"}, {Name: "instance", Value: "a"}},
+			Samples: []prometheus.Sample{{Value: 2, TimestampMs: 1420070400000}},
+		}
+		withoutJobKey = prometheus.TimeSeries{
+			Labels:  []prometheus.Label{{Name: "__name__", Value: "build_info"}, {Name: "version", Value: "1"}},
+			Samples: []prometheus.Sample{{Value: 3, TimestampMs: 1420070400000}},
+		}
+	)
+	exp := []prometheus.QueryResult{
+		{Timeseries: []prometheus.TimeSeries{withoutJobKey, withoutJob}},
+		{Timeseries: []prometheus.TimeSeries{withoutJobKey, withoutJob}},
+		{Timeseries: []prometheus.TimeSeries{withJob}},
+		{Timeseries: []prometheus.TimeSeries{withoutJobKey, withoutJob, withJob}},
+		{Timeseries: []prometheus.TimeSeries{withJob}},
+	}
+	if !reflect.DeepEqual(rresp.Results, exp) {
+		t.Fatalf("unexpected results.\n\nexp: %#v\n\ngot: %#v", exp, rresp.Results)
+	}
+}
+
+func TestHandler_PrometheusWrite_Errors(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	srvr := OpenAuthlessServer(c)
+	srvr.CreateDatabase("foo")
+	s := NewAPIServer(srvr)
+	defer s.Close()
+
+	noName := &prometheus.WriteRequest{Timeseries: []prometheus.TimeSeries{{
+		Labels:  []prometheus.Label{{Name: "job", Value: "api"}},
+		Samples: []prometheus.Sample{{Value: 1, TimestampMs: 1420070400000}},
+	}}}
+
+	for i, tt := range []struct {
+		db     string
+		body   string
+		status int
+		err    string
+	}{
+		{db: "", body: "", status: http.StatusBadRequest, err: `missing required parameter \"db\"`},
+		{db: "bar", body: "", status: http.StatusNotFound, err: `database not found: \"bar\"`},
+		{db: "foo", body: "not snappy", status: http.StatusBadRequest, err: "invalid snappy encoding"},
+		{db: "foo", body: string(snappy.Encode(nil, noName.Marshal())), status: http.StatusBadRequest, err: "time series has no __name__ label"},
+		{db: "foo", body: "\xff\xff\xff\xff\x0f", status: http.StatusBadRequest, err: "request too large: 4294967295 bytes decoded"},
+	} {
+		status, body := MustHTTP("POST", s.URL+`/api/v1/prom/write`, map[string]string{"db": tt.db}, nil, tt.body)
+		if status != tt.status {
+			t.Fatalf("%d. unexpected status: %d", i, status)
+		} else if !strings.Contains(body, tt.err) {
+			t.Fatalf("%d. unexpected error: %s", i, body)
+		}
+	}
+}
+
+func TestHandler_PrometheusRead_Unauthorized(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	srvr := OpenAuthenticatedServer(c)
+	srvr.CreateDatabase("foo")
+	srvr.CreateUser("lisa", "password", false)
+	s := NewAuthenticatedAPIServer(srvr)
+	defer s.Close()
+
+	rr := &prometheus.ReadRequest{Queries: []prometheus.Query{{EndTimestampMs: 1420070400000}}}
+	status, _ := MustHTTP("POST", s.URL+`/api/v1/prom/read`, map[string]string{"db": "foo", "u": "lisa", "p": "password"}, nil, string(snappy.Encode(nil, rr.Marshal())))
+	if status != http.StatusUnauthorized {
+		t.Fatalf("unexpected status: %d", status)
+	}
+}
+
 // str2iface converts an array of strings to an array of interfaces.
 func str2iface(strs []string) []interface{} {
 	a := make([]interface{}, 0, len(strs))
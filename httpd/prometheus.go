@@ -0,0 +1,405 @@
+package httpd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/influxdb/influxdb"
+	"github.com/influxdb/influxdb/influxql"
+	"github.com/influxdb/influxdb/prometheus"
+)
+
+// maxPromRequestSize is the largest Prometheus remote write or read request
+// accepted, both compressed and decoded.
+const maxPromRequestSize = 32 << 20
+
+// servePromWrite receives a Prometheus remote write request and writes the
+// samples to the database given by the "db" parameter. The metric name of
+// each series is used as the measurement and the other labels as tags, with
+// the sample stored in a "value" field.
+func (h *Handler) servePromWrite(w http.ResponseWriter, r *http.Request, user *influxdb.User) {
+	db, rp := r.URL.Query().Get("db"), r.URL.Query().Get("rp")
+	if !h.authorizePromRequest(w, db, user, influxql.WritePrivilege) {
+		return
+	}
+
+	var req prometheus.WriteRequest
+	if err := readPromRequest(r, &req); err != nil {
+		httpError(w, err.Error(), false, http.StatusBadRequest)
+		return
+	}
+
+	points, err := promWritePoints(req.Timeseries)
+	if err != nil {
+		httpError(w, err.Error(), false, http.StatusBadRequest)
+		return
+	}
+	if len(points) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	index, err := h.server.WriteSeries(db, rp, points)
+	if err != nil {
+		httpError(w, err.Error(), false, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("X-InfluxDB-Index", fmt.Sprintf("%d", index))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// servePromRead answers a Prometheus remote read request. Each query is
+// translated into SELECT statements against the measurements of the database
+// given by the "db" parameter and their results are returned as time series.
+func (h *Handler) servePromRead(w http.ResponseWriter, r *http.Request, user *influxdb.User) {
+	db, rp := r.URL.Query().Get("db"), r.URL.Query().Get("rp")
+	if !h.authorizePromRequest(w, db, user, influxql.ReadPrivilege) {
+		return
+	}
+
+	var req prometheus.ReadRequest
+	if err := readPromRequest(r, &req); err != nil {
+		httpError(w, err.Error(), false, http.StatusBadRequest)
+		return
+	}
+
+	var resp prometheus.ReadResponse
+	for _, q := range req.Queries {
+		show, err := promTagKeysStatement(q)
+		if err != nil {
+			httpError(w, err.Error(), false, http.StatusBadRequest)
+			return
+		}
+
+		// Find the tag keys of the measurements first, so matchers on labels
+		// a measurement doesn't have can be evaluated.
+		rows, err := h.executePromQuery(influxql.Statements{show}, db, user)
+		if err == nil {
+			rows, err = h.executePromQuery(promSelectStatements(q, rp, rows), db, user)
+		}
+		if err != nil {
+			if isAuthorizationError(err) {
+				httpError(w, err.Error(), false, http.StatusUnauthorized)
+			} else {
+				httpError(w, err.Error(), false, http.StatusInternalServerError)
+			}
+			return
+		}
+		resp.Results = append(resp.Results, prometheus.QueryResult{Timeseries: promTimeSeries(rows)})
+	}
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("Content-Encoding", "snappy")
+	w.Write(snappy.Encode(nil, resp.Marshal()))
+}
+
+// authorizePromRequest checks the database exists and the user holds the
+// privilege on it, writing an error to the client if not.
+func (h *Handler) authorizePromRequest(w http.ResponseWriter, db string, user *influxdb.User, p influxql.Privilege) bool {
+	if db == "" {
+		httpError(w, `missing required parameter "db"`, false, http.StatusBadRequest)
+		return false
+	} else if !h.server.DatabaseExists(db) {
+		httpError(w, fmt.Sprintf("database not found: %q", db), false, http.StatusNotFound)
+		return false
+	}
+
+	if h.requireAuthentication && user == nil {
+		httpError(w, fmt.Sprintf("user is required to access database %q", db), false, http.StatusUnauthorized)
+		return false
+	} else if h.requireAuthentication && !user.Authorize(p, db) {
+		httpError(w, fmt.Sprintf("%q user is not authorized to access database %q", user.Name, db), false, http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// executePromQuery runs the statements and returns the rows of their results.
+// Queries against measurements, tags or fields which do not exist return
+// no rows rather than an error.
+func (h *Handler) executePromQuery(stmts influxql.Statements, db string, user *influxdb.User) ([]*influxql.Row, error) {
+	if len(stmts) == 0 {
+		return nil, nil
+	}
+
+	results, err := h.server.ExecuteQuery(&influxql.Query{Statements: stmts}, db, user, DefaultChunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []*influxql.Row
+	for r := range results {
+		if r == nil {
+			continue
+		} else if r.Err != nil {
+			if isMeasurementNotFoundError(r.Err) || isTagNotFoundError(r.Err) || isFieldNotFoundError(r.Err) {
+				continue
+			}
+			err = r.Err
+			continue
+		}
+		rows = append(rows, r.Series...)
+	}
+	return rows, err
+}
+
+// readPromRequest reads and decodes a snappy compressed protocol buffer body.
+// Requests larger than maxPromRequestSize are rejected before being decoded.
+func readPromRequest(r *http.Request, msg interface {
+	Unmarshal([]byte) error
+}) error {
+	compressed, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPromRequestSize+1))
+	if err != nil {
+		return err
+	} else if len(compressed) > maxPromRequestSize {
+		return fmt.Errorf("request too large: more than %d bytes", maxPromRequestSize)
+	}
+
+	// Check the decoded size held in the header before allocating it.
+	if n, err := snappy.DecodedLen(compressed); err != nil {
+		return fmt.Errorf("invalid snappy encoding: %s", err)
+	} else if n > maxPromRequestSize {
+		return fmt.Errorf("request too large: %d bytes decoded", n)
+	}
+
+	buf, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return fmt.Errorf("invalid snappy encoding: %s", err)
+	}
+
+	if err := msg.Unmarshal(buf); err != nil {
+		return fmt.Errorf("invalid request: %s", err)
+	}
+	return nil
+}
+
+// promWritePoints converts remote write time series into points. Samples
+// which are not finite are skipped, since they cannot be stored.
+func promWritePoints(series []prometheus.TimeSeries) ([]influxdb.Point, error) {
+	var points []influxdb.Point
+	for _, ts := range series {
+		var name string
+		tags := make(map[string]string, len(ts.Labels))
+		for _, l := range ts.Labels {
+			if l.Name == prometheus.MetricNameLabel {
+				name = l.Value
+			} else {
+				tags[l.Name] = l.Value
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("time series has no %s label", prometheus.MetricNameLabel)
+		}
+
+		for _, s := range ts.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			points = append(points, influxdb.Point{
+				Name:      name,
+				Tags:      tags,
+				Timestamp: promTime(s.TimestampMs),
+				Fields:    map[string]interface{}{"value": s.Value},
+			})
+		}
+	}
+	return points, nil
+}
+
+// promTagKeysStatement returns a statement listing the tag keys of the
+// measurements a remote read query may select. That is a single measurement
+// if the metric name is matched by equality and all measurements otherwise.
+// Returns an error if any matcher is invalid.
+func promTagKeysStatement(q prometheus.Query) (*influxql.ShowTagKeysStatement, error) {
+	stmt := &influxql.ShowTagKeysStatement{}
+	for _, m := range q.Matchers {
+		switch m.Type {
+		case prometheus.MatchEqual, prometheus.MatchNotEqual:
+		case prometheus.MatchRegexp, prometheus.MatchNotRegexp:
+			if _, err := promRegexp(m.Value); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported matcher type: %s", m.Type)
+		}
+
+		if m.Name == prometheus.MetricNameLabel && m.Type == prometheus.MatchEqual && stmt.Source == nil {
+			stmt.Source = &influxql.Measurement{Name: m.Value}
+		}
+	}
+	return stmt, nil
+}
+
+// promSelectStatements translates a remote read query into statements
+// selecting the "value" field of every matching series in the time range,
+// one for each measurement matching the metric name. The measurements and
+// their tag keys are given by the rows of a SHOW TAG KEYS statement.
+//
+// Label matchers become tag predicates. Prometheus treats a missing label as
+// an empty value, so a matcher on a label which a measurement doesn't have as
+// a tag either matches all of its series or none of them.
+func promSelectStatements(q prometheus.Query, rp string, tagKeys []*influxql.Row) influxql.Statements {
+	var stmts influxql.Statements
+	for _, row := range tagKeys {
+		keys := make(map[string]bool)
+		for _, values := range row.Values {
+			if k, ok := values[0].(string); ok {
+				keys[k] = true
+			}
+		}
+
+		cond := influxql.Expr(&influxql.BinaryExpr{
+			Op:  influxql.AND,
+			LHS: &influxql.BinaryExpr{Op: influxql.GTE, LHS: &influxql.VarRef{Val: "time"}, RHS: &influxql.TimeLiteral{Val: promTime(q.StartTimestampMs)}},
+			RHS: &influxql.BinaryExpr{Op: influxql.LTE, LHS: &influxql.VarRef{Val: "time"}, RHS: &influxql.TimeLiteral{Val: promTime(q.EndTimestampMs)}},
+		})
+		matches := true
+		for _, m := range q.Matchers {
+			if m.Name == prometheus.MetricNameLabel {
+				matches = promMatches(row.Name, m)
+			} else if !keys[m.Name] {
+				matches = promMatches("", m)
+			} else {
+				cond = &influxql.BinaryExpr{Op: influxql.AND, LHS: cond, RHS: promMatcherExpr(m)}
+			}
+			if !matches {
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+
+		stmts = append(stmts, &influxql.SelectStatement{
+			Fields:     influxql.Fields{&influxql.Field{Expr: &influxql.VarRef{Val: "value"}}},
+			Sources:    influxql.Sources{&influxql.Measurement{RetentionPolicy: rp, Name: row.Name}},
+			Condition:  cond,
+			Dimensions: influxql.Dimensions{&influxql.Dimension{Expr: &influxql.Wildcard{}}},
+			IsRawQuery: true,
+		})
+	}
+	return stmts
+}
+
+// promMatcherExpr translates a valid label matcher into a tag predicate.
+// Series without the tag match if the matcher matches the empty string.
+func promMatcherExpr(m prometheus.LabelMatcher) influxql.Expr {
+	ref := &influxql.VarRef{Val: m.Name}
+	present := &influxql.RegexLiteral{Val: regexp.MustCompile(`.`)}
+
+	switch m.Type {
+	case prometheus.MatchEqual, prometheus.MatchNotEqual:
+		op := influxql.EQ
+		if m.Type == prometheus.MatchNotEqual {
+			op = influxql.NEQ
+		}
+
+		// An empty value matches series without the tag.
+		if m.Value == "" {
+			op = influxql.NEQREGEX
+			if m.Type == prometheus.MatchNotEqual {
+				op = influxql.EQREGEX
+			}
+			return &influxql.BinaryExpr{Op: op, LHS: ref, RHS: present}
+		}
+		return &influxql.BinaryExpr{Op: op, LHS: ref, RHS: &influxql.StringLiteral{Val: m.Value}}
+	}
+
+	re, _ := promRegexp(m.Value)
+	op := influxql.EQREGEX
+	if m.Type == prometheus.MatchNotRegexp {
+		op = influxql.NEQREGEX
+	}
+	expr := &influxql.BinaryExpr{Op: op, LHS: ref, RHS: &influxql.RegexLiteral{Val: re}}
+	if !re.MatchString("") {
+		return expr
+	}
+
+	// Include series without the tag in a match and exclude them from a
+	// negated match.
+	if m.Type == prometheus.MatchRegexp {
+		return &influxql.ParenExpr{Expr: &influxql.BinaryExpr{Op: influxql.OR, LHS: expr, RHS: &influxql.BinaryExpr{Op: influxql.NEQREGEX, LHS: ref, RHS: present}}}
+	}
+	return &influxql.BinaryExpr{Op: influxql.AND, LHS: expr, RHS: &influxql.BinaryExpr{Op: influxql.EQREGEX, LHS: ref, RHS: present}}
+}
+
+// promTimeSeries converts the result rows of a remote read query into time
+// series.
+func promTimeSeries(rows []*influxql.Row) []prometheus.TimeSeries {
+	var series []prometheus.TimeSeries
+	for _, row := range rows {
+		ts := prometheus.TimeSeries{Labels: []prometheus.Label{{Name: prometheus.MetricNameLabel, Value: row.Name}}}
+		keys := make([]string, 0, len(row.Tags))
+		for k := range row.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			// Series without the tag have an empty value, which Prometheus
+			// treats as a missing label.
+			if v := row.Tags[k]; v != "" {
+				ts.Labels = append(ts.Labels, prometheus.Label{Name: k, Value: v})
+			}
+		}
+
+		for _, values := range row.Values {
+			if len(values) != 2 {
+				continue
+			}
+			t, ok := values[0].(time.Time)
+			if !ok {
+				continue
+			}
+
+			var v float64
+			switch n := values[1].(type) {
+			case float64:
+				v = n
+			case int64:
+				v = float64(n)
+			default:
+				continue
+			}
+			ts.Samples = append(ts.Samples, prometheus.Sample{Value: v, TimestampMs: t.UnixNano() / int64(time.Millisecond)})
+		}
+
+		if len(ts.Samples) > 0 {
+			series = append(series, ts)
+		}
+	}
+	return series
+}
+
+// promMatches returns true if a label value satisfies a valid matcher.
+func promMatches(value string, m prometheus.LabelMatcher) bool {
+	var match bool
+	switch m.Type {
+	case prometheus.MatchEqual, prometheus.MatchNotEqual:
+		match = value == m.Value
+	case prometheus.MatchRegexp, prometheus.MatchNotRegexp:
+		re, _ := promRegexp(m.Value)
+		match = re.MatchString(value)
+	}
+	return match == (m.Type == prometheus.MatchEqual || m.Type == prometheus.MatchRegexp)
+}
+
+// promRegexp compiles a matcher regex. Prometheus regexes match the entire value.
+func promRegexp(s string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("^(?:" + s + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %s", s, err)
+	}
+	return re, nil
+}
+
+// promTime converts a Prometheus timestamp in milliseconds to a time.
+func promTime(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC()
+}
@@ -117,6 +117,12 @@ var (
 	// ErrFieldTypeConflict is returned when a new field already exists with a different type.
 	ErrFieldTypeConflict = errors.New("field type conflict")
 
+	// ErrInvalidFieldCoercion is returned when setting an unknown field coercion policy.
+	ErrInvalidFieldCoercion = errors.New("invalid field coercion policy")
+
+	// ErrFieldEncoding is returned when encoded field data is malformed.
+	ErrFieldEncoding = errors.New("invalid field encoding")
+
 	// ErrFieldNotFound is returned when a field cannot be found.
 	ErrFieldNotFound = errors.New("field not found")
 
@@ -146,6 +152,10 @@ var (
 
 	// ErrShardNotLocal is thrown whan a server attempts to run a mapper against a shard it doesn't have a copy of.
 	ErrShardNotLocal = errors.New("shard not local")
+
+	// ErrEngineNotFound is returned when a shard or retention policy names an
+	// engine which is not registered.
+	ErrEngineNotFound = errors.New("engine not found")
 )
 
 func ErrDatabaseNotFound(name string) error { return Errorf("database not found: %s", name) }
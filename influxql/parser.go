@@ -103,6 +103,12 @@ func (p *Parser) parseShowStatement() (Statement, error) {
 			return p.parseShowFieldKeysStatement()
 		}
 		return nil, newParseError(tokstr(tok, lit), []string{"KEYS", "VALUES"}, pos)
+	case MEASUREMENT:
+		tok, pos, lit := p.scanIgnoreWhitespace()
+		if tok == CARDINALITY {
+			return p.parseShowMeasurementCardinalityStatement()
+		}
+		return nil, newParseError(tokstr(tok, lit), []string{"CARDINALITY"}, pos)
 	case MEASUREMENTS:
 		return p.parseShowMeasurementsStatement()
 	case RETENTION:
@@ -112,7 +118,13 @@ func (p *Parser) parseShowStatement() (Statement, error) {
 		}
 		return nil, newParseError(tokstr(tok, lit), []string{"POLICIES"}, pos)
 	case SERIES:
+		if tok, _, _ := p.scanIgnoreWhitespace(); tok == CARDINALITY {
+			return p.parseShowSeriesCardinalityStatement()
+		}
+		p.unscan()
 		return p.parseShowSeriesStatement()
+	case SHARDS:
+		return p.parseShowShardsStatement()
 	case STATS:
 		return p.parseShowStatsStatement()
 	case DIAGNOSTICS:
@@ -122,6 +134,10 @@ func (p *Parser) parseShowStatement() (Statement, error) {
 		if tok == KEYS {
 			return p.parseShowTagKeysStatement()
 		} else if tok == VALUES {
+			if tok, _, _ := p.scanIgnoreWhitespace(); tok == CARDINALITY {
+				return p.parseShowTagValuesCardinalityStatement()
+			}
+			p.unscan()
 			return p.parseShowTagValuesStatement()
 		}
 		return nil, newParseError(tokstr(tok, lit), []string{"KEYS", "VALUES"}, pos)
@@ -186,9 +202,45 @@ func (p *Parser) parseAlterStatement() (Statement, error) {
 			return nil, newParseError(tokstr(tok, lit), []string{"POLICY"}, pos)
 		}
 		return p.parseAlterRetentionPolicyStatement()
+	} else if tok == DATABASE {
+		return p.parseAlterDatabaseStatement()
 	}
 
-	return nil, newParseError(tokstr(tok, lit), []string{"RETENTION"}, pos)
+	return nil, newParseError(tokstr(tok, lit), []string{"RETENTION", "DATABASE"}, pos)
+}
+
+// parseAlterDatabaseStatement parses a string and returns an AlterDatabaseStatement.
+// This function assumes the "ALTER DATABASE" tokens have already been consumed.
+func (p *Parser) parseAlterDatabaseStatement() (*AlterDatabaseStatement, error) {
+	stmt := &AlterDatabaseStatement{}
+
+	// Parse the name of the database to be altered.
+	lit, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Name = lit
+
+	// Consume the required FIELD COERCION tokens.
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != FIELD {
+		return nil, newParseError(tokstr(tok, lit), []string{"FIELD"}, pos)
+	}
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != COERCION {
+		return nil, newParseError(tokstr(tok, lit), []string{"COERCION"}, pos)
+	}
+
+	// Parse the coercion policy.
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	switch {
+	case tok == ALL:
+		stmt.FieldCoercion = "all"
+	case tok == IDENT && (strings.ToLower(lit) == "none" || strings.ToLower(lit) == "numeric"):
+		stmt.FieldCoercion = strings.ToLower(lit)
+	default:
+		return nil, newParseError(tokstr(tok, lit), []string{"NONE", "NUMERIC", "ALL"}, pos)
+	}
+
+	return stmt, nil
 }
 
 // parseSetStatement parses a string and returns a set statement.
@@ -798,6 +850,77 @@ func (p *Parser) parseShowSeriesStatement() (*ShowSeriesStatement, error) {
 	return stmt, nil
 }
 
+// parseShowSeriesCardinalityStatement parses a string and returns a ShowSeriesCardinalityStatement.
+// This function assumes the "SHOW SERIES CARDINALITY" tokens have already been consumed.
+func (p *Parser) parseShowSeriesCardinalityStatement() (*ShowSeriesCardinalityStatement, error) {
+	stmt := &ShowSeriesCardinalityStatement{}
+	var err error
+
+	// Parse optional FROM.
+	if stmt.Source, err = p.parseOptionalSource(); err != nil {
+		return nil, err
+	}
+
+	// Parse condition: "WHERE EXPR".
+	if stmt.Condition, err = p.parseCondition(); err != nil {
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+// parseShowMeasurementCardinalityStatement parses a string and returns a ShowMeasurementCardinalityStatement.
+// This function assumes the "SHOW MEASUREMENT CARDINALITY" tokens have already been consumed.
+func (p *Parser) parseShowMeasurementCardinalityStatement() (*ShowMeasurementCardinalityStatement, error) {
+	stmt := &ShowMeasurementCardinalityStatement{}
+	var err error
+
+	// Parse optional FROM.
+	if stmt.Source, err = p.parseOptionalSource(); err != nil {
+		return nil, err
+	}
+
+	// Parse condition: "WHERE EXPR".
+	if stmt.Condition, err = p.parseCondition(); err != nil {
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+// parseShowTagValuesCardinalityStatement parses a string and returns a ShowTagValuesCardinalityStatement.
+// This function assumes the "SHOW TAG VALUES CARDINALITY" tokens have already been consumed.
+func (p *Parser) parseShowTagValuesCardinalityStatement() (*ShowTagValuesCardinalityStatement, error) {
+	stmt := &ShowTagValuesCardinalityStatement{}
+	var err error
+
+	// Parse optional FROM.
+	if stmt.Source, err = p.parseOptionalSource(); err != nil {
+		return nil, err
+	}
+
+	// Parse required WITH KEY.
+	if stmt.TagKeys, err = p.parseTagKeys(); err != nil {
+		return nil, err
+	}
+
+	// Parse condition: "WHERE EXPR".
+	if stmt.Condition, err = p.parseCondition(); err != nil {
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+// parseOptionalSource parses a "FROM" clause if one is present.
+func (p *Parser) parseOptionalSource() (Source, error) {
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok != FROM {
+		p.unscan()
+		return nil, nil
+	}
+	return p.parseSource()
+}
+
 // parseShowMeasurementsStatement parses a string and returns a ShowSeriesStatement.
 // This function assumes the "SHOW MEASUREMENTS" tokens have already been consumed.
 func (p *Parser) parseShowMeasurementsStatement() (*ShowMeasurementsStatement, error) {
@@ -1014,6 +1137,15 @@ func (p *Parser) parseDropMeasurementStatement() (*DropMeasurementStatement, err
 	}
 	stmt.Name = lit
 
+	// Parse optional retention policy: "ON <rp>".
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == ON {
+		if stmt.RetentionPolicy, err = p.parseIdent(); err != nil {
+			return nil, err
+		}
+	} else {
+		p.unscan()
+	}
+
 	return stmt, nil
 }
 
@@ -1300,6 +1432,12 @@ func (p *Parser) parseShowDiagnosticsStatement() (*ShowDiagnosticsStatement, err
 	return stmt, nil
 }
 
+// parseShowShardsStatement parses a string and returns a ShowShardsStatement.
+// This function assumes the "SHOW SHARDS" tokens have already been consumed.
+func (p *Parser) parseShowShardsStatement() (*ShowShardsStatement, error) {
+	return &ShowShardsStatement{}, nil
+}
+
 // parseDropContinuousQueriesStatement parses a string and returns a DropContinuousQueryStatement.
 // This function assumes the "DROP CONTINUOUS" tokens have already been consumed.
 func (p *Parser) parseDropContinuousQueryStatement() (*DropContinuousQueryStatement, error) {
@@ -743,6 +743,12 @@ func TestParser_ParseStatement(t *testing.T) {
 			stmt: &influxql.DropMeasurementStatement{Name: "cpu"},
 		},
 
+		// DROP MEASUREMENT ON retention policy
+		{
+			s:    `DROP MEASUREMENT cpu ON "1h.cpu"`,
+			stmt: &influxql.DropMeasurementStatement{Name: "cpu", RetentionPolicy: "1h.cpu"},
+		},
+
 		// DROP RETENTION POLICY
 		{
 			s: `DROP RETENTION POLICY "1h.cpu" ON mydb`,
@@ -890,6 +896,18 @@ func TestParser_ParseStatement(t *testing.T) {
 			},
 		},
 
+		// ALTER DATABASE
+		{
+			s:    `ALTER DATABASE testdb FIELD COERCION numeric`,
+			stmt: &influxql.AlterDatabaseStatement{Name: "testdb", FieldCoercion: "numeric"},
+		},
+
+		// ALTER DATABASE with ALL keyword
+		{
+			s:    `ALTER DATABASE testdb FIELD COERCION ALL`,
+			stmt: &influxql.AlterDatabaseStatement{Name: "testdb", FieldCoercion: "all"},
+		},
+
 		// ALTER RETENTION POLICY
 		{
 			s:    `ALTER RETENTION POLICY policy1 ON testdb DURATION 1m REPLICATION 4 DEFAULT`,
@@ -951,6 +969,57 @@ func TestParser_ParseStatement(t *testing.T) {
 			},
 		},
 
+		// SHOW SHARDS
+		{
+			s:    `SHOW SHARDS`,
+			stmt: &influxql.ShowShardsStatement{},
+		},
+
+		// SHOW SERIES CARDINALITY
+		{
+			s:    `SHOW SERIES CARDINALITY`,
+			stmt: &influxql.ShowSeriesCardinalityStatement{},
+		},
+
+		// SHOW SERIES CARDINALITY FROM ... WHERE ...
+		{
+			s: `SHOW SERIES CARDINALITY FROM cpu WHERE region = 'uswest'`,
+			stmt: &influxql.ShowSeriesCardinalityStatement{
+				Source: &influxql.Measurement{Name: "cpu"},
+				Condition: &influxql.BinaryExpr{
+					Op:  influxql.EQ,
+					LHS: &influxql.VarRef{Val: "region"},
+					RHS: &influxql.StringLiteral{Val: "uswest"},
+				},
+			},
+		},
+
+		// SHOW MEASUREMENT CARDINALITY WHERE ...
+		{
+			s: `SHOW MEASUREMENT CARDINALITY WHERE region = 'uswest'`,
+			stmt: &influxql.ShowMeasurementCardinalityStatement{
+				Condition: &influxql.BinaryExpr{
+					Op:  influxql.EQ,
+					LHS: &influxql.VarRef{Val: "region"},
+					RHS: &influxql.StringLiteral{Val: "uswest"},
+				},
+			},
+		},
+
+		// SHOW TAG VALUES CARDINALITY FROM ... WITH KEY IN ...
+		{
+			s: `SHOW TAG VALUES CARDINALITY FROM cpu WITH KEY IN (host, region) WHERE region = 'uswest'`,
+			stmt: &influxql.ShowTagValuesCardinalityStatement{
+				Source:  &influxql.Measurement{Name: "cpu"},
+				TagKeys: []string{"host", "region"},
+				Condition: &influxql.BinaryExpr{
+					Op:  influxql.EQ,
+					LHS: &influxql.VarRef{Val: "region"},
+					RHS: &influxql.StringLiteral{Val: "uswest"},
+				},
+			},
+		},
+
 		// SHOW DIAGNOSTICS
 		{
 			s:    `SHOW DIAGNOSTICS`,
@@ -980,11 +1049,13 @@ func TestParser_ParseStatement(t *testing.T) {
 		{s: `DELETE FROM`, err: `found EOF, expected identifier at line 1, char 13`},
 		{s: `DELETE FROM myseries WHERE`, err: `found EOF, expected identifier, string, number, bool at line 1, char 28`},
 		{s: `DROP MEASUREMENT`, err: `found EOF, expected identifier at line 1, char 18`},
+		{s: `DROP MEASUREMENT cpu ON`, err: `found EOF, expected identifier at line 1, char 25`},
 		{s: `DROP SERIES`, err: `found EOF, expected number at line 1, char 13`},
 		{s: `DROP SERIES FROM`, err: `found EOF, expected identifier at line 1, char 18`},
 		{s: `DROP SERIES FROM src WHERE`, err: `found EOF, expected identifier, string, number, bool at line 1, char 28`},
 		{s: `SHOW CONTINUOUS`, err: `found EOF, expected QUERIES at line 1, char 17`},
 		{s: `SHOW RETENTION`, err: `found EOF, expected POLICIES at line 1, char 16`},
+		{s: `SHOW MEASUREMENT`, err: `found EOF, expected CARDINALITY at line 1, char 18`},
 		{s: `SHOW RETENTION POLICIES`, err: `found EOF, expected identifier at line 1, char 25`},
 		{s: `SHOW FOO`, err: `found FOO, expected CONTINUOUS, DATABASES, FIELD, MEASUREMENTS, RETENTION, SERIES, SERVERS, TAG, USERS at line 1, char 6`},
 		{s: `SHOW STATS ON`, err: `found EOF, expected string at line 1, char 15`},
@@ -1031,7 +1102,11 @@ func TestParser_ParseStatement(t *testing.T) {
 		{s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION 3.14`, err: `number must be an integer at line 1, char 67`},
 		{s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION 0`, err: `invalid value 0: must be 1 <= n <= 2147483647 at line 1, char 67`},
 		{s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION bad`, err: `found bad, expected number at line 1, char 67`},
-		{s: `ALTER`, err: `found EOF, expected RETENTION at line 1, char 7`},
+		{s: `ALTER`, err: `found EOF, expected RETENTION, DATABASE at line 1, char 7`},
+		{s: `ALTER DATABASE`, err: `found EOF, expected identifier at line 1, char 16`},
+		{s: `ALTER DATABASE testdb`, err: `found EOF, expected FIELD at line 1, char 23`},
+		{s: `ALTER DATABASE testdb FIELD`, err: `found EOF, expected COERCION at line 1, char 29`},
+		{s: `ALTER DATABASE testdb FIELD COERCION strings`, err: `found strings, expected NONE, NUMERIC, ALL at line 1, char 38`},
 		{s: `ALTER RETENTION`, err: `found EOF, expected POLICY at line 1, char 17`},
 		{s: `ALTER RETENTION POLICY`, err: `found EOF, expected identifier at line 1, char 24`},
 		{s: `ALTER RETENTION POLICY policy1`, err: `found EOF, expected ON at line 1, char 32`}, {s: `ALTER RETENTION POLICY policy1 ON`, err: `found EOF, expected identifier at line 1, char 35`},
@@ -1402,6 +1477,37 @@ func TestDropSeriesStatement_String(t *testing.T) {
 	}
 }
 
+func TestShowTagValuesCardinalityStatement_String(t *testing.T) {
+	var tests = []struct {
+		s    string
+		stmt influxql.Statement
+	}{
+		{
+			s:    `SHOW TAG VALUES CARDINALITY WITH KEY = host`,
+			stmt: &influxql.ShowTagValuesCardinalityStatement{TagKeys: []string{"host"}},
+		},
+		{
+			s: `SHOW TAG VALUES CARDINALITY FROM src WITH KEY IN (host, region) WHERE host = 'serverA'`,
+			stmt: &influxql.ShowTagValuesCardinalityStatement{
+				Source:  &influxql.Measurement{Name: "src"},
+				TagKeys: []string{"host", "region"},
+				Condition: &influxql.BinaryExpr{
+					Op:  influxql.EQ,
+					LHS: &influxql.VarRef{Val: "host"},
+					RHS: &influxql.StringLiteral{Val: "serverA"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s := test.stmt.String()
+		if s != test.s {
+			t.Errorf("error rendering string. expected %s, actual: %s", test.s, s)
+		}
+	}
+}
+
 func BenchmarkParserParseStatement(b *testing.B) {
 	b.ReportAllocs()
 	s := `SELECT field FROM "series" WHERE value > 10`
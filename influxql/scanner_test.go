@@ -112,6 +112,8 @@ func TestScanner_Scan(t *testing.T) {
 		{s: `ASC`, tok: influxql.ASC},
 		{s: `BEGIN`, tok: influxql.BEGIN},
 		{s: `BY`, tok: influxql.BY},
+		{s: `CARDINALITY`, tok: influxql.CARDINALITY},
+		{s: `COERCION`, tok: influxql.COERCION},
 		{s: `CREATE`, tok: influxql.CREATE},
 		{s: `CONTINUOUS`, tok: influxql.CONTINUOUS},
 		{s: `DATABASE`, tok: influxql.DATABASE},
@@ -61,6 +61,8 @@ const (
 	ASC
 	BEGIN
 	BY
+	CARDINALITY
+	COERCION
 	CREATE
 	CONTINUOUS
 	DATABASE
@@ -106,6 +108,7 @@ const (
 	SERIES
 	SERVERS
 	SET
+	SHARDS
 	SHOW
 	SLIMIT
 	STATS
@@ -166,6 +169,8 @@ var tokens = [...]string{
 	ASC:          "ASC",
 	BEGIN:        "BEGIN",
 	BY:           "BY",
+	CARDINALITY:  "CARDINALITY",
+	COERCION:     "COERCION",
 	CREATE:       "CREATE",
 	CONTINUOUS:   "CONTINUOUS",
 	DATABASE:     "DATABASE",
@@ -211,6 +216,7 @@ var tokens = [...]string{
 	SERIES:       "SERIES",
 	SERVERS:      "SERVERS",
 	SET:          "SET",
+	SHARDS:       "SHARDS",
 	SHOW:         "SHOW",
 	SLIMIT:       "SLIMIT",
 	SOFFSET:      "SOFFSET",
@@ -5,11 +5,17 @@ package influxdb
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/boltdb/bolt"
 	"github.com/influxdb/influxdb/influxql"
+	"github.com/influxdb/influxdb/messaging"
 )
 
 // Ensure a measurement can return a set of unique tag values specified by an expression.
@@ -312,6 +318,796 @@ func TestShardGroup_Contains(t *testing.T) {
 	}
 }
 
+// Ensure fields beyond the 255th and strings longer than 64KB can be encoded and decoded.
+func TestFieldCodec_EncodeDecode(t *testing.T) {
+	m := &Measurement{Name: "cpu"}
+	for i := 0; i < 300; i++ {
+		if err := m.createFieldIfNotExists(fmt.Sprintf("f%d", i), influxql.Float); err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+	}
+	if err := m.createFieldIfNotExists("payload", influxql.String); err != nil {
+		t.Fatal(err)
+	} else if err := m.createFieldIfNotExists("ok", influxql.Boolean); err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]interface{}{
+		"f0":      float64(1),
+		"f299":    float64(300),
+		"payload": string(bytes.Repeat([]byte("x"), 100000)),
+		"ok":      true,
+	}
+	codec := NewFieldCodec(m)
+	b, err := codec.EncodeFields(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if other, err := codec.DecodeFieldsWithNames(b); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(other, values) {
+		t.Fatal("decoded fields mismatch")
+	}
+	if v, err := codec.DecodeByID(m.FieldByName("f299").ID, b); err != nil || v != float64(300) {
+		t.Fatalf("unexpected value: %v, err=%v", v, err)
+	}
+	if _, err := codec.DecodeByID(m.FieldByName("f1").ID, b); err != ErrFieldNotFound {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := codec.DecodeFields(b[:len(b)-1]); err != ErrFieldEncoding {
+		t.Fatalf("unexpected truncation error: %v", err)
+	}
+}
+
+// Ensure fields written in the original 1 byte field ID encoding can still be
+// decoded.
+func TestFieldCodec_DecodeLegacy(t *testing.T) {
+	m := &Measurement{Name: "cpu"}
+	m.createFieldIfNotExists("value", influxql.Float)
+	m.createFieldIfNotExists("count", influxql.Integer)
+	m.createFieldIfNotExists("ok", influxql.Boolean)
+	m.createFieldIfNotExists("host", influxql.String)
+
+	b := []byte{
+		1, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0, // value=1.5
+		2, 0, 0, 0, 0, 0, 0, 0, 10, // count=10
+		3, 1, // ok=true
+		4, 0, 3, 'a', 'b', 'c', // host="abc"
+	}
+	codec := NewFieldCodec(m)
+	if values, err := codec.DecodeFieldsWithNames(b); err != nil {
+		t.Fatal(err)
+	} else if exp := map[string]interface{}{"value": 1.5, "count": int64(10), "ok": true, "host": "abc"}; !reflect.DeepEqual(values, exp) {
+		t.Fatalf("unexpected values: %#v", values)
+	}
+	if v, err := codec.DecodeByID(4, b); err != nil || v != "abc" {
+		t.Fatalf("unexpected value: %v, err=%v", v, err)
+	}
+}
+
+// Ensure typed field entries with a field ID of 0 are rejected.
+func TestFieldCodec_DecodeZeroFieldID(t *testing.T) {
+	m := &Measurement{Name: "cpu"}
+	m.createFieldIfNotExists("value", influxql.Float)
+	codec := NewFieldCodec(m)
+
+	for i, b := range [][]byte{
+		{fieldEncodingTyped, 0<<2 | fieldValueFloat, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0},
+		{fieldEncodingTyped, 1<<2 | fieldValueFloat, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0, 0<<2 | fieldValueBoolean, 1},
+	} {
+		if _, err := codec.DecodeFields(b); err != ErrFieldEncoding {
+			t.Errorf("%d. unexpected error: %v", i, err)
+		}
+	}
+	if _, _, _, _, err := decodeFieldValue([]byte{0<<2 | fieldValueString, 0}); err != ErrFieldEncoding {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure points can be encoded into blocks and decoded.
+func TestBlock_EncodeDecode(t *testing.T) {
+	m := &Measurement{Name: "cpu"}
+	m.createFieldIfNotExists("value", influxql.Float)
+	m.createFieldIfNotExists("count", influxql.Integer)
+	m.createFieldIfNotExists("ok", influxql.Boolean)
+	m.createFieldIfNotExists("host", influxql.String)
+	codec := NewFieldCodec(m)
+
+	for i, tt := range []struct {
+		values []map[string]interface{}
+		format byte
+	}{
+		// Single point.
+		{
+			values: []map[string]interface{}{{"value": 1.5}},
+			format: blockColumnar,
+		},
+
+		// Repeated, changing and special float values.
+		{
+			values: []map[string]interface{}{
+				{"value": 1.5}, {"value": 1.5}, {"value": -2.25}, {"value": 1e300},
+				{"value": math.Inf(1)}, {"value": 0.0}, {"value": 12.0}, {"value": 12.5},
+			},
+			format: blockColumnar,
+		},
+
+		// Sparse fields of all types.
+		{
+			values: []map[string]interface{}{
+				{"value": 1.0, "count": int64(-5), "host": "a"},
+				{"count": int64(math.MaxInt64), "ok": true},
+				{"host": "b", "ok": false},
+				{"value": 2.0, "host": "a", "count": int64(math.MinInt64)},
+				{"host": ""},
+			},
+			format: blockColumnar,
+		},
+	} {
+		var points []blockPoint
+		for j, values := range tt.values {
+			data, err := codec.EncodeFields(values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			points = append(points, blockPoint{timestamp: int64(j*j) * int64(time.Second), data: data})
+		}
+
+		b := encodeBlock(points)
+		if b[0] != tt.format {
+			t.Errorf("%d. unexpected format: %d", i, b[0])
+		}
+		other, err := decodeBlock(b)
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		} else if len(other) != len(points) {
+			t.Fatalf("%d. unexpected point count: %d", i, len(other))
+		}
+		for j := range points {
+			if other[j].timestamp != points[j].timestamp {
+				t.Errorf("%d.%d. unexpected timestamp: %d", i, j, other[j].timestamp)
+			}
+			if values, err := codec.DecodeFieldsWithNames(other[j].data); err != nil {
+				t.Errorf("%d.%d. unexpected error: %s", i, j, err)
+			} else if !reflect.DeepEqual(values, tt.values[j]) {
+				t.Errorf("%d.%d. unexpected values: %#v", i, j, values)
+			}
+		}
+	}
+
+	// Points in the untyped field encoding are stored as is.
+	points := []blockPoint{
+		{timestamp: 10, data: []byte{3, 1}},
+		{timestamp: 20, data: []byte{3, 0}},
+	}
+	b := encodeBlock(points)
+	if b[0] != blockRaw {
+		t.Fatalf("unexpected format: %d", b[0])
+	} else if other, err := decodeBlock(b); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(other, points) {
+		t.Fatalf("unexpected points: %#v", other)
+	}
+
+	// Truncated blocks return an error.
+	if _, err := decodeBlock(b[:len(b)-1]); err != errInvalidBlock {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure points are written into blocks which are split as they grow and read in order.
+func TestShard_writeBlockPoints(t *testing.T) {
+	db := mustOpenBolt()
+	defer db.Close()
+
+	// Write points out of order, overwriting some, across several blocks.
+	var exp []int64
+	if err := db.Update(func(tx *bolt.Tx) error {
+		b, _ := tx.CreateBucket(u64tob(1))
+		for _, start := range []int{1000, 0, 500, 2500} {
+			var points []blockPoint
+			for i := start; i < start+1000; i++ {
+				points = append(points, blockPoint{timestamp: int64(i), data: []byte{fieldEncodingTyped, 0x05, 0, 0, 0, 0, 0, 0, 0, byte(i)}})
+			}
+			if _, err := writeBlockPoints(b, points); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2000; i++ {
+		exp = append(exp, int64(i))
+	}
+	for i := 2500; i < 3500; i++ {
+		exp = append(exp, int64(i))
+	}
+
+	if err := db.View(func(tx *bolt.Tx) error {
+		if n := tx.Bucket(u64tob(1)).Stats().KeyN; n != 3 {
+			t.Fatalf("unexpected block count: %d", n)
+		}
+
+		// Read all points in order.
+		var timestamps []int64
+		c := newShardCursor(tx.Bucket(u64tob(1)).Cursor())
+		for k, v := c.Seek(u64tob(0)); k != nil; k, v = c.Next() {
+			if v[len(v)-1] != byte(btou64(k)) {
+				t.Fatalf("unexpected value at %d: %v", btou64(k), v)
+			}
+			timestamps = append(timestamps, int64(btou64(k)))
+		}
+		if !reflect.DeepEqual(timestamps, exp) {
+			t.Fatalf("unexpected timestamps: n=%d", len(timestamps))
+		}
+
+		// Seek between blocks and past the end.
+		if k, _ := c.Seek(u64tob(2100)); btou64(k) != 2500 {
+			t.Fatalf("unexpected seek key: %d", btou64(k))
+		} else if k, _ := c.Seek(u64tob(4000)); k != nil {
+			t.Fatalf("unexpected seek key: %d", btou64(k))
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure points written after the last block fill it and then start new blocks.
+func TestShard_writeBlockPoints_Append(t *testing.T) {
+	db := mustOpenBolt()
+	defer db.Close()
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		b, _ := tx.CreateBucket(u64tob(1))
+		for start := 0; start < 1500; start += 150 {
+			var points []blockPoint
+			for i := start; i < start+150; i++ {
+				points = append(points, blockPoint{timestamp: int64(i), data: []byte{fieldEncodingTyped, 0x05, 0, 0, 0, 0, 0, 0, 0, byte(i)}})
+			}
+			if _, err := writeBlockPoints(b, points); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.View(func(tx *bolt.Tx) error {
+		var a []int
+		c := tx.Bucket(u64tob(1)).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			n, err := blockPointN(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a = append(a, int(btou64(k)), n)
+		}
+		if !reflect.DeepEqual(a, []int{999, 1000, 1499, 500}) {
+			t.Fatalf("unexpected blocks: %v", a)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure a cursor reading a block which can't be decoded stops with an error.
+func TestShardCursor_Err(t *testing.T) {
+	db := mustOpenBolt()
+	defer db.Close()
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		b, _ := tx.CreateBucket(u64tob(1))
+		var points []blockPoint
+		for i := 0; i < 2000; i++ {
+			points = append(points, blockPoint{timestamp: int64(i), data: []byte{fieldEncodingTyped, 0x06, 1}})
+		}
+		if _, err := writeBlockPoints(b, points); err != nil {
+			return err
+		}
+
+		// Truncate the second block.
+		k, v := b.Cursor().Last()
+		return b.Put(k, v[:len(v)/2])
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.View(func(tx *bolt.Tx) error {
+		var n int
+		c := newShardCursor(tx.Bucket(u64tob(1)).Cursor())
+		for k, _ := c.Seek(u64tob(0)); k != nil; k, _ = c.Next() {
+			n++
+		}
+		if n != 1000 {
+			t.Fatalf("unexpected point count: %d", n)
+		} else if err := c.Err(); err == nil || !strings.HasPrefix(err.Error(), "decode block: key=1999") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure series written with a key per point are converted into blocks.
+func TestShard_migrateShardBlocks(t *testing.T) {
+	db := mustOpenBolt()
+	defer db.Close()
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		tx.CreateBucket([]byte("meta"))
+		tx.CreateBucket([]byte("values"))
+		for _, id := range []uint64{1, 2} {
+			b, _ := tx.CreateBucket(u64tob(id))
+			for i := 0; i < 1500; i++ {
+				b.Put(u64tob(uint64(i)), []byte{1, 0, 0, 0, 0, 0, 0, 0, byte(i)})
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	} else if err := migrateShardBlocks(db.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket([]byte("meta")).Get([]byte("format")); string(v) != "blocks" {
+			t.Fatalf("unexpected format: %q", v)
+		} else if v := tx.Bucket([]byte("meta")).Get([]byte("migrated")); v != nil {
+			t.Fatalf("unexpected resume marker: %v", v)
+		}
+
+		for _, id := range []uint64{1, 2} {
+			if n := tx.Bucket(u64tob(id)).Stats().KeyN; n != 2 {
+				t.Fatalf("%d. unexpected block count: %d", id, n)
+			}
+
+			var n int
+			c := newShardCursor(tx.Bucket(u64tob(id)).Cursor())
+			for k, v := c.Seek(u64tob(0)); k != nil; k, v = c.Next() {
+				if btou64(k) != uint64(n) || !bytes.Equal(v, []byte{1, 0, 0, 0, 0, 0, 0, 0, byte(n)}) {
+					t.Fatalf("%d. unexpected point: %d=%v", id, btou64(k), v)
+				}
+				n++
+			}
+			if n != 1500 {
+				t.Fatalf("%d. unexpected point count: %d", id, n)
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure an interrupted conversion into blocks resumes after the last series converted.
+func TestShard_migrateShardBlocks_Resume(t *testing.T) {
+	db := mustOpenBolt()
+	defer db.Close()
+
+	// Series 1 was converted before the conversion was interrupted.
+	if err := db.Update(func(tx *bolt.Tx) error {
+		meta, _ := tx.CreateBucket([]byte("meta"))
+		tx.CreateBucket([]byte("values"))
+		b, _ := tx.CreateBucket(u64tob(1))
+		if _, err := writeBlockPoints(b, []blockPoint{{timestamp: 10, data: []byte{1, 0, 0, 0, 0, 0, 0, 0, 1}}}); err != nil {
+			return err
+		}
+		b, _ = tx.CreateBucket(u64tob(2))
+		b.Put(u64tob(20), []byte{1, 0, 0, 0, 0, 0, 0, 0, 2})
+		return meta.Put([]byte("migrated"), u64tob(1))
+	}); err != nil {
+		t.Fatal(err)
+	} else if err := migrateShardBlocks(db.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.View(func(tx *bolt.Tx) error {
+		for id, exp := range map[uint64]int64{1: 10, 2: 20} {
+			c := newShardCursor(tx.Bucket(u64tob(id)).Cursor())
+			if k, _ := c.Seek(u64tob(0)); k == nil || int64(btou64(k)) != exp {
+				t.Fatalf("%d. unexpected key: %v", id, k)
+			} else if k, _ := c.Next(); k != nil {
+				t.Fatalf("%d. unexpected key: %v", id, k)
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the bolt engine can delete series and ranges of series data.
+func TestBoltEngine_Delete(t *testing.T) {
+	f, _ := ioutil.TempFile("", "influxdb-")
+	f.Close()
+	defer os.Remove(f.Name())
+
+	e := NewBoltEngine()
+	if err := e.Open(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	// Write two series across several blocks.
+	values := make(map[uint64][]SeriesValue)
+	for i := -500; i < 2500; i++ {
+		v := SeriesValue{Timestamp: int64(i), Data: []byte{fieldEncodingTyped, 0x05, 0, 0, 0, 0, 0, 0, 0, byte(i)}}
+		values[1] = append(values[1], v)
+		values[2] = append(values[2], v)
+	}
+	if err := e.WriteBatch(10, values); err != nil {
+		t.Fatal(err)
+	} else if index := e.Index(); index != 10 {
+		t.Fatalf("unexpected index: %d", index)
+	}
+
+	// Delete a range spanning zero and a range within a block, then a series.
+	if err := e.DeleteRange([]uint64{1}, -100, 499); err != nil {
+		t.Fatal(err)
+	} else if err := e.DeleteRange([]uint64{1}, 1200, 1299); err != nil {
+		t.Fatal(err)
+	} else if err := e.DeleteSeries(2); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if c := tx.Cursor(2); c != nil {
+		t.Fatal("expected series 2 to be deleted")
+	}
+
+	// Negative timestamps sort after positive ones.
+	var timestamps []int64
+	c := tx.Cursor(1)
+	for k, _ := c.Seek(u64tob(0)); k != nil; k, _ = c.Next() {
+		timestamps = append(timestamps, int64(btou64(k)))
+	}
+	var exp []int64
+	for i := 500; i < 2500; i++ {
+		if i < 1200 || i > 1299 {
+			exp = append(exp, int64(i))
+		}
+	}
+	for i := -500; i < -100; i++ {
+		exp = append(exp, int64(i))
+	}
+	if !reflect.DeepEqual(timestamps, exp) {
+		t.Fatalf("unexpected timestamps: n=%d", len(timestamps))
+	}
+}
+
+// Ensure the bolt engine can be compacted while a transaction is open.
+func TestBoltEngine_Compact(t *testing.T) {
+	f, _ := ioutil.TempFile("", "influxdb-")
+	f.Close()
+	defer os.Remove(f.Name())
+
+	e := NewBoltEngine()
+	if err := e.Open(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	// Write several series then delete most of them.
+	values := make(map[uint64][]SeriesValue)
+	for id := uint64(1); id <= 10; id++ {
+		for i := 0; i < 1000; i++ {
+			values[id] = append(values[id], SeriesValue{Timestamp: int64(i), Data: []byte{fieldEncodingTyped, 0x05, 0, 0, 0, 0, 0, 0, 0, byte(i)}})
+		}
+	}
+	if err := e.WriteBatch(10, values); err != nil {
+		t.Fatal(err)
+	} else if err := e.DeleteSeries(2, 3, 4, 5, 6, 7, 8, 9, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold a transaction open on the original file.
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.Compact(true); err != nil {
+		t.Fatal(err)
+	} else if n := e.Stats().Get("compactions"); n != 1 {
+		t.Fatalf("unexpected compactions: %d", n)
+	}
+
+	// Both the open transaction and a new one read the remaining series.
+	count := func(tx EngineTx) (n int) {
+		c := tx.Cursor(1)
+		for k, _ := c.Seek(u64tob(0)); k != nil; k, _ = c.Next() {
+			n++
+		}
+		return
+	}
+	if n := count(tx); n != 1000 {
+		t.Fatalf("unexpected count in open transaction: %d", n)
+	}
+	tx.Rollback()
+
+	tx, err = e.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if n := count(tx); n != 1000 {
+		t.Fatalf("unexpected count after compaction: %d", n)
+	} else if c := tx.Cursor(2); c != nil {
+		t.Fatal("expected series 2 to be deleted")
+	} else if index := e.Index(); index != 10 {
+		t.Fatalf("unexpected index: %d", index)
+	}
+}
+
+// Ensure the shard cache is rebuilt from its log and commits to the engine.
+func TestShardCache_Replay(t *testing.T) {
+	f, _ := ioutil.TempFile("", "influxdb-")
+	f.Close()
+	defer os.Remove(f.Name())
+
+	// Append three messages, then a partial record.
+	c, err := openShardCache(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(1); i <= 3; i++ {
+		batch := append(marshalPointHeader(1, 2, int64(i)), 0, byte(i))
+		values, _ := unmarshalSeriesBatch(batch)
+		if err := c.append(i, batch, values); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.log.Write([]byte{0, 0, 0})
+	c.close()
+
+	// Replay messages after the first.
+	c, err = openShardCache(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+	if err := c.replay(1); err != nil {
+		t.Fatal(err)
+	} else if c.index != 3 {
+		t.Fatalf("unexpected index: %d", c.index)
+	} else if values := c.seriesValues(1); !reflect.DeepEqual(values, []SeriesValue{{Timestamp: 2, Data: []byte{0, 2}}, {Timestamp: 3, Data: []byte{0, 3}}}) {
+		t.Fatalf("unexpected values: %v", values)
+	}
+
+	// Commit to an engine and ensure the log is emptied.
+	e := NewBoltEngine()
+	if err := e.Open(f.Name() + ".bolt"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name() + ".bolt")
+	defer e.Close()
+	if n, err := c.commit(e); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Fatalf("unexpected commit count: %d", n)
+	} else if e.Index() != 3 {
+		t.Fatalf("unexpected engine index: %d", e.Index())
+	} else if fi, _ := os.Stat(f.Name()); fi.Size() != 0 {
+		t.Fatalf("unexpected log size: %d", fi.Size())
+	}
+}
+
+// Ensure a closed shard's series can't be read.
+func TestShard_cursors_Closed(t *testing.T) {
+	f, _ := ioutil.TempFile("", "influxdb-")
+	f.Close()
+	defer os.Remove(f.Name())
+	defer os.Remove(f.Name() + ".cache")
+
+	sh := newShard()
+	sh.Engine = DefaultEngine
+	if err := sh.open(f.Name(), &shardTestConn{c: make(chan *messaging.Message)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, tx, err := sh.cursors([]uint64{1}); err != nil {
+		t.Fatal(err)
+	} else {
+		tx.Rollback()
+	}
+
+	sh.close()
+	if _, _, err := sh.cursors([]uint64{1}); err != ErrShardNotLocal {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := sh.readSeries(1, 0); err != ErrShardNotLocal {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := sh.flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// shardTestConn is a messaging connection which delivers messages from a channel.
+type shardTestConn struct {
+	c chan *messaging.Message
+}
+
+func (c *shardTestConn) Open(index uint64, streaming bool) error { return nil }
+func (c *shardTestConn) C() <-chan *messaging.Message            { return c.c }
+
+// Ensure the cache cursor merges cached values over stored values in order.
+func TestCacheCursor(t *testing.T) {
+	db := mustOpenBolt()
+	defer db.Close()
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		b, _ := tx.CreateBucket(u64tob(1))
+		_, err := writeBlockPoints(b, []blockPoint{
+			{timestamp: 1, data: []byte{fieldEncodingTyped, 0x06, 1}},
+			{timestamp: 3, data: []byte{fieldEncodingTyped, 0x06, 1}},
+			{timestamp: 5, data: []byte{fieldEncodingTyped, 0x06, 1}},
+		})
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, _ := db.Begin(false)
+	defer tx.Rollback()
+	c := newCacheCursor(newShardCursor(tx.Bucket(u64tob(1)).Cursor()), []SeriesValue{
+		{Timestamp: 2, Data: []byte{2}},
+		{Timestamp: 3, Data: []byte{2}},
+		{Timestamp: 6, Data: []byte{2}},
+	})
+
+	var got []string
+	for k, v := c.Seek(u64tob(0)); k != nil; k, v = c.Next() {
+		got = append(got, fmt.Sprintf("%d=%d", btou64(k), v[len(v)-1]))
+	}
+	if exp := []string{"1=1", "2=2", "3=2", "5=1", "6=2"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected values: %v", got)
+	}
+
+	if k, _ := c.Seek(u64tob(4)); btou64(k) != 5 {
+		t.Fatalf("unexpected seek key: %d", btou64(k))
+	}
+
+	// Move to the last value, which is cached, then to the last stored value.
+	if k, v := c.Last(); btou64(k) != 6 || v[len(v)-1] != 2 {
+		t.Fatalf("unexpected last value: %d=%v", btou64(k), v)
+	} else if k, _ := c.Next(); k != nil {
+		t.Fatalf("unexpected next key: %d", btou64(k))
+	}
+	c = newCacheCursor(newShardCursor(tx.Bucket(u64tob(1)).Cursor()), []SeriesValue{{Timestamp: 2, Data: []byte{2}}})
+	if k, v := c.Last(); btou64(k) != 5 || v[len(v)-1] != 1 {
+		t.Fatalf("unexpected last value: %d=%v", btou64(k), v)
+	} else if k, _ := c.Next(); k != nil {
+		t.Fatalf("unexpected next key: %d", btou64(k))
+	}
+}
+
+// Ensure the series index keeps the number of series of each measurement and
+// values of each tag, and decodes series stored as JSON.
+func TestMetastore_seriesIndex(t *testing.T) {
+	f, _ := ioutil.TempFile("", "influxdb-")
+	f.Close()
+	defer os.Remove(f.Name())
+
+	m := &metastore{}
+	if err := m.open(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+	defer m.close()
+
+	verify := func(exp map[string]int, values map[string]int) {
+		m.mustView(func(tx *metatx) error {
+			for k, v := range values {
+				if got := tx.measurementIndex("foo", "cpu").tagValueN(k); got != v {
+					t.Fatalf("unexpected tag value count: %s: %d", k, got)
+				}
+			}
+
+			n := 0
+			for name, v := range exp {
+				if got := tx.measurementIndex("foo", name).seriesN(); got != v {
+					t.Fatalf("unexpected series count: %s: %d", name, got)
+				}
+				n += v
+			}
+			if got := tx.seriesN("foo"); got != n {
+				t.Fatalf("unexpected database series count: %d", got)
+			}
+			return nil
+		})
+	}
+
+	db := newDatabase()
+	db.name = "foo"
+	if err := m.update(func(tx *metatx) error {
+		if err := tx.saveDatabase(db); err != nil {
+			return err
+		}
+		for _, tags := range []map[string]string{{"host": "a", "region": "us|west"}, {"host": "b"}} {
+			if _, err := tx.createSeries("foo", "cpu", tags); err != nil {
+				return err
+			}
+		}
+		_, err := tx.createSeries("foo", "mem", map[string]string{})
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	verify(map[string]int{"cpu": 2, "mem": 1}, map[string]int{"host": 2, "region": 1})
+
+	// Series are decoded from the compact encoding and from JSON.
+	if err := m.update(func(tx *metatx) error {
+		b := tx.Bucket([]byte("Databases")).Bucket([]byte("foo")).Bucket([]byte("Series")).Bucket([]byte("cpu"))
+		return b.Put(u64tob(2), []byte(`{"ID":2,"Tags":{"host":"b"}}`))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	m.mustView(func(tx *metatx) error {
+		mi := tx.measurementIndex("foo", "cpu")
+		if s := mi.series(1); !reflect.DeepEqual(s, &Series{ID: 1, Tags: map[string]string{"host": "a", "region": "us|west"}}) {
+			t.Fatalf("unexpected series: %#v", s)
+		} else if s := mi.series(2); !reflect.DeepEqual(s, &Series{ID: 2, Tags: map[string]string{"host": "b"}}) {
+			t.Fatalf("unexpected series: %#v", s)
+		}
+		return nil
+	})
+
+	// Counts are updated as series and measurements are dropped.
+	if err := m.update(func(tx *metatx) error {
+		if err := tx.dropSeries("foo", map[string][]uint64{"cpu": {1}}); err != nil {
+			return err
+		}
+		return tx.dropMeasurement("foo", "mem")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	verify(map[string]int{"cpu": 1, "mem": 0}, map[string]int{"host": 1, "region": 0})
+
+	// Counts are rebuilt for indexes stored without them.
+	if err := m.update(func(tx *metatx) error {
+		b := tx.Bucket([]byte("Databases")).Bucket([]byte("foo"))
+		if err := b.DeleteBucket([]byte("SeriesCounts")); err != nil {
+			return err
+		}
+		return b.DeleteBucket([]byte("TagValueCounts"))
+	}); err != nil {
+		t.Fatal(err)
+	} else if err := m.init(); err != nil {
+		t.Fatal(err)
+	}
+	verify(map[string]int{"cpu": 1}, map[string]int{"host": 1, "region": 0})
+}
+
+// mustOpenBolt returns a bolt database at a temporary path which is removed on close.
+func mustOpenBolt() *tempBolt {
+	f, _ := ioutil.TempFile("", "influxdb-")
+	f.Close()
+	db, err := bolt.Open(f.Name(), 0666, nil)
+	if err != nil {
+		panic(err)
+	}
+	return &tempBolt{db}
+}
+
+// tempBolt is a bolt database which removes its file on close.
+type tempBolt struct {
+	*bolt.DB
+}
+
+// Close closes and removes the database.
+func (db *tempBolt) Close() error {
+	defer os.Remove(db.Path())
+	return db.DB.Close()
+}
+
 // Ensure tags can be marshaled into a byte slice.
 func TestMarshalTags(t *testing.T) {
 	for i, tt := range []struct {
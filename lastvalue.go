@@ -0,0 +1,196 @@
+package influxdb
+
+import (
+	"sync"
+)
+
+// seriesIDSet is a set of series ids which is safe for concurrent use. Each
+// database holds the set of series whose latest points are cached by shards.
+type seriesIDSet struct {
+	mu  sync.RWMutex
+	ids map[uint64]struct{}
+}
+
+// newSeriesIDSet returns an empty set.
+func newSeriesIDSet() *seriesIDSet {
+	return &seriesIDSet{ids: make(map[uint64]struct{})}
+}
+
+// add adds ids to the set.
+func (s *seriesIDSet) add(ids ...uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		s.ids[id] = struct{}{}
+	}
+}
+
+// remove removes ids from the set.
+func (s *seriesIDSet) remove(ids ...uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		delete(s.ids, id)
+	}
+}
+
+// contains returns true if id is in the set.
+func (s *seriesIDSet) contains(id uint64) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.ids[id]
+	return ok
+}
+
+// slice returns the ids in the set.
+func (s *seriesIDSet) slice() []uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a := make([]uint64, 0, len(s.ids))
+	for id := range s.ids {
+		a = append(a, id)
+	}
+	return a
+}
+
+// updateLastValues records the latest of the values of each tracked series.
+func (s *Shard) updateLastValues(values map[uint64][]SeriesValue) {
+	if s.lastSeries == nil {
+		return
+	}
+
+	s.lastMu.Lock()
+	defer s.lastMu.Unlock()
+	for seriesID, a := range values {
+		if !s.lastSeries.contains(seriesID) {
+			continue
+		}
+
+		// Later values replace earlier ones with the same timestamp.
+		v, ok := s.last[seriesID]
+		for _, other := range a {
+			if !ok || other.Timestamp >= v.Timestamp {
+				v, ok = other, true
+			}
+		}
+		s.last[seriesID] = SeriesValue{Timestamp: v.Timestamp, Data: append([]byte{}, v.Data...)}
+	}
+}
+
+// loadLastValues reads the latest value of each series from the shard.
+func (s *Shard) loadLastValues(seriesIDs []uint64) error {
+	cursors, tx, err := s.cursors(seriesIDs)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	values := make(map[uint64][]SeriesValue)
+	for i, c := range cursors {
+		if c == nil {
+			continue
+		}
+
+		// Keys are ordered as unsigned integers so negative timestamps are
+		// last. Read up to the first of them for the latest other timestamp.
+		k, v := c.Last()
+		if k != nil && int64(btou64(k)) < 0 {
+			for pk, pv := c.Seek(u64tob(0)); pk != nil && int64(btou64(pk)) >= 0; pk, pv = c.Next() {
+				k, v = pk, pv
+			}
+		}
+		if err := c.Err(); err != nil {
+			return err
+		} else if k != nil {
+			values[seriesIDs[i]] = []SeriesValue{{Timestamp: int64(btou64(k)), Data: append([]byte{}, v...)}}
+		}
+	}
+	s.updateLastValues(values)
+	return nil
+}
+
+// lastValues returns the cached latest value of each series, or nil if the
+// series isn't cached.
+func (s *Shard) lastValues(seriesIDs []uint64) []*SeriesValue {
+	s.lastMu.RLock()
+	defer s.lastMu.RUnlock()
+	a := make([]*SeriesValue, len(seriesIDs))
+	for i, id := range seriesIDs {
+		if v, ok := s.last[id]; ok {
+			a[i] = &v
+		}
+	}
+	return a
+}
+
+// dropLastValues removes the cached values of the series.
+func (s *Shard) dropLastValues(seriesIDs ...uint64) {
+	s.lastMu.Lock()
+	defer s.lastMu.Unlock()
+	for _, id := range seriesIDs {
+		delete(s.last, id)
+	}
+}
+
+// valueCursor is a cursor over a single value.
+type valueCursor struct {
+	value SeriesValue
+}
+
+// Seek returns the value if it is at or after the timestamp key.
+func (c *valueCursor) Seek(seek []byte) (key, value []byte) {
+	if uint64(c.value.Timestamp) < btou64(seek) {
+		return nil, nil
+	}
+	return u64tob(uint64(c.value.Timestamp)), c.value.Data
+}
+
+// Next returns nil since there is only one value.
+func (c *valueCursor) Next() (key, value []byte) { return nil, nil }
+
+// Last returns the value.
+func (c *valueCursor) Last() (key, value []byte) {
+	return u64tob(uint64(c.value.Timestamp)), c.value.Data
+}
+
+// Err returns nil since the value is always readable.
+func (c *valueCursor) Err() error { return nil }
+
+// EnableLastValueCache caches the latest point of each series of a measurement
+// on the local shards so queries selecting only last() don't read every series.
+// The cache is held in memory and rebuilt when the server opens.
+func (s *Server) EnableLastValueCache(database, measurement string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastValueMeasurements[database] == nil {
+		s.lastValueMeasurements[database] = make(map[string]bool)
+	}
+	s.lastValueMeasurements[database][measurement] = true
+
+	// Track the existing series of an open server's measurement.
+	db := s.databases[database]
+	if db == nil {
+		return
+	}
+	m := db.measurements[measurement]
+	if m == nil {
+		return
+	}
+	ids := []uint64(m.seriesIDs())
+	db.lastValueSeries.add(ids...)
+
+	// Load the latest values from the local shards.
+	for _, rp := range db.policies {
+		for _, g := range rp.shardGroups {
+			for _, sh := range g.Shards {
+				if sh.engine == nil {
+					continue
+				}
+				if err := sh.loadLastValues(ids); err != nil {
+					s.Logger.Printf("failed to load last values: shard=%d, err=%s", sh.ID, err)
+				}
+			}
+		}
+	}
+}
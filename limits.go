@@ -0,0 +1,183 @@
+package influxdb
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// seriesLimitWarnRatio is the fraction of a cardinality limit at which a
+	// warning is logged.
+	seriesLimitWarnRatio = 0.8
+
+	// partialWriteErrorPointN is the most dropped points listed by the text of
+	// a partial write error.
+	partialWriteErrorPointN = 10
+)
+
+// ErrPartialWrite is returned when some points of a write are dropped. The
+// other points are written.
+type ErrPartialWrite struct {
+	Dropped []Point // points which were not written
+	Reason  error   // why the first point was dropped
+}
+
+// Error returns the number of points dropped, why, and which points they were.
+func (e ErrPartialWrite) Error() string {
+	a := make([]string, 0, partialWriteErrorPointN+1)
+	for i, p := range e.Dropped {
+		if i == partialWriteErrorPointN {
+			a = append(a, fmt.Sprintf("and %d more", len(e.Dropped)-i))
+			break
+		}
+		a = append(a, pointString(p))
+	}
+	return fmt.Sprintf("%d points dropped: %s: %s", len(e.Dropped), e.Reason, strings.Join(a, ", "))
+}
+
+// pointString returns the measurement, sorted tags and timestamp of a point.
+func pointString(p Point) string {
+	keys := make([]string, 0, len(p.Tags))
+	for k := range p.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	s := p.Name
+	for _, k := range keys {
+		s += "," + k + "=" + p.Tags[k]
+	}
+	return s + " " + p.Timestamp.UTC().Format(time.RFC3339Nano)
+}
+
+// enforceSeriesLimits returns the points which can be written without creating
+// more series than the server's cardinality limits allow. If any points are
+// dropped, an ErrPartialWrite listing them is returned as well.
+//
+// Limits are checked against the series known to this server, so concurrent
+// writes through other servers may exceed them slightly.
+func (s *Server) enforceSeriesLimits(database string, points []Point) ([]Point, error) {
+	if s.MaxSeriesPerDatabase <= 0 && s.MaxValuesPerTag <= 0 {
+		return points, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	db := s.databases[database]
+	if db == nil {
+		return points, nil
+	}
+
+	// Series and tag values created by earlier points of the batch.
+	newSeries := make(map[string]struct{})
+	newValues := make(map[string]map[string]struct{})
+	valueN := make(map[string]int)
+
+	seriesN := -1
+	var limitErr error
+	var dropped []Point
+	accepted := make([]Point, 0, len(points))
+	_ = s.meta.mustView(func(tx *metatx) error {
+		indexes := newMeasurementIndexes(tx, database)
+		for _, p := range points {
+			key := string(marshalTags(p.Tags))
+			mi := indexes.get(p.Name)
+
+			// Points of existing series are always written.
+			if _, ok := newSeries[p.Name+"\x00"+key]; ok {
+				accepted = append(accepted, p)
+				continue
+			} else if mi.seriesByTags(p.Tags) != nil {
+				accepted = append(accepted, p)
+				continue
+			}
+
+			// Check the number of series in the database.
+			if s.MaxSeriesPerDatabase > 0 {
+				if seriesN < 0 {
+					seriesN = tx.seriesN(database)
+				}
+				if seriesN+len(newSeries) >= s.MaxSeriesPerDatabase {
+					if limitErr == nil {
+						limitErr = fmt.Errorf("max series per database exceeded: %s (%d)", database, s.MaxSeriesPerDatabase)
+					}
+					dropped = append(dropped, p)
+					continue
+				}
+			}
+
+			// Check the number of values of each tag.
+			var values []string
+			if s.MaxValuesPerTag > 0 {
+				var err error
+				if values, err = s.newTagValues(mi, p, newValues, valueN); err != nil {
+					if limitErr == nil {
+						limitErr = err
+					}
+					dropped = append(dropped, p)
+					continue
+				}
+			}
+
+			// Accept the point and track the series and tag values it creates.
+			newSeries[p.Name+"\x00"+key] = struct{}{}
+			if s.MaxSeriesPerDatabase > 0 {
+				warnSeriesLimit(seriesN+len(newSeries), s.MaxSeriesPerDatabase, "series in database %s", database)
+			}
+			for _, k := range values {
+				tagKey := p.Name + "\x00" + k
+				if newValues[tagKey] == nil {
+					newValues[tagKey] = make(map[string]struct{})
+				}
+				newValues[tagKey][p.Tags[k]] = struct{}{}
+				warnSeriesLimit(valueN[tagKey]+len(newValues[tagKey]), s.MaxValuesPerTag, "values of tag %s.%s in database %s", p.Name, k, database)
+			}
+			accepted = append(accepted, p)
+		}
+		return nil
+	})
+
+	if len(dropped) > 0 {
+		s.stats.Add("pointWriteRxLimited", int64(len(dropped)))
+		return accepted, ErrPartialWrite{Dropped: dropped, Reason: limitErr}
+	}
+	return accepted, nil
+}
+
+// newTagValues returns the tag keys of a point whose values don't exist yet.
+// Returns an error if a new value would exceed the server's limit of values
+// per tag. The number of existing values of each tag is cached in valueN.
+func (s *Server) newTagValues(mi *measurementIndex, p Point, newValues map[string]map[string]struct{}, valueN map[string]int) ([]string, error) {
+	var keys []string
+	for k, v := range p.Tags {
+		tagKey := p.Name + "\x00" + k
+		if _, ok := newValues[tagKey][v]; ok {
+			continue
+		} else if mi.hasTagValue(k, v) {
+			continue
+		}
+
+		n, ok := valueN[tagKey]
+		if !ok {
+			n = mi.tagValueN(k)
+			valueN[tagKey] = n
+		}
+		if n+len(newValues[tagKey]) >= s.MaxValuesPerTag {
+			return nil, fmt.Errorf("max values per tag exceeded: %s.%s (%d)", p.Name, k, s.MaxValuesPerTag)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// warnSeriesLimit logs a warning when n reaches the warning ratio of a limit.
+func warnSeriesLimit(n, limit int, format string, a ...interface{}) {
+	if n == int(math.Ceil(float64(limit)*seriesLimitWarnRatio)) {
+		log.Printf("warning: %d of %d "+format+" used", append([]interface{}{n, limit}, a...)...)
+	}
+}
@@ -45,7 +45,8 @@ func (m *metastore) init() error {
 		_, _ = tx.CreateBucketIfNotExists([]byte("DataNodes"))
 		_, _ = tx.CreateBucketIfNotExists([]byte("Databases"))
 		_, _ = tx.CreateBucketIfNotExists([]byte("Users"))
-		return nil
+		_, _ = tx.CreateBucketIfNotExists([]byte("ShardPaths"))
+		return (&metatx{tx}).buildSeriesIndexes()
 	})
 }
 
@@ -155,6 +156,29 @@ func (tx *metatx) nextShardGroupID() (id uint64) {
 	return tx.mustNextSequence([]byte("shardGroupID"))
 }
 
+// shardPath returns the path a local shard was moved to, or a blank string if
+// the shard is stored at its default path.
+func (tx *metatx) shardPath(id uint64) string {
+	return string(tx.Bucket([]byte("ShardPaths")).Get(u64tob(id)))
+}
+
+// setShardPath records the path a local shard was moved to. Paths are local to
+// the server and not replicated.
+func (tx *metatx) setShardPath(id uint64, path string) error {
+	return tx.Bucket([]byte("ShardPaths")).Put(u64tob(id), []byte(path))
+}
+
+// deleteShardPaths removes the recorded paths of shards.
+func (tx *metatx) deleteShardPaths(shards []*Shard) error {
+	b := tx.Bucket([]byte("ShardPaths"))
+	for _, sh := range shards {
+		if err := b.Delete(u64tob(sh.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // dataNodes returns a list of all data nodes from the metastore.
 func (tx *metatx) dataNodes() (a []*DataNode) {
 	c := tx.Bucket([]byte("DataNodes")).Cursor()
@@ -204,6 +228,11 @@ func (tx *metatx) saveDatabase(db *database) error {
 	_, _ = b.CreateBucketIfNotExists([]byte("TagBytesToID"))
 	_, _ = b.CreateBucketIfNotExists([]byte("Measurements"))
 	_, _ = b.CreateBucketIfNotExists([]byte("Series"))
+	_, _ = b.CreateBucketIfNotExists([]byte("SeriesKeys"))
+	_, _ = b.CreateBucketIfNotExists([]byte("Tags"))
+	_, _ = b.CreateBucketIfNotExists([]byte("SeriesMeasurements"))
+	_, _ = b.CreateBucketIfNotExists([]byte("SeriesCounts"))
+	_, _ = b.CreateBucketIfNotExists([]byte("TagValueCounts"))
 	return b.Put([]byte("meta"), mustMarshalJSON(db))
 }
 
@@ -212,9 +241,23 @@ func (tx *metatx) dropDatabase(name string) error {
 	return tx.Bucket([]byte("Databases")).DeleteBucket([]byte(name))
 }
 
-// dropMeasurement removes measurement from the metastore.
+// dropMeasurement removes measurement and its series from the metastore.
 func (tx *metatx) dropMeasurement(database, measurement string) error {
-	return tx.Bucket([]byte("Databases")).Bucket([]byte(database)).Bucket([]byte("Series")).DeleteBucket([]byte(measurement))
+	db := tx.Bucket([]byte("Databases")).Bucket([]byte(database))
+	for _, id := range tx.measurementIndex(database, measurement).seriesIDs() {
+		if err := db.Bucket([]byte("SeriesMeasurements")).Delete(u64tob(id)); err != nil {
+			return err
+		}
+	}
+	for _, name := range []string{"SeriesKeys", "Tags", "TagValueCounts"} {
+		if err := db.Bucket([]byte(name)).DeleteBucket([]byte(measurement)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+	}
+	if err := db.Bucket([]byte("SeriesCounts")).Delete([]byte(measurement)); err != nil {
+		return err
+	}
+	return db.Bucket([]byte("Series")).DeleteBucket([]byte(measurement))
 }
 
 // saveMeasurement persists a measurement to the metastore.
@@ -241,43 +284,58 @@ func (tx *metatx) createSeries(database, name string, tags map[string]string) (*
 	s := &Series{ID: uint64(id), Tags: tags}
 	idBytes := u64tob(uint64(id))
 
-	if err := b.Put(idBytes, mustMarshalJSON(s)); err != nil {
+	if err := b.Put(idBytes, marshalSeries(s)); err != nil {
+		return nil, err
+	} else if err := indexSeries(db, name, s); err != nil {
 		return nil, err
 	}
 	return s, nil
 }
 
+// series returns a series of a database by id along with the name of its
+// measurement. Returns nil if the series doesn't exist.
+func (tx *metatx) series(database string, id uint64) (string, *Series) {
+	db := tx.Bucket([]byte("Databases")).Bucket([]byte(database))
+	if db == nil {
+		return "", nil
+	}
+	name := db.Bucket([]byte("SeriesMeasurements")).Get(u64tob(id))
+	if name == nil {
+		return "", nil
+	}
+	return string(name), tx.measurementIndex(database, string(name)).series(id)
+}
+
 // dropSeries removes all seriesIDS for a given database/measurement
 func (tx *metatx) dropSeries(database string, seriesByMeasurement map[string][]uint64) error {
+	db := tx.Bucket([]byte("Databases")).Bucket([]byte(database))
 	for measurement, ids := range seriesByMeasurement {
-		b := tx.Bucket([]byte("Databases")).Bucket([]byte(database)).Bucket([]byte("Series")).Bucket([]byte(measurement))
-		if b != nil {
-			for _, id := range ids {
-				if err := b.Delete(u64tob(id)); err != nil {
-					return err
-				}
+		mi := tx.measurementIndex(database, measurement)
+		for _, id := range ids {
+			s := mi.series(id)
+			if s == nil {
+				continue
+			}
+			if err := unindexSeries(db, measurement, s); err != nil {
+				return err
+			} else if err := mi.bucket.Delete(u64tob(id)); err != nil {
+				return err
 			}
 		}
 	}
 	return nil
 }
 
-// loops through all the measurements and series in a database
+// loads the measurements of a database. Series are read from the series index
+// on demand.
 func (tx *metatx) indexDatabase(db *database) {
 	// get the bucket that holds series data for the database
 	b := tx.Bucket([]byte("Databases")).Bucket([]byte(db.name))
 
-	// Iterate over and index series.
-	seriesBucket := b.Bucket([]byte("Series"))
-	c := seriesBucket.Cursor()
+	// Iterate over measurements with series.
+	c := b.Bucket([]byte("Series")).Cursor()
 	for k, _ := c.First(); k != nil; k, _ = c.Next() {
-		mc := seriesBucket.Bucket(k).Cursor()
-		name := string(k)
-		for id, v := mc.First(); id != nil; id, v = mc.Next() {
-			var s *Series
-			mustUnmarshalJSON(v, &s)
-			db.addSeriesToIndex(name, s)
-		}
+		db.createMeasurementIfNotExists(string(k))
 	}
 
 	// Iterate over measurement metadata.
@@ -0,0 +1,254 @@
+package opentsdb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/influxdb/influxdb"
+)
+
+// httpMethods are the request line prefixes used to detect HTTP connections.
+// Telnet commands are lower case, so "PUT " cannot be confused with "put ".
+var httpMethods = []string{"GET ", "POST", "PUT ", "HEAD", "OPTI", "DELE"}
+
+// isHTTP returns true if the first bytes of a connection are an HTTP request line.
+func isHTTP(b []byte) bool {
+	for _, m := range httpMethods {
+		if string(b) == m {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler serves the OpenTSDB HTTP API. Only /api/put is supported.
+type Handler struct {
+	server *Server
+}
+
+// ServeHTTP responds to HTTP requests.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/put":
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.servePut(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// putPoint is a single data point posted to /api/put.
+type putPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp int64             `json:"timestamp"`
+	Value     interface{}       `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// putError describes a data point which could not be stored.
+type putError struct {
+	Datapoint putPoint `json:"datapoint"`
+	Error     string   `json:"error"`
+}
+
+// putResponse is returned when the summary or details parameter is set.
+type putResponse struct {
+	Success int        `json:"success"`
+	Failed  int        `json:"failed"`
+	Errors  []putError `json:"errors,omitempty"`
+}
+
+// servePut decodes a single data point or an array of data points and passes
+// them to the server's batcher. The body may be gzip compressed.
+func (h *Handler) servePut(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, "invalid gzip body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gr.Close()
+		body = gr
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		http.Error(w, "unable to parse request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Accept either a single object or an array of objects.
+	var points []putPoint
+	if len(raw) > 0 && raw[0] == '[' {
+		if err := json.Unmarshal(raw, &points); err != nil {
+			http.Error(w, "unable to parse request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		var p putPoint
+		if err := json.Unmarshal(raw, &p); err != nil {
+			http.Error(w, "unable to parse request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		points = append(points, p)
+	}
+
+	var resp putResponse
+	for _, p := range points {
+		pt, err := p.point()
+		if err != nil {
+			h.server.stats.Inc("parseFail")
+			resp.Failed++
+			resp.Errors = append(resp.Errors, putError{Datapoint: p, Error: err.Error()})
+			continue
+		}
+
+		h.server.stats.Inc("pointsRx")
+		h.server.batcher.In() <- pt
+		resp.Success++
+	}
+
+	// Only report details if requested.
+	q := r.URL.Query()
+	_, details := q["details"]
+	_, summary := q["summary"]
+	if !details {
+		resp.Errors = nil
+	}
+
+	status := http.StatusNoContent
+	if resp.Failed > 0 {
+		status = http.StatusBadRequest
+	}
+
+	if !details && !summary {
+		if resp.Failed > 0 {
+			http.Error(w, fmt.Sprintf("%d of %d data points had errors", resp.Failed, len(points)), status)
+			return
+		}
+		w.WriteHeader(status)
+		return
+	}
+
+	if status == http.StatusNoContent {
+		status = http.StatusOK
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// point converts the data point to an InfluxDB point.
+func (p *putPoint) point() (influxdb.Point, error) {
+	if p.Metric == "" {
+		return influxdb.Point{}, errors.New("metric name required")
+	} else if p.Timestamp <= 0 {
+		return influxdb.Point{}, errors.New("invalid timestamp")
+	}
+
+	// Values may be sent as numbers or as strings.
+	var v float64
+	switch value := p.Value.(type) {
+	case float64:
+		v = value
+	case string:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return influxdb.Point{}, fmt.Errorf("invalid value: %q", value)
+		}
+		v = f
+	default:
+		return influxdb.Point{}, fmt.Errorf("invalid value: %v", p.Value)
+	}
+
+	// Timestamps larger than 10 digits are in milliseconds.
+	var t time.Time
+	if p.Timestamp > 9999999999 {
+		t = time.Unix(p.Timestamp/1000, (p.Timestamp%1000)*int64(time.Millisecond))
+	} else {
+		t = time.Unix(p.Timestamp, 0)
+	}
+
+	return influxdb.Point{
+		Name:      p.Metric,
+		Tags:      p.Tags,
+		Timestamp: t,
+		Fields:    map[string]interface{}{"value": v},
+	}, nil
+}
+
+// chanListener is a net.Listener which accepts connections handed to it by
+// the server after it has detected an HTTP request.
+type chanListener struct {
+	addr   net.Addr
+	ch     chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newChanListener(addr net.Addr) *chanListener {
+	return &chanListener{
+		addr:   addr,
+		ch:     make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+// Accept waits for the next handed off connection.
+func (l *chanListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.ch:
+		return conn, nil
+	case <-l.closed:
+		return nil, errors.New("listener closed")
+	}
+}
+
+// Close stops the listener. Connections handed off afterwards are closed.
+func (l *chanListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+// Addr returns the address of the OpenTSDB listener.
+func (l *chanListener) Addr() net.Addr { return l.addr }
+
+// handoff passes conn to the HTTP server, closing it if the listener is closed.
+func (l *chanListener) handoff(conn net.Conn) {
+	select {
+	case l.ch <- conn:
+	case <-l.closed:
+		conn.Close()
+	}
+}
+
+// sniffedConn is a connection whose first bytes have already been buffered by
+// a reader. onClose is called once when the connection is closed.
+type sniffedConn struct {
+	net.Conn
+	r       *bufio.Reader
+	once    sync.Once
+	onClose func()
+}
+
+func (c *sniffedConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+func (c *sniffedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.onClose)
+	return err
+}
@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"log"
 	"net"
+	"net/http"
 	"net/textproto"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -27,6 +29,9 @@ type SeriesWriter interface {
 }
 
 // An InfluxDB input class to accept OpenTSDB's telnet protocol
+// Points from all connections are buffered and written in batches.
+// HTTP requests to /api/put are served on the same port, and are
+// detected from the first bytes sent on a connection.
 // Each telnet command consists of a line of the form:
 //   put sys.cpu.user 1356998400 42.5 host=webserver01 cpu=0
 type Server struct {
@@ -36,7 +41,18 @@ type Server struct {
 	retentionpolicy string
 
 	listener *net.TCPListener
-	wg       sync.WaitGroup
+	httpLn   *chanListener
+	batcher  *influxdb.PointBatcher
+	stats    *influxdb.Stats
+
+	wg      sync.WaitGroup // accept loop and connections
+	writing sync.WaitGroup // batch writer
+	done    chan struct{}
+
+	// Points are buffered until BatchSize points are received or
+	// BatchTimeout has passed since the first buffered point.
+	BatchSize    int
+	BatchTimeout time.Duration
 
 	addr net.Addr
 }
@@ -47,10 +63,19 @@ func NewServer(w SeriesWriter, retpol string, db string) *Server {
 	s.writer = w
 	s.retentionpolicy = retpol
 	s.database = db
+	s.stats = influxdb.NewStats("opentsdb")
+	s.BatchSize = influxdb.DefaultBatchSize
+	s.BatchTimeout = influxdb.DefaultBatchTimeout
 
 	return s
 }
 
+// Stats returns the counters for points received, batches written and
+// parse failures.
+func (s *Server) Stats() *influxdb.Stats {
+	return s.stats
+}
+
 func (s *Server) Addr() net.Addr {
 	return s.addr
 }
@@ -72,6 +97,21 @@ func (s *Server) ListenAndServe(listenAddress string) {
 
 	s.addr = s.listener.Addr()
 
+	s.batcher = influxdb.NewPointBatcher(s.BatchSize, s.BatchTimeout)
+	s.batcher.Start()
+	s.done = make(chan struct{})
+	s.writing.Add(1)
+	go s.writePoints()
+
+	// Serve HTTP connections handed off by HandleConnection.
+	s.httpLn = newChanListener(s.addr)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		srv := &http.Server{Handler: &Handler{server: s}}
+		srv.Serve(s.httpLn)
+	}()
+
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
@@ -91,18 +131,41 @@ func (s *Server) ListenAndServe(listenAddress string) {
 	}()
 }
 
+// Close stops the listener, waits for open connections to finish and writes
+// any buffered points.
 func (s *Server) Close() error {
-	var err error
-	if s.listener != nil {
-		err = (*s.listener).Close()
+	if s.listener == nil {
+		return nil
 	}
+
+	err := s.listener.Close()
+	s.httpLn.Close()
 	s.wg.Wait()
+
+	// Flush the remaining points before stopping the writer.
+	s.batcher.Stop()
+	close(s.done)
+	s.writing.Wait()
+
 	s.listener = nil
 	return err
 }
 
+// writePoints writes batches emitted by the batcher until the server is closed.
+func (s *Server) writePoints() {
+	defer s.writing.Done()
+	influxdb.WriteBatches(s.batcher, s.writer, s.database, s.retentionpolicy, s.stats, log.New(os.Stderr, "", log.LstdFlags), s.done)
+}
+
 func (s *Server) HandleConnection(conn net.Conn) {
 	reader := bufio.NewReader(conn)
+
+	// Hand HTTP connections off to the HTTP server, which closes them.
+	if b, err := reader.Peek(4); err == nil && isHTTP(b) {
+		s.httpLn.handoff(&sniffedConn{Conn: conn, r: reader, onClose: s.wg.Done})
+		return
+	}
+
 	tp := textproto.NewReader(reader)
 
 	defer conn.Close()
@@ -123,6 +186,7 @@ func (s *Server) HandleConnection(conn net.Conn) {
 		}
 
 		if len(inputStrs) < 4 || inputStrs[0] != "put" {
+			s.stats.Inc("parseFail")
 			log.Println("TSDBServer: malformed line, skipping: ", line)
 			continue
 		}
@@ -135,7 +199,9 @@ func (s *Server) HandleConnection(conn net.Conn) {
 		var t time.Time
 		ts, err := strconv.ParseInt(tsStr, 10, 64)
 		if err != nil {
+			s.stats.Inc("parseFail")
 			log.Println("TSDBServer: malformed timestamp, skipping: ", tsStr)
+			continue
 		}
 
 		switch len(tsStr) {
@@ -146,6 +212,7 @@ func (s *Server) HandleConnection(conn net.Conn) {
 			t = time.Unix(ts/1000, (ts%1000)*1000)
 			break
 		default:
+			s.stats.Inc("parseFail")
 			log.Println("TSDBServer: timestamp must be 10 or 13 chars, skipping: ", tsStr)
 			continue
 		}
@@ -165,6 +232,7 @@ func (s *Server) HandleConnection(conn net.Conn) {
 		fields := make(map[string]interface{})
 		fields["value"], err = strconv.ParseFloat(valueStr, 64)
 		if err != nil {
+			s.stats.Inc("parseFail")
 			log.Println("TSDBServer: could not parse value as float: ", valueStr)
 			continue
 		}
@@ -176,10 +244,7 @@ func (s *Server) HandleConnection(conn net.Conn) {
 			Fields:    fields,
 		}
 
-		_, err = s.writer.WriteSeries(s.database, s.retentionpolicy, []influxdb.Point{p})
-		if err != nil {
-			log.Println("TSDB cannot write data: ", err)
-			continue
-		}
+		s.stats.Inc("pointsRx")
+		s.batcher.In() <- p
 	}
 }
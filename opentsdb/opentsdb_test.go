@@ -0,0 +1,172 @@
+package opentsdb_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdb/influxdb/opentsdb"
+	"github.com/influxdb/influxdb/test"
+)
+
+// Ensure the server buffers points and writes them in batches.
+func TestServer_Batching(t *testing.T) {
+	w := make(test.SeriesWriter, 1)
+	s := opentsdb.NewServer(w, "raw", "opentsdb")
+	s.BatchSize = 2
+	s.BatchTimeout = time.Hour
+	s.ListenAndServe("127.0.0.1:0")
+	if s.Addr() == nil {
+		t.Fatal("server not listening")
+	}
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("put sys.cpu.user 1356998400 42.5 host=webserver01\n" +
+		"put sys.cpu.user bad 42.5\n" +
+		"put sys.cpu.user 1356998401 43 host=webserver01\n" +
+		"put sys.cpu.user 1356998402 44 host=webserver01\n")); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	// The first batch is written once it is full.
+	b := w.Wait(t)
+	if b.Database != "opentsdb" || b.RetentionPolicy != "raw" {
+		t.Fatalf("unexpected destination: %s.%s", b.Database, b.RetentionPolicy)
+	} else if len(b.Points) != 2 {
+		t.Fatalf("unexpected number of points.  expected %d, got %d", 2, len(b.Points))
+	} else if b.Points[0].Tags["host"] != "webserver01" || b.Points[0].Fields["value"] != 42.5 {
+		t.Fatalf("unexpected point: %#v", b.Points[0])
+	}
+
+	// The remaining point is written when the server is closed.
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b := w.Wait(t); len(b.Points) != 1 {
+		t.Fatalf("unexpected number of points.  expected %d, got %d", 1, len(b.Points))
+	}
+
+	st := s.Stats()
+	if n := st.Get("pointsRx"); n != 3 {
+		t.Fatalf("unexpected pointsRx.  expected %d, got %d", 3, n)
+	} else if n := st.Get("batchesTx"); n != 2 {
+		t.Fatalf("unexpected batchesTx.  expected %d, got %d", 2, n)
+	} else if n := st.Get("parseFail"); n != 1 {
+		t.Fatalf("unexpected parseFail.  expected %d, got %d", 1, n)
+	}
+}
+
+// Ensure the server accepts data points posted to /api/put.
+func TestServer_HTTP_Put(t *testing.T) {
+	var tests = []struct {
+		test   string
+		query  string
+		body   string
+		gzip   bool
+		status int
+		resp   string
+		n      int
+	}{
+		{
+			test:   "single point",
+			body:   `{"metric":"sys.cpu.nice","timestamp":1346846400,"value":18,"tags":{"host":"web01"}}`,
+			status: http.StatusNoContent,
+			n:      1,
+		},
+		{
+			test:   "multiple points",
+			body:   `[{"metric":"sys.cpu.nice","timestamp":1346846400,"value":18,"tags":{"host":"web01"}},{"metric":"sys.cpu.nice","timestamp":1346846400000,"value":"9.5","tags":{"host":"web02"}}]`,
+			status: http.StatusNoContent,
+			n:      2,
+		},
+		{
+			test:   "gzip body",
+			body:   `{"metric":"sys.cpu.nice","timestamp":1346846400,"value":18,"tags":{"host":"web01"}}`,
+			gzip:   true,
+			status: http.StatusNoContent,
+			n:      1,
+		},
+		{
+			test:   "summary",
+			query:  "summary",
+			body:   `[{"metric":"sys.cpu.nice","timestamp":1346846400,"value":18},{"metric":"","timestamp":1346846400,"value":18}]`,
+			status: http.StatusBadRequest,
+			resp:   `{"success":1,"failed":1}`,
+			n:      1,
+		},
+		{
+			test:   "details",
+			query:  "details",
+			body:   `{"metric":"sys.cpu.nice","timestamp":1346846400,"value":"x"}`,
+			status: http.StatusBadRequest,
+			resp:   `{"success":0,"failed":1,"errors":[{"datapoint":{"metric":"sys.cpu.nice","timestamp":1346846400,"value":"x","tags":null},"error":"invalid value: \"x\""}]}`,
+		},
+		{
+			test:   "invalid json",
+			body:   `{"metric":`,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Logf("testing %q...", tt.test)
+
+		w := make(test.SeriesWriter, 1)
+		s := opentsdb.NewServer(w, "", "opentsdb")
+		s.BatchTimeout = time.Hour
+		s.ListenAndServe("127.0.0.1:0")
+
+		var body bytes.Buffer
+		if tt.gzip {
+			gw := gzip.NewWriter(&body)
+			gw.Write([]byte(tt.body))
+			gw.Close()
+		} else {
+			body.WriteString(tt.body)
+		}
+
+		req, err := http.NewRequest("POST", "http://"+s.Addr().String()+"/api/put?"+tt.query, &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.gzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		req.Close = true
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.status {
+			t.Fatalf("unexpected status.  expected %d, got %d: %s", tt.status, resp.StatusCode, b)
+		} else if tt.resp != "" && strings.TrimSpace(string(b)) != tt.resp {
+			t.Fatalf("unexpected response.\n\nexp: %s\n\ngot: %s", tt.resp, b)
+		}
+
+		// Buffered points are written on close.
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if tt.n == 0 {
+			continue
+		}
+		if b := w.Wait(t); len(b.Points) != tt.n {
+			t.Fatalf("unexpected number of points.  expected %d, got %d", tt.n, len(b.Points))
+		} else if !b.Points[0].Timestamp.Equal(time.Unix(1346846400, 0)) {
+			t.Fatalf("unexpected timestamp: %v", b.Points[0].Timestamp)
+		}
+	}
+}
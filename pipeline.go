@@ -0,0 +1,305 @@
+package influxdb
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Rule actions supported by a Pipeline.
+const (
+	// RuleRenameMeasurement replaces matches of Pattern in measurement names with Value.
+	RuleRenameMeasurement = "rename-measurement"
+
+	// RuleRenameTag replaces matches of Pattern in tag keys with Value.
+	RuleRenameTag = "rename-tag"
+
+	// RuleRenameField replaces matches of Pattern in field keys with Value.
+	RuleRenameField = "rename-field"
+
+	// RuleDropTag removes tags with keys matching Pattern.
+	RuleDropTag = "drop-tag"
+
+	// RuleDropPoint drops points with measurement names matching Pattern or,
+	// if Key is set, with a value of the tag Key matching Pattern.
+	RuleDropPoint = "drop-point"
+
+	// RuleAddTag sets the tag Key to Value on points which don't have it.
+	RuleAddTag = "add-tag"
+
+	// RuleConvertField converts fields with keys matching Pattern to Type,
+	// which is one of "float", "integer", "string" or "boolean".
+	RuleConvertField = "convert-field"
+)
+
+// Rule describes a single step of a Pipeline.
+type Rule struct {
+	// Name identifies the rule in the pipeline stats. It defaults to the
+	// rule's position and action, such as "rule1_drop-tag".
+	Name string
+
+	Action string
+
+	// Measurement, if set, is a regex restricting the rule to points with
+	// matching measurement names.
+	Measurement string
+
+	Pattern string
+	Key     string
+	Value   string
+	Type    string
+
+	measurement *regexp.Regexp
+	pattern     *regexp.Regexp
+}
+
+// Pipeline rewrites and filters points before they are written. Rules are
+// applied to each point in order and the number of points each rule changed
+// or dropped is counted in the pipeline's stats under the rule's name.
+type Pipeline struct {
+	rules []*Rule
+	stats *Stats
+}
+
+// NewPipeline returns a pipeline applying the rules in order. Returns an
+// error if a rule is invalid.
+func NewPipeline(rules []Rule) (*Pipeline, error) {
+	p := &Pipeline{stats: NewStats("pipeline")}
+	for i := range rules {
+		r := rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule%d_%s", i+1, r.Action)
+		}
+
+		switch r.Action {
+		case RuleRenameMeasurement, RuleRenameTag, RuleRenameField, RuleDropTag, RuleDropPoint:
+			if r.Pattern == "" {
+				return nil, fmt.Errorf("rule %s: pattern required", r.Name)
+			}
+		case RuleAddTag:
+			if r.Key == "" || r.Value == "" {
+				return nil, fmt.Errorf("rule %s: key and value required", r.Name)
+			}
+		case RuleConvertField:
+			if r.Pattern == "" {
+				return nil, fmt.Errorf("rule %s: pattern required", r.Name)
+			} else if _, err := convertFieldValue(0.0, r.Type); err != nil {
+				return nil, fmt.Errorf("rule %s: %s", r.Name, err)
+			}
+		default:
+			return nil, fmt.Errorf("rule %s: unknown action: %q", r.Name, r.Action)
+		}
+
+		var err error
+		if r.Measurement != "" {
+			if r.measurement, err = regexp.Compile(r.Measurement); err != nil {
+				return nil, fmt.Errorf("rule %s: invalid measurement regex: %s", r.Name, err)
+			}
+		}
+		if r.Pattern != "" {
+			if r.pattern, err = regexp.Compile(r.Pattern); err != nil {
+				return nil, fmt.Errorf("rule %s: invalid pattern: %s", r.Name, err)
+			}
+		}
+		p.rules = append(p.rules, &r)
+	}
+	return p, nil
+}
+
+// Stats returns the counters for each rule and for points dropped.
+func (p *Pipeline) Stats() *Stats {
+	return p.stats
+}
+
+// Process applies the rules to the points and returns the points which
+// weren't dropped. The tags and fields of the given points are not
+// modified, since they may be shared between points.
+func (p *Pipeline) Process(points []Point) []Point {
+	if len(p.rules) == 0 {
+		return points
+	}
+
+	other := make([]Point, 0, len(points))
+	for _, pt := range points {
+		pt.Tags = copyTags(pt.Tags)
+		pt.Fields = copyFields(pt.Fields)
+
+		if p.apply(&pt) {
+			other = append(other, pt)
+		} else {
+			p.stats.Inc("pointsDropped")
+		}
+	}
+	return other
+}
+
+// apply runs each rule against the point. Returns false if the point is dropped.
+func (p *Pipeline) apply(pt *Point) bool {
+	for _, r := range p.rules {
+		if r.measurement != nil && !r.measurement.MatchString(pt.Name) {
+			continue
+		}
+
+		var changed bool
+		switch r.Action {
+		case RuleRenameMeasurement:
+			if name := r.pattern.ReplaceAllString(pt.Name, r.Value); name != pt.Name {
+				pt.Name, changed = name, true
+			}
+		case RuleRenameTag:
+			// Find the renamed keys first so new keys aren't renamed again.
+			renames := make(map[string]string)
+			for k := range pt.Tags {
+				if key := r.pattern.ReplaceAllString(k, r.Value); key != k {
+					renames[k] = key
+				}
+			}
+			for k, key := range renames {
+				pt.Tags[key] = pt.Tags[k]
+				delete(pt.Tags, k)
+			}
+			changed = len(renames) > 0
+		case RuleRenameField:
+			renames := make(map[string]string)
+			for k := range pt.Fields {
+				if key := r.pattern.ReplaceAllString(k, r.Value); key != k {
+					renames[k] = key
+				}
+			}
+			for k, key := range renames {
+				pt.Fields[key] = pt.Fields[k]
+				delete(pt.Fields, k)
+			}
+			changed = len(renames) > 0
+		case RuleDropTag:
+			for k := range pt.Tags {
+				if r.pattern.MatchString(k) {
+					delete(pt.Tags, k)
+					changed = true
+				}
+			}
+		case RuleDropPoint:
+			if r.Key == "" {
+				changed = r.pattern.MatchString(pt.Name)
+			} else if v, ok := pt.Tags[r.Key]; ok {
+				changed = r.pattern.MatchString(v)
+			}
+			if changed {
+				p.stats.Inc(r.Name)
+				return false
+			}
+		case RuleAddTag:
+			if _, ok := pt.Tags[r.Key]; !ok {
+				pt.Tags[r.Key], changed = r.Value, true
+			}
+		case RuleConvertField:
+			for k, v := range pt.Fields {
+				if !r.pattern.MatchString(k) {
+					continue
+				}
+				// Values which can't be converted are left unchanged.
+				if value, err := convertFieldValue(v, r.Type); err == nil && value != v {
+					pt.Fields[k], changed = value, true
+				}
+			}
+		}
+
+		if changed {
+			p.stats.Inc(r.Name)
+		}
+	}
+	return true
+}
+
+// convertFieldValue converts a field value to the named type.
+func convertFieldValue(v interface{}, typ string) (interface{}, error) {
+	switch typ {
+	case "float":
+		switch v := v.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		case int32:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case bool:
+			if v {
+				return float64(1), nil
+			}
+			return float64(0), nil
+		case string:
+			return strconv.ParseFloat(v, 64)
+		}
+	case "integer":
+		switch v := v.(type) {
+		case float64:
+			return int64(v), nil
+		case int:
+			return int64(v), nil
+		case int32:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case bool:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		case string:
+			return strconv.ParseInt(v, 10, 64)
+		}
+	case "string":
+		switch v := v.(type) {
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case int:
+			return strconv.Itoa(v), nil
+		case int32:
+			return strconv.FormatInt(int64(v), 10), nil
+		case int64:
+			return strconv.FormatInt(v, 10), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		case string:
+			return v, nil
+		}
+	case "boolean":
+		switch v := v.(type) {
+		case float64:
+			return v != 0, nil
+		case int:
+			return v != 0, nil
+		case int32:
+			return v != 0, nil
+		case int64:
+			return v != 0, nil
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(v)
+		}
+	default:
+		return nil, fmt.Errorf("unknown field type: %q", typ)
+	}
+	return nil, fmt.Errorf("unsupported field value: %T", v)
+}
+
+// copyTags returns a copy of a tag set.
+func copyTags(tags map[string]string) map[string]string {
+	other := make(map[string]string, len(tags))
+	for k, v := range tags {
+		other[k] = v
+	}
+	return other
+}
+
+// copyFields returns a copy of a field set.
+func copyFields(fields map[string]interface{}) map[string]interface{} {
+	other := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		other[k] = v
+	}
+	return other
+}
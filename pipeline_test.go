@@ -0,0 +1,85 @@
+package influxdb_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdb/influxdb"
+)
+
+// Ensure the pipeline applies each rule action in order.
+func TestPipeline_Process(t *testing.T) {
+	p, err := influxdb.NewPipeline([]influxdb.Rule{
+		{Action: influxdb.RuleRenameMeasurement, Pattern: `^servers\.`, Value: ""},
+		{Name: "fix_host", Action: influxdb.RuleRenameTag, Pattern: `^hostname$`, Value: "host"},
+		{Action: influxdb.RuleRenameField, Measurement: `^cpu$`, Pattern: `^val$`, Value: "value"},
+		{Action: influxdb.RuleDropTag, Pattern: `^request_id$`},
+		{Action: influxdb.RuleDropPoint, Pattern: `^debug_`},
+		{Action: influxdb.RuleDropPoint, Key: "env", Pattern: `^test$`},
+		{Action: influxdb.RuleAddTag, Key: "dc", Value: "east"},
+		{Action: influxdb.RuleConvertField, Pattern: `^count$`, Type: "integer"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(0, 0).UTC()
+	tags := map[string]string{"hostname": "server01", "request_id": "abc"}
+	points := p.Process([]influxdb.Point{
+		{Name: "servers.cpu", Tags: tags, Timestamp: now, Fields: map[string]interface{}{"val": 1.5}},
+		{Name: "mem", Tags: tags, Timestamp: now, Fields: map[string]interface{}{"val": 2.5, "count": "10"}},
+		{Name: "debug_requests", Timestamp: now, Fields: map[string]interface{}{"value": 1.0}},
+		{Name: "cpu", Tags: map[string]string{"env": "test"}, Timestamp: now, Fields: map[string]interface{}{"value": 1.0}},
+	})
+
+	exp := []influxdb.Point{
+		{Name: "cpu", Tags: map[string]string{"host": "server01", "dc": "east"}, Timestamp: now, Fields: map[string]interface{}{"value": 1.5}},
+		{Name: "mem", Tags: map[string]string{"host": "server01", "dc": "east"}, Timestamp: now, Fields: map[string]interface{}{"val": 2.5, "count": int64(10)}},
+	}
+	if !reflect.DeepEqual(points, exp) {
+		t.Fatalf("unexpected points.\n\nexp: %#v\n\ngot: %#v", exp, points)
+	}
+
+	// The original tags are shared between points and must be unchanged.
+	if !reflect.DeepEqual(tags, map[string]string{"hostname": "server01", "request_id": "abc"}) {
+		t.Fatalf("tags modified: %v", tags)
+	}
+
+	for _, tt := range []struct {
+		key string
+		n   int64
+	}{
+		{"rule1_rename-measurement", 1},
+		{"fix_host", 2},
+		{"rule3_rename-field", 1},
+		{"rule4_drop-tag", 2},
+		{"rule5_drop-point", 1},
+		{"rule6_drop-point", 1},
+		{"rule7_add-tag", 2},
+		{"rule8_convert-field", 1},
+		{"pointsDropped", 2},
+	} {
+		if n := p.Stats().Get(tt.key); n != tt.n {
+			t.Fatalf("unexpected %s.  expected %d, got %d", tt.key, tt.n, n)
+		}
+	}
+}
+
+func TestNewPipeline_Err(t *testing.T) {
+	for i, tt := range []struct {
+		rule influxdb.Rule
+		err  string
+	}{
+		{rule: influxdb.Rule{Action: "delete"}, err: `rule rule1_delete: unknown action: "delete"`},
+		{rule: influxdb.Rule{Action: influxdb.RuleDropTag}, err: `rule rule1_drop-tag: pattern required`},
+		{rule: influxdb.Rule{Name: "dc", Action: influxdb.RuleAddTag, Key: "dc"}, err: `rule dc: key and value required`},
+		{rule: influxdb.Rule{Action: influxdb.RuleConvertField, Pattern: "x", Type: "number"}, err: `rule rule1_convert-field: unknown field type: "number"`},
+		{rule: influxdb.Rule{Action: influxdb.RuleDropTag, Pattern: "("}, err: "rule rule1_drop-tag: invalid pattern: error parsing regexp: missing closing ): `(`"},
+		{rule: influxdb.Rule{Action: influxdb.RuleDropTag, Pattern: "x", Measurement: "["}, err: "rule rule1_drop-tag: invalid measurement regex: error parsing regexp: missing closing ]: `[`"},
+	} {
+		if _, err := influxdb.NewPipeline([]influxdb.Rule{tt.rule}); errstr(err) != tt.err {
+			t.Fatalf("%d. unexpected error.  expected %s, got %v", i, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package influxdb
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParsePointsString is identical to ParsePoints but accepts a string buffer.
+func ParsePointsString(buf string) ([]Point, error) {
+	return ParsePoints([]byte(buf))
+}
+
+// ParsePoints parses a buffer of points written in the line protocol, one
+// point per line. Timestamps are interpreted as nanoseconds and points without
+// a timestamp are assigned the current time.
+func ParsePoints(buf []byte) ([]Point, error) {
+	return ParsePointsWithPrecision(buf, time.Now().UTC(), "n")
+}
+
+// ParsePointsWithPrecision parses a buffer of points written in the line
+// protocol. Each line has the form:
+//
+//	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+//
+// Commas, spaces and equal signs in measurement names, tag keys, tag values
+// and field keys can be escaped with a backslash. String field values are
+// double quoted, booleans are written as t, true, f or false, integers carry
+// an "i" suffix and all other numbers are floats.
+//
+// Timestamps are interpreted using precision ("n", "u", "ms", "s", "m" or "h")
+// and points without a timestamp are assigned defaultTime. Empty lines and
+// lines starting with '#' are ignored.
+func ParsePointsWithPrecision(buf []byte, defaultTime time.Time, precision string) ([]Point, error) {
+	var points []Point
+	for _, line := range bytes.Split(buf, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		p, err := parsePoint(string(line), defaultTime, precision)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse '%s': %s", line, err)
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// parsePoint parses a single line protocol entry into a point.
+func parsePoint(line string, defaultTime time.Time, precision string) (Point, error) {
+	sections := splitEscaped(line, ' ', true)
+	if len(sections) < 2 {
+		return Point{}, fmt.Errorf("missing fields")
+	} else if len(sections) > 3 {
+		return Point{}, fmt.Errorf("invalid field format")
+	}
+
+	// Parse the measurement name and tags.
+	keys := splitEscaped(sections[0], ',', false)
+	name := unescape(keys[0])
+	if name == "" {
+		return Point{}, ErrMeasurementNameRequired
+	}
+
+	tags := make(map[string]string)
+	for _, s := range keys[1:] {
+		kv := splitEscaped(s, '=', false)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return Point{}, fmt.Errorf("invalid tag format: %s", s)
+		}
+		tags[unescape(kv[0])] = unescape(kv[1])
+	}
+
+	// Parse the fields.
+	fields := make(map[string]interface{})
+	for _, s := range splitEscaped(sections[1], ',', true) {
+		kv := splitEscaped(s, '=', true)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return Point{}, fmt.Errorf("invalid field format: %s", s)
+		}
+
+		v, err := parseFieldValue(kv[1])
+		if err != nil {
+			return Point{}, fmt.Errorf("invalid value for field %s: %s", kv[0], err)
+		}
+		fields[unescape(kv[0])] = v
+	}
+
+	// Parse the timestamp, if one was given.
+	timestamp := defaultTime
+	if len(sections) == 3 {
+		ts, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return Point{}, fmt.Errorf("invalid timestamp: %s", sections[2])
+		}
+
+		timestamp, err = timeFromPrecision(ts, precision)
+		if err != nil {
+			return Point{}, err
+		}
+	}
+
+	return Point{
+		Name:      name,
+		Tags:      tags,
+		Timestamp: timestamp,
+		Fields:    fields,
+	}, nil
+}
+
+// parseFieldValue converts the text representation of a field value into a
+// string, boolean, integer or float value.
+func parseFieldValue(s string) (interface{}, error) {
+	// Strings are double quoted.
+	if s[0] == '"' {
+		if len(s) < 2 || s[len(s)-1] != '"' {
+			return nil, fmt.Errorf("unterminated string: %s", s)
+		}
+		return strings.Replace(s[1:len(s)-1], `\"`, `"`, -1), nil
+	}
+
+	switch s {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+
+	// Integers carry a trailing "i".
+	if strings.HasSuffix(s, "i") {
+		return strconv.ParseInt(s[:len(s)-1], 10, 64)
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+// timeFromPrecision converts an integer timestamp in the given precision to a time.
+func timeFromPrecision(ts int64, precision string) (time.Time, error) {
+	switch precision {
+	case "", "n":
+		return time.Unix(0, ts).UTC(), nil
+	case "u":
+		return time.Unix(0, ts*int64(time.Microsecond)).UTC(), nil
+	case "ms":
+		return time.Unix(0, ts*int64(time.Millisecond)).UTC(), nil
+	case "s":
+		return time.Unix(ts, 0).UTC(), nil
+	case "m":
+		return time.Unix(ts*60, 0).UTC(), nil
+	case "h":
+		return time.Unix(ts*3600, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown precision: %s", precision)
+}
+
+// splitEscaped splits s around each instance of sep which is not preceded by a
+// backslash. If quotes is true, separators inside double quotes are ignored.
+// Escape sequences are preserved in the returned parts.
+func splitEscaped(s string, sep byte, quotes bool) []string {
+	var a []string
+	var quoted bool
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '"' && quotes:
+			quoted = !quoted
+		case c == sep && !quoted:
+			// Collapse runs of spaces between sections.
+			if sep == ' ' && i == start {
+				start = i + 1
+				continue
+			}
+			a = append(a, s[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(s) || sep != ' ' {
+		a = append(a, s[start:])
+	}
+	return a
+}
+
+// unescape removes the backslashes from escaped commas, spaces, equal signs,
+// double quotes and backslashes.
+func unescape(s string) string {
+	if strings.IndexByte(s, '\\') == -1 {
+		return s
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case ',', ' ', '=', '"', '\\':
+				i++
+			}
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
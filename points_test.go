@@ -0,0 +1,113 @@
+package influxdb_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdb/influxdb"
+)
+
+// Ensure that points in the line protocol can be parsed.
+func TestParsePoints(t *testing.T) {
+	var tests = []struct {
+		line   string
+		points []influxdb.Point
+		err    string
+	}{
+		{
+			line: `cpu value=1.5 1000000000`,
+			points: []influxdb.Point{{
+				Name:      "cpu",
+				Tags:      map[string]string{},
+				Timestamp: time.Unix(1, 0).UTC(),
+				Fields:    map[string]interface{}{"value": 1.5},
+			}},
+		},
+		{
+			line: `cpu,host=serverA,region=us-west value=1,count=10i,ok=t,msg="hello, world" 1000000000`,
+			points: []influxdb.Point{{
+				Name:      "cpu",
+				Tags:      map[string]string{"host": "serverA", "region": "us-west"},
+				Timestamp: time.Unix(1, 0).UTC(),
+				Fields:    map[string]interface{}{"value": float64(1), "count": int64(10), "ok": true, "msg": "hello, world"},
+			}},
+		},
+		{
+			line: `cpu\ load,host\=name=server\,A value=-2.5e3,up=false 1000000000`,
+			points: []influxdb.Point{{
+				Name:      "cpu load",
+				Tags:      map[string]string{"host=name": "server,A"},
+				Timestamp: time.Unix(1, 0).UTC(),
+				Fields:    map[string]interface{}{"value": -2500.0, "up": false},
+			}},
+		},
+		{
+			line: `log msg="say \"hi\" = ok" 1000000000`,
+			points: []influxdb.Point{{
+				Name:      "log",
+				Tags:      map[string]string{},
+				Timestamp: time.Unix(1, 0).UTC(),
+				Fields:    map[string]interface{}{"msg": `say "hi" = ok`},
+			}},
+		},
+		{
+			line: "# comment\n\ncpu value=1 1000000000\nmem value=2 2000000000\n",
+			points: []influxdb.Point{
+				{Name: "cpu", Tags: map[string]string{}, Timestamp: time.Unix(1, 0).UTC(), Fields: map[string]interface{}{"value": float64(1)}},
+				{Name: "mem", Tags: map[string]string{}, Timestamp: time.Unix(2, 0).UTC(), Fields: map[string]interface{}{"value": float64(2)}},
+			},
+		},
+		{line: `cpu`, err: `unable to parse 'cpu': missing fields`},
+		{line: `cpu,host value=1`, err: `unable to parse 'cpu,host value=1': invalid tag format: host`},
+		{line: `cpu value=`, err: `unable to parse 'cpu value=': invalid field format: value=`},
+		{line: `cpu value=abc`, err: `unable to parse 'cpu value=abc': invalid value for field value: strconv.ParseFloat: parsing "abc": invalid syntax`},
+		{line: `cpu value="abc`, err: `unable to parse 'cpu value="abc': invalid value for field value: unterminated string: "abc`},
+		{line: `cpu value=1 abc`, err: `unable to parse 'cpu value=1 abc': invalid timestamp: abc`},
+		{line: `cpu value=1 1 extra`, err: `unable to parse 'cpu value=1 1 extra': invalid field format`},
+	}
+
+	for i, tt := range tests {
+		points, err := influxdb.ParsePointsString(tt.line)
+		if errstr(err) != tt.err {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s", i, tt.line, tt.err, errstr(err))
+		} else if !reflect.DeepEqual(points, tt.points) {
+			t.Errorf("%d. %q: points mismatch:\n  exp=%#v\n  got=%#v", i, tt.line, tt.points, points)
+		}
+	}
+}
+
+// Ensure that timestamps are interpreted using the given precision.
+func TestParsePointsWithPrecision(t *testing.T) {
+	now := time.Unix(100, 0).UTC()
+	var tests = []struct {
+		line      string
+		precision string
+		timestamp time.Time
+		err       string
+	}{
+		{line: `cpu value=1`, precision: "s", timestamp: now},
+		{line: `cpu value=1 1`, precision: "n", timestamp: time.Unix(0, 1).UTC()},
+		{line: `cpu value=1 1`, precision: "u", timestamp: time.Unix(0, 1000).UTC()},
+		{line: `cpu value=1 1`, precision: "ms", timestamp: time.Unix(0, 1000000).UTC()},
+		{line: `cpu value=1 1`, precision: "s", timestamp: time.Unix(1, 0).UTC()},
+		{line: `cpu value=1 1`, precision: "m", timestamp: time.Unix(60, 0).UTC()},
+		{line: `cpu value=1 1`, precision: "h", timestamp: time.Unix(3600, 0).UTC()},
+		{line: `cpu value=1 1`, precision: "d", err: `unknown precision: d`},
+	}
+
+	for i, tt := range tests {
+		points, err := influxdb.ParsePointsWithPrecision([]byte(tt.line), now, tt.precision)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%d. %s: error mismatch: exp=%s, got=%v", i, tt.precision, tt.err, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%d. %s: unexpected error: %s", i, tt.precision, err)
+		} else if !points[0].Timestamp.Equal(tt.timestamp) {
+			t.Errorf("%d. %s: timestamp mismatch: exp=%s, got=%s", i, tt.precision, tt.timestamp, points[0].Timestamp)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package prometheus
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdb/influxdb"
+)
+
+// Metric types declared by "# TYPE" lines.
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+	typeSummary   = "summary"
+	typeUntyped   = "untyped"
+)
+
+// sample is a single sample line of the exposition format.
+type sample struct {
+	name      string
+	labels    map[string]string
+	value     float64
+	timestamp int64 // milliseconds, zero if not set
+}
+
+// Parse parses metrics in the Prometheus text exposition format into points.
+// Each metric family is written to a measurement of the same name with its
+// labels as tags. Counters, gauges and untyped metrics have a single "value"
+// field. Histograms and summaries have one point per label set with "count"
+// and "sum" fields and a field per bucket upper bound or quantile.
+//
+// Samples without a timestamp are assigned now. Samples with values which
+// are not finite are skipped, since they cannot be stored.
+func Parse(r io.Reader, now time.Time) ([]influxdb.Point, error) {
+	points, _, err := parse(r, now)
+	return points, err
+}
+
+// parse parses metrics into points and also returns the number of samples.
+func parse(r io.Reader, now time.Time) ([]influxdb.Point, int, error) {
+	types := make(map[string]string)
+	var samples []sample
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if line[0] == '#' {
+			// Only TYPE comments are significant.
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		s, err := parseSample(line)
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: %s", n, err)
+		}
+		samples = append(samples, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return toPoints(samples, types, now), len(samples), nil
+}
+
+// toPoints groups samples into points by metric family and label set.
+func toPoints(samples []sample, types map[string]string, now time.Time) []influxdb.Point {
+	var (
+		points []influxdb.Point
+		index  = make(map[string]int) // point index by family and label set
+	)
+
+	for _, s := range samples {
+		if math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+			continue
+		}
+
+		name, field := family(s.name, types)
+		tags := s.labels
+
+		// Bucket bounds and quantiles become field names rather than tags.
+		switch types[name] {
+		case typeHistogram:
+			if field == "bucket" {
+				field, tags = s.labels["le"], without(s.labels, "le")
+			}
+		case typeSummary:
+			if field == "value" {
+				field, tags = s.labels["quantile"], without(s.labels, "quantile")
+			}
+		}
+		if field == "" {
+			continue
+		}
+
+		timestamp := now
+		if s.timestamp != 0 {
+			timestamp = time.Unix(0, s.timestamp*int64(time.Millisecond)).UTC()
+		}
+
+		// Add the field to an existing point for the same series and time.
+		key := seriesKey(name, tags) + " " + strconv.FormatInt(timestamp.UnixNano(), 10)
+		if i, ok := index[key]; ok {
+			points[i].Fields[field] = s.value
+			continue
+		}
+
+		index[key] = len(points)
+		points = append(points, influxdb.Point{
+			Name:      name,
+			Tags:      tags,
+			Timestamp: timestamp,
+			Fields:    map[string]interface{}{field: s.value},
+		})
+	}
+	return points
+}
+
+// family returns the metric family a sample belongs to and the field name
+// of the sample. Histogram and summary samples use the _bucket, _sum and
+// _count suffixes.
+func family(name string, types map[string]string) (string, string) {
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+
+		base := strings.TrimSuffix(name, suffix)
+		switch types[base] {
+		case typeHistogram:
+			return base, suffix[1:]
+		case typeSummary:
+			if suffix != "_bucket" {
+				return base, suffix[1:]
+			}
+		}
+	}
+	return name, "value"
+}
+
+// parseSample parses a line of the form name[{label="value",...}] value [timestamp].
+func parseSample(line string) (sample, error) {
+	s := sample{labels: make(map[string]string)}
+
+	// Read the metric name.
+	i := strings.IndexAny(line, "{ \t")
+	if i <= 0 {
+		return sample{}, fmt.Errorf("invalid sample: %s", line)
+	}
+	s.name, line = line[:i], line[i:]
+
+	// Read the labels.
+	if line[0] == '{' {
+		var err error
+		if line, err = parseLabels(line[1:], s.labels); err != nil {
+			return sample{}, err
+		}
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 1 || len(fields) > 2 {
+		return sample{}, fmt.Errorf("invalid sample: %s", s.name)
+	}
+
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample{}, fmt.Errorf("invalid value for %s: %s", s.name, fields[0])
+	}
+	s.value = v
+
+	if len(fields) == 2 {
+		ts, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return sample{}, fmt.Errorf("invalid timestamp for %s: %s", s.name, fields[1])
+		}
+		s.timestamp = ts
+	}
+	return s, nil
+}
+
+// parseLabels parses label pairs up to the closing brace into labels and
+// returns the remainder of the line.
+func parseLabels(line string, labels map[string]string) (string, error) {
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if strings.HasPrefix(line, "}") {
+			return line[1:], nil
+		}
+
+		// Read the label name.
+		i := strings.Index(line, "=")
+		if i <= 0 {
+			return "", fmt.Errorf("invalid label: %s", line)
+		}
+		name := strings.TrimSpace(line[:i])
+		line = strings.TrimLeft(line[i+1:], " \t")
+
+		// Read the quoted label value.
+		if !strings.HasPrefix(line, `"`) {
+			return "", fmt.Errorf("invalid value for label %s", name)
+		}
+		var buf bytes.Buffer
+		j := 1
+		for ; j < len(line) && line[j] != '"'; j++ {
+			if line[j] == '\\' && j+1 < len(line) {
+				j++
+				switch line[j] {
+				case 'n':
+					buf.WriteByte('\n')
+				default:
+					buf.WriteByte(line[j])
+				}
+				continue
+			}
+			buf.WriteByte(line[j])
+		}
+		if j >= len(line) {
+			return "", fmt.Errorf("unterminated value for label %s", name)
+		}
+		labels[name] = buf.String()
+		line = strings.TrimLeft(line[j+1:], " \t")
+
+		if strings.HasPrefix(line, ",") {
+			line = line[1:]
+		} else if !strings.HasPrefix(line, "}") {
+			return "", fmt.Errorf("invalid label: %s", line)
+		}
+	}
+}
+
+// without returns a copy of labels without the given label.
+func without(labels map[string]string, name string) map[string]string {
+	other := make(map[string]string, len(labels))
+	for k, v := range labels {
+		if k != name {
+			other[k] = v
+		}
+	}
+	return other
+}
+
+// seriesKey returns a key which is unique for a measurement and tag set.
+func seriesKey(name string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	key := name
+	for _, k := range keys {
+		key += "," + k + "=" + tags[k]
+	}
+	return key
+}
@@ -0,0 +1,112 @@
+package prometheus_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdb/influxdb"
+	"github.com/influxdb/influxdb/prometheus"
+	"github.com/influxdb/influxdb/test"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Unix(1420000000, 0).UTC()
+	var tests = []struct {
+		text   string
+		points []influxdb.Point
+		err    string
+	}{
+		{
+			text: "# HELP http_requests_total Total requests.\n" +
+				"# TYPE http_requests_total counter\n" +
+				`http_requests_total{method="post",code="200"} 1027 1395066363000` + "\n" +
+				`http_requests_total{method="post",code="400"} 3` + "\n",
+			points: []influxdb.Point{
+				{
+					Name:      "http_requests_total",
+					Tags:      map[string]string{"method": "post", "code": "200"},
+					Timestamp: time.Unix(1395066363, 0).UTC(),
+					Fields:    map[string]interface{}{"value": float64(1027)},
+				},
+				{
+					Name:      "http_requests_total",
+					Tags:      map[string]string{"method": "post", "code": "400"},
+					Timestamp: now,
+					Fields:    map[string]interface{}{"value": float64(3)},
+				},
+			},
+		},
+		{
+			text: "# TYPE temperature gauge\n" +
+				`temperature{room="a \"b\"\\c\nd"} -3.5` + "\n" +
+				"uptime 42\n" +
+				"nan_gauge NaN\n" +
+				"inf_gauge +Inf\n",
+			points: []influxdb.Point{
+				{
+					Name:      "temperature",
+					Tags:      map[string]string{"room": "a \"b\"\\c\nd"},
+					Timestamp: now,
+					Fields:    map[string]interface{}{"value": float64(-3.5)},
+				},
+				{
+					Name:      "uptime",
+					Tags:      map[string]string{},
+					Timestamp: now,
+					Fields:    map[string]interface{}{"value": float64(42)},
+				},
+			},
+		},
+		{
+			text: "# TYPE request_duration_seconds histogram\n" +
+				`request_duration_seconds_bucket{path="/",le="0.1"} 5` + "\n" +
+				`request_duration_seconds_bucket{path="/",le="+Inf"} 8` + "\n" +
+				`request_duration_seconds_sum{path="/"} 1.25` + "\n" +
+				`request_duration_seconds_count{path="/"} 8` + "\n",
+			points: []influxdb.Point{
+				{
+					Name:      "request_duration_seconds",
+					Tags:      map[string]string{"path": "/"},
+					Timestamp: now,
+					Fields: map[string]interface{}{
+						"0.1": float64(5), "+Inf": float64(8), "sum": float64(1.25), "count": float64(8),
+					},
+				},
+			},
+		},
+		{
+			text: "# TYPE rpc_duration_seconds summary\n" +
+				`rpc_duration_seconds{quantile="0.5"} 0.02` + "\n" +
+				`rpc_duration_seconds{quantile="0.99"} 0.3` + "\n" +
+				"rpc_duration_seconds_sum 17\n" +
+				"rpc_duration_seconds_count 100\n",
+			points: []influxdb.Point{
+				{
+					Name:      "rpc_duration_seconds",
+					Tags:      map[string]string{},
+					Timestamp: now,
+					Fields: map[string]interface{}{
+						"0.5": float64(0.02), "0.99": float64(0.3), "sum": float64(17), "count": float64(100),
+					},
+				},
+			},
+		},
+		{text: "{a=\"b\"} 1\n", err: `line 1: invalid sample: {a="b"} 1`},
+		{text: "cpu\n", err: `line 1: invalid sample: cpu`},
+		{text: "cpu abc\n", err: `line 1: invalid value for cpu: abc`},
+		{text: "cpu 1 abc\n", err: `line 1: invalid timestamp for cpu: abc`},
+		{text: "\ncpu{host=web01} 1\n", err: `line 2: invalid value for label host`},
+		{text: "cpu{host=\"web01} 1\n", err: `line 1: unterminated value for label host`},
+	}
+
+	for i, tt := range tests {
+		points, err := prometheus.Parse(strings.NewReader(tt.text), now)
+		if test.Errstr(err) != tt.err {
+			t.Fatalf("%d. err does not match.  expected %v, got %v", i, tt.err, err)
+		} else if err == nil && !reflect.DeepEqual(points, tt.points) {
+			t.Fatalf("%d. points mismatch.\n\nexp: %#v\n\ngot: %#v", i, tt.points, points)
+		}
+	}
+}
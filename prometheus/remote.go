@@ -0,0 +1,408 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The messages below implement the protocol buffer encoding of the
+// Prometheus remote storage protocol:
+//
+//	message Sample       { double value = 1; int64 timestamp_ms = 2; }
+//	message Label        { string name = 1; string value = 2; }
+//	message TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//
+//	message LabelMatcher { Type type = 1; string name = 2; string value = 3; }
+//	message Query        { int64 start_timestamp_ms = 1; int64 end_timestamp_ms = 2; repeated LabelMatcher matchers = 3; }
+//	message QueryResult  { repeated TimeSeries timeseries = 1; }
+//	message ReadRequest  { repeated Query queries = 1; }
+//	message ReadResponse { repeated QueryResult results = 1; }
+//
+// Remote storage requests and responses are sent snappy compressed.
+
+// MetricNameLabel is the label holding the name of a metric.
+const MetricNameLabel = "__name__"
+
+// MatchType is the type of comparison performed by a LabelMatcher.
+type MatchType int32
+
+const (
+	MatchEqual MatchType = iota
+	MatchNotEqual
+	MatchRegexp
+	MatchNotRegexp
+)
+
+// String returns the operator of the match type.
+func (t MatchType) String() string {
+	switch t {
+	case MatchEqual:
+		return "="
+	case MatchNotEqual:
+		return "!="
+	case MatchRegexp:
+		return "=~"
+	case MatchNotRegexp:
+		return "!~"
+	}
+	return fmt.Sprintf("MatchType(%d)", int32(t))
+}
+
+// errTruncated is returned when a message ends in the middle of a field.
+var errTruncated = errors.New("unexpected end of message")
+
+// Protocol buffer wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Sample is a single value of a time series.
+type Sample struct {
+	Value       float64
+	TimestampMs int64
+}
+
+// Label is a name/value pair identifying a time series.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// TimeSeries is a set of labels and the samples recorded for them.
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// WriteRequest is the body of a remote write request.
+type WriteRequest struct {
+	Timeseries []TimeSeries
+}
+
+// LabelMatcher selects time series by the value of a label.
+type LabelMatcher struct {
+	Type  MatchType
+	Name  string
+	Value string
+}
+
+// Query selects the samples of matching time series within a time range.
+type Query struct {
+	StartTimestampMs int64
+	EndTimestampMs   int64
+	Matchers         []LabelMatcher
+}
+
+// QueryResult holds the time series returned for a single Query.
+type QueryResult struct {
+	Timeseries []TimeSeries
+}
+
+// ReadRequest is the body of a remote read request.
+type ReadRequest struct {
+	Queries []Query
+}
+
+// ReadResponse is the body of a remote read response, holding a result for
+// each query of the request in order.
+type ReadResponse struct {
+	Results []QueryResult
+}
+
+// Marshal encodes the sample.
+func (s *Sample) Marshal() []byte {
+	var b []byte
+	b = appendKey(b, 1, wireFixed64)
+	b = appendFixed64(b, math.Float64bits(s.Value))
+	b = appendVarintField(b, 2, uint64(s.TimestampMs))
+	return b
+}
+
+// Unmarshal decodes the sample from buf.
+func (s *Sample) Unmarshal(buf []byte) error {
+	return walkFields(buf, func(num, typ int, v uint64, _ []byte) error {
+		switch {
+		case num == 1 && typ == wireFixed64:
+			s.Value = math.Float64frombits(v)
+		case num == 2 && typ == wireVarint:
+			s.TimestampMs = int64(v)
+		}
+		return nil
+	})
+}
+
+// Marshal encodes the label.
+func (l *Label) Marshal() []byte {
+	var b []byte
+	b = appendBytesField(b, 1, []byte(l.Name))
+	b = appendBytesField(b, 2, []byte(l.Value))
+	return b
+}
+
+// Unmarshal decodes the label from buf.
+func (l *Label) Unmarshal(buf []byte) error {
+	return walkFields(buf, func(num, typ int, _ uint64, data []byte) error {
+		switch {
+		case num == 1 && typ == wireBytes:
+			l.Name = string(data)
+		case num == 2 && typ == wireBytes:
+			l.Value = string(data)
+		}
+		return nil
+	})
+}
+
+// Marshal encodes the time series.
+func (ts *TimeSeries) Marshal() []byte {
+	var b []byte
+	for i := range ts.Labels {
+		b = appendBytesField(b, 1, ts.Labels[i].Marshal())
+	}
+	for i := range ts.Samples {
+		b = appendBytesField(b, 2, ts.Samples[i].Marshal())
+	}
+	return b
+}
+
+// Unmarshal decodes the time series from buf.
+func (ts *TimeSeries) Unmarshal(buf []byte) error {
+	return walkFields(buf, func(num, typ int, _ uint64, data []byte) error {
+		switch {
+		case num == 1 && typ == wireBytes:
+			var l Label
+			if err := l.Unmarshal(data); err != nil {
+				return err
+			}
+			ts.Labels = append(ts.Labels, l)
+		case num == 2 && typ == wireBytes:
+			var s Sample
+			if err := s.Unmarshal(data); err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, s)
+		}
+		return nil
+	})
+}
+
+// Marshal encodes the write request.
+func (r *WriteRequest) Marshal() []byte {
+	return marshalTimeSeries(r.Timeseries)
+}
+
+// Unmarshal decodes the write request from buf.
+func (r *WriteRequest) Unmarshal(buf []byte) error {
+	return unmarshalTimeSeries(buf, &r.Timeseries)
+}
+
+// Marshal encodes the label matcher.
+func (m *LabelMatcher) Marshal() []byte {
+	var b []byte
+	b = appendVarintField(b, 1, uint64(m.Type))
+	b = appendBytesField(b, 2, []byte(m.Name))
+	b = appendBytesField(b, 3, []byte(m.Value))
+	return b
+}
+
+// Unmarshal decodes the label matcher from buf.
+func (m *LabelMatcher) Unmarshal(buf []byte) error {
+	return walkFields(buf, func(num, typ int, v uint64, data []byte) error {
+		switch {
+		case num == 1 && typ == wireVarint:
+			m.Type = MatchType(v)
+		case num == 2 && typ == wireBytes:
+			m.Name = string(data)
+		case num == 3 && typ == wireBytes:
+			m.Value = string(data)
+		}
+		return nil
+	})
+}
+
+// Marshal encodes the query.
+func (q *Query) Marshal() []byte {
+	var b []byte
+	b = appendVarintField(b, 1, uint64(q.StartTimestampMs))
+	b = appendVarintField(b, 2, uint64(q.EndTimestampMs))
+	for i := range q.Matchers {
+		b = appendBytesField(b, 3, q.Matchers[i].Marshal())
+	}
+	return b
+}
+
+// Unmarshal decodes the query from buf.
+func (q *Query) Unmarshal(buf []byte) error {
+	return walkFields(buf, func(num, typ int, v uint64, data []byte) error {
+		switch {
+		case num == 1 && typ == wireVarint:
+			q.StartTimestampMs = int64(v)
+		case num == 2 && typ == wireVarint:
+			q.EndTimestampMs = int64(v)
+		case num == 3 && typ == wireBytes:
+			var m LabelMatcher
+			if err := m.Unmarshal(data); err != nil {
+				return err
+			}
+			q.Matchers = append(q.Matchers, m)
+		}
+		return nil
+	})
+}
+
+// Marshal encodes the query result.
+func (r *QueryResult) Marshal() []byte {
+	return marshalTimeSeries(r.Timeseries)
+}
+
+// Unmarshal decodes the query result from buf.
+func (r *QueryResult) Unmarshal(buf []byte) error {
+	return unmarshalTimeSeries(buf, &r.Timeseries)
+}
+
+// Marshal encodes the read request.
+func (r *ReadRequest) Marshal() []byte {
+	var b []byte
+	for i := range r.Queries {
+		b = appendBytesField(b, 1, r.Queries[i].Marshal())
+	}
+	return b
+}
+
+// Unmarshal decodes the read request from buf.
+func (r *ReadRequest) Unmarshal(buf []byte) error {
+	return walkFields(buf, func(num, typ int, _ uint64, data []byte) error {
+		if num == 1 && typ == wireBytes {
+			var q Query
+			if err := q.Unmarshal(data); err != nil {
+				return err
+			}
+			r.Queries = append(r.Queries, q)
+		}
+		return nil
+	})
+}
+
+// Marshal encodes the read response.
+func (r *ReadResponse) Marshal() []byte {
+	var b []byte
+	for i := range r.Results {
+		b = appendBytesField(b, 1, r.Results[i].Marshal())
+	}
+	return b
+}
+
+// Unmarshal decodes the read response from buf.
+func (r *ReadResponse) Unmarshal(buf []byte) error {
+	return walkFields(buf, func(num, typ int, _ uint64, data []byte) error {
+		if num == 1 && typ == wireBytes {
+			var qr QueryResult
+			if err := qr.Unmarshal(data); err != nil {
+				return err
+			}
+			r.Results = append(r.Results, qr)
+		}
+		return nil
+	})
+}
+
+// marshalTimeSeries encodes a list of time series as field 1.
+func marshalTimeSeries(a []TimeSeries) []byte {
+	var b []byte
+	for i := range a {
+		b = appendBytesField(b, 1, a[i].Marshal())
+	}
+	return b
+}
+
+// unmarshalTimeSeries decodes the time series in field 1 of buf.
+func unmarshalTimeSeries(buf []byte, a *[]TimeSeries) error {
+	return walkFields(buf, func(num, typ int, _ uint64, data []byte) error {
+		if num == 1 && typ == wireBytes {
+			var ts TimeSeries
+			if err := ts.Unmarshal(data); err != nil {
+				return err
+			}
+			*a = append(*a, ts)
+		}
+		return nil
+	})
+}
+
+// walkFields calls fn for each field in buf. Varint and fixed width values
+// are passed as v and length-delimited values as data.
+func walkFields(buf []byte, fn func(num, typ int, v uint64, data []byte) error) error {
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return errTruncated
+		}
+		buf = buf[n:]
+
+		num, typ := int(key>>3), int(key&7)
+		var v uint64
+		var data []byte
+		switch typ {
+		case wireVarint:
+			if v, n = binary.Uvarint(buf); n <= 0 {
+				return errTruncated
+			}
+			buf = buf[n:]
+		case wireFixed64:
+			if len(buf) < 8 {
+				return errTruncated
+			}
+			v, buf = binary.LittleEndian.Uint64(buf), buf[8:]
+		case wireFixed32:
+			if len(buf) < 4 {
+				return errTruncated
+			}
+			v, buf = uint64(binary.LittleEndian.Uint32(buf)), buf[4:]
+		case wireBytes:
+			l, n := binary.Uvarint(buf)
+			if n <= 0 || uint64(len(buf)-n) < l {
+				return errTruncated
+			}
+			data, buf = buf[n:n+int(l)], buf[n+int(l):]
+		default:
+			return fmt.Errorf("unsupported wire type %d for field %d", typ, num)
+		}
+
+		if err := fn(num, typ, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendKey(b []byte, num, typ int) []byte {
+	return appendVarint(b, uint64(num)<<3|uint64(typ))
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendFixed64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendVarintField(b []byte, num int, v uint64) []byte {
+	b = appendKey(b, num, wireVarint)
+	return appendVarint(b, v)
+}
+
+func appendBytesField(b []byte, num int, data []byte) []byte {
+	b = appendKey(b, num, wireBytes)
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
@@ -0,0 +1,58 @@
+package prometheus_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/influxdb/influxdb/prometheus"
+	"github.com/influxdb/influxdb/test"
+)
+
+// Ensure remote storage messages survive encoding and decoding.
+func TestReadRequest_Marshal(t *testing.T) {
+	req := &prometheus.ReadRequest{Queries: []prometheus.Query{
+		{
+			StartTimestampMs: -1000,
+			EndTimestampMs:   1420070400000,
+			Matchers: []prometheus.LabelMatcher{
+				{Type: prometheus.MatchEqual, Name: "__name__", Value: "up"},
+				{Type: prometheus.MatchNotRegexp, Name: "job", Value: "node|api"},
+			},
+		},
+		{EndTimestampMs: 1},
+	}}
+
+	var other prometheus.ReadRequest
+	if err := other.Unmarshal(req.Marshal()); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(req, &other) {
+		t.Fatalf("mismatch.\n\nexp: %#v\n\ngot: %#v", req, &other)
+	}
+}
+
+func TestReadResponse_Marshal(t *testing.T) {
+	resp := &prometheus.ReadResponse{Results: []prometheus.QueryResult{{Timeseries: []prometheus.TimeSeries{{
+		Labels:  []prometheus.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}},
+		Samples: []prometheus.Sample{{Value: 1, TimestampMs: 1420070400000}, {Value: math.MaxFloat64, TimestampMs: 1420070410000}},
+	}}}}}
+
+	var other prometheus.ReadResponse
+	if err := other.Unmarshal(resp.Marshal()); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(resp, &other) {
+		t.Fatalf("mismatch.\n\nexp: %#v\n\ngot: %#v", resp, &other)
+	}
+}
+
+func TestWriteRequest_Unmarshal_Truncated(t *testing.T) {
+	req := &prometheus.WriteRequest{Timeseries: []prometheus.TimeSeries{{
+		Labels: []prometheus.Label{{Name: "__name__", Value: "up"}},
+	}}}
+	buf := req.Marshal()
+
+	var other prometheus.WriteRequest
+	if err := other.Unmarshal(buf[:len(buf)-1]); test.Errstr(err) != "unexpected end of message" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
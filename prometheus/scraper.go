@@ -0,0 +1,213 @@
+package prometheus
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/influxdb/influxdb"
+)
+
+const (
+	// DefaultInterval is the default time between scrapes of each target.
+	DefaultInterval = 10 * time.Second
+
+	// DefaultTimeout is the default time allowed for a single scrape.
+	DefaultTimeout = 5 * time.Second
+
+	// HealthMeasurement is the measurement scrape results are written to.
+	HealthMeasurement = "prometheus_scrape"
+
+	// acceptHeader requests the text exposition format.
+	acceptHeader = "text/plain;version=0.0.4;q=1,*/*;q=0.1"
+)
+
+var (
+	// ErrTargetsRequired is returned when opening a Scraper without targets.
+	ErrTargetsRequired = errors.New("at least one target required")
+
+	// ErrDatabaseRequired is returned when opening a Scraper without a target database.
+	ErrDatabaseRequired = errors.New("database was not specified in config")
+
+	// ErrScraperOpen is returned when opening an already open Scraper.
+	ErrScraperOpen = errors.New("scraper already open")
+
+	// ErrScraperClosed is returned when closing an already closed Scraper.
+	ErrScraperClosed = errors.New("scraper already closed")
+)
+
+// SeriesWriter defines the interface for the destination of the data.
+type SeriesWriter interface {
+	WriteSeries(database, retentionPolicy string, points []influxdb.Point) (uint64, error)
+}
+
+// Scraper periodically fetches metrics in the Prometheus text exposition
+// format from a list of targets and writes them to a database. Every point
+// is tagged with the URL of its target as "instance". An "instance" label
+// exported by the target is kept as "exported_instance", as Prometheus does.
+//
+// The result of each scrape is written to HealthMeasurement, with an "up"
+// field which is false if the scrape failed, the scrape duration in seconds
+// and the number of samples scraped.
+type Scraper struct {
+	writer SeriesWriter
+	stats  *influxdb.Stats
+
+	wg      sync.WaitGroup
+	closing chan struct{}
+
+	// Targets are the URLs scraped, such as "http://localhost:9100/metrics".
+	Targets []string
+
+	Database        string
+	RetentionPolicy string
+
+	// Interval is the time between scrapes of each target.
+	Interval time.Duration
+
+	// Timeout is the time allowed for a single scrape.
+	Timeout time.Duration
+
+	client *http.Client
+	Logger *log.Logger
+}
+
+// NewScraper returns a new instance of a Scraper.
+func NewScraper(w SeriesWriter) *Scraper {
+	return &Scraper{
+		writer:   w,
+		stats:    influxdb.NewStats("prometheus"),
+		Interval: DefaultInterval,
+		Timeout:  DefaultTimeout,
+		client:   &http.Client{},
+		Logger:   log.New(os.Stderr, "[prometheus] ", log.LstdFlags),
+	}
+}
+
+// Stats returns the counters for scrapes, scrape failures and points written.
+func (s *Scraper) Stats() *influxdb.Stats {
+	return s.stats
+}
+
+// Open validates the targets and starts scraping each of them.
+func (s *Scraper) Open() error {
+	if s.closing != nil {
+		return ErrScraperOpen
+	} else if len(s.Targets) == 0 {
+		return ErrTargetsRequired
+	} else if s.Database == "" {
+		return ErrDatabaseRequired
+	}
+
+	for _, target := range s.Targets {
+		if u, err := url.Parse(target); err != nil {
+			return fmt.Errorf("invalid target %q: %s", target, err)
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid target %q: scheme must be http or https", target)
+		}
+	}
+
+	s.client.Timeout = s.Timeout
+	s.closing = make(chan struct{})
+	for _, target := range s.Targets {
+		s.wg.Add(1)
+		go s.scrapeLoop(target)
+	}
+	return nil
+}
+
+// Close stops scraping and waits for in-progress scrapes to finish.
+func (s *Scraper) Close() error {
+	if s.closing == nil {
+		return ErrScraperClosed
+	}
+	close(s.closing)
+	s.wg.Wait()
+	s.closing = nil
+	return nil
+}
+
+// scrapeLoop scrapes a target immediately and then at every interval.
+func (s *Scraper) scrapeLoop(target string) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		s.Scrape(target)
+
+		select {
+		case <-ticker.C:
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+// Scrape fetches the metrics of a single target and writes them along with
+// the scrape health.
+func (s *Scraper) Scrape(target string) {
+	start := time.Now()
+	points, samples, err := s.fetch(target, start.UTC())
+	duration := time.Since(start)
+
+	s.stats.Inc("scrapes")
+	if err != nil {
+		s.stats.Inc("scrapesFail")
+		s.Logger.Printf("failed to scrape %s: %s", target, err)
+	}
+
+	// Tag every point with the target, keeping any exported instance label.
+	for i := range points {
+		tags := points[i].Tags
+		if v, ok := tags["instance"]; ok {
+			tags["exported_instance"] = v
+		}
+		tags["instance"] = target
+	}
+
+	points = append(points, influxdb.Point{
+		Name:      HealthMeasurement,
+		Tags:      map[string]string{"instance": target},
+		Timestamp: start.UTC(),
+		Fields: map[string]interface{}{
+			"up":       err == nil,
+			"duration": duration.Seconds(),
+			"samples":  float64(samples),
+		},
+	})
+
+	if _, err := s.writer.WriteSeries(s.Database, s.RetentionPolicy, points); err != nil {
+		s.stats.Inc("batchesTxFail")
+		s.Logger.Printf("failed to write %d points from %s: %s", len(points), target, err)
+		return
+	}
+	s.stats.Inc("batchesTx")
+	s.stats.Add("pointsTx", int64(len(points)))
+}
+
+// fetch requests the metrics of a target and parses the response. Returns the
+// points and the number of samples scraped.
+func (s *Scraper) fetch(target string, now time.Time) ([]influxdb.Point, int, error) {
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", acceptHeader)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return parse(resp.Body, now)
+}
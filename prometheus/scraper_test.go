@@ -0,0 +1,116 @@
+package prometheus_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/influxdb/influxdb/prometheus"
+	"github.com/influxdb/influxdb/test"
+)
+
+// Ensure the scraper writes the metrics of a target along with the scrape health.
+func TestScraper_Scrape(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "# TYPE jobs_total counter\njobs_total{queue=\"default\"} 12\n")
+	}))
+	defer ts.Close()
+
+	w := make(test.SeriesWriter, 1)
+	s := prometheus.NewScraper(w)
+	s.Targets = []string{ts.URL}
+	s.Database = "prometheus"
+	s.RetentionPolicy = "raw"
+	s.Interval = time.Hour
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	b := w.Wait(t)
+	if b.Database != "prometheus" || b.RetentionPolicy != "raw" {
+		t.Fatalf("unexpected destination: %s.%s", b.Database, b.RetentionPolicy)
+	} else if len(b.Points) != 2 {
+		t.Fatalf("unexpected point count.  expected %d, got %d", 2, len(b.Points))
+	}
+
+	if p := b.Points[0]; p.Name != "jobs_total" || p.Tags["queue"] != "default" || p.Tags["instance"] != ts.URL || p.Fields["value"] != float64(12) {
+		t.Fatalf("unexpected point: %v", p)
+	}
+	if p := b.Points[1]; p.Name != prometheus.HealthMeasurement || p.Tags["instance"] != ts.URL || p.Fields["up"] != true || p.Fields["samples"] != float64(1) {
+		t.Fatalf("unexpected health point: %v", p)
+	}
+}
+
+// Ensure an instance label exported by a target is kept and the health point
+// counts scraped samples rather than written points.
+func TestScraper_Scrape_ExportedInstance(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "jobs_total{instance=\"worker-1\"} 12\n")
+		fmt.Fprint(w, "# TYPE rpc_seconds summary\nrpc_seconds{quantile=\"0.5\"} 0.2\nrpc_seconds_sum 10\nrpc_seconds_count 50\n")
+	}))
+	defer ts.Close()
+
+	w := make(test.SeriesWriter, 1)
+	s := prometheus.NewScraper(w)
+	s.Database = "prometheus"
+	s.Scrape(ts.URL)
+
+	b := w.Wait(t)
+	if len(b.Points) != 3 {
+		t.Fatalf("unexpected point count.  expected %d, got %d", 3, len(b.Points))
+	}
+	if p := b.Points[0]; p.Tags["instance"] != ts.URL || p.Tags["exported_instance"] != "worker-1" {
+		t.Fatalf("unexpected tags: %v", p.Tags)
+	}
+	if _, ok := b.Points[1].Tags["exported_instance"]; ok {
+		t.Fatalf("unexpected exported_instance tag: %v", b.Points[1].Tags)
+	}
+	if p := b.Points[2]; p.Name != prometheus.HealthMeasurement || p.Fields["samples"] != float64(4) {
+		t.Fatalf("unexpected health point: %v", p)
+	}
+}
+
+// Ensure a failed scrape is recorded as down.
+func TestScraper_Scrape_Fail(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	w := make(test.SeriesWriter, 1)
+	s := prometheus.NewScraper(w)
+	s.Database = "prometheus"
+	s.Scrape(ts.URL)
+
+	b := w.Wait(t)
+	if len(b.Points) != 1 || b.Points[0].Name != prometheus.HealthMeasurement || b.Points[0].Fields["up"] != false {
+		t.Fatalf("unexpected points: %v", b.Points)
+	}
+	if n := s.Stats().Get("scrapesFail"); n != 1 {
+		t.Fatalf("unexpected scrapesFail.  expected %d, got %d", 1, n)
+	}
+}
+
+func TestScraper_Open_Err(t *testing.T) {
+	var tests = []struct {
+		targets  []string
+		database string
+		err      string
+	}{
+		{database: "db", err: prometheus.ErrTargetsRequired.Error()},
+		{targets: []string{"http://localhost:9100/metrics"}, err: prometheus.ErrDatabaseRequired.Error()},
+		{targets: []string{"localhost:9100"}, database: "db", err: `invalid target "localhost:9100": scheme must be http or https`},
+	}
+
+	for i, tt := range tests {
+		s := prometheus.NewScraper(make(test.SeriesWriter))
+		s.Targets = tt.targets
+		s.Database = tt.database
+		if err := s.Open(); test.Errstr(err) != tt.err {
+			t.Fatalf("%d. err does not match.  expected %v, got %v", i, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,504 @@
+package influxdb
+
+import (
+	"encoding/binary"
+	"log"
+	"sort"
+
+	"github.com/boltdb/bolt"
+)
+
+// The series index of each database is stored in the metastore so it doesn't
+// have to be rebuilt in memory when the server opens. Lookups only page in the
+// parts of the index they read through bolt's memory map. Within the bucket of
+// a database the index is laid out as:
+//
+//   Series/<measurement>/<id>               tags of the series
+//   SeriesKeys/<measurement>/<tags>         series id by marshaled tags
+//   Tags/<measurement>/<key>/<value>/<id>   postings list of each tag value
+//   SeriesMeasurements/<id>                 measurement name by series id
+//   SeriesCounts/<measurement>              number of series
+//   TagValueCounts/<measurement>/<key>      number of values of each tag key
+//
+// Postings lists are buckets keyed by big endian series id so they are always
+// sorted and can be updated without rewriting them. Tags, tag keys and values
+// are stored with a prefix byte since bolt doesn't allow empty keys. Counts are
+// big endian and kept up to date as series are indexed so they aren't counted
+// on each read.
+//
+// The tags of a series are encoded by marshalSeries. Series stored by earlier
+// versions are encoded as JSON.
+
+// seriesEncodingTags marks series encoded by marshalSeries. JSON encoded series
+// start with '{'.
+const seriesEncodingTags = 0
+
+// measurementIndex is a view of the series index of a measurement within a
+// metastore transaction. All lookups return nothing for measurements without
+// series.
+type measurementIndex struct {
+	bucket *bolt.Bucket // series by id
+	keys   *bolt.Bucket // series ids by marshaled tags
+	tags   *bolt.Bucket // postings lists by tag key and value
+	values *bolt.Bucket // number of values by tag key
+	n      int          // number of series
+}
+
+// measurementIndex returns the series index of a measurement.
+func (tx *metatx) measurementIndex(database, name string) *measurementIndex {
+	b := tx.Bucket([]byte("Databases")).Bucket([]byte(database))
+	if b == nil {
+		return &measurementIndex{}
+	}
+	return &measurementIndex{
+		bucket: bucketOf(b, "Series", name),
+		keys:   bucketOf(b, "SeriesKeys", name),
+		tags:   bucketOf(b, "Tags", name),
+		values: bucketOf(b, "TagValueCounts", name),
+		n:      countOf(b.Bucket([]byte("SeriesCounts")), []byte(name)),
+	}
+}
+
+// measurementIndexes reads the series index of each measurement of a database
+// at most once within a metastore transaction. Used by lookups over many points.
+type measurementIndexes struct {
+	tx       *metatx
+	database string
+	indexes  map[string]*measurementIndex
+}
+
+// newMeasurementIndexes returns the measurement indexes of a database.
+func newMeasurementIndexes(tx *metatx, database string) *measurementIndexes {
+	return &measurementIndexes{tx: tx, database: database, indexes: make(map[string]*measurementIndex)}
+}
+
+// get returns the series index of a measurement.
+func (a *measurementIndexes) get(name string) *measurementIndex {
+	mi := a.indexes[name]
+	if mi == nil {
+		mi = a.tx.measurementIndex(a.database, name)
+		a.indexes[name] = mi
+	}
+	return mi
+}
+
+// seriesN returns the number of series in a database.
+func (tx *metatx) seriesN(database string) (n int) {
+	b := bucketOf(tx.Bucket([]byte("Databases")), database, "SeriesCounts")
+	if b == nil {
+		return 0
+	}
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		n += int(btou64(v))
+	}
+	return
+}
+
+// bucketOf returns a nested bucket by path. Returns nil if any bucket on the
+// path doesn't exist.
+func bucketOf(b *bolt.Bucket, names ...string) *bolt.Bucket {
+	for _, name := range names {
+		if b == nil {
+			return nil
+		}
+		b = b.Bucket([]byte(name))
+	}
+	return b
+}
+
+// seriesIDs returns the sorted ids of the measurement's series.
+func (mi *measurementIndex) seriesIDs() seriesIDs {
+	if mi.bucket == nil {
+		return nil
+	}
+	var ids seriesIDs
+	c := mi.bucket.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		ids = append(ids, btou64(k))
+	}
+	return ids
+}
+
+// seriesN returns the number of series in the measurement.
+func (mi *measurementIndex) seriesN() int { return mi.n }
+
+// series returns a series by id. Returns nil if the series doesn't exist.
+func (mi *measurementIndex) series(id uint64) *Series {
+	if mi.bucket == nil {
+		return nil
+	}
+	v := mi.bucket.Get(u64tob(id))
+	if v == nil {
+		return nil
+	}
+	return mustUnmarshalSeries(id, v)
+}
+
+// seriesByTags returns the series with the given tags. Returns nil if the
+// series doesn't exist.
+func (mi *measurementIndex) seriesByTags(tags map[string]string) *Series {
+	if mi.keys == nil {
+		return nil
+	}
+	v := mi.keys.Get(indexKey(string(marshalTags(tags))))
+	if v == nil {
+		return nil
+	}
+	return mi.series(btou64(v))
+}
+
+// hasTagKey returns true if any series has a value for the tag key.
+func (mi *measurementIndex) hasTagKey(key string) bool {
+	return mi.tags != nil && mi.tags.Bucket(indexKey(key)) != nil
+}
+
+// tagKeys returns the sorted tag keys of the measurement.
+func (mi *measurementIndex) tagKeys() []string {
+	if mi.tags == nil {
+		return nil
+	}
+	var keys []string
+	c := mi.tags.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		keys = append(keys, string(k[1:]))
+	}
+	return keys
+}
+
+// tagValues returns the sorted values of a tag key.
+func (mi *measurementIndex) tagValues(key string) []string {
+	b := tagBucket(mi.tags, key)
+	if b == nil {
+		return nil
+	}
+	var values []string
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		values = append(values, string(k[1:]))
+	}
+	return values
+}
+
+// tagValueN returns the number of values of a tag key.
+func (mi *measurementIndex) tagValueN(key string) int {
+	return countOf(mi.values, indexKey(key))
+}
+
+// tagValueNBySeriesIDs returns the number of values of a tag key used by the
+// given series. Only the postings lists of the tag values are read.
+func (mi *measurementIndex) tagValueNBySeriesIDs(key string, ids seriesIDs) (n int) {
+	for _, v := range mi.tagValues(key) {
+		if len(mi.tagValueSeriesIDs(key, v).intersect(ids)) > 0 {
+			n++
+		}
+	}
+	return
+}
+
+// hasTagValue returns true if any series has the value for the tag key.
+func (mi *measurementIndex) hasTagValue(key, value string) bool {
+	return tagBucket(mi.tags, key, value) != nil
+}
+
+// tagValueSeriesIDs returns the sorted ids of the series with a tag value.
+func (mi *measurementIndex) tagValueSeriesIDs(key, value string) seriesIDs {
+	b := tagBucket(mi.tags, key, value)
+	if b == nil {
+		return nil
+	}
+	var ids seriesIDs
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		ids = append(ids, btou64(k))
+	}
+	return ids
+}
+
+// indexSeries adds a series to the index of a database bucket.
+func indexSeries(b *bolt.Bucket, name string, s *Series) error {
+	id := u64tob(s.ID)
+
+	counts, err := b.CreateBucketIfNotExists([]byte("SeriesCounts"))
+	if err != nil {
+		return err
+	} else if err := addCount(counts, []byte(name), 1); err != nil {
+		return err
+	}
+
+	keys, err := createBucketPath(b, "SeriesKeys", name)
+	if err != nil {
+		return err
+	} else if err := keys.Put(indexKey(string(marshalTags(s.Tags))), id); err != nil {
+		return err
+	}
+
+	tags, err := createBucketPath(b, "Tags", name)
+	if err != nil {
+		return err
+	}
+	valueCounts, err := createBucketPath(b, "TagValueCounts", name)
+	if err != nil {
+		return err
+	}
+	for k, v := range s.Tags {
+		values, err := tags.CreateBucketIfNotExists(indexKey(k))
+		if err != nil {
+			return err
+		}
+
+		// Count the value if it's new.
+		postings := values.Bucket(indexKey(v))
+		if postings == nil {
+			if postings, err = values.CreateBucket(indexKey(v)); err != nil {
+				return err
+			} else if err := addCount(valueCounts, indexKey(k), 1); err != nil {
+				return err
+			}
+		}
+		if err := postings.Put(id, nil); err != nil {
+			return err
+		}
+	}
+
+	return b.Bucket([]byte("SeriesMeasurements")).Put(id, []byte(name))
+}
+
+// unindexSeries removes a series from the index of a database bucket. Tag
+// values and keys without series are removed.
+func unindexSeries(b *bolt.Bucket, name string, s *Series) error {
+	id := u64tob(s.ID)
+
+	if counts := b.Bucket([]byte("SeriesCounts")); counts != nil {
+		if err := addCount(counts, []byte(name), -1); err != nil {
+			return err
+		}
+	}
+
+	if keys := bucketOf(b, "SeriesKeys", name); keys != nil {
+		if err := keys.Delete(indexKey(string(marshalTags(s.Tags)))); err != nil {
+			return err
+		}
+	}
+
+	tags := bucketOf(b, "Tags", name)
+	valueCounts := bucketOf(b, "TagValueCounts", name)
+	for k, v := range s.Tags {
+		values := tagBucket(tags, k)
+		postings := tagBucket(values, v)
+		if postings == nil {
+			continue
+		}
+		if err := postings.Delete(id); err != nil {
+			return err
+		}
+
+		// Remove the tag value and key once they have no series.
+		if first, _ := postings.Cursor().First(); first != nil {
+			continue
+		} else if err := values.DeleteBucket(indexKey(v)); err != nil {
+			return err
+		} else if valueCounts != nil {
+			if err := addCount(valueCounts, indexKey(k), -1); err != nil {
+				return err
+			}
+		}
+		if first, _ := values.Cursor().First(); first != nil {
+			continue
+		} else if err := tags.DeleteBucket(indexKey(k)); err != nil {
+			return err
+		}
+	}
+
+	return b.Bucket([]byte("SeriesMeasurements")).Delete(id)
+}
+
+// countOf returns a count stored in a bucket, or zero if it isn't set.
+func countOf(b *bolt.Bucket, key []byte) int {
+	if b == nil {
+		return 0
+	}
+	v := b.Get(key)
+	if v == nil {
+		return 0
+	}
+	return int(btou64(v))
+}
+
+// addCount adds delta to a count stored in a bucket. Counts reaching zero are
+// removed.
+func addCount(b *bolt.Bucket, key []byte, delta int) error {
+	n := countOf(b, key) + delta
+	if n <= 0 {
+		return b.Delete(key)
+	}
+	return b.Put(key, u64tob(uint64(n)))
+}
+
+// marshalSeries encodes the tags of a series as a marker byte followed by each
+// key and value, ordered by key and prefixed by their lengths as uvarints.
+func marshalSeries(s *Series) []byte {
+	keys := make([]string, 0, len(s.Tags))
+	for k := range s.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b := []byte{seriesEncodingTags}
+	for _, k := range keys {
+		b = appendUvarint(b, uint64(len(k)))
+		b = append(b, k...)
+		b = appendUvarint(b, uint64(len(s.Tags[k])))
+		b = append(b, s.Tags[k]...)
+	}
+	return b
+}
+
+// mustUnmarshalSeries decodes a series stored under an id by marshalSeries or
+// as JSON. Panics if the series can't be decoded.
+func mustUnmarshalSeries(id uint64, b []byte) *Series {
+	if len(b) > 0 && b[0] == '{' {
+		var s *Series
+		mustUnmarshalJSON(b, &s)
+		return s
+	} else if len(b) == 0 || b[0] != seriesEncodingTags {
+		panic("unmarshal series: invalid encoding")
+	}
+
+	s := &Series{ID: id, Tags: make(map[string]string)}
+	for b = b[1:]; len(b) > 0; {
+		var kv [2]string
+		for i := range kv {
+			n, sz := binary.Uvarint(b)
+			if sz <= 0 || n > uint64(len(b)-sz) {
+				panic("unmarshal series: invalid encoding")
+			}
+			kv[i], b = string(b[sz:sz+int(n)]), b[sz+int(n):]
+		}
+		s.Tags[kv[0]] = kv[1]
+	}
+	return s
+}
+
+// indexKey returns the key of a tag, tag key or value in the index.
+func indexKey(s string) []byte { return append([]byte{'='}, s...) }
+
+// tagBucket returns a nested bucket by tag key and value. Returns nil if any
+// bucket on the path doesn't exist.
+func tagBucket(b *bolt.Bucket, names ...string) *bolt.Bucket {
+	for _, name := range names {
+		if b == nil {
+			return nil
+		}
+		b = b.Bucket(indexKey(name))
+	}
+	return b
+}
+
+// createBucketPath returns a nested bucket by path, creating any buckets on the
+// path which don't exist.
+func createBucketPath(b *bolt.Bucket, names ...string) (*bolt.Bucket, error) {
+	for _, name := range names {
+		var err error
+		if b, err = b.CreateBucketIfNotExists([]byte(name)); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// buildSeriesIndexes indexes the series of databases which were stored before
+// the series index was added to the metastore, and counts the series and tag
+// values of indexes built before the counts were kept.
+func (tx *metatx) buildSeriesIndexes() error {
+	c := tx.Bucket([]byte("Databases")).Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		b := c.Bucket().Bucket(k)
+		if b.Bucket([]byte("SeriesMeasurements")) != nil {
+			if b.Bucket([]byte("SeriesCounts")) == nil {
+				if err := countSeries(b); err != nil {
+					return err
+				}
+			}
+			if b.Bucket([]byte("TagValueCounts")) == nil {
+				if err := countTagValues(b); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		log.Printf("building series index for %s", k)
+
+		if _, err := b.CreateBucketIfNotExists([]byte("SeriesMeasurements")); err != nil {
+			return err
+		} else if _, err := b.CreateBucketIfNotExists([]byte("SeriesCounts")); err != nil {
+			return err
+		} else if _, err := b.CreateBucketIfNotExists([]byte("TagValueCounts")); err != nil {
+			return err
+		}
+		series, err := b.CreateBucketIfNotExists([]byte("Series"))
+		if err != nil {
+			return err
+		}
+
+		// Index the series of each measurement.
+		mc := series.Cursor()
+		for name, _ := mc.First(); name != nil; name, _ = mc.Next() {
+			sc := series.Bucket(name).Cursor()
+			for id, v := sc.First(); id != nil; id, v = sc.Next() {
+				s := mustUnmarshalSeries(btou64(id), v)
+				if err := indexSeries(b, string(name), s); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// countSeries stores the number of series of each measurement of a database
+// bucket.
+func countSeries(b *bolt.Bucket) error {
+	counts, err := b.CreateBucketIfNotExists([]byte("SeriesCounts"))
+	if err != nil {
+		return err
+	}
+	c := b.Bucket([]byte("Series")).Cursor()
+	for name, _ := c.First(); name != nil; name, _ = c.Next() {
+		if n := b.Bucket([]byte("Series")).Bucket(name).Stats().KeyN; n > 0 {
+			if err := counts.Put(name, u64tob(uint64(n))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// countTagValues stores the number of values of each tag key of a database
+// bucket.
+func countTagValues(b *bolt.Bucket) error {
+	counts, err := b.CreateBucketIfNotExists([]byte("TagValueCounts"))
+	if err != nil {
+		return err
+	}
+	tags := b.Bucket([]byte("Tags"))
+	c := tags.Cursor()
+	for name, _ := c.First(); name != nil; name, _ = c.Next() {
+		mc, err := counts.CreateBucketIfNotExists(name)
+		if err != nil {
+			return err
+		}
+		kc := tags.Bucket(name).Cursor()
+		for k, _ := kc.First(); k != nil; k, _ = kc.Next() {
+			var n int
+			vc := tags.Bucket(name).Bucket(k).Cursor()
+			for v, _ := vc.First(); v != nil; v, _ = vc.Next() {
+				n++
+			}
+			if err := mc.Put(k, u64tob(uint64(n))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
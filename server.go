@@ -63,6 +63,7 @@ type Server struct {
 	done     chan struct{} // goroutine close notification
 	rpDone   chan struct{} // retention policies goroutine close notification
 	sgpcDone chan struct{} // shard group pre-create goroutine close notification
+	compDone chan struct{} // shard compaction goroutine close notification
 
 	client MessagingClient  // broker client
 	index  uint64           // highest broadcast index seen
@@ -76,7 +77,12 @@ type Server struct {
 
 	shards map[uint64]*Shard // shards by shard id
 
+	lastValueMeasurements map[string]map[string]bool     // measurements with cached last values by database
+	coldTiers             map[string]map[string]coldTier // cold tiers by database and retention policy
+
 	stats      *Stats
+	inputStats []*Stats  // stats registered by input services
+	pipeline   *Pipeline // rewrites points before they are written
 	Logger     *log.Logger
 	WriteTrace bool // Detailed logging of write path
 
@@ -85,6 +91,14 @@ type Server struct {
 	// Retention policy settings
 	RetentionAutoCreate bool
 
+	// Series cardinality limits, zero for no limit
+	MaxSeriesPerDatabase int
+	MaxValuesPerTag      int
+
+	// Shard write cache settings
+	ShardCacheMaxSize       int
+	ShardCacheFlushInterval time.Duration
+
 	// continuous query settings
 	RecomputePreviousN     int
 	RecomputeNoOlderThan   time.Duration
@@ -115,6 +129,12 @@ func NewServer() *Server {
 		shards: make(map[uint64]*Shard),
 		stats:  NewStats("server"),
 		Logger: log.New(os.Stderr, "[server] ", log.LstdFlags),
+
+		lastValueMeasurements: make(map[string]map[string]bool),
+		coldTiers:             make(map[string]map[string]coldTier),
+
+		ShardCacheMaxSize:       DefaultShardCacheMaxSize,
+		ShardCacheFlushInterval: DefaultShardCacheFlushInterval,
 	}
 	// Server will always return with authentication enabled.
 	// This ensures that disabling authentication must be an explicit decision.
@@ -253,6 +273,11 @@ func (s *Server) close() error {
 		s.sgpcDone = nil
 	}
 
+	if s.compDone != nil {
+		close(s.compDone)
+		s.compDone = nil
+	}
+
 	// Remove path.
 	s.path = ""
 	s.index = 0
@@ -305,6 +330,7 @@ func (s *Server) load() error {
 
 			// load the index
 			log.Printf("Loading metadata index for %s\n", db.name)
+			db.meta = s.meta
 			err := s.meta.view(func(tx *metatx) error {
 				tx.indexDatabase(db)
 				return nil
@@ -312,6 +338,13 @@ func (s *Server) load() error {
 			if err != nil {
 				return err
 			}
+
+			// Track the series of measurements with cached last values.
+			for name := range s.lastValueMeasurements[db.name] {
+				if m := db.measurements[name]; m != nil {
+					db.lastValueSeries.add(m.seriesIDs()...)
+				}
+			}
 		}
 
 		// Load shards.
@@ -328,9 +361,23 @@ func (s *Server) load() error {
 							continue
 						}
 
-						if err := sh.open(s.shardPath(sh.ID), s.client.Conn(sh.ID)); err != nil {
+						sh.cacheMaxSize, sh.cacheFlushInterval = s.ShardCacheMaxSize, s.ShardCacheFlushInterval
+						sh.lastSeries = db.lastValueSeries
+						// Open shards moved to a cold tier from where they were moved to,
+						// which must exist so the shard isn't recreated empty. Shards
+						// restored from a snapshot are found at the default path instead.
+						path, cold := s.shardPath(sh.ID), false
+						if p := tx.shardPath(sh.ID); p != "" {
+							if _, err := os.Stat(p); err == nil {
+								path, cold = p, true
+							} else if _, e := os.Stat(path); e != nil {
+								return fmt.Errorf("cannot open moved shard store: id=%d, err=%s", sh.ID, err)
+							}
+						}
+						if err := sh.open(path, s.client.Conn(sh.ID)); err != nil {
 							return fmt.Errorf("cannot open shard store: id=%d, err=%s", sh.ID, err)
 						}
+						sh.cold = cold
 						s.stats.Inc("shardsOpen")
 					}
 				}
@@ -347,6 +394,23 @@ func (s *Server) load() error {
 	})
 }
 
+// RegisterStats adds stats which are written by self-monitoring along with
+// the server's own stats, such as the counters of an input service.
+func (s *Server) RegisterStats(st *Stats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inputStats = append(s.inputStats, st)
+}
+
+// SetPipeline sets the pipeline applied to all points before they are
+// written and registers its stats.
+func (s *Server) SetPipeline(p *Pipeline) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pipeline = p
+	s.inputStats = append(s.inputStats, p.Stats())
+}
+
 // StartSelfMonitoring starts a goroutine which monitors the InfluxDB server
 // itself and stores the results in the specified database at a given interval.
 func (s *Server) StartSelfMonitoring(database, retention string, interval time.Duration) error {
@@ -388,10 +452,20 @@ func (s *Server) StartSelfMonitoring(database, retention string, interval time.D
 			}
 			batch := pointsFromStats(s.stats, tags)
 
+			// Input service stats.
+			s.mu.RLock()
+			for _, st := range s.inputStats {
+				batch = append(batch, pointsFromStats(st, tags)...)
+			}
+			s.mu.RUnlock()
+
 			// Shard-level stats.
 			tags["shardID"] = strconv.FormatUint(s.id, 10)
 			for _, sh := range s.shards {
 				batch = append(batch, pointsFromStats(sh.stats, tags)...)
+				if sh.engine != nil {
+					batch = append(batch, pointsFromStats(sh.engine.Stats(), tags)...)
+				}
 			}
 
 			// Server diagnostics.
@@ -428,6 +502,7 @@ func (s *Server) StartRetentionPolicyEnforcement(checkInterval time.Duration) er
 				return
 			case <-time.After(checkInterval):
 				s.EnforceRetentionPolicies()
+				s.MoveColdShards()
 			}
 		}
 	}()
@@ -473,6 +548,56 @@ func (s *Server) EnforceRetentionPolicies() {
 	}
 }
 
+// StartShardCompaction launches compaction of the local shards which haven't
+// been written to for coldAfter.
+func (s *Server) StartShardCompaction(checkInterval, coldAfter time.Duration, recompress bool) error {
+	if checkInterval == 0 {
+		return fmt.Errorf("shard compaction check interval must be non-zero")
+	}
+	compDone := make(chan struct{}, 0)
+	s.compDone = compDone
+	go func() {
+		for {
+			select {
+			case <-compDone:
+				return
+			case <-time.After(checkInterval):
+				s.CompactShards(coldAfter, recompress)
+			}
+		}
+	}()
+	return nil
+}
+
+// CompactShards rewrites the local shards which haven't been written to for
+// coldAfter, reclaiming the space of deleted data. Each shard is compacted once
+// until it is written to again.
+func (s *Server) CompactShards(coldAfter time.Duration, recompress bool) {
+	// Only keep the lock while finding the shards so writes aren't blocked
+	// while compacting.
+	var shards []*Shard
+	func() {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		for _, sh := range s.shards {
+			if sh.isCold(coldAfter) {
+				shards = append(shards, sh)
+			}
+		}
+	}()
+
+	for _, sh := range shards {
+		n, err := sh.compact(recompress)
+		if err != nil {
+			log.Printf("failed to compact shard %d: %s", sh.ID, err)
+			continue
+		}
+		log.Printf("compacted shard %d, %d bytes reclaimed", sh.ID, n)
+		s.stats.Inc("shardsCompacted")
+		s.stats.Add("shardBytesReclaimed", n)
+	}
+}
+
 // StartShardGroupsPreCreate launches shard group pre-create to avoid write bottlenecks.
 func (s *Server) StartShardGroupsPreCreate(checkInterval time.Duration) error {
 	if checkInterval == 0 {
@@ -590,7 +715,7 @@ func (s *Server) Sync(topicID, index uint64) error {
 	s.mu.RUnlock()
 
 	// Return error if there is no shard.
-	if sh == nil || sh.store == nil {
+	if sh == nil || sh.engine == nil {
 		return errors.New("shard not owned")
 	}
 
@@ -972,6 +1097,7 @@ func (s *Server) applyCreateDatabase(m *messaging.Message) (err error) {
 	// Create database entry.
 	db := newDatabase()
 	db.name = c.Name
+	db.meta = s.meta
 
 	if s.RetentionAutoCreate {
 		// Create the default retention policy.
@@ -994,6 +1120,57 @@ func (s *Server) applyCreateDatabase(m *messaging.Message) (err error) {
 	return
 }
 
+// FieldCoercion returns the field coercion policy of a database.
+func (s *Server) FieldCoercion(database string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	db := s.databases[database]
+	if db == nil {
+		return "", ErrDatabaseNotFound(database)
+	} else if db.fieldCoercion == "" {
+		return FieldCoercionNone, nil
+	}
+	return db.fieldCoercion, nil
+}
+
+// SetFieldCoercion sets the policy for writing values to fields of a database
+// which were created with another type.
+func (s *Server) SetFieldCoercion(database, policy string) error {
+	switch policy {
+	case FieldCoercionNone, FieldCoercionNumeric, FieldCoercionAll:
+	default:
+		return ErrInvalidFieldCoercion
+	}
+	c := &setFieldCoercionCommand{Database: database, Policy: policy}
+	_, err := s.broadcast(setFieldCoercionMessageType, c)
+	return err
+}
+
+func (s *Server) applySetFieldCoercion(m *messaging.Message) (err error) {
+	var c setFieldCoercionCommand
+	mustUnmarshalJSON(m.Data, &c)
+
+	// Validate command.
+	db := s.databases[c.Database]
+	if db == nil {
+		return ErrDatabaseNotFound(c.Database)
+	}
+
+	// Update the policy. The default is stored as an empty string.
+	db.fieldCoercion = c.Policy
+	if c.Policy == FieldCoercionNone {
+		db.fieldCoercion = ""
+	}
+
+	// Persist to metastore.
+	err = s.meta.mustUpdate(m.Index, func(tx *metatx) error {
+		return tx.saveDatabase(db)
+	})
+
+	return
+}
+
 // DropDatabase deletes an existing database.
 func (s *Server) DropDatabase(name string) error {
 	if name == "" {
@@ -1013,30 +1190,41 @@ func (s *Server) applyDropDatabase(m *messaging.Message) (err error) {
 	}
 
 	// Remove from metastore.
-	err = s.meta.mustUpdate(m.Index, func(tx *metatx) error { return tx.dropDatabase(c.Name) })
-
 	db := s.databases[c.Name]
+	err = s.meta.mustUpdate(m.Index, func(tx *metatx) error {
+		for _, rp := range db.policies {
+			for _, g := range rp.shardGroups {
+				if err := tx.deleteShardPaths(g.Shards); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.dropDatabase(c.Name)
+	})
+
 	for _, rp := range db.policies {
 		for _, sg := range rp.shardGroups {
 			for _, sh := range sg.Shards {
 
 				// if we have this shard locally, close and remove it
-				if sh.store != nil {
+				if sh.engine != nil {
 					// close topic readers/heartbeaters/etc. connections
 					err := s.client.CloseConn(sh.ID)
 					if err != nil {
 						panic(err)
 					}
 
+					path := sh.path
 					err = sh.close()
 					if err != nil {
 						panic(err)
 					}
 
-					err = os.Remove(s.shardPath(sh.ID))
+					err = os.Remove(path)
 					if err != nil {
 						panic(err)
 					}
+					_ = os.Remove(path + ".cache")
 				}
 
 				delete(s.shards, sh.ID)
@@ -1145,6 +1333,7 @@ func (s *Server) applyCreateShardGroupIfNotExists(m *messaging.Message) (err err
 	g.Shards = make([]*Shard, shardN)
 	for i := range g.Shards {
 		g.Shards[i] = newShard()
+		g.Shards[i].Engine = rp.Engine
 	}
 
 	// Persist to metastore if a shard was created.
@@ -1186,6 +1375,8 @@ func (s *Server) applyCreateShardGroupIfNotExists(m *messaging.Message) (err err
 		}
 
 		// Open shard store. Panic if an error occurs and we can retry.
+		sh.cacheMaxSize, sh.cacheFlushInterval = s.ShardCacheMaxSize, s.ShardCacheFlushInterval
+		sh.lastSeries = db.lastValueSeries
 		if err := sh.open(s.shardPath(sh.ID), s.client.Conn(sh.ID)); err != nil {
 			panic("unable to open shard: " + err.Error())
 		}
@@ -1236,19 +1427,23 @@ func (s *Server) applyDeleteShardGroup(m *messaging.Message) (err error) {
 			continue
 		}
 
-		path := shard.store.Path()
+		path := shard.path
 		shard.close()
 		if err := os.Remove(path); err != nil {
 			// Log, but keep going. This can happen if shards were deleted, but the server exited
 			// before it acknowledged the delete command.
 			log.Printf("error deleting shard %s, group ID %d, policy %s: %s", path, g.ID, rp.Name, err.Error())
 		}
+		_ = os.Remove(path + ".cache")
 	}
 
 	// Remove from metastore.
 	rp.removeShardGroupByID(c.ID)
 	err = s.meta.mustUpdate(m.Index, func(tx *metatx) error {
 		s.stats.Add("shardsDeleted", int64(len(g.Shards)))
+		if err := tx.deleteShardPaths(g.Shards); err != nil {
+			return err
+		}
 		return tx.saveDatabase(db)
 	})
 	return
@@ -1515,12 +1710,18 @@ func (s *Server) CreateRetentionPolicy(database string, rp *RetentionPolicy) err
 		return ErrRetentionPolicyMinDuration
 	}
 
+	// Ensure the engine exists.
+	if _, err := NewEngine(rp.Engine); err != nil {
+		return err
+	}
+
 	c := &createRetentionPolicyCommand{
 		Database:           database,
 		Name:               rp.Name,
 		Duration:           rp.Duration,
 		ShardGroupDuration: calculateShardGroupDuration(rp.Duration),
 		ReplicaN:           rp.ReplicaN,
+		Engine:             rp.Engine,
 	}
 	_, err := s.broadcast(createRetentionPolicyMessageType, c)
 	return err
@@ -1574,6 +1775,7 @@ func (s *Server) applyCreateRetentionPolicy(m *messaging.Message) error {
 		Duration:           c.Duration,
 		ShardGroupDuration: c.ShardGroupDuration,
 		ReplicaN:           c.ReplicaN,
+		Engine:             c.Engine,
 	}
 
 	// Persist to metastore.
@@ -1590,6 +1792,7 @@ type RetentionPolicyUpdate struct {
 	Name     *string        `json:"name,omitempty"`
 	Duration *time.Duration `json:"duration,omitempty"`
 	ReplicaN *uint32        `json:"replicaN,omitempty"`
+	Engine   *string        `json:"engine,omitempty"`
 }
 
 // UpdateRetentionPolicy updates an existing retention policy on a database.
@@ -1599,6 +1802,13 @@ func (s *Server) UpdateRetentionPolicy(database, name string, rpu *RetentionPoli
 		return ErrRetentionPolicyMinDuration
 	}
 
+	// Ensure the engine exists.
+	if rpu.Engine != nil {
+		if _, err := NewEngine(*rpu.Engine); err != nil {
+			return err
+		}
+	}
+
 	c := &updateRetentionPolicyCommand{Database: database, Name: name, Policy: rpu}
 	_, err := s.broadcast(updateRetentionPolicyMessageType, c)
 	return err
@@ -1639,6 +1849,11 @@ func (s *Server) applyUpdateRetentionPolicy(m *messaging.Message) (err error) {
 		p.ReplicaN = *c.Policy.ReplicaN
 	}
 
+	// Update the engine of new shards.
+	if c.Policy.Engine != nil {
+		p.Engine = *c.Policy.Engine
+	}
+
 	// Persist to metastore.
 	err = s.meta.mustUpdate(m.Index, func(tx *metatx) error {
 		return tx.saveDatabase(db)
@@ -1718,23 +1933,25 @@ func (s *Server) applyDropSeries(m *messaging.Message) error {
 		return ErrDatabaseNotFound(c.Database)
 	}
 
-	// Remove from metastore.
-	err := s.meta.mustUpdate(m.Index, func(tx *metatx) error {
-		if err := tx.dropSeries(c.Database, c.SeriesByMeasurement); err != nil {
-			return err
+	// Only delete the data in the time range. The series stay in the index.
+	if c.restricted() {
+		for _, ids := range c.SeriesByMeasurement {
+			if err := database.deleteSeriesRange("", ids, c.MinTime, c.MaxTime); err != nil {
+				return fmt.Errorf("failed to remove series data: %s", err)
+			}
 		}
+		return s.meta.mustUpdate(m.Index, func(tx *metatx) error { return nil })
+	}
 
-		// Delete series from the database.
-		if err := database.dropSeries(c.SeriesByMeasurement); err != nil {
-			return fmt.Errorf("failed to remove series from index: %s", err)
-		}
-		return nil
-	})
-	if err != nil {
-		return err
+	// Delete series from the database.
+	if err := database.dropSeries(c.SeriesByMeasurement); err != nil {
+		return fmt.Errorf("failed to remove series from index: %s", err)
 	}
 
-	return nil
+	// Remove from metastore.
+	return s.meta.mustUpdate(m.Index, func(tx *metatx) error {
+		return tx.dropSeries(c.Database, c.SeriesByMeasurement)
+	})
 }
 
 // DropSeries deletes from an existing series.
@@ -1744,6 +1961,97 @@ func (s *Server) DropSeries(database string, seriesByMeasurement map[string][]ui
 	return err
 }
 
+// DropSeriesRange deletes the data of series with timestamps between min and
+// max, inclusive. A zero time leaves that side of the range unbounded.
+//
+// Once the data is deleted, the series found without data left are removed
+// from the index by a separate command, which every server applies as is.
+// Series with data in shards stored on other servers are kept in the index. A
+// point written to a series between the check and its removal from the index
+// can't be queried.
+func (s *Server) DropSeriesRange(database string, seriesByMeasurement map[string][]uint64, min, max time.Time) error {
+	if min.IsZero() {
+		min = time.Unix(0, math.MinInt64).UTC()
+	}
+	if max.IsZero() {
+		max = time.Unix(0, math.MaxInt64).UTC()
+	}
+	c := dropSeriesCommand{
+		Database:            database,
+		SeriesByMeasurement: seriesByMeasurement,
+		MinTime:             min,
+		MaxTime:             max,
+	}
+	if _, err := s.broadcast(dropSeriesMessageType, c); err != nil {
+		return err
+	}
+
+	// Find the shard groups with data left outside the range.
+	var ranges []keptRange
+	if err := func() error {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+
+		db := s.databases[database]
+		if db == nil {
+			return ErrDatabaseNotFound(database)
+		}
+		ranges = keptRanges(db, "", min, max)
+		return nil
+	}(); err != nil {
+		return err
+	}
+
+	// Remove the series without data left from the index.
+	unindex := make(map[string][]uint64)
+	for name, ids := range seriesByMeasurement {
+		a := make(seriesIDs, len(ids))
+		copy(a, ids)
+		sort.Sort(a)
+
+		unused, err := unusedSeriesIDs(ranges, a)
+		if err != nil {
+			return err
+		} else if len(unused) > 0 {
+			unindex[name] = unused
+		}
+	}
+	if len(unindex) == 0 {
+		return nil
+	}
+	_, err := s.broadcast(unindexSeriesMessageType, &unindexSeriesCommand{Database: database, SeriesByMeasurement: unindex})
+	return err
+}
+
+func (s *Server) applyUnindexSeries(m *messaging.Message) error {
+	var c unindexSeriesCommand
+	mustUnmarshalJSON(m.Data, &c)
+
+	database := s.databases[c.Database]
+	if database == nil {
+		return ErrDatabaseNotFound(c.Database)
+	}
+
+	return s.meta.mustUpdate(m.Index, func(tx *metatx) error {
+		if err := tx.dropSeries(c.Database, c.SeriesByMeasurement); err != nil {
+			return err
+		}
+		for name, ids := range c.SeriesByMeasurement {
+			database.lastValueSeries.remove(ids...)
+
+			// Drop the measurement once it has no series left.
+			if !c.DropMeasurements || tx.measurementIndex(c.Database, name).seriesN() > 0 {
+				continue
+			}
+			if err := tx.dropMeasurement(c.Database, name); err != nil {
+				return err
+			}
+			database.dropMeasurement(name)
+		}
+		return nil
+	})
+}
+
 // Point defines the values that will be written to the database
 type Point struct {
 	Name      string
@@ -1753,7 +2061,8 @@ type Point struct {
 }
 
 // WriteSeries writes series data to the database.
-// Returns the messaging index the data was written to.
+// Returns the messaging index the data was written to. If some points are
+// dropped the others are still written and an ErrPartialWrite is returned.
 func (s *Server) WriteSeries(database, retentionPolicy string, points []Point) (idx uint64, err error) {
 	s.stats.Inc("batchWriteRx")
 	s.stats.Add("pointWriteRx", int64(len(points)))
@@ -1768,6 +2077,16 @@ func (s *Server) WriteSeries(database, retentionPolicy string, points []Point) (
 			database, retentionPolicy, len(points))
 	}
 
+	// Rewrite and filter the points. There is nothing to write if all are dropped.
+	s.mu.RLock()
+	pipeline := s.pipeline
+	s.mu.RUnlock()
+	if pipeline != nil {
+		if points = pipeline.Process(points); len(points) == 0 {
+			return 0, nil
+		}
+	}
+
 	// Make sure every point has at least one field.
 	for _, p := range points {
 		if len(p.Fields) == 0 {
@@ -1786,6 +2105,13 @@ func (s *Server) WriteSeries(database, retentionPolicy string, points []Point) (
 		retentionPolicy = rp.Name
 	}
 
+	// Drop points which would create series beyond the cardinality limits.
+	// The remaining points are still written.
+	points, limitErr := s.enforceSeriesLimits(database, points)
+	if len(points) == 0 {
+		return 0, limitErr
+	}
+
 	// Ensure all required Series and Measurement Fields are created cluster-wide.
 	if err := s.createMeasurementsIfNotExists(database, retentionPolicy, points); err != nil {
 		return 0, err
@@ -1814,55 +2140,60 @@ func (s *Server) WriteSeries(database, retentionPolicy string, points []Point) (
 		if db == nil {
 			return ErrDatabaseNotFound(database)
 		}
-		for _, p := range points {
-			measurement, series := db.MeasurementAndSeries(p.Name, p.Tags)
-			if series == nil {
-				s.Logger.Printf("series not found: name=%s, tags=%#v", p.Name, p.Tags)
-				return ErrSeriesNotFound
-			}
+		// Look up the series of all points within a single view of the index.
+		return s.meta.mustView(func(tx *metatx) error {
+			indexes := newMeasurementIndexes(tx, database)
+			for _, p := range points {
+				measurement, series := db.measurements[p.Name], indexes.get(p.Name).seriesByTags(p.Tags)
+				if series == nil {
+					s.Logger.Printf("series not found: name=%s, tags=%#v", p.Name, p.Tags)
+					return ErrSeriesNotFound
+				}
 
-			// Retrieve shard group.
-			g, err := s.shardGroupByTimestamp(database, retentionPolicy, p.Timestamp)
-			if err != nil {
-				return err
-			}
-			if s.WriteTrace {
-				log.Printf("shard group located: %v", g)
-			}
+				// Retrieve shard group.
+				g, err := s.shardGroupByTimestamp(database, retentionPolicy, p.Timestamp)
+				if err != nil {
+					return err
+				}
+				if s.WriteTrace {
+					log.Printf("shard group located: %v", g)
+				}
 
-			// Find appropriate shard within the shard group.
-			sh := g.ShardBySeriesID(series.ID)
-			if s.WriteTrace {
-				log.Printf("shard located: %v", sh)
-			}
+				// Find appropriate shard within the shard group.
+				sh := g.ShardBySeriesID(series.ID)
+				if s.WriteTrace {
+					log.Printf("shard located: %v", sh)
+				}
 
-			// Many points are likely to have the same Measurement name. Re-use codecs if possible.
-			var codec *FieldCodec
-			codec, ok := codecs[measurement.Name]
-			if !ok {
-				codec = NewFieldCodec(measurement)
-				codecs[measurement.Name] = codec
-			}
+				// Many points are likely to have the same Measurement name. Re-use codecs if possible.
+				var codec *FieldCodec
+				codec, ok := codecs[measurement.Name]
+				if !ok {
+					codec = NewFieldCodec(measurement)
+					codec.coercion = db.fieldCoercion
+					codecs[measurement.Name] = codec
+				}
 
-			// Convert string-key/values to encoded fields.
-			encodedFields, err := codec.EncodeFields(p.Fields)
-			if err != nil {
-				return err
-			}
+				// Convert string-key/values to encoded fields.
+				encodedFields, err := codec.EncodeFields(p.Fields)
+				if err != nil {
+					return err
+				}
 
-			// Encode point header, followed by point data, and add to shard's batch.
-			data := marshalPointHeader(series.ID, uint32(len(encodedFields)), p.Timestamp.UnixNano())
-			data = append(data, encodedFields...)
-			if shardData[sh.ID] == nil {
-				shardData[sh.ID] = make([]byte, 0)
-			}
-			shardData[sh.ID] = append(shardData[sh.ID], data...)
-			if s.WriteTrace {
-				log.Printf("data appended to buffer for shard %d", sh.ID)
+				// Encode point header, followed by point data, and add to shard's batch.
+				data := marshalPointHeader(series.ID, uint32(len(encodedFields)), p.Timestamp.UnixNano())
+				data = append(data, encodedFields...)
+				if shardData[sh.ID] == nil {
+					shardData[sh.ID] = make([]byte, 0)
+				}
+				shardData[sh.ID] = append(shardData[sh.ID], data...)
+				if s.WriteTrace {
+					log.Printf("data appended to buffer for shard %d", sh.ID)
+				}
 			}
-		}
 
-		return nil
+			return nil
+		})
 	}(); err != nil {
 		return 0, err
 	}
@@ -1889,7 +2220,7 @@ func (s *Server) WriteSeries(database, retentionPolicy string, points []Point) (
 		}
 	}
 
-	return maxIndex, nil
+	return maxIndex, limitErr
 }
 
 // createMeasurementsIfNotExists walks the "points" and ensures that all new Series are created, and all
@@ -1907,32 +2238,38 @@ func (s *Server) createMeasurementsIfNotExists(database, retentionPolicy string,
 			return ErrDatabaseNotFound(database)
 		}
 
-		for _, p := range points {
-			measurement, series := db.MeasurementAndSeries(p.Name, p.Tags)
+		return s.meta.mustView(func(tx *metatx) error {
+			indexes := newMeasurementIndexes(tx, database)
+			for _, p := range points {
+				measurement, series := db.measurements[p.Name], indexes.get(p.Name).seriesByTags(p.Tags)
 
-			if series == nil {
-				// Series does not exist in Metastore, add it so it's created cluster-wide.
-				c.addSeriesIfNotExists(p.Name, p.Tags)
-			}
+				if series == nil {
+					// Series does not exist in Metastore, add it so it's created cluster-wide.
+					c.addSeriesIfNotExists(p.Name, p.Tags)
+				}
 
-			for k, v := range p.Fields {
-				if measurement != nil {
-					if f := measurement.FieldByName(k); f != nil {
-						// Field present in Metastore, make sure there is no type conflict.
-						if f.Type != influxql.InspectDataType(v) {
-							return fmt.Errorf("field \"%s\" is type %T, mapped as type %s", k, v, f.Type)
+				for k, v := range p.Fields {
+					if measurement != nil {
+						if f := measurement.FieldByName(k); f != nil {
+							// Field present in Metastore, make sure there is no type conflict
+							// the database's coercion policy can't resolve.
+							if f.Type != influxql.InspectDataType(v) {
+								if _, err := coerceFieldValue(v, f.Type, db.fieldCoercion); err != nil {
+									return fmt.Errorf("field \"%s\" is type %T, mapped as type %s", k, v, f.Type)
+								}
+							}
+							continue // Field is present, and its value can be written. Nothing more to do.
 						}
-						continue // Field is present, and it's of the same type. Nothing more to do.
 					}
-				}
-				// Field isn't in Metastore. Add it to command so it's created cluster-wide.
-				if err := c.addFieldIfNotExists(p.Name, k, influxql.InspectDataType(v)); err != nil {
-					return err
+					// Field isn't in Metastore. Add it to command so it's created cluster-wide.
+					if err := c.addFieldIfNotExists(p.Name, k, influxql.InspectDataType(v)); err != nil {
+						return err
+					}
 				}
 			}
-		}
 
-		return nil
+			return nil
+		})
 	}()
 
 	// Any broadcast actually required?
@@ -1960,12 +2297,12 @@ func (s *Server) applyCreateMeasurementsIfNotExists(m *messaging.Message) error
 	// Process command within a transaction.
 	if err := s.meta.mustUpdate(m.Index, func(tx *metatx) error {
 		for _, cm := range c.Measurements {
+			db.createMeasurementIfNotExists(cm.Name)
+
 			// Create each series
 			for _, t := range cm.Tags {
-				_, ss := db.MeasurementAndSeries(cm.Name, t)
-
 				// Ensure creation of Series is idempotent.
-				if ss != nil {
+				if tx.measurementIndex(db.name, cm.Name).seriesByTags(t) != nil {
 					continue
 				}
 
@@ -1973,7 +2310,9 @@ func (s *Server) applyCreateMeasurementsIfNotExists(m *messaging.Message) error
 				if err != nil {
 					return err
 				}
-				db.addSeriesToIndex(cm.Name, series)
+				if s.lastValueMeasurements[db.name][cm.Name] {
+					db.lastValueSeries.add(series.ID)
+				}
 			}
 
 			// Create each new field.
@@ -2016,6 +2355,69 @@ func (s *Server) DropMeasurement(database, name string) error {
 	return err
 }
 
+// DropMeasurementFromPolicy deletes the data of a measurement in a retention
+// policy. Once the data is deleted, the series found without data left in other
+// retention policies are removed from the index, and the measurement dropped if
+// it has no series left, in the same way as by DropSeriesRange.
+func (s *Server) DropMeasurementFromPolicy(database, name, policy string) error {
+	// Validate the policy before broadcasting.
+	if err := func() error {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+
+		db := s.databases[database]
+		if db == nil {
+			return ErrDatabaseNotFound(database)
+		} else if db.policies[policy] == nil {
+			return ErrRetentionPolicyNotFound
+		}
+		return nil
+	}(); err != nil {
+		return err
+	}
+
+	c := &dropMeasurementCommand{Database: database, Name: name, Policy: policy}
+	if _, err := s.broadcast(dropMeasurementMessageType, c); err != nil {
+		return err
+	}
+
+	// Find the measurement's series and the shard groups of other policies.
+	var ids seriesIDs
+	var ranges []keptRange
+	if err := func() error {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+
+		db := s.databases[database]
+		if db == nil {
+			return ErrDatabaseNotFound(database)
+		}
+		m := db.measurements[name]
+		if m == nil {
+			return ErrMeasurementNotFound(name)
+		}
+		ids = m.seriesIDs()
+		ranges = keptRanges(db, policy, time.Unix(0, math.MinInt64).UTC(), time.Unix(0, math.MaxInt64).UTC())
+		return nil
+	}(); err != nil {
+		return err
+	}
+
+	// Remove the series without data left from the index.
+	unused, err := unusedSeriesIDs(ranges, ids)
+	if err != nil {
+		return err
+	} else if len(unused) == 0 && len(ids) > 0 {
+		return nil
+	}
+	_, err = s.broadcast(unindexSeriesMessageType, &unindexSeriesCommand{
+		Database:            database,
+		SeriesByMeasurement: map[string][]uint64{name: unused},
+		DropMeasurements:    true,
+	})
+	return err
+}
+
 func (s *Server) applyDropMeasurement(m *messaging.Message) error {
 	var c dropMeasurementCommand
 	mustUnmarshalJSON(m.Data, &c)
@@ -2029,24 +2431,31 @@ func (s *Server) applyDropMeasurement(m *messaging.Message) error {
 	if measurement == nil {
 		return ErrMeasurementNotFound(c.Name)
 	}
+	ids := measurement.seriesIDs()
+
+	// Only delete the data of the retention policy. The series stay in the index.
+	if c.Policy != "" {
+		if err := database.deleteSeriesRange(c.Policy, ids, time.Unix(0, math.MinInt64).UTC(), time.Unix(0, math.MaxInt64).UTC()); err != nil {
+			return fmt.Errorf("failed to remove measurement data: %s", err)
+		}
+		return s.meta.mustUpdate(m.Index, func(tx *metatx) error { return nil })
+	}
+
+	// Delete the measurement's data.
+	if err := database.dropSeries(map[string][]uint64{c.Name: ids}); err != nil {
+		return err
+	}
 
-	err := s.meta.mustUpdate(m.Index, func(tx *metatx) error {
+	return s.meta.mustUpdate(m.Index, func(tx *metatx) error {
 		// Drop metastore data
 		if err := tx.dropMeasurement(c.Database, c.Name); err != nil {
 			return err
 		}
 
 		// Drop measurement from the database.
-		if err := database.dropMeasurement(c.Name); err != nil {
-			return err
-		}
+		database.dropMeasurement(c.Name)
 		return nil
 	})
-	if err != nil {
-		return err
-	}
-
-	return nil
 }
 
 // createShardGroupsIfNotExist walks the "points" and ensures that all required shards exist on the cluster.
@@ -2205,20 +2614,28 @@ func (s *Server) ExecuteQuery(q *influxql.Query, database string, user *User, ch
 				res = s.executeDropSeriesStatement(stmt, database, user)
 			case *influxql.ShowSeriesStatement:
 				res = s.executeShowSeriesStatement(stmt, database, user)
+			case *influxql.ShowSeriesCardinalityStatement:
+				res = s.executeShowSeriesCardinalityStatement(stmt, database, user)
 			case *influxql.DropMeasurementStatement:
 				res = s.executeDropMeasurementStatement(stmt, database, user)
 			case *influxql.ShowMeasurementsStatement:
 				res = s.executeShowMeasurementsStatement(stmt, database, user)
+			case *influxql.ShowMeasurementCardinalityStatement:
+				res = s.executeShowMeasurementCardinalityStatement(stmt, database, user)
 			case *influxql.ShowTagKeysStatement:
 				res = s.executeShowTagKeysStatement(stmt, database, user)
 			case *influxql.ShowTagValuesStatement:
 				res = s.executeShowTagValuesStatement(stmt, database, user)
+			case *influxql.ShowTagValuesCardinalityStatement:
+				res = s.executeShowTagValuesCardinalityStatement(stmt, database, user)
 			case *influxql.ShowFieldKeysStatement:
 				res = s.executeShowFieldKeysStatement(stmt, database, user)
 			case *influxql.ShowStatsStatement:
 				res = s.executeShowStatsStatement(stmt, user)
 			case *influxql.ShowDiagnosticsStatement:
 				res = s.executeShowDiagnosticsStatement(stmt, user)
+			case *influxql.ShowShardsStatement:
+				res = s.executeShowShardsStatement(stmt, user)
 			case *influxql.GrantStatement:
 				res = s.executeGrantStatement(stmt, user)
 			case *influxql.RevokeStatement:
@@ -2227,6 +2644,8 @@ func (s *Server) ExecuteQuery(q *influxql.Query, database string, user *User, ch
 				res = s.executeCreateRetentionPolicyStatement(stmt, user)
 			case *influxql.AlterRetentionPolicyStatement:
 				res = s.executeAlterRetentionPolicyStatement(stmt, user)
+			case *influxql.AlterDatabaseStatement:
+				res = s.executeAlterDatabaseStatement(stmt, user)
 			case *influxql.DropRetentionPolicyStatement:
 				res = s.executeDropRetentionPolicyStatement(stmt, user)
 			case *influxql.ShowRetentionPoliciesStatement:
@@ -2474,6 +2893,44 @@ func (s *Server) executeShowServersStatement(q *influxql.ShowServersStatement, u
 	return &Result{Series: []*influxql.Row{row}}
 }
 
+func (s *Server) executeShowShardsStatement(q *influxql.ShowShardsStatement, user *User) *Result {
+	names := s.Databases()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var rows []*influxql.Row
+	for _, name := range names {
+		db := s.databases[name]
+		if db == nil {
+			continue
+		}
+
+		// Sort policies by name.
+		var policies RetentionPolicies
+		for _, rp := range db.policies {
+			policies = append(policies, rp)
+		}
+		sort.Sort(policies)
+
+		row := &influxql.Row{Name: name, Columns: []string{"id", "retention_policy", "start_time", "end_time", "owners", "tier"}}
+		for _, rp := range policies {
+			for _, g := range rp.shardGroups {
+				for _, sh := range g.Shards {
+					var owners []string
+					for _, id := range sh.DataNodeIDs {
+						owners = append(owners, strconv.FormatUint(id, 10))
+					}
+					row.Values = append(row.Values, []interface{}{sh.ID, rp.Name, g.StartTime.UTC().Format(time.RFC3339),
+						g.EndTime.UTC().Format(time.RFC3339), strings.Join(owners, ","), sh.tier()})
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+	return &Result{Series: rows}
+}
+
 func (s *Server) executeCreateUserStatement(q *influxql.CreateUserStatement, user *User) *Result {
 	isAdmin := false
 	if q.Privilege != nil {
@@ -2491,6 +2948,9 @@ func (s *Server) executeDropUserStatement(q *influxql.DropUserStatement, user *U
 }
 
 func (s *Server) executeDropMeasurementStatement(stmt *influxql.DropMeasurementStatement, database string, user *User) *Result {
+	if stmt.RetentionPolicy != "" {
+		return &Result{Err: s.DropMeasurementFromPolicy(database, stmt.Name, stmt.RetentionPolicy)}
+	}
 	return &Result{Err: s.DropMeasurement(database, stmt.Name)}
 }
 
@@ -2500,13 +2960,14 @@ func (s *Server) executeDropSeriesStatement(stmt *influxql.DropSeriesStatement,
 	seriesByMeasurement := make(map[string][]uint64)
 	// Handle the simple `DROP SERIES <id>` case.
 	if stmt.Source == nil && stmt.Condition == nil {
-		for _, db := range s.databases {
-			for _, m := range db.measurements {
-				if m.seriesByID[stmt.SeriesID] != nil {
-					seriesByMeasurement[m.Name] = []uint64{stmt.SeriesID}
+		_ = s.meta.mustView(func(tx *metatx) error {
+			for _, db := range s.databases {
+				if name, series := tx.series(db.name, stmt.SeriesID); series != nil {
+					seriesByMeasurement[name] = []uint64{stmt.SeriesID}
 				}
 			}
-		}
+			return nil
+		})
 
 		s.mu.RUnlock()
 		return &Result{Err: s.DropSeries(database, seriesByMeasurement)}
@@ -2528,41 +2989,30 @@ func (s *Server) executeDropSeriesStatement(stmt *influxql.DropSeriesStatement,
 		return &Result{Err: err}
 	}
 
-	for _, m := range measurements {
-		var ids seriesIDs
-		if stmt.Condition != nil {
-			// Get series IDs that match the WHERE clause.
-			filters := map[uint64]influxql.Expr{}
-			ids, _, _, err = m.walkWhereForSeriesIds(stmt.Condition, filters)
-			if err != nil {
-				return &Result{Err: err}
-			}
+	// Separate the time range to drop from the condition on tags.
+	cond, tmin, tmax := splitTimeCondition(stmt.Condition)
 
-			// TODO: check return of walkWhereForSeriesIds for fields
-		} else {
-			// No WHERE clause so get all series IDs for this measurement.
-			ids = m.seriesIDs
+	for _, m := range measurements {
+		// Get series IDs that match the WHERE clause.
+		ids, err := m.seriesIDsAllOrByExpr(cond)
+		if err != nil {
+			s.mu.RUnlock()
+			return &Result{Err: err}
 		}
 
 		seriesByMeasurement[m.Name] = ids
 	}
 	s.mu.RUnlock()
 
+	// Only drop the data in the time range if there is one.
+	if !tmin.IsZero() || !tmax.IsZero() {
+		return &Result{Err: s.DropSeriesRange(database, seriesByMeasurement, tmin, tmax)}
+	}
 	return &Result{Err: s.DropSeries(database, seriesByMeasurement)}
 }
 
 func (s *Server) executeShowSeriesStatement(stmt *influxql.ShowSeriesStatement, database string, user *User) *Result {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	// Find the database.
-	db := s.databases[database]
-	if db == nil {
-		return &Result{Err: ErrDatabaseNotFound(database)}
-	}
-
-	// Get the list of measurements we're interested in.
-	measurements, err := measurementsFromSourceOrDB(stmt.Source, db)
+	measurements, matches, scan, err := s.seriesByCondition(database, stmt.Source, stmt.Condition)
 	if err != nil {
 		return &Result{Err: err}
 	}
@@ -2573,47 +3023,44 @@ func (s *Server) executeShowSeriesStatement(stmt *influxql.ShowSeriesStatement,
 	}
 
 	// Loop through measurements to build result. One result row / measurement.
-	for _, m := range measurements {
+	for i, m := range measurements {
+		// Get series IDs that match the WHERE clause.
 		var ids seriesIDs
-
-		if stmt.Condition != nil {
-			// Get series IDs that match the WHERE clause.
-			filters := map[uint64]influxql.Expr{}
-			ids, _, _, err = m.walkWhereForSeriesIds(stmt.Condition, filters)
-			if err != nil {
+		if matches != nil {
+			if ids, err = scan.seriesIDs(matches[i]); err != nil {
 				return &Result{Err: err}
 			}
 
 			// If no series matched, then go to the next measurement.
-			if len(ids) == 0 {
+			if len(ids) == 0 && stmt.Condition != nil {
 				continue
 			}
-
-			// TODO: check return of walkWhereForSeriesIds for fields
-		} else {
-			// No WHERE clause so get all series IDs for this measurement.
-			ids = m.seriesIDs
 		}
 
 		// Make a new row for this measurement.
-		r := &influxql.Row{
-			Name:    m.Name,
-			Columns: m.tagKeys(),
-		}
+		r := &influxql.Row{Name: m.Name}
 
-		// Loop through series IDs getting matching tag sets.
-		for _, id := range ids {
-			if s, ok := m.seriesByID[id]; ok {
-				values := make([]interface{}, 0, len(r.Columns)+1)
-				values = append(values, id)
-				for _, column := range r.Columns {
-					values = append(values, s.Tags[column])
-				}
+		// Read the tag keys and the tag sets of the series from a single view of the index.
+		m.index(func(mi *measurementIndex) {
+			r.Columns = mi.tagKeys()
+			if matches == nil {
+				ids = mi.seriesIDs()
+			}
 
-				// Add the tag values to the row.
-				r.Values = append(r.Values, values)
+			// Loop through series IDs getting matching tag sets.
+			for _, id := range ids {
+				if s := mi.series(id); s != nil {
+					values := make([]interface{}, 0, len(r.Columns)+1)
+					values = append(values, id)
+					for _, column := range r.Columns {
+						values = append(values, s.Tags[column])
+					}
+
+					// Add the tag values to the row.
+					r.Values = append(r.Values, values)
+				}
 			}
-		}
+		})
 		// make the id the first column
 		r.Columns = append([]string{"_id"}, r.Columns...)
 
@@ -2658,27 +3105,14 @@ func (s *Server) filterShowSeriesResult(limit, offset int, rows influxql.Rows) i
 }
 
 func (s *Server) executeShowMeasurementsStatement(stmt *influxql.ShowMeasurementsStatement, database string, user *User) *Result {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	// Find the database.
-	db := s.databases[database]
-	if db == nil {
-		return &Result{Err: ErrDatabaseNotFound(database)}
+	measurements, scan, err := s.measurementsByCondition(database, stmt.Condition)
+	if err != nil {
+		return &Result{Err: err}
 	}
 
-	var measurements Measurements
-
-	// If a WHERE clause was specified, filter the measurements.
-	if stmt.Condition != nil {
-		var err error
-		measurements, err = db.measurementsByExpr(stmt.Condition)
-		if err != nil {
-			return &Result{Err: err}
-		}
-	} else {
-		// Otherwise, get all measurements from the database.
-		measurements = db.Measurements()
+	// Only keep measurements with data in the time range.
+	if measurements, err = scan.measurements(measurements); err != nil {
+		return &Result{Err: err}
 	}
 	sort.Sort(measurements)
 
@@ -2748,7 +3182,7 @@ func (s *Server) executeShowTagKeysStatement(stmt *influxql.ShowTagKeysStatement
 		keys := m.tagKeys()
 
 		// Convert keys to an [][]interface{}.
-		values := make([][]interface{}, 0, len(m.seriesByTagKeyValue))
+		values := make([][]interface{}, 0, len(keys))
 		for _, k := range keys {
 			v := interface{}(k)
 			values = append(values, []interface{}{v})
@@ -2770,17 +3204,7 @@ func (s *Server) executeShowTagKeysStatement(stmt *influxql.ShowTagKeysStatement
 }
 
 func (s *Server) executeShowTagValuesStatement(stmt *influxql.ShowTagValuesStatement, database string, user *User) *Result {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	// Find the database.
-	db := s.databases[database]
-	if db == nil {
-		return &Result{Err: ErrDatabaseNotFound(database)}
-	}
-
-	// Get the list of measurements we're interested in.
-	measurements, err := measurementsFromSourceOrDB(stmt.Source, db)
+	measurements, matches, scan, err := s.seriesByCondition(database, stmt.Source, stmt.Condition)
 	if err != nil {
 		return &Result{Err: err}
 	}
@@ -2791,29 +3215,30 @@ func (s *Server) executeShowTagValuesStatement(stmt *influxql.ShowTagValuesState
 	}
 
 	tagValues := make(map[string]stringSet)
-	for _, m := range measurements {
+	for i, m := range measurements {
+		// Get series IDs that match the WHERE clause.
 		var ids seriesIDs
-
-		if stmt.Condition != nil {
-			// Get series IDs that match the WHERE clause.
-			filters := map[uint64]influxql.Expr{}
-			ids, _, _, err = m.walkWhereForSeriesIds(stmt.Condition, filters)
-			if err != nil {
+		if matches != nil {
+			if ids, err = scan.seriesIDs(matches[i]); err != nil {
 				return &Result{Err: err}
 			}
 
 			// If no series matched, then go to the next measurement.
-			if len(ids) == 0 {
+			if len(ids) == 0 && stmt.Condition != nil {
 				continue
 			}
-
-			// TODO: check return of walkWhereForSeriesIds for fields
-		} else {
-			// No WHERE clause so get all series IDs for this measurement.
-			ids = m.seriesIDs
 		}
 
-		for k, v := range m.tagValuesByKeyAndSeriesID(stmt.TagKeys, ids) {
+		// Read the series and their tag values from a single view of the index.
+		var values map[string]stringSet
+		m.index(func(mi *measurementIndex) {
+			if matches == nil {
+				ids = mi.seriesIDs()
+			}
+			values = mi.tagValuesByKeyAndSeriesID(stmt.TagKeys, ids)
+		})
+
+		for k, v := range values {
 			_, ok := tagValues[k]
 			if !ok {
 				tagValues[k] = v
@@ -2866,6 +3291,18 @@ func (s *Server) executeShowStatsStatement(stmt *influxql.ShowStatsStatement, us
 	})
 	rows = append(rows, serverRow)
 
+	// Stats registered by input services and the pipeline.
+	s.mu.RLock()
+	for _, st := range s.inputStats {
+		row := &influxql.Row{Name: st.Name(), Columns: []string{}}
+		st.Walk(func(k string, v int64) {
+			row.Columns = append(row.Columns, k)
+			row.Values = append(row.Values, []interface{}{v})
+		})
+		rows = append(rows, row)
+	}
+	s.mu.RUnlock()
+
 	// Shard-level stats.
 	for _, sh := range s.shards {
 		row := &influxql.Row{Columns: []string{}}
@@ -2875,6 +3312,17 @@ func (s *Server) executeShowStatsStatement(stmt *influxql.ShowStatsStatement, us
 			row.Values = append(row.Values, []interface{}{v})
 		})
 		rows = append(rows, row)
+
+		// Engine stats of local shards.
+		if sh.engine != nil {
+			st := sh.engine.Stats()
+			row := &influxql.Row{Name: st.Name(), Columns: []string{}}
+			st.Walk(func(k string, v int64) {
+				row.Columns = append(row.Columns, k)
+				row.Values = append(row.Values, []interface{}{v})
+			})
+			rows = append(rows, row)
+		}
 	}
 
 	return &Result{Series: rows}
@@ -2906,6 +3354,129 @@ func filterMeasurementsByExpr(measurements Measurements, expr influxql.Expr) (Me
 	return filtered, nil
 }
 
+// executeShowSeriesCardinalityStatement counts the series of each measurement
+// from the series index without reading the series themselves.
+func (s *Server) executeShowSeriesCardinalityStatement(stmt *influxql.ShowSeriesCardinalityStatement, database string, user *User) *Result {
+	measurements, matches, scan, err := s.seriesByCondition(database, stmt.Source, stmt.Condition)
+	if err != nil {
+		return &Result{Err: err}
+	}
+
+	// Add one row per measurement with series to the result.
+	result := &Result{
+		Series: make(influxql.Rows, 0, len(measurements)),
+	}
+	for i, m := range measurements {
+		var n int
+		if stmt.Condition != nil {
+			// Count the series IDs that match the WHERE clause.
+			ids, err := scan.seriesIDs(matches[i])
+			if err != nil {
+				return &Result{Err: err}
+			}
+			n = len(ids)
+		} else {
+			n = m.seriesN()
+		}
+		if n == 0 {
+			continue
+		}
+
+		result.Series = append(result.Series, &influxql.Row{
+			Name:    m.Name,
+			Columns: []string{"count"},
+			Values:  [][]interface{}{{n}},
+		})
+	}
+
+	return result
+}
+
+// executeShowMeasurementCardinalityStatement counts the measurements of a database.
+func (s *Server) executeShowMeasurementCardinalityStatement(stmt *influxql.ShowMeasurementCardinalityStatement, database string, user *User) *Result {
+	measurements, scan, err := s.measurementsByCondition(database, stmt.Condition)
+	if err != nil {
+		return &Result{Err: err}
+	} else if measurements, err = scan.measurements(measurements); err != nil {
+		return &Result{Err: err}
+	}
+
+	// Only count the measurement in the FROM clause.
+	n := len(measurements)
+	if stmt.Source != nil {
+		src, ok := stmt.Source.(*influxql.Measurement)
+		if !ok {
+			return &Result{Err: errors.New("identifiers in FROM clause must be measurement names")}
+		}
+		n = 0
+		for _, m := range measurements {
+			if m.Name == src.Name {
+				n++
+			}
+		}
+	}
+
+	return &Result{
+		Series: influxql.Rows{{
+			Name:    "measurements",
+			Columns: []string{"count"},
+			Values:  [][]interface{}{{n}},
+		}},
+	}
+}
+
+// executeShowTagValuesCardinalityStatement counts the values of tag keys for each
+// measurement from the series index.
+func (s *Server) executeShowTagValuesCardinalityStatement(stmt *influxql.ShowTagValuesCardinalityStatement, database string, user *User) *Result {
+	measurements, matches, scan, err := s.seriesByCondition(database, stmt.Source, stmt.Condition)
+	if err != nil {
+		return &Result{Err: err}
+	}
+
+	// Add one row per measurement to the result with the count of each tag key.
+	result := &Result{
+		Series: make(influxql.Rows, 0, len(measurements)),
+	}
+	keys := make([]string, len(stmt.TagKeys))
+	copy(keys, stmt.TagKeys)
+	sort.Strings(keys)
+	for i, m := range measurements {
+		// Get series IDs that match the WHERE clause.
+		var ids seriesIDs
+		if stmt.Condition != nil {
+			ids, err = scan.seriesIDs(matches[i])
+			if err != nil {
+				return &Result{Err: err}
+			} else if len(ids) == 0 {
+				continue
+			}
+		}
+
+		r := &influxql.Row{
+			Name:    m.Name,
+			Columns: []string{"tagKey", "count"},
+		}
+		m.index(func(mi *measurementIndex) {
+			for _, k := range keys {
+				var n int
+				if stmt.Condition != nil {
+					n = mi.tagValueNBySeriesIDs(k, ids)
+				} else {
+					n = mi.tagValueN(k)
+				}
+				if n > 0 {
+					r.Values = append(r.Values, []interface{}{k, n})
+				}
+			}
+		})
+		if len(r.Values) > 0 {
+			result.Series = append(result.Series, r)
+		}
+	}
+
+	return result
+}
+
 func (s *Server) executeShowFieldKeysStatement(stmt *influxql.ShowFieldKeysStatement, database string, user *User) *Result {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -2934,20 +3505,21 @@ func (s *Server) executeShowFieldKeysStatement(stmt *influxql.ShowFieldKeysState
 		// Create a new row.
 		r := &influxql.Row{
 			Name:    m.Name,
-			Columns: []string{"fieldKey"},
+			Columns: []string{"fieldKey", "fieldType"},
 		}
 
 		// Get a list of field names from the measurement then sort them.
 		names := make([]string, 0, len(m.Fields))
+		types := make(map[string]influxql.DataType, len(m.Fields))
 		for _, f := range m.Fields {
 			names = append(names, f.Name)
+			types[f.Name] = f.Type
 		}
 		sort.Strings(names)
 
-		// Add the field names to the result row values.
+		// Add the field names and types to the result row values.
 		for _, n := range names {
-			v := interface{}(n)
-			r.Values = append(r.Values, []interface{}{v})
+			r.Values = append(r.Values, []interface{}{n, string(types[n])})
 		}
 
 		// Append the row to the result.
@@ -2985,7 +3557,7 @@ func measurementsFromSourceOrDB(stmt influxql.Source, db *database) (Measurement
 	} else {
 		// No measurements specified in FROM clause so get all measurements that have series.
 		for _, m := range db.Measurements() {
-			if len(m.seriesIDs) > 0 {
+			if m.seriesN() > 0 {
 				measurements = append(measurements, m)
 			}
 		}
@@ -2995,6 +3567,255 @@ func measurementsFromSourceOrDB(stmt influxql.Source, db *database) (Measurement
 	return measurements, nil
 }
 
+// splitTimeCondition separates the time range from the condition of a metadata
+// statement, replacing now() with the current time. Returns the condition on
+// tags, or nil if there is none, and zero times for missing time bounds.
+func splitTimeCondition(expr influxql.Expr) (cond influxql.Expr, tmin, tmax time.Time) {
+	if !hasTimeCondition(expr) {
+		return expr, time.Time{}, time.Time{}
+	}
+	expr = influxql.Reduce(expr, &influxql.NowValuer{Now: time.Now().UTC()})
+	tmin, tmax = influxql.TimeRange(expr)
+	return removeTimeCondition(expr), tmin, tmax
+}
+
+// hasTimeCondition returns true if an expression references time.
+func hasTimeCondition(expr influxql.Expr) (ok bool) {
+	influxql.WalkFunc(expr, func(n influxql.Node) {
+		if ref, isRef := n.(*influxql.VarRef); isRef && strings.ToLower(ref.Val) == "time" {
+			ok = true
+		}
+	})
+	return
+}
+
+// removeTimeCondition returns an expression without its comparisons on time.
+// Returns nil if only time is compared.
+func removeTimeCondition(expr influxql.Expr) influxql.Expr {
+	switch expr := expr.(type) {
+	case *influxql.BinaryExpr:
+		if expr.Op == influxql.AND || expr.Op == influxql.OR {
+			lhs, rhs := removeTimeCondition(expr.LHS), removeTimeCondition(expr.RHS)
+			if lhs == nil {
+				return rhs
+			} else if rhs == nil {
+				return lhs
+			}
+			return &influxql.BinaryExpr{Op: expr.Op, LHS: lhs, RHS: rhs}
+		} else if hasTimeCondition(expr) {
+			return nil
+		}
+	case *influxql.ParenExpr:
+		if e := removeTimeCondition(expr.Expr); e != nil {
+			return &influxql.ParenExpr{Expr: e}
+		}
+		return nil
+	}
+	return expr
+}
+
+// measurementsByCondition returns the measurements of a database matching the
+// condition on tags of a metadata statement, or all measurements if there is
+// none, and a scan of the shards covering the condition's time range. The
+// server lock is held while finding the measurements but not returned with.
+func (s *Server) measurementsByCondition(database string, expr influxql.Expr) (Measurements, *activeSeriesScan, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Find the database.
+	db := s.databases[database]
+	if db == nil {
+		return nil, nil, ErrDatabaseNotFound(database)
+	}
+
+	// If a WHERE clause was specified, filter the measurements.
+	cond, tmin, tmax := splitTimeCondition(expr)
+	if cond == nil {
+		return db.Measurements(), s.newActiveSeriesScan(db, tmin, tmax), nil
+	}
+	measurements, err := db.measurementsByExpr(cond)
+	if err != nil {
+		return nil, nil, err
+	}
+	return measurements, s.newActiveSeriesScan(db, tmin, tmax), nil
+}
+
+// seriesByCondition returns the measurements of a database named by the source
+// of a metadata statement, the ids of each measurement's series matching the
+// condition on tags and a scan of the shards covering the condition's time
+// range. No series ids are returned without a condition. The server lock is
+// held while finding the series but not while the caller scans the shards.
+func (s *Server) seriesByCondition(database string, source influxql.Source, expr influxql.Expr) (Measurements, []seriesIDs, *activeSeriesScan, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Find the database.
+	db := s.databases[database]
+	if db == nil {
+		return nil, nil, nil, ErrDatabaseNotFound(database)
+	}
+
+	// Get the list of measurements we're interested in.
+	measurements, err := measurementsFromSourceOrDB(source, db)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Separate the time range from the condition on tags.
+	if expr == nil {
+		return measurements, nil, nil, nil
+	}
+	cond, tmin, tmax := splitTimeCondition(expr)
+	matches := make([]seriesIDs, len(measurements))
+	for i, m := range measurements {
+		if matches[i], err = m.seriesIDsAllOrByExpr(cond); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return measurements, matches, s.newActiveSeriesScan(db, tmin, tmax), nil
+}
+
+// activeSeriesScan finds the series with data between tmin and tmax by reading
+// the shards of the shard groups covering the time range. The shard groups are
+// found while holding the server lock and the shards are read without it.
+type activeSeriesScan struct {
+	groups     []*ShardGroup
+	tmin, tmax time.Time
+}
+
+// newActiveSeriesScan returns a scan of the shard groups of a database covering
+// the time range between tmin and tmax, or nil if neither is set. A missing
+// upper bound means now. Server lock must be held.
+func (s *Server) newActiveSeriesScan(db *database, tmin, tmax time.Time) *activeSeriesScan {
+	if tmin.IsZero() && tmax.IsZero() {
+		return nil
+	}
+	if tmin.IsZero() {
+		tmin = time.Unix(0, 0)
+	}
+	if tmax.IsZero() {
+		tmax = time.Now().UTC()
+	}
+
+	sc := &activeSeriesScan{tmin: tmin, tmax: tmax}
+	for _, rp := range db.policies {
+		for _, g := range rp.shardGroups {
+			if g.Contains(tmin, tmax) {
+				sc.groups = append(sc.groups, g)
+			}
+		}
+	}
+	return sc
+}
+
+// seriesIDs returns the series which have data in the time range. Series of
+// shards stored on other servers can't be checked, so they are always returned
+// when their shard group is. Returns all series if the scan is nil.
+func (sc *activeSeriesScan) seriesIDs(ids seriesIDs) (seriesIDs, error) {
+	if sc == nil {
+		return ids, nil
+	}
+
+	var active seriesIDs
+	for _, g := range sc.groups {
+		a, err := groupActiveSeriesIDs(g, ids.reject(active), sc.tmin, sc.tmax)
+		if err != nil {
+			return nil, err
+		}
+		active = active.union(a)
+	}
+	return active, nil
+}
+
+// measurements returns the measurements with series which have data in the
+// time range. Returns all measurements if the scan is nil.
+func (sc *activeSeriesScan) measurements(measurements Measurements) (Measurements, error) {
+	if sc == nil {
+		return measurements, nil
+	}
+
+	var a Measurements
+	for _, m := range measurements {
+		ids, err := sc.seriesIDs(m.seriesIDs())
+		if err != nil {
+			return nil, err
+		} else if len(ids) > 0 {
+			a = append(a, m)
+		}
+	}
+	return a, nil
+}
+
+// groupActiveSeriesIDs returns the series which have data between tmin and tmax
+// in a shard group. Series of shards stored on other servers are always returned.
+func groupActiveSeriesIDs(g *ShardGroup, ids seriesIDs, tmin, tmax time.Time) (seriesIDs, error) {
+	if len(g.Shards) == 0 || len(ids) == 0 {
+		return nil, nil
+	}
+
+	// Group the series by shard.
+	byShard := make(map[*Shard][]uint64)
+	for _, id := range ids {
+		sh := g.ShardBySeriesID(id)
+		byShard[sh] = append(byShard[sh], id)
+	}
+
+	var active seriesIDs
+	for sh, shardIDs := range byShard {
+		a, err := sh.activeSeriesIDs(shardIDs, tmin.UnixNano(), tmax.UnixNano())
+		if err == ErrShardNotLocal {
+			a = shardIDs
+		} else if err != nil {
+			return nil, err
+		}
+		active = active.union(a)
+	}
+	return active, nil
+}
+
+// keptRange is a time range of a shard group whose data is kept by a drop.
+type keptRange struct {
+	g          *ShardGroup
+	tmin, tmax time.Time
+}
+
+// keptRanges returns the parts of the shard groups of a database which are kept
+// when the data between tmin and tmax of a retention policy, or of every policy
+// if the policy name is blank, is dropped. Server lock must be held.
+func keptRanges(db *database, policy string, tmin, tmax time.Time) []keptRange {
+	var a []keptRange
+	for _, rp := range db.policies {
+		for _, g := range rp.shardGroups {
+			start, end := g.StartTime, g.EndTime.Add(-1)
+			if policy != "" && rp.Name != policy {
+				a = append(a, keptRange{g, start, end})
+				continue
+			}
+			if start.Before(tmin) {
+				a = append(a, keptRange{g, start, minTime(end, tmin.Add(-1))})
+			}
+			if end.After(tmax) {
+				a = append(a, keptRange{g, maxTime(start, tmax.Add(1)), end})
+			}
+		}
+	}
+	return a
+}
+
+// unusedSeriesIDs returns the series which have no data in the kept ranges.
+// Series of shards stored on other servers are assumed to have data left.
+func unusedSeriesIDs(ranges []keptRange, ids seriesIDs) (seriesIDs, error) {
+	var used seriesIDs
+	for _, r := range ranges {
+		a, err := groupActiveSeriesIDs(r.g, ids.reject(used), r.tmin, r.tmax)
+		if err != nil {
+			return nil, err
+		}
+		used = used.union(a)
+	}
+	return ids.reject(used), nil
+}
+
 func (s *Server) executeShowUsersStatement(q *influxql.ShowUsersStatement, user *User) *Result {
 	row := &influxql.Row{Columns: []string{"user", "admin"}}
 	for _, user := range s.Users() {
@@ -3022,6 +3843,10 @@ func (s *Server) executeCreateRetentionPolicyStatement(stmt *influxql.CreateRete
 	return &Result{Err: err}
 }
 
+func (s *Server) executeAlterDatabaseStatement(stmt *influxql.AlterDatabaseStatement, user *User) *Result {
+	return &Result{Err: s.SetFieldCoercion(stmt.Name, stmt.FieldCoercion)}
+}
+
 func (s *Server) executeAlterRetentionPolicyStatement(stmt *influxql.AlterRetentionPolicyStatement, user *User) *Result {
 	rpu := &RetentionPolicyUpdate{
 		Duration: stmt.Duration,
@@ -3147,7 +3972,7 @@ func (s *Server) StartLocalMapper(rm *RemoteMapper) (*LocalMapper, error) {
 	}
 
 	// this should never be the case, but we have to be sure
-	if shard.store == nil {
+	if shard.engine == nil {
 		return nil, ErrShardNotLocal
 	}
 
@@ -3180,7 +4005,7 @@ func (s *Server) StartLocalMapper(rm *RemoteMapper) (*LocalMapper, error) {
 	lm := &LocalMapper{
 		seriesIDs:    rm.SeriesIDs,
 		job:          job,
-		db:           shard.store,
+		shard:        shard,
 		decoder:      NewFieldCodec(m),
 		filters:      rm.FilterExprs(),
 		whereFields:  rm.WhereFields,
@@ -3336,9 +4161,9 @@ func (s *Server) DiagnosticsAsRows() []*influxql.Row {
 				strings.Join(nodes, ","), strconv.FormatUint(sh.Index(), 10)})
 		}
 		// Shard may not be local to this node.
-		if sh.store != nil {
+		if sh.engine != nil {
 			shardsRow.Columns = append(shardsRow.Columns, "path")
-			shardsRow.Values[0] = append(shardsRow.Values[0], sh.store.Path())
+			shardsRow.Values[0] = append(shardsRow.Values[0], sh.path)
 		}
 	}
 
@@ -3410,6 +4235,8 @@ func (s *Server) processor(conn MessagingConn, done chan struct{}) {
 				err = s.applyDeleteShardGroup(m)
 			case setDefaultRetentionPolicyMessageType:
 				err = s.applySetDefaultRetentionPolicy(m)
+			case setFieldCoercionMessageType:
+				err = s.applySetFieldCoercion(m)
 			case createMeasurementsIfNotExistsMessageType:
 				err = s.applyCreateMeasurementsIfNotExists(m)
 			case dropMeasurementMessageType:
@@ -3422,6 +4249,8 @@ func (s *Server) processor(conn MessagingConn, done chan struct{}) {
 				err = s.applyDropContinuousQueryCommand(m)
 			case dropSeriesMessageType:
 				err = s.applyDropSeries(m)
+			case unindexSeriesMessageType:
+				err = s.applyUnindexSeries(m)
 			case writeRawSeriesMessageType:
 				panic("write series not allowed in broadcast topic")
 			}
@@ -4044,7 +4873,7 @@ func (s *Server) reportServer(clusterID uint64) {
 	numSeries, numMeasurements := 0, 0
 
 	for _, db := range s.databases {
-		numSeries += len(db.series)
+		numSeries += db.seriesN()
 		numMeasurements += len(db.measurements)
 	}
 
@@ -16,6 +16,7 @@ import (
 
 	"github.com/influxdb/influxdb"
 	"github.com/influxdb/influxdb/influxql"
+	"github.com/influxdb/influxdb/messaging"
 	"github.com/influxdb/influxdb/test"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -677,6 +678,18 @@ func TestServer_CreateRetentionPolicy_ErrRetentionPolicyExists(t *testing.T) {
 	}
 }
 
+// Ensure the server returns an error when creating a retention policy with an unknown engine.
+func TestServer_CreateRetentionPolicy_ErrEngineNotFound(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenServer(c)
+	defer s.Close()
+	s.CreateDatabase("foo")
+	if err := s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "bar", Duration: time.Hour, Engine: "no_such_engine"}); err != influxdb.ErrEngineNotFound {
+		t.Fatal(err)
+	}
+}
+
 // Ensure the server returns an error when creating a retention policy with a duration less than one hour.
 func TestServer_CreateRetentionPolicy_ErrRetentionPolicyMinDuration(t *testing.T) {
 	c := test.NewDefaultMessagingClient()
@@ -1010,6 +1023,161 @@ func TestServer_WriteAllDataTypes(t *testing.T) {
 	f(t, "foo", "SELECT * from series4", `{"series":[{"name":"series4","columns":["time","value"],"values":[["2000-01-01T00:00:00Z",true]]}]}`)
 }
 
+// Ensure the server applies its pipeline to written points and reports the rule counters.
+func TestServer_WriteSeries_Pipeline(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenServer(c)
+	defer s.Close()
+	s.CreateDatabase("foo")
+	s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "raw", Duration: 1 * time.Hour})
+	s.SetDefaultRetentionPolicy("foo", "raw")
+
+	p, err := influxdb.NewPipeline([]influxdb.Rule{
+		{Name: "fix_host", Action: influxdb.RuleRenameTag, Pattern: `^hostname$`, Value: "host"},
+		{Name: "drop_debug", Action: influxdb.RuleDropPoint, Pattern: `^debug$`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetPipeline(p)
+
+	// Points which are all dropped aren't written.
+	if index, err := s.WriteSeries("foo", "raw", []influxdb.Point{{Name: "debug", Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(1)}}}); err != nil || index != 0 {
+		t.Fatalf("unexpected write: index=%d, err=%v", index, err)
+	}
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Tags: map[string]string{"hostname": "serverA"}, Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(20)}}})
+
+	results := s.executeQuery(MustParseQuery(`SHOW SERIES`), "foo", nil)
+	if res := results.Results[0]; res.Err != nil {
+		t.Fatalf("unexpected error: %s", res.Err)
+	} else if s := mustMarshalJSON(res); s != `{"series":[{"name":"cpu","columns":["_id","host"],"values":[[1,"serverA"]]}]}` {
+		t.Fatalf("unexpected row(0): %s", s)
+	}
+
+	results = s.executeQuery(MustParseQuery(`SHOW STATS`), "", nil)
+	var found bool
+	for _, row := range results.Results[0].Series {
+		if row.Name != "pipeline" {
+			continue
+		}
+		found = true
+		stats := make(map[string]interface{})
+		for i, col := range row.Columns {
+			stats[col] = row.Values[i][0]
+		}
+		if exp := map[string]interface{}{"fix_host": int64(1), "drop_debug": int64(1), "pointsDropped": int64(1)}; !reflect.DeepEqual(stats, exp) {
+			t.Fatalf("unexpected pipeline stats: %v", stats)
+		}
+	}
+	if !found {
+		t.Fatal("pipeline stats not found")
+	}
+}
+
+// Ensure the server coerces field values according to the database's policy.
+func TestServer_WriteSeries_FieldCoercion(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenServer(c)
+	defer s.Close()
+	s.CreateDatabase("foo")
+	s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "raw", Duration: 1 * time.Hour})
+	s.SetDefaultRetentionPolicy("foo", "raw")
+
+	// Create float and integer fields.
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(1.5), "count": int64(1)}}})
+
+	// Values of another type are rejected by default.
+	if _, err := s.WriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Timestamp: mustParseTime("2000-01-01T00:00:10Z"), Fields: map[string]interface{}{"value": int64(2)}}}); err == nil {
+		t.Fatal("expected type conflict error")
+	}
+
+	// Numeric coercion converts integers to floats and whole floats to integers.
+	if err := s.SetFieldCoercion("foo", influxdb.FieldCoercionNumeric); err != nil {
+		t.Fatal(err)
+	}
+	s.Restart()
+	if policy, err := s.FieldCoercion("foo"); err != nil || policy != influxdb.FieldCoercionNumeric {
+		t.Fatalf("unexpected policy: %q, err=%v", policy, err)
+	}
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Timestamp: mustParseTime("2000-01-01T00:00:10Z"), Fields: map[string]interface{}{"value": int64(2), "count": float64(3)}}})
+	if _, err := s.WriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Timestamp: mustParseTime("2000-01-01T00:00:20Z"), Fields: map[string]interface{}{"count": float64(3.5)}}}); err == nil {
+		t.Fatal("expected type conflict error for fractional integer")
+	} else if _, err := s.WriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Timestamp: mustParseTime("2000-01-01T00:00:20Z"), Fields: map[string]interface{}{"value": "4"}}}); err == nil {
+		t.Fatal("expected type conflict error for string")
+	}
+
+	// Coercing all types converts parseable strings.
+	if err := s.SetFieldCoercion("foo", influxdb.FieldCoercionAll); err != nil {
+		t.Fatal(err)
+	}
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Timestamp: mustParseTime("2000-01-01T00:00:20Z"), Fields: map[string]interface{}{"value": "4", "count": true}}})
+	if _, err := s.WriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Timestamp: mustParseTime("2000-01-01T00:00:30Z"), Fields: map[string]interface{}{"value": "x"}}}); err == nil {
+		t.Fatal("expected type conflict error for unparseable string")
+	}
+
+	results := s.executeQuery(MustParseQuery(`SELECT value, count FROM cpu`), "foo", nil)
+	if res := results.Results[0]; res.Err != nil {
+		t.Fatalf("unexpected error: %s", res.Err)
+	} else if s := mustMarshalJSON(res); s != `{"series":[{"name":"cpu","columns":["time","value","count"],"values":[["2000-01-01T00:00:00Z",1.5,1],["2000-01-01T00:00:10Z",2,3],["2000-01-01T00:00:20Z",4,1]]}]}` {
+		t.Fatalf("unexpected row(0): %s", s)
+	}
+
+	results = s.executeQuery(MustParseQuery(`SHOW FIELD KEYS FROM cpu`), "foo", nil)
+	if res := results.Results[0]; res.Err != nil {
+		t.Fatalf("unexpected error: %s", res.Err)
+	} else if s := mustMarshalJSON(res); s != `{"series":[{"name":"cpu","columns":["fieldKey","fieldType"],"values":[["count","integer"],["value","float"]]}]}` {
+		t.Fatalf("unexpected row(0): %s", s)
+	}
+
+	// Unknown policies are rejected.
+	if err := s.SetFieldCoercion("foo", "bad"); err != influxdb.ErrInvalidFieldCoercion {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure last() queries return the latest values with the last value cache enabled.
+func TestServer_LastValueCache(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenServer(c)
+	defer s.Close()
+	s.CreateDatabase("foo")
+	s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "raw", Duration: 1 * time.Hour})
+	s.SetDefaultRetentionPolicy("foo", "raw")
+
+	verify := func(exp string) {
+		results := s.executeQuery(MustParseQuery(`SELECT last(value) FROM cpu GROUP BY *`), "foo", nil)
+		if res := results.Results[0]; res.Err != nil {
+			t.Fatalf("unexpected error: %s", res.Err)
+		} else if s := mustMarshalJSON(res); s != exp {
+			t.Fatalf("unexpected row(0): %s", s)
+		}
+	}
+
+	// Enable the cache after the first points are written.
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{
+		{Name: "cpu", Tags: map[string]string{"host": "a"}, Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(1)}},
+		{Name: "cpu", Tags: map[string]string{"host": "b"}, Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(2)}},
+	})
+	s.EnableLastValueCache("foo", "cpu")
+	verify(`{"series":[{"name":"cpu","tags":{"host":"a"},"columns":["time","last"],"values":[["1970-01-01T00:00:00Z",1]]},{"name":"cpu","tags":{"host":"b"},"columns":["time","last"],"values":[["1970-01-01T00:00:00Z",2]]}]}`)
+
+	// The latest point of host b doesn't have the queried field.
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{
+		{Name: "cpu", Tags: map[string]string{"host": "a"}, Timestamp: mustParseTime("2000-01-01T00:00:10Z"), Fields: map[string]interface{}{"value": float64(3)}},
+		{Name: "cpu", Tags: map[string]string{"host": "b"}, Timestamp: mustParseTime("2000-01-01T00:00:10Z"), Fields: map[string]interface{}{"other": float64(4)}},
+		{Name: "cpu", Tags: map[string]string{"host": "c"}, Timestamp: mustParseTime("2000-01-01T00:00:05Z"), Fields: map[string]interface{}{"value": float64(5)}},
+	})
+	exp := `{"series":[{"name":"cpu","tags":{"host":"a"},"columns":["time","last"],"values":[["1970-01-01T00:00:00Z",3]]},{"name":"cpu","tags":{"host":"b"},"columns":["time","last"],"values":[["1970-01-01T00:00:00Z",2]]},{"name":"cpu","tags":{"host":"c"},"columns":["time","last"],"values":[["1970-01-01T00:00:00Z",5]]}]}`
+	verify(exp)
+
+	// Ensure the cache is rebuilt on restart.
+	s.Restart()
+	verify(exp)
+}
+
 func TestServer_EnforceRetentionPolices(t *testing.T) {
 	c := test.NewDefaultMessagingClient()
 	s := OpenServer(c)
@@ -1194,6 +1362,397 @@ func TestServer_DropSeriesFromMeasurement(t *testing.T) {
 	}
 }
 
+// Ensure the series index is persisted and kept up to date as series are dropped.
+func TestServer_SeriesIndex_Restart(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	s := OpenServer(c)
+	defer s.Close()
+	s.CreateDatabase("foo")
+	s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "raw", Duration: 1 * time.Hour})
+	s.SetDefaultRetentionPolicy("foo", "raw")
+
+	// Write two series to the database.
+	index, err := s.WriteSeries("foo", "raw", []influxdb.Point{
+		{Name: "cpu", Tags: map[string]string{"host": "serverA", "region": "uswest"}, Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(10)}},
+		{Name: "cpu", Tags: map[string]string{"host": "serverB", "region": "uswest"}, Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(20)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Sync(index)
+
+	// Drop one series and reopen the server.
+	results := s.executeQuery(MustParseQuery(`DROP SERIES FROM cpu WHERE host = 'serverA'`), "foo", nil)
+	if results.Error() != nil {
+		t.Fatalf("unexpected error: %s", results.Error())
+	}
+	s.Restart()
+
+	// Ensure only the remaining series is found by its tags.
+	results = s.executeQuery(MustParseQuery(`SHOW SERIES WHERE region = 'uswest'`), "foo", nil)
+	if res := results.Results[0]; res.Err != nil {
+		t.Fatalf("unexpected error: %s", res.Err)
+	} else if s := mustMarshalJSON(res); s != `{"series":[{"name":"cpu","columns":["_id","host","region"],"values":[[2,"serverB","uswest"]]}]}` {
+		t.Fatalf("unexpected row(0): %s", s)
+	}
+
+	// Ensure tag values without series are removed.
+	results = s.executeQuery(MustParseQuery(`SHOW TAG VALUES FROM cpu WITH KEY = host`), "foo", nil)
+	if res := results.Results[0]; res.Err != nil {
+		t.Fatalf("unexpected error: %s", res.Err)
+	} else if s := mustMarshalJSON(res); s != `{"series":[{"name":"hostTagValues","columns":["host"],"values":[["serverB"]]}]}` {
+		t.Fatalf("unexpected row(0): %s", s)
+	}
+
+	// Ensure the series can still be queried.
+	results = s.executeQuery(MustParseQuery(`SELECT value FROM cpu WHERE host = 'serverB'`), "foo", nil)
+	if res := results.Results[0]; res.Err != nil {
+		t.Fatalf("unexpected error: %s", res.Err)
+	} else if s := mustMarshalJSON(res); s != `{"series":[{"name":"cpu","columns":["time","value"],"values":[["2000-01-01T00:00:00Z",20]]}]}` {
+		t.Fatalf("unexpected row(0): %s", s)
+	}
+}
+
+// Ensure the server drops points which would exceed the series cardinality limits.
+func TestServer_WriteSeries_SeriesLimits(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	s := OpenServer(c)
+	defer s.Close()
+	s.CreateDatabase("foo")
+	s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "raw", Duration: 1 * time.Hour})
+	s.SetDefaultRetentionPolicy("foo", "raw")
+	s.MaxSeriesPerDatabase = 3
+	s.MaxValuesPerTag = 2
+
+	point := func(host, region string) influxdb.Point {
+		return influxdb.Point{Name: "cpu", Tags: map[string]string{"host": host, "region": region}, Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(1)}}
+	}
+
+	// Write a third value of the host tag.
+	index, err := s.WriteSeries("foo", "raw", []influxdb.Point{point("serverA", "uswest"), point("serverB", "uswest"), point("serverC", "uswest")})
+	if err == nil || !strings.Contains(err.Error(), "1 points dropped: max values per tag exceeded: cpu.host (2)") {
+		t.Fatalf("unexpected error: %v", err)
+	} else if e, ok := err.(influxdb.ErrPartialWrite); !ok || !reflect.DeepEqual(e.Dropped, []influxdb.Point{point("serverC", "uswest")}) {
+		t.Fatalf("unexpected dropped points: %#v", err)
+	}
+	c.Sync(index)
+
+	// Write a fourth series to the database.
+	index, err = s.WriteSeries("foo", "raw", []influxdb.Point{point("serverA", "useast"), point("serverB", "useast")})
+	if err == nil || !strings.Contains(err.Error(), "1 points dropped: max series per database exceeded: foo (3)") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Sync(index)
+
+	// Ensure points of existing series can still be written.
+	if index, err = s.WriteSeries("foo", "raw", []influxdb.Point{point("serverA", "uswest")}); err != nil {
+		t.Fatal(err)
+	}
+	c.Sync(index)
+
+	results := s.executeQuery(MustParseQuery(`SHOW SERIES`), "foo", nil)
+	if res := results.Results[0]; res.Err != nil {
+		t.Fatalf("unexpected error: %s", res.Err)
+	} else if s := mustMarshalJSON(res); s != `{"series":[{"name":"cpu","columns":["_id","host","region"],"values":[[1,"serverA","uswest"],[2,"serverB","uswest"],[3,"serverA","useast"]]}]}` {
+		t.Fatalf("unexpected row(0): %s", s)
+	}
+}
+
+// Ensure the server can count series, measurements and tag values.
+func TestServer_ShowCardinality(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	s := OpenServer(c)
+	defer s.Close()
+	s.CreateDatabase("foo")
+	s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "raw", Duration: 1 * time.Hour})
+	s.SetDefaultRetentionPolicy("foo", "raw")
+
+	point := func(name, host, region string) influxdb.Point {
+		return influxdb.Point{Name: name, Tags: map[string]string{"host": host, "region": region}, Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(1)}}
+	}
+	index, err := s.WriteSeries("foo", "raw", []influxdb.Point{
+		point("cpu", "serverA", "uswest"),
+		point("cpu", "serverB", "uswest"),
+		point("cpu", "serverC", "useast"),
+		point("mem", "serverA", "uswest"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Sync(index)
+
+	for i, tt := range []struct {
+		query string
+		exp   string
+	}{
+		{
+			query: `SHOW SERIES CARDINALITY`,
+			exp:   `{"series":[{"name":"cpu","columns":["count"],"values":[[3]]},{"name":"mem","columns":["count"],"values":[[1]]}]}`,
+		},
+		{
+			query: `SHOW SERIES CARDINALITY FROM cpu WHERE region = 'uswest'`,
+			exp:   `{"series":[{"name":"cpu","columns":["count"],"values":[[2]]}]}`,
+		},
+		{
+			query: `SHOW MEASUREMENT CARDINALITY`,
+			exp:   `{"series":[{"name":"measurements","columns":["count"],"values":[[2]]}]}`,
+		},
+		{
+			query: `SHOW MEASUREMENT CARDINALITY WHERE region = 'useast'`,
+			exp:   `{"series":[{"name":"measurements","columns":["count"],"values":[[1]]}]}`,
+		},
+		{
+			query: `SHOW TAG VALUES CARDINALITY WITH KEY IN (region, host)`,
+			exp:   `{"series":[{"name":"cpu","columns":["tagKey","count"],"values":[["host",3],["region",2]]},{"name":"mem","columns":["tagKey","count"],"values":[["host",1],["region",1]]}]}`,
+		},
+		{
+			query: `SHOW TAG VALUES CARDINALITY FROM cpu WITH KEY = host WHERE region = 'uswest'`,
+			exp:   `{"series":[{"name":"cpu","columns":["tagKey","count"],"values":[["host",2]]}]}`,
+		},
+	} {
+		results := s.executeQuery(MustParseQuery(tt.query), "foo", nil)
+		if res := results.Results[0]; res.Err != nil {
+			t.Errorf("%d. %s: unexpected error: %s", i, tt.query, res.Err)
+		} else if s := mustMarshalJSON(res); s != tt.exp {
+			t.Errorf("%d. %s: unexpected result:\n\nexp=%s\n\ngot=%s", i, tt.query, tt.exp, s)
+		}
+	}
+}
+
+// Ensure metadata statements only return series with data in the time range of their condition.
+func TestServer_ShowMetadata_TimeCondition(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	s := OpenServer(c)
+	defer s.Close()
+	s.CreateDatabase("foo")
+	s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "raw", Duration: 1 * time.Hour})
+	s.SetDefaultRetentionPolicy("foo", "raw")
+
+	now := time.Now().UTC().Add(-time.Minute)
+	point := func(name, host string, timestamp time.Time) influxdb.Point {
+		return influxdb.Point{Name: name, Tags: map[string]string{"host": host, "region": "uswest"}, Timestamp: timestamp, Fields: map[string]interface{}{"value": float64(1)}}
+	}
+	index, err := s.WriteSeries("foo", "raw", []influxdb.Point{
+		point("cpu", "serverA", mustParseTime("2000-01-01T00:00:00Z")),
+		point("cpu", "serverB", now),
+		point("mem", "serverA", mustParseTime("2000-01-01T00:00:00Z")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Sync(index)
+
+	for i, tt := range []struct {
+		query string
+		exp   string
+	}{
+		{
+			query: `SHOW SERIES WHERE time > now() - 1d`,
+			exp:   `{"series":[{"name":"cpu","columns":["_id","host","region"],"values":[[2,"serverB","uswest"]]}]}`,
+		},
+		{
+			query: `SHOW SERIES WHERE region = 'uswest' AND time < '2000-01-02'`,
+			exp:   `{"series":[{"name":"cpu","columns":["_id","host","region"],"values":[[1,"serverA","uswest"]]},{"name":"mem","columns":["_id","host","region"],"values":[[3,"serverA","uswest"]]}]}`,
+		},
+		{
+			query: `SHOW TAG VALUES WITH KEY = host WHERE time > now() - 1d`,
+			exp:   `{"series":[{"name":"hostTagValues","columns":["host"],"values":[["serverB"]]}]}`,
+		},
+		{
+			query: `SHOW MEASUREMENTS WHERE time > now() - 1d`,
+			exp:   `{"series":[{"name":"measurements","columns":["name"],"values":[["cpu"]]}]}`,
+		},
+		{
+			query: `SHOW SERIES CARDINALITY WHERE time > now() - 1d`,
+			exp:   `{"series":[{"name":"cpu","columns":["count"],"values":[[1]]}]}`,
+		},
+	} {
+		results := s.executeQuery(MustParseQuery(tt.query), "foo", nil)
+		if res := results.Results[0]; res.Err != nil {
+			t.Errorf("%d. %s: unexpected error: %s", i, tt.query, res.Err)
+		} else if s := mustMarshalJSON(res); s != tt.exp {
+			t.Errorf("%d. %s: unexpected result:\n\nexp=%s\n\ngot=%s", i, tt.query, tt.exp, s)
+		}
+	}
+}
+
+// Ensure the server can drop the data of series in a time range and only removes series without data from the index.
+func TestServer_DropSeries_TimeRange(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	s := OpenServer(c)
+	defer s.Close()
+	s.CreateDatabase("foo")
+	s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "raw", Duration: 1 * time.Hour})
+	s.SetDefaultRetentionPolicy("foo", "raw")
+
+	point := func(host, timestamp string) influxdb.Point {
+		return influxdb.Point{Name: "cpu", Tags: map[string]string{"host": host}, Timestamp: mustParseTime(timestamp), Fields: map[string]interface{}{"value": float64(1)}}
+	}
+	index, err := s.WriteSeries("foo", "raw", []influxdb.Point{
+		point("serverA", "2000-01-01T00:00:00Z"),
+		point("serverA", "2000-01-01T00:10:00Z"),
+		point("serverA", "2000-01-03T00:00:00Z"),
+		point("serverB", "2000-01-01T00:00:00Z"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Sync(index)
+
+	for i, tt := range []struct {
+		query string
+		exp   string
+	}{
+		{
+			query: `DROP SERIES FROM cpu WHERE host = 'serverA' AND time < '2000-01-01T00:05:00Z'`,
+			exp:   `{}`,
+		},
+		{
+			query: `SELECT value FROM cpu WHERE host = 'serverA'`,
+			exp:   `{"series":[{"name":"cpu","columns":["time","value"],"values":[["2000-01-01T00:10:00Z",1],["2000-01-03T00:00:00Z",1]]}]}`,
+		},
+		{
+			query: `DROP SERIES FROM cpu WHERE host = 'serverA' AND time < '2000-01-02T00:00:00Z'`,
+			exp:   `{}`,
+		},
+		{
+			query: `SHOW SERIES`,
+			exp:   `{"series":[{"name":"cpu","columns":["_id","host"],"values":[[1,"serverA"],[2,"serverB"]]}]}`,
+		},
+		{
+			query: `DROP SERIES FROM cpu WHERE host = 'serverA' AND time <= '2000-01-03T00:00:00Z'`,
+			exp:   `{}`,
+		},
+		{
+			query: `SHOW SERIES`,
+			exp:   `{"series":[{"name":"cpu","columns":["_id","host"],"values":[[2,"serverB"]]}]}`,
+		},
+		{
+			query: `SELECT value FROM cpu`,
+			exp:   `{"series":[{"name":"cpu","columns":["time","value"],"values":[["2000-01-01T00:00:00Z",1]]}]}`,
+		},
+	} {
+		results := s.executeQuery(MustParseQuery(tt.query), "foo", nil)
+		if res := results.Results[0]; res.Err != nil {
+			t.Fatalf("%d. %s: unexpected error: %s", i, tt.query, res.Err)
+		} else if s := mustMarshalJSON(res); s != tt.exp {
+			t.Fatalf("%d. %s: unexpected result:\n\nexp=%s\n\ngot=%s", i, tt.query, tt.exp, s)
+		}
+	}
+}
+
+// Ensure a time range drop keeps series in the index which are written to while their data is deleted.
+func TestServer_DropSeries_TimeRange_ConcurrentWrite(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	s := OpenServer(c)
+	defer s.Close()
+	s.CreateDatabase("foo")
+	s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "raw", Duration: 1 * time.Hour})
+	s.SetDefaultRetentionPolicy("foo", "raw")
+
+	point := func(timestamp string) influxdb.Point {
+		return influxdb.Point{Name: "cpu", Tags: map[string]string{"host": "serverA"}, Timestamp: mustParseTime(timestamp), Fields: map[string]interface{}{"value": float64(1)}}
+	}
+	index, err := s.WriteSeries("foo", "raw", []influxdb.Point{point("2000-01-01T00:00:00Z")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Sync(index)
+
+	// Write a point outside the dropped range before the drop is published.
+	c.PublishFunc = func(m *messaging.Message) (uint64, error) {
+		c.PublishFunc = c.DefaultPublishFunc
+		index, err := s.WriteSeries("foo", "raw", []influxdb.Point{point("2000-01-01T00:10:00Z")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Sync(index)
+		return c.DefaultPublishFunc(m)
+	}
+
+	for i, tt := range []struct {
+		query string
+		exp   string
+	}{
+		{
+			query: `DROP SERIES FROM cpu WHERE time < '2000-01-01T00:05:00Z'`,
+			exp:   `{}`,
+		},
+		{
+			query: `SHOW SERIES`,
+			exp:   `{"series":[{"name":"cpu","columns":["_id","host"],"values":[[1,"serverA"]]}]}`,
+		},
+		{
+			query: `SELECT value FROM cpu`,
+			exp:   `{"series":[{"name":"cpu","columns":["time","value"],"values":[["2000-01-01T00:10:00Z",1]]}]}`,
+		},
+	} {
+		results := s.executeQuery(MustParseQuery(tt.query), "foo", nil)
+		if res := results.Results[0]; res.Err != nil {
+			t.Fatalf("%d. %s: unexpected error: %s", i, tt.query, res.Err)
+		} else if s := mustMarshalJSON(res); s != tt.exp {
+			t.Fatalf("%d. %s: unexpected result:\n\nexp=%s\n\ngot=%s", i, tt.query, tt.exp, s)
+		}
+	}
+}
+
+// Ensure the server can drop the data of a measurement from a single retention policy.
+func TestServer_DropMeasurement_RetentionPolicy(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	s := OpenServer(c)
+	defer s.Close()
+	s.CreateDatabase("foo")
+	s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "raw", Duration: 1 * time.Hour})
+	s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "archive", Duration: 24 * time.Hour})
+	s.SetDefaultRetentionPolicy("foo", "raw")
+
+	points := []influxdb.Point{{Name: "cpu", Tags: map[string]string{"host": "serverA"}, Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(1)}}}
+	for _, rp := range []string{"raw", "archive"} {
+		index, err := s.WriteSeries("foo", rp, points)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Sync(index)
+	}
+
+	for i, tt := range []struct {
+		query string
+		exp   string
+	}{
+		{
+			query: `DROP MEASUREMENT cpu ON raw`,
+			exp:   `{}`,
+		},
+		{
+			query: `SELECT value FROM "foo"."raw".cpu`,
+			exp:   `{"series":[{"name":"cpu","columns":["time","value"]}]}`,
+		},
+		{
+			query: `SELECT value FROM "foo"."archive".cpu`,
+			exp:   `{"series":[{"name":"cpu","columns":["time","value"],"values":[["2000-01-01T00:00:00Z",1]]}]}`,
+		},
+		{
+			query: `SHOW MEASUREMENTS`,
+			exp:   `{"series":[{"name":"measurements","columns":["name"],"values":[["cpu"]]}]}`,
+		},
+		{
+			query: `DROP MEASUREMENT cpu ON archive`,
+			exp:   `{}`,
+		},
+		{
+			query: `SHOW MEASUREMENTS`,
+			exp:   `{}`,
+		},
+	} {
+		results := s.executeQuery(MustParseQuery(tt.query), "foo", nil)
+		if res := results.Results[0]; res.Err != nil {
+			t.Fatalf("%d. %s: unexpected error: %s", i, tt.query, res.Err)
+		} else if s := mustMarshalJSON(res); s != tt.exp {
+			t.Fatalf("%d. %s: unexpected result:\n\nexp=%s\n\ngot=%s", i, tt.query, tt.exp, s)
+		}
+	}
+}
+
 // Ensure Drop Series can:
 // write to measurement cpu with tags region=uswest host=serverA
 // write to measurement cpu with tags region=uswest host=serverB
@@ -1364,6 +1923,115 @@ func TestServer_CreateShardGroupIfNotExist(t *testing.T) {
 	}
 }
 
+// Ensure new shards use the engine of their retention policy.
+func TestServer_CreateShardGroupIfNotExist_Engine(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenServer(c)
+	defer s.Close()
+	s.CreateDatabase("foo")
+
+	if err := s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "bar", Duration: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Set the engine and ensure an unknown engine is rejected.
+	engine := "bolt"
+	if err := s.UpdateRetentionPolicy("foo", "bar", &influxdb.RetentionPolicyUpdate{Engine: &engine}); err != nil {
+		t.Fatal(err)
+	}
+	other := "no_such_engine"
+	if err := s.UpdateRetentionPolicy("foo", "bar", &influxdb.RetentionPolicyUpdate{Engine: &other}); err != influxdb.ErrEngineNotFound {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := s.CreateShardGroupIfNotExists("foo", "bar", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restart the server to ensure the engine is persisted.
+	s.Restart()
+
+	if rp, err := s.RetentionPolicy("foo", "bar"); err != nil {
+		t.Fatal(err)
+	} else if rp.Engine != "bolt" {
+		t.Fatalf("unexpected retention policy engine: %q", rp.Engine)
+	}
+	if a, err := s.ShardGroups("foo"); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0].Shards[0].Engine != "bolt" {
+		t.Fatalf("unexpected shard groups: %#v", a)
+	}
+}
+
+// Ensure shards are moved to the cold tier once their group is old enough.
+func TestServer_MoveColdShards(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenServer(c)
+	defer s.Close()
+	s.CreateDatabase("foo")
+
+	coldPath := tempfile()
+	defer os.RemoveAll(coldPath)
+	if err := s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "raw"}); err != nil {
+		t.Fatal(err)
+	}
+	s.SetDefaultRetentionPolicy("foo", "raw")
+	s.EnableColdTier("foo", "raw", time.Hour, coldPath)
+
+	// Write a point to an old shard group and to the current one.
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(1)}}})
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Timestamp: time.Now(), Fields: map[string]interface{}{"value": float64(2)}}})
+
+	tiers := func() []string {
+		results := s.executeQuery(MustParseQuery(`SHOW SHARDS`), "", nil)
+		if res := results.Results[0]; res.Err != nil {
+			t.Fatalf("unexpected error: %s", res.Err)
+		} else if len(res.Series) != 1 {
+			t.Fatalf("unexpected row count: %d", len(res.Series))
+		}
+		var a []string
+		for _, v := range results.Results[0].Series[0].Values {
+			a = append(a, v[5].(string))
+		}
+		return a
+	}
+	verify := func() {
+		results := s.executeQuery(MustParseQuery(`SELECT sum(value) FROM cpu`), "foo", nil)
+		if res := results.Results[0]; res.Err != nil {
+			t.Fatalf("unexpected error: %s", res.Err)
+		} else if s := mustMarshalJSON(res); s != `{"series":[{"name":"cpu","columns":["time","sum"],"values":[["1970-01-01T00:00:00Z",3]]}]}` {
+			t.Fatalf("unexpected row(0): %s", s)
+		}
+	}
+
+	s.MoveColdShards()
+	if a := tiers(); !reflect.DeepEqual(a, []string{"cold", "hot"}) {
+		t.Fatalf("unexpected tiers: %v", a)
+	}
+	verify()
+
+	// Ensure the shard is opened from the cold tier on restart, even after the
+	// tier is moved to another directory.
+	s.EnableColdTier("foo", "raw", time.Hour, tempfile())
+	s.Restart()
+	if a := tiers(); !reflect.DeepEqual(a, []string{"cold", "hot"}) {
+		t.Fatalf("unexpected tiers after restart: %v", a)
+	}
+	verify()
+
+	// Ensure the server doesn't open if a moved shard is missing.
+	path := s.Path()
+	if err := s.Server.Close(); err != nil {
+		t.Fatal(err)
+	} else if err := os.RemoveAll(coldPath); err != nil {
+		t.Fatal(err)
+	} else if err := s.Server.Open(path, c); err == nil || !strings.Contains(err.Error(), "cannot open moved shard store") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func TestServer_DeleteShardGroup(t *testing.T) {
 	c := test.NewDefaultMessagingClient()
 	defer c.Close()
@@ -1785,7 +2453,7 @@ func TestServer_CreateSnapshotWriter(t *testing.T) {
 	// They are tracked here so that we can see when they change over time.
 	if len(sw.Snapshot.Files) != 2 {
 		t.Fatalf("unexpected file count: %d", len(sw.Snapshot.Files))
-	} else if !reflect.DeepEqual(sw.Snapshot.Files[0], influxdb.SnapshotFile{Name: "meta", Size: 45056, Index: 6}) {
+	} else if !reflect.DeepEqual(sw.Snapshot.Files[0], influxdb.SnapshotFile{Name: "meta", Size: 57344, Index: 6}) {
 		t.Fatalf("unexpected file(0): %#v", sw.Snapshot.Files[0])
 	} else if !reflect.DeepEqual(sw.Snapshot.Files[1], influxdb.SnapshotFile{Name: "shards/1", Size: 24576, Index: index}) {
 		t.Fatalf("unexpected file(1): %#v", sw.Snapshot.Files[1])
@@ -7,7 +7,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/boltdb/bolt"
 	"github.com/influxdb/influxdb/messaging"
 )
 
@@ -55,17 +54,46 @@ func (g *ShardGroup) dropSeries(seriesIDs ...uint64) error {
 	return nil
 }
 
+// deleteRange removes the data of the series with timestamps between min and
+// max, inclusive. Series are dropped entirely if the range covers the group.
+func (g *ShardGroup) deleteRange(seriesIDs []uint64, min, max time.Time) error {
+	if !min.After(g.StartTime) && !max.Before(g.EndTime.Add(-1)) {
+		return g.dropSeries(seriesIDs...)
+	}
+	for _, s := range g.Shards {
+		if err := s.deleteRange(seriesIDs, min.UnixNano(), max.UnixNano()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Shard represents the logical storage for a given time range.
-// The instance on a local server may contain the raw data in "store" if the
+// The instance on a local server may contain the raw data in "engine" if the
 // shard is assigned to the server's data node id.
 type Shard struct {
 	ID          uint64   `json:"id,omitempty"`
 	DataNodeIDs []uint64 `json:"nodeIDs,omitempty"` // owners
+	Engine      string   `json:"engine,omitempty"`  // storage engine name
+
+	mu     sync.RWMutex
+	index  uint64        // highest replicated index
+	path   string        // path of the engine's data
+	cold   bool          // stored in the cold tier
+	engine Engine        // underlying data store
+	cache  *shardCache   // points not yet committed to the engine
+	conn   MessagingConn // streaming connection to broker
 
-	mu    sync.RWMutex
-	index uint64        // highest replicated index
-	store *bolt.DB      // underlying data store
-	conn  MessagingConn // streaming connection to broker
+	cacheMaxSize       int           // cache size which triggers a commit
+	cacheFlushInterval time.Duration // longest time between commits
+
+	compactMu    sync.Mutex // held while compacting or closing
+	lastModified time.Time  // time of the last write or delete
+	compacted    bool       // compacted since the last modification
+
+	lastMu     sync.RWMutex
+	last       map[uint64]SeriesValue // latest value of tracked series
+	lastSeries *seriesIDSet           // series whose latest value is tracked
 
 	stats *Stats // In-memory stats
 
@@ -78,61 +106,74 @@ func newShard() *Shard { return &Shard{} }
 
 // open initializes and opens the shard's store.
 func (s *Shard) open(path string, conn MessagingConn) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	// Return an error if the shard is already open.
-	if s.store != nil {
+	s.mu.Lock()
+	if s.engine != nil {
+		s.mu.Unlock()
 		return errors.New("shard already open")
 	}
-
 	if s.stats == nil {
 		s.stats = NewStats("shard")
 	}
+	s.mu.Unlock()
 
-	// Open store on shard.
-	store, err := bolt.Open(path, 0666, &bolt.Options{Timeout: 1 * time.Second})
+	// Open engine on shard.
+	engine, err := NewEngine(s.Engine)
 	if err != nil {
-		return err
+		return fmt.Errorf("engine: name=%s, err=%s", s.Engine, err)
+	}
+	if err := engine.Open(path); err != nil {
+		return fmt.Errorf("init: %s", err)
 	}
-	s.store = store
 
-	// Initialize store.
-	if err := s.store.Update(func(tx *bolt.Tx) error {
-		_, _ = tx.CreateBucketIfNotExists([]byte("meta"))
-		_, _ = tx.CreateBucketIfNotExists([]byte("values"))
+	// Find highest committed index.
+	index := engine.Index()
 
-		// Find highest replicated index.
-		s.index = shardMetaIndex(tx)
+	// Rebuild the cache from the messages received since the last commit.
+	cache, err := openShardCache(path + ".cache")
+	if err != nil {
+		_ = engine.Close()
+		return fmt.Errorf("init: open cache: %s", err)
+	}
+	if err := cache.replay(index); err != nil {
+		_ = cache.close()
+		_ = engine.Close()
+		return fmt.Errorf("init: replay cache: %s", err)
+	}
+	if cache.index > index {
+		index = cache.index
+	}
 
-		// Open connection.
-		if err := conn.Open(s.index, true); err != nil {
-			return fmt.Errorf("open shard conn: id=%d, idx=%d, err=%s", s.ID, s.index, err)
+	s.mu.Lock()
+	s.engine, s.cache, s.path, s.index = engine, cache, path, index
+	s.last = make(map[uint64]SeriesValue)
+	s.mu.Unlock()
+
+	// Find the latest values of tracked series.
+	if s.lastSeries != nil {
+		if err := s.loadLastValues(s.lastSeries.slice()); err != nil {
+			_ = s.close()
+			return fmt.Errorf("init: load last values: %s", err)
 		}
+	}
 
-		return nil
-	}); err != nil {
+	// Open connection.
+	if err := conn.Open(index, true); err != nil {
 		_ = s.close()
-		return fmt.Errorf("init: %s", err)
+		return fmt.Errorf("init: open shard conn: id=%d, idx=%d, err=%s", s.ID, index, err)
 	}
 
 	// Start importing from connection.
+	s.mu.Lock()
+	s.lastModified = time.Now()
 	s.closing = make(chan struct{})
 	s.wg.Add(1)
 	go s.processor(conn, s.closing)
+	s.mu.Unlock()
 
 	return nil
 }
 
-// shardMetaIndex returns the index from the "meta" bucket on a transaction.
-func shardMetaIndex(tx *bolt.Tx) uint64 {
-	var index uint64
-	if buf := tx.Bucket([]byte("meta")).Get([]byte("index")); len(buf) > 0 {
-		index = btou64(buf)
-	}
-	return index
-}
-
 // Index returns the highest Raft index processed by this shard. Shard RLock
 // held during execution.
 func (s *Shard) Index() uint64 {
@@ -143,6 +184,9 @@ func (s *Shard) Index() uint64 {
 
 // close shuts down the shard's store.
 func (s *Shard) close() error {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
 	// Wait for goroutines to stop.
 	if s.closing != nil {
 		close(s.closing)
@@ -151,8 +195,20 @@ func (s *Shard) close() error {
 
 	s.wg.Wait()
 
-	if s.store != nil {
-		_ = s.store.Close()
+	// Commit cached points, then detach the store so readers find the shard
+	// isn't local before it is closed.
+	_ = s.flush()
+
+	s.mu.Lock()
+	engine, cache := s.engine, s.cache
+	s.engine, s.cache = nil, nil
+	s.mu.Unlock()
+
+	if cache != nil {
+		_ = cache.close()
+	}
+	if engine != nil {
+		_ = engine.Close()
 	}
 	return nil
 }
@@ -185,83 +241,247 @@ func (s *Shard) HasDataNodeID(id uint64) bool {
 
 // readSeries reads encoded series data from a shard.
 func (s *Shard) readSeries(seriesID uint64, timestamp int64) (values []byte, err error) {
-	err = s.store.View(func(tx *bolt.Tx) error {
-		// Find series bucket.
-		b := tx.Bucket(u64tob(seriesID))
-		if b == nil {
-			return nil
-		}
+	cursors, tx, err := s.cursors([]uint64{seriesID})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
 
-		// Retrieve encoded series data.
-		values = b.Get(u64tob(uint64(timestamp)))
-		return nil
-	})
+	// Retrieve encoded series data at the timestamp.
+	if c := cursors[0]; c != nil {
+		if k, v := c.Seek(u64tob(uint64(timestamp))); k != nil && int64(btou64(k)) == timestamp {
+			values = v
+		}
+		err = c.Err()
+	}
 	return
 }
 
-// writeSeries writes series batch to a shard.
+// cursors returns a cursor over the stored and cached values of each series,
+// or nil if the series has no values, and the engine transaction they read
+// from. The transaction must be rolled back once the cursors are not used.
+// Returns ErrShardNotLocal if the shard is closed.
+func (s *Shard) cursors(seriesIDs []uint64) ([]EngineCursor, EngineTx, error) {
+	s.mu.RLock()
+	engine, cache := s.engine, s.cache
+	s.mu.RUnlock()
+	if engine == nil {
+		return nil, nil, ErrShardNotLocal
+	}
+
+	// Copy the cached values before reading from the engine since a commit in
+	// between only moves values from the cache into the engine.
+	values := make([][]SeriesValue, len(seriesIDs))
+	for i, id := range seriesIDs {
+		values[i] = cache.seriesValues(id)
+	}
+
+	tx, err := engine.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cursors := make([]EngineCursor, len(seriesIDs))
+	for i, id := range seriesIDs {
+		c := tx.Cursor(id)
+		if len(values[i]) > 0 {
+			cursors[i] = newCacheCursor(c, values[i])
+		} else if c != nil {
+			cursors[i] = c
+		}
+	}
+	return cursors, tx, nil
+}
+
+// activeSeriesIDs returns the ids of the series which have values with
+// timestamps between min and max, inclusive.
+func (s *Shard) activeSeriesIDs(seriesIDs []uint64, min, max int64) ([]uint64, error) {
+	cursors, tx, err := s.cursors(seriesIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var ids []uint64
+	for i, c := range cursors {
+		if c == nil {
+			continue
+		}
+		if k, _ := c.Seek(u64tob(uint64(min))); k != nil && int64(btou64(k)) <= max {
+			ids = append(ids, seriesIDs[i])
+		} else if err := c.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// writeSeries appends a series batch to the shard's cache.
 func (s *Shard) writeSeries(index uint64, batch []byte) error {
-	return s.store.Update(func(tx *bolt.Tx) error {
-		for {
-			if pointHeaderSize > len(batch) {
-				return ErrInvalidPointBuffer
-			}
-			seriesID, payloadLength, timestamp := unmarshalPointHeader(batch[:pointHeaderSize])
-			batch = batch[pointHeaderSize:]
+	values, err := unmarshalSeriesBatch(batch)
+	if err != nil {
+		return err
+	}
+	if err := s.cache.append(index, batch, values); err != nil {
+		return err
+	}
+	s.updateLastValues(values)
+	return nil
+}
 
-			if payloadLength > uint32(len(batch)) {
-				return ErrInvalidPointBuffer
-			}
-			data := batch[:payloadLength]
+// flush commits the cached points to the engine, if the shard is open.
+func (s *Shard) flush() error {
+	s.mu.RLock()
+	engine, cache := s.engine, s.cache
+	s.mu.RUnlock()
+	if engine == nil {
+		return nil
+	}
 
-			// Create a bucket for the series.
-			b, err := tx.CreateBucketIfNotExists(u64tob(seriesID))
-			if err != nil {
-				return err
-			}
+	n, err := cache.commit(engine)
+	if err != nil {
+		return err
+	} else if n > 0 {
+		s.stats.Inc("cacheCommit")
+		s.stats.Add("cacheCommitPoints", int64(n))
+	}
+	return nil
+}
 
-			// Insert the values by timestamp.
-			if err := b.Put(u64tob(uint64(timestamp)), data); err != nil {
-				return err
-			}
-			s.stats.Add("shardBytes", int64(len(data))+8) // Payload plus timestamp
-			s.stats.Inc("shardWrite")
+// isCold returns true if the shard is local and has not been written to or
+// compacted within d.
+func (s *Shard) isCold(d time.Duration) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.engine != nil && !s.compacted && time.Since(s.lastModified) >= d
+}
 
-			// Push the buffer forward and check if we're done.
-			batch = batch[payloadLength:]
-			if len(batch) == 0 {
-				break
-			}
+// compact rewrites the shard's store to reclaim space, if its engine supports
+// compaction. Returns the number of bytes reclaimed.
+func (s *Shard) compact(recompress bool) (int64, error) {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	// Ignore shards which are closed.
+	if s.closing == nil {
+		return 0, nil
+	}
+	c, ok := s.engine.(EngineCompactor)
+	if !ok {
+		return 0, nil
+	}
+
+	// Commit cached points so they're compacted too.
+	if err := s.flush(); err != nil {
+		return 0, err
+	}
+	n, err := c.Compact(recompress)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	s.compacted = true
+	s.mu.Unlock()
+
+	s.stats.Inc("compactions")
+	s.stats.Add("compactBytesReclaimed", n)
+	return n, nil
+}
+
+// unmarshalSeriesBatch groups the points of a series batch by series.
+func unmarshalSeriesBatch(batch []byte) (map[uint64][]SeriesValue, error) {
+	values := make(map[uint64][]SeriesValue)
+	for {
+		if pointHeaderSize > len(batch) {
+			return nil, ErrInvalidPointBuffer
 		}
+		seriesID, payloadLength, timestamp := unmarshalPointHeader(batch[:pointHeaderSize])
+		batch = batch[pointHeaderSize:]
 
-		// Set index.
-		if err := tx.Bucket([]byte("meta")).Put([]byte("index"), u64tob(index)); err != nil {
-			return fmt.Errorf("write shard index: %s", err)
+		if payloadLength > uint32(len(batch)) {
+			return nil, ErrInvalidPointBuffer
 		}
+		data := batch[:payloadLength]
 
-		return nil
-	})
+		values[seriesID] = append(values[seriesID], SeriesValue{Timestamp: timestamp, Data: data})
+
+		// Push the buffer forward and check if we're done.
+		batch = batch[payloadLength:]
+		if len(batch) == 0 {
+			break
+		}
+	}
+	return values, nil
 }
 
+// dropSeries deletes all data of the series from the shard's engine.
 func (s *Shard) dropSeries(seriesIDs ...uint64) error {
-	if s.store == nil {
+	if s.engine == nil {
 		return nil
 	}
-	return s.store.Update(func(tx *bolt.Tx) error {
-		for _, seriesID := range seriesIDs {
-			err := tx.DeleteBucket(u64tob(seriesID))
-			if err != bolt.ErrBucketNotFound {
-				return err
-			}
+	s.dropLastValues(seriesIDs...)
+
+	s.mu.Lock()
+	s.lastModified, s.compacted = time.Now(), false
+	s.mu.Unlock()
+
+	// Commit the cache first so dropped points aren't restored from its log.
+	if err := s.flush(); err != nil {
+		return err
+	}
+	return s.engine.DeleteSeries(seriesIDs...)
+}
+
+// deleteRange removes the values of the series with timestamps between min and
+// max, inclusive. Cached last values of the series are reloaded.
+func (s *Shard) deleteRange(seriesIDs []uint64, min, max int64) error {
+	if s.engine == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	s.lastModified, s.compacted = time.Now(), false
+	s.mu.Unlock()
+
+	// Commit the cache first so deleted points aren't restored from its log.
+	if err := s.flush(); err != nil {
+		return err
+	} else if err := s.engine.DeleteRange(seriesIDs, min, max); err != nil {
+		return err
+	}
+
+	// Reload the last values which may have been deleted.
+	var cached []uint64
+	for i, v := range s.lastValues(seriesIDs) {
+		if v != nil {
+			cached = append(cached, seriesIDs[i])
 		}
+	}
+	if len(cached) == 0 {
 		return nil
-	})
+	}
+	s.dropLastValues(cached...)
+	return s.loadLastValues(cached)
 }
 
 // processor runs in a separate goroutine and processes all incoming broker messages.
+// Messages are acknowledged once they are in the cache log and the cache is
+// committed to the engine when it grows too large or on an interval.
 func (s *Shard) processor(conn MessagingConn, closing <-chan struct{}) {
 	defer s.wg.Done()
 
+	interval := s.cacheFlushInterval
+	if interval <= 0 {
+		interval = DefaultShardCacheFlushInterval
+	}
+	maxSize := s.cacheMaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultShardCacheMaxSize
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
 	for {
 		// Read incoming message.
 		// Exit if the connection has been closed or if shard is closing.
@@ -272,33 +492,69 @@ func (s *Shard) processor(conn MessagingConn, closing <-chan struct{}) {
 			if !ok {
 				return
 			}
+		case <-ticker.C:
+			if err := s.flush(); err != nil {
+				panic(fmt.Errorf("commit shard: id=%d, err=%s", s.ID, err))
+			}
+			continue
 		case <-closing:
 			return
 		}
 
+		// Read any other pending messages so they share a log sync.
+		messages := []*messaging.Message{m}
+	loop:
+		for len(messages) < shardCacheBatchN {
+			select {
+			case m, ok := <-conn.C():
+				if !ok {
+					break loop
+				}
+				messages = append(messages, m)
+			default:
+				break loop
+			}
+		}
+
 		// Ignore any writes that are from an old index.
 		s.mu.RLock()
-		i := s.index
+		index := s.index
 		s.mu.RUnlock()
-		if m.Index < i {
-			continue
-		}
 
-		// Handle write series separately so we don't lock server during shard writes.
-		switch m.Type {
-		case writeRawSeriesMessageType:
-			s.stats.Inc("writeSeriesMessageRx")
-			if err := s.writeSeries(m.Index, m.Data); err != nil {
-				panic(fmt.Errorf("apply shard: id=%d, idx=%d, err=%s", s.ID, m.Index, err))
+		for _, m := range messages {
+			if m.Index < index {
+				continue
+			}
+
+			// Handle write series separately so we don't lock server during shard writes.
+			switch m.Type {
+			case writeRawSeriesMessageType:
+				s.stats.Inc("writeSeriesMessageRx")
+				if err := s.writeSeries(m.Index, m.Data); err != nil {
+					panic(fmt.Errorf("apply shard: id=%d, idx=%d, err=%s", s.ID, m.Index, err))
+				}
+			default:
+				panic(fmt.Sprintf("invalid shard message type: %d", m.Type))
 			}
-		default:
-			panic(fmt.Sprintf("invalid shard message type: %d", m.Type))
+			index = m.Index
+		}
+
+		if err := s.cache.sync(); err != nil {
+			panic(fmt.Errorf("sync shard cache: id=%d, err=%s", s.ID, err))
 		}
 
 		// Track last index.
 		s.mu.Lock()
-		s.index = m.Index
+		s.index = index
+		s.lastModified, s.compacted = time.Now(), false
 		s.mu.Unlock()
+
+		// Commit the cache once it's full.
+		if s.cache.Size() >= maxSize {
+			if err := s.flush(); err != nil {
+				panic(fmt.Errorf("commit shard: id=%d, idx=%d, err=%s", s.ID, index, err))
+			}
+		}
 	}
 }
 
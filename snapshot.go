@@ -593,23 +593,26 @@ func createMetaSnapshotFile(meta *metastore) (*SnapshotFile, SnapshotFileWriter,
 
 func createShardSnapshotFile(sh *Shard) (*SnapshotFile, SnapshotFileWriter, error) {
 	// Ignore shard if it's not owned by the server.
-	if sh.store == nil {
+	if sh.engine == nil {
 		return nil, nil, nil
 	}
 
-	// Begin transaction.
-	tx, err := sh.store.Begin(false)
+	// Commit cached points and snapshot the engine.
+	if err := sh.flush(); err != nil {
+		return nil, nil, fmt.Errorf("commit shard: %s", err)
+	}
+	size, index, w, err := sh.engine.Snapshot()
 	if err != nil {
-		return nil, nil, fmt.Errorf("begin: %s", err)
+		return nil, nil, err
 	}
 
 	// Create and return file and writer.
 	f := &SnapshotFile{
-		Name:  path.Join("shards", filepath.Base(sh.store.Path())),
-		Size:  tx.Size(),
-		Index: shardMetaIndex(tx),
+		Name:  path.Join("shards", filepath.Base(sh.path)),
+		Size:  size,
+		Index: index,
 	}
-	return f, &boltTxCloser{tx}, nil
+	return f, w, nil
 }
 
 // SnapshotFileWriter is the interface used for writing a file to a snapshot.
@@ -62,11 +62,14 @@ func (s *Stats) Inc(key string) {
 	s.Add(key, 1)
 }
 
-// Get returns a value for a given key.
+// Get returns a value for a given key, or zero if the key has not been set.
 func (s *Stats) Get(key string) int64 {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.m[key].i
+	if i, ok := s.m[key]; ok {
+		return i.i
+	}
+	return 0
 }
 
 // Set sets a value for the given key.
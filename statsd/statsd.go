@@ -0,0 +1,476 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdb/influxdb"
+	"github.com/influxdb/influxdb/graphite"
+)
+
+const (
+	// DefaultPort is the default StatsD port.
+	DefaultPort = 8125
+
+	// DefaultFlushInterval is the default time between writes of aggregated metrics.
+	DefaultFlushInterval = 10 * time.Second
+
+	udpBufferSize = 65536
+)
+
+// DefaultPercentiles are the timer percentiles computed if none are set.
+var DefaultPercentiles = []float64{90}
+
+var (
+	// ErrBindAddressRequired is returned when starting the Server
+	// without a listening address.
+	ErrBindAddressRequired = errors.New("bind address required")
+
+	// ErrDatabaseRequired is returned when starting the Server
+	// without a target database.
+	ErrDatabaseRequired = errors.New("database was not specified in config")
+
+	// ErrServerClosed is returned when closing an already closed Server.
+	ErrServerClosed = errors.New("server already closed")
+)
+
+// SeriesWriter defines the interface for the destination of the data.
+type SeriesWriter interface {
+	WriteSeries(database, retentionPolicy string, points []influxdb.Point) (uint64, error)
+}
+
+// Metric types.
+const (
+	typeCounter = "c"
+	typeGauge   = "g"
+	typeTimer   = "ms"
+	typeHisto   = "h"
+	typeSet     = "s"
+)
+
+// Metric is a single StatsD sample, such as "api.requests:1|c|@0.1".
+type Metric struct {
+	Bucket     string
+	Value      float64
+	Text       string  // raw value, used by sets
+	Type       string  // "c", "g", "ms", "h" or "s"
+	SampleRate float64 // between 0 and 1
+	Delta      bool    // gauge value is signed, and changes the current value
+}
+
+// ParseMetric parses a single StatsD line of the form
+// <bucket>:<value>|<type>[|@<sample rate>].
+func ParseMetric(line string) (Metric, error) {
+	i := strings.LastIndex(line, ":")
+	if i <= 0 {
+		return Metric{}, fmt.Errorf("invalid metric %q: missing bucket", line)
+	}
+
+	m := Metric{Bucket: line[:i], SampleRate: 1}
+	parts := strings.Split(line[i+1:], "|")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Metric{}, fmt.Errorf("invalid metric %q: expected value|type[|@rate]", line)
+	}
+
+	m.Text, m.Type = parts[0], parts[1]
+	switch m.Type {
+	case typeCounter, typeGauge, typeTimer, typeHisto, typeSet:
+	default:
+		return Metric{}, fmt.Errorf("invalid metric %q: unknown type %q", line, m.Type)
+	}
+
+	// Sets count unique values, which need not be numbers.
+	if m.Type != typeSet {
+		v, err := strconv.ParseFloat(m.Text, 64)
+		if err != nil {
+			return Metric{}, fmt.Errorf("invalid metric %q: invalid value", line)
+		}
+		m.Value = v
+		m.Delta = m.Type == typeGauge && (m.Text[0] == '+' || m.Text[0] == '-')
+	}
+
+	if len(parts) == 3 {
+		if !strings.HasPrefix(parts[2], "@") {
+			return Metric{}, fmt.Errorf("invalid metric %q: invalid sample rate", line)
+		}
+		rate, err := strconv.ParseFloat(parts[2][1:], 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return Metric{}, fmt.Errorf("invalid metric %q: invalid sample rate", line)
+		}
+		m.SampleRate = rate
+	}
+
+	return m, nil
+}
+
+// series identifies the point an aggregate is written to.
+type series struct {
+	name  string
+	tags  map[string]string
+	field string
+}
+
+// seriesKey returns a key which is unique for a measurement, tag set and field.
+func seriesKey(name string, tags map[string]string, field string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	key := name
+	for _, k := range keys {
+		key += "," + k + "=" + tags[k]
+	}
+	return key + " " + field
+}
+
+// counter holds the sum of a counter during a flush interval.
+type counter struct {
+	series
+	value float64
+}
+
+// gauge holds the current value of a gauge.
+type gauge struct {
+	series
+	value float64
+}
+
+// set holds the unique values received for a set during a flush interval.
+type set struct {
+	series
+	values map[string]struct{}
+}
+
+// timer holds the samples received for a timer during a flush interval.
+type timer struct {
+	series
+	values []float64
+	count  float64 // sample count, adjusted by the sample rates
+}
+
+// Server receives StatsD metrics over UDP, aggregates them and writes the
+// aggregates to a database at every flush interval. Counters are summed,
+// gauges keep their last value, sets count unique values and timers are
+// summarized by their count, lower, upper, sum, mean and percentiles.
+type Server struct {
+	writer SeriesWriter
+	parser *graphite.Parser
+	conn   *net.UDPConn
+	stats  *influxdb.Stats
+
+	mu       sync.Mutex
+	counters map[string]*counter
+	gauges   map[string]*gauge
+	sets     map[string]*set
+	timers   map[string]*timer
+
+	wg   sync.WaitGroup
+	done chan struct{}
+
+	Database        string
+	RetentionPolicy string
+
+	// FlushInterval is the time between writes of the aggregated metrics.
+	FlushInterval time.Duration
+
+	// Percentiles are computed for timers, as mean_<p> and upper_<p> fields.
+	Percentiles []float64
+
+	Logger *log.Logger
+}
+
+// NewServer returns a new instance of a Server. Bucket names are parsed into a
+// measurement name, tags and a field name by p, as for Graphite metric paths.
+func NewServer(w SeriesWriter, p *graphite.Parser) *Server {
+	return &Server{
+		writer:        w,
+		parser:        p,
+		stats:         influxdb.NewStats("statsd"),
+		counters:      make(map[string]*counter),
+		gauges:        make(map[string]*gauge),
+		sets:          make(map[string]*set),
+		timers:        make(map[string]*timer),
+		FlushInterval: DefaultFlushInterval,
+		Percentiles:   DefaultPercentiles,
+		Logger:        log.New(os.Stderr, "[statsd] ", log.LstdFlags),
+	}
+}
+
+// Stats returns the counters for packets received, metrics parsed, parse
+// failures and points written.
+func (s *Server) Stats() *influxdb.Stats {
+	return s.stats
+}
+
+// ListenAndServe binds the server to the given UDP interface.
+func (s *Server) ListenAndServe(iface string) error {
+	if iface == "" {
+		return ErrBindAddressRequired
+	} else if s.Database == "" {
+		return ErrDatabaseRequired
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", iface)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.done = make(chan struct{})
+
+	s.wg.Add(2)
+	go s.serve()
+	go s.flushLoop()
+
+	s.Logger.Println("listening on UDP connection", conn.LocalAddr().String())
+	return nil
+}
+
+// Addr returns the address the server is listening on, or nil if it is closed.
+func (s *Server) Addr() net.Addr {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.LocalAddr()
+}
+
+// Close stops the listener and writes the metrics aggregated so far.
+func (s *Server) Close() error {
+	if s.conn == nil {
+		return ErrServerClosed
+	}
+
+	close(s.done)
+	err := s.conn.Close()
+	s.wg.Wait()
+
+	s.Flush()
+
+	s.conn = nil
+	return err
+}
+
+// serve reads datagrams until the connection is closed.
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	buf := make([]byte, udpBufferSize)
+	for {
+		n, _, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			s.Logger.Printf("Failed read UDP message: %s", err)
+			continue
+		}
+		s.stats.Inc("packetsRx")
+		s.HandleMessage(buf[:n])
+	}
+}
+
+// flushLoop writes the aggregated metrics at every flush interval.
+func (s *Server) flushLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// HandleMessage parses and aggregates the newline separated metrics in buf.
+func (s *Server) HandleMessage(buf []byte) {
+	for _, line := range strings.Split(string(buf), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		m, err := ParseMetric(line)
+		if err != nil {
+			s.stats.Inc("parseFail")
+			s.Logger.Printf("unable to parse metric: %s", err)
+			continue
+		}
+
+		if err := s.aggregate(m); err != nil {
+			s.stats.Inc("parseFail")
+			s.Logger.Printf("unable to parse metric %q: %s", line, err)
+			continue
+		}
+		s.stats.Inc("metricsRx")
+	}
+}
+
+// aggregate adds a metric to the aggregates of the current flush interval.
+func (s *Server) aggregate(m Metric) error {
+	name, tags, field, err := s.parser.DecodeMetric(m.Bucket)
+	if err != nil {
+		return err
+	}
+	sr := series{name: name, tags: tags, field: field}
+	key := seriesKey(name, tags, field)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch m.Type {
+	case typeCounter:
+		c, ok := s.counters[key]
+		if !ok {
+			c = &counter{series: sr}
+			s.counters[key] = c
+		}
+		c.value += m.Value / m.SampleRate
+
+	case typeGauge:
+		g, ok := s.gauges[key]
+		if !ok {
+			g = &gauge{series: sr}
+			s.gauges[key] = g
+		}
+		if m.Delta {
+			g.value += m.Value
+		} else {
+			g.value = m.Value
+		}
+
+	case typeSet:
+		st, ok := s.sets[key]
+		if !ok {
+			st = &set{series: sr, values: make(map[string]struct{})}
+			s.sets[key] = st
+		}
+		st.values[m.Text] = struct{}{}
+
+	case typeTimer, typeHisto:
+		t, ok := s.timers[key]
+		if !ok {
+			t = &timer{series: sr}
+			s.timers[key] = t
+		}
+		t.values = append(t.values, m.Value)
+		t.count += 1 / m.SampleRate
+	}
+	return nil
+}
+
+// Flush writes the aggregated metrics and resets the counters, sets and
+// timers. Gauges keep their value until they are next set.
+func (s *Server) Flush() {
+	points := s.points(time.Now().UTC())
+	if len(points) == 0 {
+		return
+	}
+
+	if _, err := s.writer.WriteSeries(s.Database, s.RetentionPolicy, points); err != nil {
+		s.stats.Inc("batchesTxFail")
+		s.Logger.Printf("failed to write %d points to database %q: %s", len(points), s.Database, err)
+		return
+	}
+	s.stats.Inc("batchesTx")
+	s.stats.Add("pointsTx", int64(len(points)))
+}
+
+// points returns the aggregates as points and resets them for the next interval.
+func (s *Server) points(now time.Time) []influxdb.Point {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var points []influxdb.Point
+	newPoint := func(sr series, fields map[string]interface{}) {
+		points = append(points, influxdb.Point{
+			Name:      sr.name,
+			Tags:      sr.tags,
+			Timestamp: now,
+			Fields:    fields,
+		})
+	}
+
+	for _, c := range s.counters {
+		newPoint(c.series, map[string]interface{}{c.field: c.value})
+	}
+	for _, g := range s.gauges {
+		newPoint(g.series, map[string]interface{}{g.field: g.value})
+	}
+	for _, st := range s.sets {
+		newPoint(st.series, map[string]interface{}{st.field: float64(len(st.values))})
+	}
+	for _, t := range s.timers {
+		newPoint(t.series, timerFields(t, s.Percentiles))
+	}
+
+	s.counters = make(map[string]*counter)
+	s.sets = make(map[string]*set)
+	s.timers = make(map[string]*timer)
+	return points
+}
+
+// timerFields summarizes the samples of a timer. Field names are prefixed
+// with the field name of the timer unless it is the default field name.
+func timerFields(t *timer, percentiles []float64) map[string]interface{} {
+	values := append([]float64(nil), t.values...)
+	sort.Float64s(values)
+
+	prefix := ""
+	if t.field != graphite.DefaultGraphiteFieldName {
+		prefix = t.field + "_"
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+
+	fields := map[string]interface{}{
+		prefix + "count": t.count,
+		prefix + "lower": values[0],
+		prefix + "upper": values[len(values)-1],
+		prefix + "sum":   sum,
+		prefix + "mean":  sum / float64(len(values)),
+	}
+
+	// Percentiles summarize the lowest p percent of the samples.
+	for _, p := range percentiles {
+		n := int(math.Floor(p/100*float64(len(values)) + 0.5))
+		if n < 1 {
+			n = 1
+		} else if n > len(values) {
+			n = len(values)
+		}
+
+		var psum float64
+		for _, v := range values[:n] {
+			psum += v
+		}
+
+		suffix := strings.Replace(strconv.FormatFloat(p, 'f', -1, 64), ".", "_", -1)
+		fields[prefix+"upper_"+suffix] = values[n-1]
+		fields[prefix+"mean_"+suffix] = psum / float64(n)
+	}
+	return fields
+}
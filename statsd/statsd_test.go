@@ -0,0 +1,174 @@
+package statsd_test
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/influxdb/influxdb"
+	"github.com/influxdb/influxdb/graphite"
+	"github.com/influxdb/influxdb/statsd"
+	"github.com/influxdb/influxdb/test"
+)
+
+func TestParseMetric(t *testing.T) {
+	var tests = []struct {
+		line   string
+		metric statsd.Metric
+		err    string
+	}{
+		{
+			line:   "api.requests:1|c",
+			metric: statsd.Metric{Bucket: "api.requests", Value: 1, Text: "1", Type: "c", SampleRate: 1},
+		},
+		{
+			line:   "api.requests:2|c|@0.1",
+			metric: statsd.Metric{Bucket: "api.requests", Value: 2, Text: "2", Type: "c", SampleRate: 0.1},
+		},
+		{
+			line:   "queue.size:-5|g",
+			metric: statsd.Metric{Bucket: "queue.size", Value: -5, Text: "-5", Type: "g", SampleRate: 1, Delta: true},
+		},
+		{
+			line:   "api.latency:320.5|ms",
+			metric: statsd.Metric{Bucket: "api.latency", Value: 320.5, Text: "320.5", Type: "ms", SampleRate: 1},
+		},
+		{
+			line:   "users:alice|s",
+			metric: statsd.Metric{Bucket: "users", Text: "alice", Type: "s", SampleRate: 1},
+		},
+		{line: "api.requests", err: `invalid metric "api.requests": missing bucket`},
+		{line: ":1|c", err: `invalid metric ":1|c": missing bucket`},
+		{line: "api.requests:1", err: `invalid metric "api.requests:1": expected value|type[|@rate]`},
+		{line: "api.requests:1|x", err: `invalid metric "api.requests:1|x": unknown type "x"`},
+		{line: "api.requests:abc|c", err: `invalid metric "api.requests:abc|c": invalid value`},
+		{line: "api.requests:1|c|@2", err: `invalid metric "api.requests:1|c|@2": invalid sample rate`},
+	}
+
+	for _, tt := range tests {
+		m, err := statsd.ParseMetric(tt.line)
+		if test.Errstr(err) != tt.err {
+			t.Fatalf("%q: err does not match.  expected %v, got %v", tt.line, tt.err, err)
+		} else if err == nil && m != tt.metric {
+			t.Fatalf("%q: metric mismatch.\n\nexp: %#v\n\ngot: %#v", tt.line, tt.metric, m)
+		}
+	}
+}
+
+// Ensure metrics are aggregated over a flush interval.
+func TestServer_Flush(t *testing.T) {
+	w := make(test.SeriesWriter, 2)
+	s := statsd.NewServer(w, mustNewParser("host.measurement"))
+	s.Database = "statsd"
+	s.Percentiles = []float64{50, 99.5}
+
+	s.HandleMessage([]byte("web01.requests:1|c\nweb01.requests:2|c|@0.5\n" +
+		"web01.queue:10|g\nweb01.queue:+5|g\n" +
+		"web01.users:alice|s\nweb01.users:bob|s\nweb01.users:alice|s\n" +
+		"web01.latency:30|ms\nweb01.latency:10|ms\nweb01.latency:20|ms\nweb01.latency:40|ms\n" +
+		"bad\n"))
+	s.Flush()
+
+	points := sortPoints(w.Wait(t).Points)
+	if len(points) != 4 {
+		t.Fatalf("unexpected point count.  expected %d, got %d", 4, len(points))
+	}
+
+	for i, exp := range []struct {
+		name   string
+		fields map[string]interface{}
+	}{
+		{name: "latency", fields: map[string]interface{}{
+			"count": float64(4), "lower": float64(10), "upper": float64(40), "sum": float64(100), "mean": float64(25),
+			"upper_50": float64(20), "mean_50": float64(15), "upper_99_5": float64(40), "mean_99_5": float64(25),
+		}},
+		{name: "queue", fields: map[string]interface{}{"value": float64(15)}},
+		{name: "requests", fields: map[string]interface{}{"value": float64(5)}},
+		{name: "users", fields: map[string]interface{}{"value": float64(2)}},
+	} {
+		if points[i].Name != exp.name {
+			t.Fatalf("%d. name mismatch.  expected %q, got %q", i, exp.name, points[i].Name)
+		} else if !reflect.DeepEqual(points[i].Tags, map[string]string{"host": "web01"}) {
+			t.Fatalf("%d. tags mismatch: %v", i, points[i].Tags)
+		} else if !reflect.DeepEqual(points[i].Fields, exp.fields) {
+			t.Fatalf("%d. fields mismatch.\n\nexp: %v\n\ngot: %v", i, exp.fields, points[i].Fields)
+		}
+	}
+
+	if n := s.Stats().Get("parseFail"); n != 1 {
+		t.Fatalf("unexpected parseFail.  expected %d, got %d", 1, n)
+	}
+
+	// Only gauges are written again if nothing else is received.
+	s.Flush()
+	if points := w.Wait(t).Points; len(points) != 1 || points[0].Name != "queue" {
+		t.Fatalf("unexpected points after second flush: %v", points)
+	}
+}
+
+// Ensure the server writes aggregated metrics received over UDP when it is closed.
+func TestServer_ListenAndServe(t *testing.T) {
+	w := make(test.SeriesWriter, 1)
+	s := statsd.NewServer(w, mustNewParser("measurement.field"))
+	s.Database = "statsd"
+	s.RetentionPolicy = "raw"
+	s.FlushInterval = time.Hour
+	if err := s.ListenAndServe("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("udp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("api.latency:5|ms"))
+	conn.Close()
+
+	// Wait for the packet to be received before closing.
+	for i := 0; s.Stats().Get("metricsRx") == 0; i++ {
+		if i > 100 {
+			t.Fatal("timed out waiting for metric")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := w.Wait(t)
+	if b.Database != "statsd" || b.RetentionPolicy != "raw" {
+		t.Fatalf("unexpected destination: %s.%s", b.Database, b.RetentionPolicy)
+	} else if len(b.Points) != 1 || b.Points[0].Name != "api" || b.Points[0].Fields["latency_count"] != float64(1) {
+		t.Fatalf("unexpected points: %v", b.Points)
+	}
+}
+
+func TestServer_ListenAndServe_ErrDatabaseRequired(t *testing.T) {
+	s := statsd.NewServer(make(test.SeriesWriter), mustNewParser("measurement*"))
+	if err := s.ListenAndServe("127.0.0.1:0"); err != statsd.ErrDatabaseRequired {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// mustNewParser returns a Graphite parser for the given templates.
+func mustNewParser(templates ...string) *graphite.Parser {
+	p := graphite.NewParser()
+	if err := p.SetTemplates(templates); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// sortPoints sorts points by name.
+func sortPoints(a []influxdb.Point) []influxdb.Point {
+	sort.Sort(pointsByName(a))
+	return a
+}
+
+type pointsByName []influxdb.Point
+
+func (a pointsByName) Len() int           { return len(a) }
+func (a pointsByName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+func (a pointsByName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
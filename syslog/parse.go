@@ -0,0 +1,286 @@
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdb/influxdb"
+)
+
+// nilValue is the RFC 5424 placeholder for an absent header field.
+const nilValue = "-"
+
+var (
+	// ErrMissingPriority is returned when a message doesn't start with a priority.
+	ErrMissingPriority = errors.New("missing priority")
+
+	// ErrInvalidPriority is returned when a message priority is out of range.
+	ErrInvalidPriority = errors.New("invalid priority")
+)
+
+// facilities are the names of syslog facilities, indexed by code.
+var facilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// severities are the names of syslog severities, indexed by code.
+var severities = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+// Message is a parsed syslog message.
+type Message struct {
+	Facility  int
+	Severity  int
+	Timestamp time.Time
+	Hostname  string
+	AppName   string
+	ProcID    string
+	MsgID     string
+
+	// StructuredData maps the ID of each structured data element to its
+	// parameters. It is only set for RFC 5424 messages.
+	StructuredData map[string]map[string]string
+
+	Text string
+}
+
+// Point returns the message as a point in the given measurement. The
+// facility, severity, hostname and app name are tags and the message text,
+// process ID, message ID and structured data parameters are string fields.
+// Structured data parameters are named by element ID and parameter name,
+// such as "origin_ip".
+func (m *Message) Point(measurement string) influxdb.Point {
+	tags := map[string]string{
+		"facility": facilities[m.Facility],
+		"severity": severities[m.Severity],
+	}
+	if m.Hostname != "" {
+		tags["hostname"] = m.Hostname
+	}
+	if m.AppName != "" {
+		tags["appname"] = m.AppName
+	}
+
+	fields := map[string]interface{}{"message": m.Text}
+	if m.ProcID != "" {
+		fields["procid"] = m.ProcID
+	}
+	if m.MsgID != "" {
+		fields["msgid"] = m.MsgID
+	}
+	for id, params := range m.StructuredData {
+		for name, value := range params {
+			fields[id+"_"+name] = value
+		}
+	}
+
+	return influxdb.Point{
+		Name:      measurement,
+		Tags:      tags,
+		Timestamp: m.Timestamp,
+		Fields:    fields,
+	}
+}
+
+// ParseMessage parses an RFC 5424 or RFC 3164 message. The format is
+// detected from the version number which follows the priority in RFC 5424
+// messages.
+//
+// RFC 3164 timestamps have no year or time zone, so they are read as UTC in
+// the year of now, or the year before if that would be more than a day in
+// the future. Messages without a valid timestamp are assigned now.
+func ParseMessage(b []byte, now time.Time) (*Message, error) {
+	line := strings.TrimRight(string(b), "\r\n\x00")
+
+	m := &Message{}
+	rest, err := parsePriority(line, m)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) >= 2 && rest[0] >= '1' && rest[0] <= '9' && rest[1] == ' ' {
+		err = parseRFC5424(rest[2:], now, m)
+	} else {
+		parseRFC3164(rest, now, m)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parsePriority parses the "<PRI>" prefix of a message into its facility and
+// severity and returns the remainder of the message.
+func parsePriority(line string, m *Message) (string, error) {
+	if !strings.HasPrefix(line, "<") {
+		return "", ErrMissingPriority
+	}
+
+	i := strings.IndexByte(line, '>')
+	if i < 2 || i > 4 {
+		return "", ErrMissingPriority
+	}
+
+	pri, err := strconv.Atoi(line[1:i])
+	if err != nil || pri < 0 || pri >= len(facilities)*8 {
+		return "", ErrInvalidPriority
+	}
+	m.Facility, m.Severity = pri/8, pri%8
+	return line[i+1:], nil
+}
+
+// parseRFC5424 parses the header, structured data and message text of an
+// RFC 5424 message following the version.
+func parseRFC5424(rest string, now time.Time, m *Message) error {
+	header := strings.SplitN(rest, " ", 6)
+	if len(header) != 6 {
+		return fmt.Errorf("incomplete header: %s", rest)
+	}
+
+	if ts := header[0]; ts == nilValue {
+		m.Timestamp = now
+	} else if t, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+		return fmt.Errorf("invalid timestamp: %s", ts)
+	} else {
+		m.Timestamp = t.UTC()
+	}
+
+	m.Hostname = nilToEmpty(header[1])
+	m.AppName = nilToEmpty(header[2])
+	m.ProcID = nilToEmpty(header[3])
+	m.MsgID = nilToEmpty(header[4])
+
+	rest = header[5]
+	if strings.HasPrefix(rest, nilValue) {
+		rest = rest[1:]
+	} else {
+		var err error
+		if m.StructuredData, rest, err = parseStructuredData(rest); err != nil {
+			return err
+		}
+	}
+
+	if rest != "" && rest[0] != ' ' {
+		return fmt.Errorf("invalid structured data: %s", rest)
+	}
+	m.Text = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\xef\xbb\xbf")
+	return nil
+}
+
+// parseStructuredData parses one or more "[id name="value" ...]" elements
+// and returns the remainder of the message.
+func parseStructuredData(s string) (map[string]map[string]string, string, error) {
+	data := make(map[string]map[string]string)
+	for strings.HasPrefix(s, "[") {
+		// Read the element ID.
+		i := strings.IndexAny(s, " ]")
+		if i < 2 {
+			return nil, "", fmt.Errorf("invalid structured data: %s", s)
+		}
+		id := s[1:i]
+		params := make(map[string]string)
+		s = s[i:]
+
+		for s != "" && s[0] == ' ' {
+			s = s[1:]
+
+			// Read the parameter name and quoted value.
+			i := strings.Index(s, `="`)
+			if i < 1 {
+				return nil, "", fmt.Errorf("invalid structured data parameter in %s", id)
+			}
+			name := s[:i]
+			s = s[i+2:]
+
+			var buf bytes.Buffer
+			j := 0
+			for ; j < len(s) && s[j] != '"'; j++ {
+				// Only '"', '\' and ']' are escaped.
+				if s[j] == '\\' && j+1 < len(s) && strings.IndexByte(`"\]`, s[j+1]) >= 0 {
+					j++
+				}
+				buf.WriteByte(s[j])
+			}
+			if j == len(s) {
+				return nil, "", fmt.Errorf("unterminated value for %s in %s", name, id)
+			}
+			params[name] = buf.String()
+			s = s[j+1:]
+		}
+
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", fmt.Errorf("unterminated structured data element %s", id)
+		}
+		data[id] = params
+		s = s[1:]
+	}
+	return data, s, nil
+}
+
+// parseRFC3164 parses the timestamp, hostname, tag and content of an
+// RFC 3164 message. Since the format is loosely defined, anything which
+// cannot be parsed is kept as the message text.
+func parseRFC3164(rest string, now time.Time, m *Message) {
+	m.Timestamp = now
+	m.Text = rest
+
+	// Read the timestamp, such as "Oct 11 22:14:15". Without one, the
+	// message is treated as content only.
+	if len(rest) < len(time.Stamp) {
+		return
+	}
+	t, err := time.Parse(time.Stamp, rest[:len(time.Stamp)])
+	if err != nil {
+		return
+	}
+	t = time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	m.Timestamp = t
+	rest = strings.TrimPrefix(rest[len(time.Stamp):], " ")
+
+	// Read the hostname.
+	if i := strings.IndexByte(rest, ' '); i > 0 {
+		m.Hostname, rest = rest[:i], rest[i+1:]
+	} else {
+		m.Hostname, rest = rest, ""
+	}
+	m.Text = rest
+
+	// Read the tag, such as "sshd[1234]:", which is the app name and an
+	// optional process ID.
+	i := strings.IndexAny(rest, ":[ ")
+	if i <= 0 || rest[i] == ' ' {
+		return
+	}
+	tag, content := rest[:i], rest[i:]
+	var procID string
+	if content[0] == '[' {
+		j := strings.IndexByte(content, ']')
+		if j < 0 {
+			return
+		}
+		procID, content = content[1:j], content[j+1:]
+	}
+	if !strings.HasPrefix(content, ":") {
+		return
+	}
+	m.AppName, m.ProcID = tag, procID
+	m.Text = strings.TrimPrefix(content[1:], " ")
+}
+
+// nilToEmpty returns an empty string for the RFC 5424 nil value.
+func nilToEmpty(s string) string {
+	if s == nilValue {
+		return ""
+	}
+	return s
+}
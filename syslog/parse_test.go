@@ -0,0 +1,125 @@
+package syslog_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdb/influxdb"
+	"github.com/influxdb/influxdb/syslog"
+	"github.com/influxdb/influxdb/test"
+)
+
+func TestParseMessage(t *testing.T) {
+	now := time.Date(2015, time.January, 1, 12, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		line string
+		msg  *syslog.Message
+		err  string
+	}{
+		// RFC 5424
+		{
+			line: `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"] ` + "\xef\xbb\xbf" + `An application event log entry...`,
+			msg: &syslog.Message{
+				Facility: 20, Severity: 5,
+				Timestamp: time.Date(2003, time.October, 11, 22, 14, 15, 3000000, time.UTC),
+				Hostname:  "mymachine.example.com", AppName: "evntslog", MsgID: "ID47",
+				StructuredData: map[string]map[string]string{
+					"exampleSDID@32473": {"iut": "3", "eventSource": "Application", "eventID": "1011"},
+				},
+				Text: "An application event log entry...",
+			},
+		},
+		{
+			line: `<34>1 2003-10-11T22:14:15.003-07:00 host su 123 - - 'su root' failed`,
+			msg: &syslog.Message{
+				Facility: 4, Severity: 2,
+				Timestamp: time.Date(2003, time.October, 12, 5, 14, 15, 3000000, time.UTC),
+				Hostname:  "host", AppName: "su", ProcID: "123",
+				Text: "'su root' failed",
+			},
+		},
+		{
+			line: `<14>1 - - - - - [a x="\"q\"\]"][b]` + "\n",
+			msg: &syslog.Message{
+				Facility: 1, Severity: 6,
+				Timestamp:      now,
+				StructuredData: map[string]map[string]string{"a": {"x": `"q"]`}, "b": {}},
+			},
+		},
+		{line: `<14>1 2003-10-11T22:14:15Z host app -`, err: `incomplete header: 2003-10-11T22:14:15Z host app -`},
+		{line: `<14>1 yesterday host app - - - msg`, err: `invalid timestamp: yesterday`},
+		{line: `<14>1 - host app - - [a x="1 msg`, err: `unterminated value for x in a`},
+		{line: `<14>1 - host app - - [a x="1" msg`, err: `invalid structured data parameter in a`},
+		{line: `<14>1 - host app - - [a x="1"`, err: `unterminated structured data element a`},
+		{line: `<14>1 - host app - - [a]msg`, err: `invalid structured data: msg`},
+
+		// RFC 3164
+		{
+			line: `<38>Oct 11 22:14:15 mymachine sshd[2112]: Accepted publickey for root`,
+			msg: &syslog.Message{
+				Facility: 4, Severity: 6,
+				Timestamp: time.Date(2014, time.October, 11, 22, 14, 15, 0, time.UTC),
+				Hostname:  "mymachine", AppName: "sshd", ProcID: "2112",
+				Text: "Accepted publickey for root",
+			},
+		},
+		{
+			line: `<13>Jan  1 11:59:00 web01 cron: job done`,
+			msg: &syslog.Message{
+				Facility: 1, Severity: 5,
+				Timestamp: time.Date(2015, time.January, 1, 11, 59, 0, 0, time.UTC),
+				Hostname:  "web01", AppName: "cron",
+				Text: "job done",
+			},
+		},
+		{
+			line: `<13>Jan  1 11:59:00 web01 no tag here`,
+			msg: &syslog.Message{
+				Facility: 1, Severity: 5,
+				Timestamp: time.Date(2015, time.January, 1, 11, 59, 0, 0, time.UTC),
+				Hostname:  "web01",
+				Text:      "no tag here",
+			},
+		},
+		{
+			line: `<13>unparsed message`,
+			msg:  &syslog.Message{Facility: 1, Severity: 5, Timestamp: now, Text: "unparsed message"},
+		},
+
+		{line: `no priority`, err: `missing priority`},
+		{line: `<1000>1 - - - - - -`, err: `missing priority`},
+		{line: `<192>1 - - - - - -`, err: `invalid priority`},
+	}
+
+	for i, tt := range tests {
+		m, err := syslog.ParseMessage([]byte(tt.line), now)
+		if test.Errstr(err) != tt.err {
+			t.Fatalf("%d. err does not match.  expected %v, got %v", i, tt.err, err)
+		} else if err == nil && !reflect.DeepEqual(m, tt.msg) {
+			t.Fatalf("%d. message mismatch.\n\nexp: %#v\n\ngot: %#v", i, tt.msg, m)
+		}
+	}
+}
+
+func TestMessage_Point(t *testing.T) {
+	m := &syslog.Message{
+		Facility: 20, Severity: 3,
+		Timestamp: time.Date(2003, time.October, 11, 22, 14, 15, 0, time.UTC),
+		Hostname:  "web01", AppName: "nginx", ProcID: "42", MsgID: "ID1",
+		StructuredData: map[string]map[string]string{"origin": {"ip": "10.0.0.1"}},
+		Text:           "upstream timed out",
+	}
+
+	exp := influxdb.Point{
+		Name:      "syslog",
+		Tags:      map[string]string{"facility": "local4", "severity": "err", "hostname": "web01", "appname": "nginx"},
+		Timestamp: m.Timestamp,
+		Fields: map[string]interface{}{
+			"message": "upstream timed out", "procid": "42", "msgid": "ID1", "origin_ip": "10.0.0.1",
+		},
+	}
+	if p := m.Point("syslog"); !reflect.DeepEqual(p, exp) {
+		t.Fatalf("point mismatch.\n\nexp: %#v\n\ngot: %#v", exp, p)
+	}
+}
@@ -0,0 +1,373 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/influxdb/influxdb"
+)
+
+const (
+	// DefaultPort is the default syslog port.
+	DefaultPort = 514
+
+	// DefaultMeasurement is the default measurement messages are written to.
+	DefaultMeasurement = "syslog"
+
+	// maxMessageSize is the largest message accepted, and the size of the UDP read buffer.
+	maxMessageSize = 65536
+)
+
+var (
+	// ErrBindAddressRequired is returned when starting the Server
+	// without a TCP or UDP listening address.
+	ErrBindAddressRequired = errors.New("bind address required")
+
+	// ErrDatabaseRequired is returned when starting the Server without a
+	// target database.
+	ErrDatabaseRequired = errors.New("database was not specified in config")
+
+	// ErrServerClosed return when closing an already closed syslog server.
+	ErrServerClosed = errors.New("server already closed")
+
+	// errInvalidLength is returned when a TCP message has an invalid length prefix.
+	errInvalidLength = errors.New("invalid message length")
+
+	// errMessageTooLong is returned when a TCP message ended by a newline is
+	// longer than maxMessageSize.
+	errMessageTooLong = errors.New("message too long")
+)
+
+// maxPrefixLen is the length of the longest valid message length prefix,
+// including the space which ends it.
+var maxPrefixLen = len(strconv.Itoa(maxMessageSize)) + 1
+
+// SeriesWriter defines the interface for the destination of the data.
+type SeriesWriter interface {
+	WriteSeries(database, retentionPolicy string, points []influxdb.Point) (uint64, error)
+}
+
+// Server receives RFC 5424 and RFC 3164 syslog messages over TCP and UDP and
+// writes each message as a point. Points from all listeners are buffered and
+// written in batches.
+//
+// TCP messages are framed by a newline or, if a message begins with a
+// digit, by a length prefix as described in RFC 6587.
+type Server struct {
+	writer SeriesWriter
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closing  bool
+	udpConn  *net.UDPConn
+	batcher  *influxdb.PointBatcher
+	stats    *influxdb.Stats
+
+	wg      sync.WaitGroup // listeners and connections
+	writing sync.WaitGroup // batch writer
+	done    chan struct{}
+
+	Database        string
+	RetentionPolicy string
+
+	// Measurement is the measurement messages are written to.
+	Measurement string
+
+	// Points are buffered until BatchSize points are received or
+	// BatchTimeout has passed since the first buffered point.
+	BatchSize    int
+	BatchTimeout time.Duration
+
+	Logger *log.Logger
+}
+
+// NewServer returns a new instance of a Server.
+func NewServer(w SeriesWriter) *Server {
+	return &Server{
+		writer:       w,
+		conns:        make(map[net.Conn]struct{}),
+		stats:        influxdb.NewStats("syslog"),
+		Measurement:  DefaultMeasurement,
+		BatchSize:    influxdb.DefaultBatchSize,
+		BatchTimeout: influxdb.DefaultBatchTimeout,
+		Logger:       log.New(os.Stderr, "[syslog] ", log.LstdFlags),
+	}
+}
+
+// Stats returns the counters for points received, batches written and
+// parse failures.
+func (s *Server) Stats() *influxdb.Stats {
+	return s.stats
+}
+
+// TCPAddr returns the address of the TCP listener, if open.
+func (s *Server) TCPAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// UDPAddr returns the address of the UDP listener, if open.
+func (s *Server) UDPAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.udpConn == nil {
+		return nil
+	}
+	return s.udpConn.LocalAddr()
+}
+
+// ListenAndServeTCP starts receiving messages over TCP on the given
+// interface. iface must be in the form host:port.
+func (s *Server) ListenAndServeTCP(iface string) error {
+	if iface == "" {
+		return ErrBindAddressRequired
+	} else if s.Database == "" {
+		return ErrDatabaseRequired
+	}
+
+	ln, err := net.Listen("tcp", iface)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.listener = ln
+	s.start()
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.serveTCP(ln)
+	return nil
+}
+
+// ListenAndServeUDP starts receiving messages over UDP on the given
+// interface, one message per datagram. iface must be in the form host:port.
+func (s *Server) ListenAndServeUDP(iface string) error {
+	if iface == "" {
+		return ErrBindAddressRequired
+	} else if s.Database == "" {
+		return ErrDatabaseRequired
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", iface)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.udpConn = conn
+	s.start()
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.serveUDP(conn)
+	return nil
+}
+
+// start starts the batch writer if it isn't already running.
+func (s *Server) start() {
+	if s.batcher != nil {
+		return
+	}
+
+	s.batcher = influxdb.NewPointBatcher(s.BatchSize, s.BatchTimeout)
+	s.batcher.Start()
+	s.done = make(chan struct{})
+	s.writing.Add(1)
+	go s.writePoints()
+}
+
+// Close stops the listeners and open connections and writes any buffered points.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.batcher == nil {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+
+	s.closing = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	if s.udpConn != nil {
+		if e := s.udpConn.Close(); err == nil {
+			err = e
+		}
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	// Flush the remaining points before stopping the writer.
+	s.batcher.Stop()
+	close(s.done)
+	s.writing.Wait()
+
+	s.mu.Lock()
+	s.listener, s.udpConn, s.batcher = nil, nil, nil
+	s.closing = false
+	s.mu.Unlock()
+	return err
+}
+
+// serveTCP accepts connections until the listener is closed.
+func (s *Server) serveTCP(ln net.Listener) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := ln.Accept()
+		if opErr, ok := err.(*net.OpError); ok && !opErr.Temporary() {
+			return
+		} else if err != nil {
+			s.Logger.Printf("failed to accept connection: %s", err)
+			continue
+		}
+
+		// Connections accepted while closing aren't tracked, so close them.
+		s.mu.Lock()
+		if s.closing {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handleConnection(conn)
+	}
+}
+
+// handleConnection reads framed messages until the connection is closed.
+func (s *Server) handleConnection(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		msg, err := readFrame(r)
+		if err == errInvalidLength || err == errMessageTooLong {
+			s.stats.Inc("parseFail")
+			s.Logger.Printf("failed to read message from %s: %s", conn.RemoteAddr(), err)
+			return
+		} else if err != nil {
+			return
+		}
+		s.handleMessage(msg)
+	}
+}
+
+// serveUDP reads datagrams until the connection is closed.
+func (s *Server) serveUDP(conn *net.UDPConn) {
+	defer s.wg.Done()
+
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		s.handleMessage(buf[:n])
+	}
+}
+
+// handleMessage parses a single message and sends it to the batcher.
+func (s *Server) handleMessage(b []byte) {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return
+	}
+
+	m, err := ParseMessage(b, time.Now().UTC())
+	if err != nil {
+		s.stats.Inc("parseFail")
+		s.Logger.Printf("failed to parse message: %s", err)
+		return
+	}
+
+	s.stats.Inc("pointsRx")
+	s.batcher.In() <- m.Point(s.Measurement)
+}
+
+// writePoints writes batches emitted by the batcher until the server is closed.
+func (s *Server) writePoints() {
+	defer s.writing.Done()
+	influxdb.WriteBatches(s.batcher, s.writer, s.Database, s.RetentionPolicy, s.stats, s.Logger, s.done)
+}
+
+// readFrame reads a single message from a TCP stream. Messages beginning
+// with a digit are prefixed by their length and a space, otherwise they are
+// terminated by a newline.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if b[0] >= '0' && b[0] <= '9' {
+		// Read the length prefix without reading past the longest valid one.
+		var prefix []byte
+		for {
+			c, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			} else if c == ' ' {
+				break
+			} else if len(prefix) == maxPrefixLen-1 {
+				return nil, errInvalidLength
+			}
+			prefix = append(prefix, c)
+		}
+		n, err := strconv.Atoi(string(prefix))
+		if err != nil || n <= 0 || n > maxMessageSize {
+			return nil, errInvalidLength
+		}
+
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+
+	// Read up to the newline without buffering more than the longest message.
+	var line []byte
+	for {
+		b, err := r.ReadSlice('\n')
+		if len(line)+len(b) > maxMessageSize+1 {
+			return nil, errMessageTooLong
+		}
+		line = append(line, b...)
+		if err == bufio.ErrBufferFull {
+			continue
+		} else if err == io.EOF && len(line) > 0 {
+			return line, nil
+		}
+		return line, err
+	}
+}
@@ -0,0 +1,148 @@
+package syslog_test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdb/influxdb/syslog"
+	"github.com/influxdb/influxdb/test"
+)
+
+// Ensure messages received over TCP with both framings are written in a batch.
+func TestServer_ListenAndServeTCP(t *testing.T) {
+	w := make(test.SeriesWriter, 1)
+	s := syslog.NewServer(w)
+	s.Database = "syslog"
+	s.RetentionPolicy = "raw"
+	s.BatchSize = 3
+	if err := s.ListenAndServeTCP("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := "<34>1 2003-10-11T22:14:15Z host su - - - 'su root' failed"
+	fmt.Fprintf(conn, "<13>Oct 11 22:14:15 web01 cron: job done\n\n%d %s", len(msg), msg)
+	fmt.Fprintf(conn, "<14>Oct 11 22:14:16 web01 cron: next\n")
+	conn.Close()
+
+	b := w.Wait(t)
+	if b.Database != "syslog" || b.RetentionPolicy != "raw" {
+		t.Fatalf("unexpected destination: %s.%s", b.Database, b.RetentionPolicy)
+	} else if len(b.Points) != 3 {
+		t.Fatalf("unexpected point count.  expected %d, got %d", 3, len(b.Points))
+	}
+	for i, exp := range []string{"job done", "'su root' failed", "next"} {
+		if p := b.Points[i]; p.Name != "syslog" || p.Fields["message"] != exp {
+			t.Fatalf("%d. unexpected point: %v", i, p)
+		}
+	}
+}
+
+// Ensure a TCP connection sending an overlong length prefix is closed.
+func TestServer_ListenAndServeTCP_InvalidLength(t *testing.T) {
+	s := syslog.NewServer(make(test.SeriesWriter, 1))
+	s.Database = "syslog"
+	if err := s.ListenAndServeTCP("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte(strings.Repeat("1", 1000)))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected connection to be closed, got: %v", err)
+	} else if n := s.Stats().Get("parseFail"); n != 1 {
+		t.Fatalf("unexpected parseFail.  expected %d, got %d", 1, n)
+	}
+}
+
+// Ensure a TCP connection sending a line longer than the longest message is closed.
+func TestServer_ListenAndServeTCP_LineTooLong(t *testing.T) {
+	s := syslog.NewServer(make(test.SeriesWriter, 1))
+	s.Database = "syslog"
+	if err := s.ListenAndServeTCP("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.TCPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Fill the reader's buffer once more past the limit without a newline.
+	conn.Write([]byte(strings.Repeat("a", 65536+4096)))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected connection to be closed, got: %v", err)
+	} else if n := s.Stats().Get("parseFail"); n != 1 {
+		t.Fatalf("unexpected parseFail.  expected %d, got %d", 1, n)
+	}
+}
+
+// Ensure messages received over UDP are written when the server is closed.
+func TestServer_ListenAndServeUDP(t *testing.T) {
+	w := make(test.SeriesWriter, 1)
+	s := syslog.NewServer(w)
+	s.Database = "syslog"
+	s.Measurement = "logs"
+	s.BatchTimeout = time.Hour
+	if err := s.ListenAndServeUDP("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("udp", s.UDPAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("<11>1 - web01 app - - - disk full"))
+	conn.Write([]byte("bad"))
+	conn.Close()
+
+	// Wait for both datagrams to be handled before closing.
+	for i := 0; s.Stats().Get("pointsRx")+s.Stats().Get("parseFail") < 2; i++ {
+		if i > 100 {
+			t.Fatal("timed out waiting for messages")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := w.Wait(t)
+	if len(b.Points) != 1 || b.Points[0].Name != "logs" || b.Points[0].Tags["severity"] != "err" {
+		t.Fatalf("unexpected points: %v", b.Points)
+	} else if n := s.Stats().Get("parseFail"); n != 1 {
+		t.Fatalf("unexpected parseFail.  expected %d, got %d", 1, n)
+	}
+}
+
+func TestServer_ListenAndServe_Err(t *testing.T) {
+	s := syslog.NewServer(make(test.SeriesWriter))
+	if err := s.ListenAndServeTCP("127.0.0.1:0"); err != syslog.ErrDatabaseRequired {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s.Database = "syslog"
+	if err := s.ListenAndServeUDP(""); err != syslog.ErrBindAddressRequired {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.Close(); err != syslog.ErrServerClosed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdb/influxdb"
+)
+
+// SeriesWriter represents a test series writer which sends each write to the channel.
+type SeriesWriter chan SeriesWrite
+
+// SeriesWrite represents a single call to WriteSeries.
+type SeriesWrite struct {
+	Database        string
+	RetentionPolicy string
+	Points          []influxdb.Point
+}
+
+// WriteSeries sends the write to the channel.
+func (w SeriesWriter) WriteSeries(database, retentionPolicy string, points []influxdb.Point) (uint64, error) {
+	w <- SeriesWrite{Database: database, RetentionPolicy: retentionPolicy, Points: points}
+	return 0, nil
+}
+
+// Wait returns the next write, failing the test if none arrives in time.
+func (w SeriesWriter) Wait(t *testing.T) SeriesWrite {
+	select {
+	case b := <-w:
+		return b
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for write")
+	}
+	return SeriesWrite{}
+}
+
+// Errstr returns the message of an error, or a blank string if it is nil.
+func Errstr(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
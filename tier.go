@@ -0,0 +1,264 @@
+package influxdb
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Storage tiers reported for local shards.
+const (
+	ShardTierHot  = "hot"
+	ShardTierCold = "cold"
+)
+
+// coldTier is a directory on the server which the local shards of a retention
+// policy are moved to once their shard group ended longer ago than moveAfter.
+type coldTier struct {
+	path      string
+	moveAfter time.Duration
+}
+
+// shardPath returns the path of a shard in the cold tier.
+func (t coldTier) shardPath(id uint64) string {
+	return filepath.Join(t.path, "shards", strconv.FormatUint(id, 10))
+}
+
+// EnableColdTier moves the local shards of a retention policy to a directory
+// once their shard group ended longer ago than moveAfter. The tier is a setting
+// of this server only. Where each moved shard is stored is recorded in the
+// metastore, so moved shards are still found if the tier is changed later.
+func (s *Server) EnableColdTier(database, policy string, moveAfter time.Duration, path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.coldTiers[database] == nil {
+		s.coldTiers[database] = make(map[string]coldTier)
+	}
+	s.coldTiers[database][policy] = coldTier{path: path, moveAfter: moveAfter}
+}
+
+// tier returns the storage tier of a shard, or a blank string if the shard is
+// not stored on this server.
+func (sh *Shard) tier() string {
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	if sh.engine == nil {
+		return ""
+	} else if sh.cold {
+		return ShardTierCold
+	}
+	return ShardTierHot
+}
+
+// MoveColdShards moves the local shards of retention policies with a cold tier
+// once their shard group ended longer ago than the tier's move after duration.
+func (s *Server) MoveColdShards() {
+	type move struct {
+		sh   *Shard
+		path string
+	}
+
+	// Find the shards to move.
+	var moves []move
+	func() {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		for name, tiers := range s.coldTiers {
+			db := s.databases[name]
+			if db == nil {
+				continue
+			}
+			for policy, t := range tiers {
+				rp := db.policies[policy]
+				if rp == nil || t.path == "" {
+					continue
+				}
+				for _, g := range rp.shardGroups {
+					if !g.EndTime.Add(t.moveAfter).Before(time.Now().UTC()) {
+						continue
+					}
+					for _, sh := range g.Shards {
+						if sh.tier() == ShardTierHot {
+							moves = append(moves, move{sh, t.shardPath(sh.ID)})
+						}
+					}
+				}
+			}
+		}
+	}()
+
+	for _, m := range moves {
+		if err := s.moveShard(m.sh, m.path); err != nil {
+			log.Printf("failed to move shard %d to cold tier: %s", m.sh.ID, err)
+			continue
+		}
+		log.Printf("moved shard %d to cold tier: %s", m.sh.ID, m.path)
+		s.stats.Inc("shardsMoved")
+	}
+}
+
+// moveShard copies a snapshot of a local shard's store to path, reopens the
+// shard from there and records the path in the metastore. The store is copied
+// without holding the server lock, which is only taken to close the shard and
+// reopen it from the copy. The shard is reopened from its original path if it
+// was written to during the copy or it can't be opened from the copy.
+func (s *Server) moveShard(sh *Shard, path string) error {
+	// Ignore the shard if it was deleted or moved since it was found.
+	s.mu.RLock()
+	current := s.shards[sh.ID] == sh
+	s.mu.RUnlock()
+	if !current || sh.tier() != ShardTierHot {
+		return nil
+	}
+
+	// Copy the store to a temporary file which replaces path once verified, so
+	// a partial copy is never opened.
+	tmp := path + ".tmp"
+	modified, err := sh.copyStore(tmp)
+	if err == ErrShardNotLocal {
+		return nil
+	} else if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shards[sh.ID] != sh || sh.tier() != ShardTierHot {
+		_ = os.Remove(tmp)
+		return nil
+	}
+
+	// Close the shard, which commits its cached points.
+	src := sh.path
+	if err := s.client.CloseConn(sh.ID); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	} else if err := sh.close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	// Open the shard from the copy unless it was modified after the copy.
+	sh.mu.RLock()
+	unmodified := sh.lastModified.Equal(modified)
+	sh.mu.RUnlock()
+	if !unmodified {
+		err = errors.New("shard modified during copy")
+	} else if err = renameFileSync(tmp, path); err == nil {
+		if err = sh.open(path, s.client.Conn(sh.ID)); err == nil {
+			if err = s.meta.update(func(tx *metatx) error { return tx.setShardPath(sh.ID, path) }); err != nil {
+				_ = sh.close()
+			}
+		}
+		if err != nil {
+			_ = s.client.CloseConn(sh.ID)
+		}
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		_ = os.Remove(path)
+		_ = os.Remove(path + ".cache")
+		if err := sh.open(src, s.client.Conn(sh.ID)); err != nil {
+			panic("unable to reopen shard: " + err.Error())
+		}
+		return err
+	}
+
+	sh.mu.Lock()
+	sh.cold = true
+	sh.mu.Unlock()
+
+	// Remove the original store.
+	_ = os.Remove(src)
+	_ = os.Remove(src + ".cache")
+	return nil
+}
+
+// copyStore commits the cached points of a local shard and writes a snapshot of
+// its store to path. Returns the time the shard was last modified before the
+// snapshot, or ErrShardNotLocal if the shard is closed.
+func (sh *Shard) copyStore(path string) (time.Time, error) {
+	sh.mu.RLock()
+	engine, modified := sh.engine, sh.lastModified
+	sh.mu.RUnlock()
+	if engine == nil {
+		return time.Time{}, ErrShardNotLocal
+	}
+
+	if err := sh.flush(); err != nil {
+		return time.Time{}, fmt.Errorf("commit shard: %s", err)
+	}
+	_, _, w, err := engine.Snapshot()
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer func() { _ = w.Close() }()
+
+	return modified, writeFileVerified(path, w)
+}
+
+// writeFileVerified writes the contents of w to path, syncs it and checks it
+// against the checksum of what was written.
+func writeFileVerified(path string, w io.WriterTo) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Write the file, computing the checksum of the contents.
+	sum, err := func() (uint32, error) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+
+		h := crc32.NewIEEE()
+		if _, err := w.WriteTo(io.MultiWriter(f, h)); err != nil {
+			return 0, err
+		} else if err := f.Sync(); err != nil {
+			return 0, err
+		}
+		return h.Sum32(), nil
+	}()
+	if err != nil {
+		return err
+	}
+
+	// Read the file back and compare.
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	} else if h.Sum32() != sum {
+		return fmt.Errorf("checksum mismatch: %s", path)
+	}
+	return nil
+}
+
+// renameFileSync renames a file and syncs its directory so the rename is
+// durable.
+func renameFileSync(oldpath, newpath string) error {
+	if err := os.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+	dir, err := os.Open(filepath.Dir(newpath))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
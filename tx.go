@@ -6,7 +6,6 @@ import (
 	"sort"
 	"time"
 
-	"github.com/boltdb/bolt"
 	"github.com/influxdb/influxdb/influxql"
 )
 
@@ -95,6 +94,7 @@ func (tx *tx) CreateMapReduceJobs(stmt *influxql.SelectStatement, tagKeys []stri
 
 		// Grab time range from statement.
 		tmin, tmax := influxql.TimeRange(stmt.Condition)
+		hasLowerBound := !tmin.IsZero()
 		if tmax.IsZero() {
 			tmax = tx.now
 		}
@@ -121,6 +121,10 @@ func (tx *tx) CreateMapReduceJobs(stmt *influxql.SelectStatement, tagKeys []stri
 			interval = d.Nanoseconds()
 		}
 
+		// Queries selecting only last() of fields over all time can use the latest
+		// values cached by shards.
+		lastOnly := interval == 0 && !hasLowerBound && len(whereFields) == 0 && isLastOnly(stmt)
+
 		// get the sorted unique tag sets for this query.
 		tagSets, err := m.tagSets(stmt, tagKeys)
 		if err != nil {
@@ -153,7 +157,7 @@ func (tx *tx) CreateMapReduceJobs(stmt *influxql.SelectStatement, tagKeys []stri
 					var mapper influxql.Mapper
 
 					// create either a remote or local mapper for this shard
-					if shard.store == nil {
+					if shard.engine == nil {
 						nodes := tx.server.DataNodesByID(shard.DataNodeIDs)
 						if len(nodes) == 0 {
 							return nil, ErrShardNotFound
@@ -180,13 +184,14 @@ func (tx *tx) CreateMapReduceJobs(stmt *influxql.SelectStatement, tagKeys []stri
 					} else {
 						mapper = &LocalMapper{
 							seriesIDs:    sids,
-							db:           shard.store,
+							shard:        shard,
 							job:          job,
 							decoder:      NewFieldCodec(m),
 							filters:      t.Filters,
 							whereFields:  whereFields,
 							selectFields: selectFields,
 							selectTags:   selectTags,
+							lastOnly:     lastOnly,
 							tmin:         tmin.UnixNano(),
 							tmax:         tmax.UnixNano(),
 							interval:     interval,
@@ -212,8 +217,22 @@ func (tx *tx) CreateMapReduceJobs(stmt *influxql.SelectStatement, tagKeys []stri
 	return jobs, nil
 }
 
+// isLastOnly returns true if every field of the statement is a last() call.
+func isLastOnly(stmt *influxql.SelectStatement) bool {
+	calls := stmt.FunctionCalls()
+	if len(calls) == 0 || len(calls) != len(stmt.Fields) {
+		return false
+	}
+	for _, c := range calls {
+		if c.Name != "last" {
+			return false
+		}
+	}
+	return true
+}
+
 // DecodeValues is for use in a raw data query
-func (tx *tx) DecodeValues(fieldIDs []uint8, timestamp int64, data []byte) []interface{} {
+func (tx *tx) DecodeValues(fieldIDs []uint16, timestamp int64, data []byte) []interface{} {
 	vals := make([]interface{}, len(fieldIDs)+1)
 	vals[0] = timestamp
 	for i, id := range fieldIDs {
@@ -224,9 +243,9 @@ func (tx *tx) DecodeValues(fieldIDs []uint8, timestamp int64, data []byte) []int
 }
 
 // FieldIDs will take an array of fields and return the id associated with each
-func (tx *tx) FieldIDs(fields []*influxql.Field) ([]uint8, error) {
+func (tx *tx) FieldIDs(fields []*influxql.Field) ([]uint16, error) {
 	names := tx.fieldNames(fields)
-	ids := make([]uint8, len(names))
+	ids := make([]uint16, len(names))
 
 	for i, n := range names {
 		field := tx.measurement.FieldByName(n)
@@ -255,13 +274,16 @@ type LocalMapper struct {
 	cursorsEmpty     bool                   // boolean that lets us know if the cursors are empty
 	decoder          fieldDecoder           // decoder for the raw data bytes
 	filters          []influxql.Expr        // filters for each series
-	cursors          []*bolt.Cursor         // bolt cursors for each series id
+	cursors          []EngineCursor         // cursors for each series id
+	storedCursors    []EngineCursor         // cursors over the shard for each series id
+	lastOnly         bool                   // if the query only selects last() of fields
+	lastValues       []*SeriesValue         // the shard's cached latest value of each series
 	seriesIDs        []uint64               // seriesIDs to be read from this shard
-	db               *bolt.DB               // bolt store for the shard accessed by this mapper
-	txn              *bolt.Tx               // read transactions by shard id
+	shard            *Shard                 // shard accessed by this mapper
+	txn              EngineTx               // read transaction on the shard's engine
 	job              *influxql.MapReduceJob // the MRJob this mapper belongs to
 	mapFunc          influxql.MapFunc       // the map func
-	fieldID          uint8                  // the field ID associated with the mapFunc curently being run
+	fieldID          uint16                 // the field ID associated with the mapFunc curently being run
 	fieldName        string                 // the field name associated with the mapFunc currently being run
 	keyBuffer        []int64                // the current timestamp key for each cursor
 	valueBuffer      [][]byte               // the current value for each cursor
@@ -280,23 +302,16 @@ type LocalMapper struct {
 
 // Open opens the LocalMapper.
 func (l *LocalMapper) Open() error {
-	// Open the data store
-	txn, err := l.db.Begin(false)
+	// create a cursor for each unique series id
+	cursors, txn, err := l.shard.cursors(l.seriesIDs)
 	if err != nil {
 		return err
 	}
-	l.txn = txn
-
-	// create a bolt cursor for each unique series id
-	l.cursors = make([]*bolt.Cursor, len(l.seriesIDs))
+	l.cursors, l.storedCursors, l.txn = cursors, cursors, txn
 
-	for i, id := range l.seriesIDs {
-		b := l.txn.Bucket(u64tob(id))
-		if b == nil {
-			continue
-		}
-
-		l.cursors[i] = b.Cursor()
+	// grab the latest values cached by the shard if the query only needs those
+	if l.lastOnly {
+		l.lastValues = l.shard.lastValues(l.seriesIDs)
 	}
 
 	return nil
@@ -350,7 +365,10 @@ func (l *LocalMapper) Begin(c *influxql.Call, startingTime int64, chunkSize int)
 		l.fieldName = f.Name
 	}
 
-	// seek the bolt cursors and fill the buffers
+	// read cached latest values instead of the shard where possible
+	l.cursors = l.lastValueCursors(c)
+
+	// seek the cursors and fill the buffers
 	for i, c := range l.cursors {
 		// this series may have never been written in this shard group (time range) so the cursor would be nil
 		if c == nil {
@@ -369,9 +387,44 @@ func (l *LocalMapper) Begin(c *influxql.Call, startingTime int64, chunkSize int)
 		l.keyBuffer[i] = t
 		l.valueBuffer[i] = v
 	}
+	return l.cursorErr()
+}
+
+// cursorErr returns the first error which ended the iteration of a cursor.
+func (l *LocalMapper) cursorErr() error {
+	for _, c := range l.cursors {
+		if c == nil {
+			continue
+		} else if err := c.Err(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// lastValueCursors returns the cursors to read for a call. Series whose cached
+// latest value is within the query's time range and holds the field are read
+// from the cache instead of the shard.
+func (l *LocalMapper) lastValueCursors(c *influxql.Call) []EngineCursor {
+	if l.lastValues == nil || c == nil || c.Name != "last" || l.fieldName == "" {
+		return l.storedCursors
+	}
+
+	cursors := make([]EngineCursor, len(l.storedCursors))
+	for i, cur := range l.storedCursors {
+		cursors[i] = cur
+
+		v := l.lastValues[i]
+		if v == nil || v.Timestamp < l.job.TMin || v.Timestamp > l.job.TMax {
+			continue
+		} else if _, err := l.decoder.DecodeByID(l.fieldID, v.Data); err != nil {
+			continue
+		}
+		cursors[i] = &valueCursor{value: *v}
+	}
+	return cursors
+}
+
 // NextInterval will get the time ordered next interval of the given interval size from the mapper. This is a
 // forward only operation from the start time passed into Begin. Will return nil when there is no more data to be read.
 // If this is a raw query, interval should be the max time to hit in the query
@@ -399,6 +452,9 @@ func (l *LocalMapper) NextInterval() (interface{}, error) {
 
 	// Execute the map function. This local mapper acts as the iterator
 	val := l.mapFunc(l)
+	if err := l.cursorErr(); err != nil {
+		return nil, err
+	}
 
 	// see if all the cursors are empty
 	l.cursorsEmpty = true
@@ -528,7 +584,7 @@ func matchesWhere(f influxql.Expr, fields map[string]interface{}) bool {
 }
 
 type fieldDecoder interface {
-	DecodeByID(fieldID uint8, b []byte) (interface{}, error)
+	DecodeByID(fieldID uint16, b []byte) (interface{}, error)
 	FieldByName(name string) *Field
 	DecodeFieldsWithNames(b []byte) (map[string]interface{}, error)
 }
@@ -3,8 +3,12 @@ package udp
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"log"
 	"net"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/influxdb/influxdb"
 	"github.com/influxdb/influxdb/client"
@@ -14,65 +18,193 @@ const (
 	udpBufferSize = 65536
 )
 
+var (
+	// ErrBindAddressRequired is returned when starting the UDPServer
+	// without a listening address.
+	ErrBindAddressRequired = errors.New("bind address required")
+
+	// ErrDatabaseRequired is returned when starting the UDPServer
+	// without a target database.
+	ErrDatabaseRequired = errors.New("database was not specified in config")
+
+	// ErrServerClosed is returned when closing an already closed UDPServer.
+	ErrServerClosed = errors.New("server already closed")
+)
+
 // SeriesWriter defines the interface for the destination of the data.
 type SeriesWriter interface {
 	WriteSeries(database, retentionPolicy string, points []influxdb.Point) (uint64, error)
 }
 
-// UDPServer
+// UDPServer receives points in the line protocol via UDP, batches them and
+// writes them to a single database and retention policy.
 type UDPServer struct {
-	writer SeriesWriter
+	writer  SeriesWriter
+	conn    *net.UDPConn
+	batcher *influxdb.PointBatcher
+	stats   *influxdb.Stats
+
+	wg   sync.WaitGroup
+	done chan struct{}
+
+	Database        string
+	RetentionPolicy string
+
+	// Precision of the timestamps in received points ("n", "u", "ms", "s", "m" or "h").
+	Precision string
+
+	// Points are buffered until BatchSize points are received or
+	// BatchTimeout has passed since the first buffered point.
+	BatchSize    int
+	BatchTimeout time.Duration
+
+	Logger *log.Logger
 }
 
-// NewUDPServer returns a new instance of a UDPServer
-func NewUDPServer(w SeriesWriter) *UDPServer {
+// NewUDPServer returns a new instance of a UDPServer writing to the given database
+// and retention policy.
+func NewUDPServer(w SeriesWriter, db, rp string) *UDPServer {
 	u := UDPServer{
-		writer: w,
+		writer:          w,
+		Database:        db,
+		RetentionPolicy: rp,
+		stats:           influxdb.NewStats("udp"),
+		BatchSize:       influxdb.DefaultBatchSize,
+		BatchTimeout:    influxdb.DefaultBatchTimeout,
+		Logger:          log.New(os.Stderr, "[udp] ", log.LstdFlags),
 	}
 	return &u
 }
 
+// Stats returns the server's counters.
+func (u *UDPServer) Stats() *influxdb.Stats {
+	return u.stats
+}
+
 // ListenAndServe binds the server to the given UDP interface.
 func (u *UDPServer) ListenAndServe(iface string) error {
+	if iface == "" {
+		return ErrBindAddressRequired
+	} else if u.Database == "" {
+		return ErrDatabaseRequired
+	}
+
 	addr, err := net.ResolveUDPAddr("udp", iface)
 	if err != nil {
-		log.Printf("Failed resolve UDP address %s: %s", iface, err)
+		u.Logger.Printf("Failed resolve UDP address %s: %s", iface, err)
 		return err
 	}
 
 	conn, err := net.ListenUDP("udp", addr)
 	if err != nil {
-		log.Printf("Failed set up UDP listener at address %s: %s", addr, err)
+		u.Logger.Printf("Failed set up UDP listener at address %s: %s", addr, err)
 		return err
 	}
+	u.conn = conn
+	u.done = make(chan struct{})
 
-	var bp client.BatchPoints
-	buf := make([]byte, udpBufferSize)
+	u.batcher = influxdb.NewPointBatcher(u.BatchSize, u.BatchTimeout)
+	u.batcher.Start()
 
-	go func() {
-		for {
-			_, _, err := conn.ReadFromUDP(buf)
-			if err != nil {
-				log.Printf("Failed read UDP message: %s.", err)
-				continue
-			}
+	u.wg.Add(2)
+	go u.serve()
+	go u.writePoints()
 
-			dec := json.NewDecoder(bytes.NewReader(buf))
-			if err := dec.Decode(&bp); err != nil {
-				log.Printf("Failed decode JSON UDP message")
-				continue
-			}
+	u.Logger.Println("listening on UDP connection", conn.LocalAddr().String())
+	return nil
+}
 
-			points, err := influxdb.NormalizeBatchPoints(bp)
-			if err != nil {
-				log.Printf("Failed normalize batch points")
-				continue
-			}
+// Addr returns the address the server is listening on, or nil if it is closed.
+func (u *UDPServer) Addr() net.Addr {
+	if u.conn == nil {
+		return nil
+	}
+	return u.conn.LocalAddr()
+}
+
+// Close stops the listener and writes any buffered points.
+func (u *UDPServer) Close() error {
+	if u.conn == nil {
+		return ErrServerClosed
+	}
+
+	// Closing the connection stops the reader, which flushes the remaining
+	// batch and then stops the writer.
+	err := u.conn.Close()
+	u.wg.Wait()
+
+	u.conn = nil
+	u.batcher = nil
+	u.done = nil
+	return err
+}
+
+// serve reads datagrams until the connection is closed.
+func (u *UDPServer) serve() {
+	defer u.wg.Done()
+	defer close(u.done)
+	defer u.batcher.Stop()
 
-			if msgIndex, err := u.writer.WriteSeries(bp.Database, bp.RetentionPolicy, points); err != nil {
-				log.Printf("Server write failed. Message index was %d: %s", msgIndex, err)
+	buf := make([]byte, udpBufferSize)
+	for {
+		n, _, err := u.conn.ReadFromUDP(buf)
+		if err != nil {
+			if opErr, ok := err.(*net.OpError); ok && !opErr.Temporary() {
+				return
 			}
+			u.Logger.Printf("Failed read UDP message: %s.", err)
+			continue
 		}
-	}()
-	return nil
+		u.handleMessage(buf[:n])
+	}
+}
+
+// handleMessage parses a single datagram and passes its points to the batcher.
+// Datagrams starting with '{' are decoded as a JSON batch for backwards compatibility.
+func (u *UDPServer) handleMessage(buf []byte) {
+	if b := bytes.TrimSpace(buf); len(b) > 0 && b[0] == '{' {
+		u.handleJSON(b)
+		return
+	}
+
+	points, err := influxdb.ParsePointsWithPrecision(buf, time.Now().UTC(), u.Precision)
+	if err != nil {
+		u.Logger.Printf("Failed to parse points: %s", err)
+		return
+	}
+
+	for _, p := range points {
+		u.batcher.In() <- p
+	}
+}
+
+// handleJSON decodes a JSON batch and writes it directly, since it may
+// target a different database or retention policy.
+func (u *UDPServer) handleJSON(buf []byte) {
+	var bp client.BatchPoints
+	if err := json.Unmarshal(buf, &bp); err != nil {
+		u.Logger.Printf("Failed decode JSON UDP message: %s", err)
+		return
+	}
+
+	points, err := influxdb.NormalizeBatchPoints(bp)
+	if err != nil {
+		u.Logger.Printf("Failed normalize batch points: %s", err)
+		return
+	}
+
+	database, retentionPolicy := bp.Database, bp.RetentionPolicy
+	if database == "" {
+		database, retentionPolicy = u.Database, u.RetentionPolicy
+	}
+
+	if msgIndex, err := u.writer.WriteSeries(database, retentionPolicy, points); err != nil {
+		u.Logger.Printf("Server write failed. Message index was %d: %s", msgIndex, err)
+	}
+}
+
+// writePoints writes batches emitted by the batcher until the server is closed.
+func (u *UDPServer) writePoints() {
+	defer u.wg.Done()
+	influxdb.WriteBatches(u.batcher, u.writer, u.Database, u.RetentionPolicy, u.stats, u.Logger, u.done)
 }
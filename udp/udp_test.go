@@ -0,0 +1,122 @@
+package udp_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdb/influxdb"
+	"github.com/influxdb/influxdb/test"
+	"github.com/influxdb/influxdb/udp"
+)
+
+// Ensure the server requires a bind address and database.
+func TestUDPServer_ListenAndServe_ErrConfig(t *testing.T) {
+	s := udp.NewUDPServer(make(test.SeriesWriter, 10), "", "")
+	if err := s.ListenAndServe(""); err != udp.ErrBindAddressRequired {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.ListenAndServe("127.0.0.1:0"); err != udp.ErrDatabaseRequired {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure the server batches points received across datagrams.
+func TestUDPServer_WriteSeries_Batch(t *testing.T) {
+	w := make(test.SeriesWriter, 10)
+	s := udp.NewUDPServer(w, "db0", "rp0")
+	s.Precision = "s"
+	s.BatchSize = 3
+	s.BatchTimeout = time.Hour
+	if err := s.ListenAndServe("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	MustSend(t, s.Addr(), "cpu,host=serverA value=1 10\ncpu,host=serverB value=2 10")
+	MustSend(t, s.Addr(), "mem value=3 20")
+
+	batch := w.Wait(t)
+	if batch.Database != "db0" || batch.RetentionPolicy != "rp0" {
+		t.Fatalf("unexpected target: %s.%s", batch.Database, batch.RetentionPolicy)
+	} else if len(batch.Points) != 3 {
+		t.Fatalf("unexpected point count: %d", len(batch.Points))
+	} else if !reflect.DeepEqual(batch.Points[2], influxdb.Point{
+		Name:      "mem",
+		Tags:      map[string]string{},
+		Timestamp: time.Unix(20, 0).UTC(),
+		Fields:    map[string]interface{}{"value": float64(3)},
+	}) {
+		t.Fatalf("unexpected point: %#v", batch.Points[2])
+	}
+}
+
+// Ensure the server writes a partial batch after the batch timeout.
+func TestUDPServer_WriteSeries_Timeout(t *testing.T) {
+	w := make(test.SeriesWriter, 10)
+	s := udp.NewUDPServer(w, "db0", "")
+	s.BatchSize = 100
+	s.BatchTimeout = 50 * time.Millisecond
+	if err := s.ListenAndServe("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	MustSend(t, s.Addr(), "cpu value=1")
+	if batch := w.Wait(t); len(batch.Points) != 1 {
+		t.Fatalf("unexpected point count: %d", len(batch.Points))
+	}
+}
+
+// Ensure the server writes buffered points when it is closed.
+func TestUDPServer_Close_Flush(t *testing.T) {
+	w := make(test.SeriesWriter, 10)
+	s := udp.NewUDPServer(w, "db0", "")
+	s.BatchSize = 100
+	s.BatchTimeout = time.Hour
+	if err := s.ListenAndServe("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+
+	MustSend(t, s.Addr(), "cpu value=1")
+	time.Sleep(50 * time.Millisecond)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	} else if err := s.Close(); err != udp.ErrServerClosed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if batch := w.Wait(t); len(batch.Points) != 1 {
+		t.Fatalf("unexpected point count: %d", len(batch.Points))
+	}
+}
+
+// Ensure JSON datagrams are still accepted and may target another database.
+func TestUDPServer_WriteSeries_JSON(t *testing.T) {
+	w := make(test.SeriesWriter, 10)
+	s := udp.NewUDPServer(w, "db0", "")
+	if err := s.ListenAndServe("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	MustSend(t, s.Addr(), `{"database":"db1","points":[{"name":"cpu","fields":{"value":1}}]}`)
+	if batch := w.Wait(t); batch.Database != "db1" {
+		t.Fatalf("unexpected database: %s", batch.Database)
+	} else if len(batch.Points) != 1 {
+		t.Fatalf("unexpected point count: %d", len(batch.Points))
+	}
+}
+
+// MustSend sends a datagram to addr. Fails the test on error.
+func MustSend(t *testing.T, addr net.Addr, s string) {
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+}